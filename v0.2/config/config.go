@@ -3,12 +3,48 @@ package config
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"time"
+)
+
+// Default settings used when the corresponding env var is not set.
+const (
+	defaultMinConns          = 2
+	defaultMaxConns          = 10
+	defaultAcquireTimeout    = 5 * time.Second
+	defaultHealthCheckPeriod = 30 * time.Second
+	defaultQueryTimeout      = 10 * time.Second
+	defaultCantabularURL     = "http://localhost:8491"
+	defaultCantabularTimeout = 30 * time.Second
 )
 
 type Config struct {
 	Username string
 	Password string
 	Database string
+	Pool     PoolConfig
+	// QueryTimeout is the deadline for the database queries made while handling a single API request.
+	QueryTimeout time.Duration
+}
+
+// PoolConfig holds the postgres connection pool settings.
+type PoolConfig struct {
+	// MinConns is the number of connections the pool keeps open even when idle.
+	MinConns int32
+	// MaxConns is the maximum number of connections the pool will open.
+	MaxConns int32
+	// AcquireTimeout is how long a request will wait for a free connection before giving up.
+	AcquireTimeout time.Duration
+	// HealthCheckPeriod is the interval between checks of idle connections.
+	HealthCheckPeriod time.Duration
+}
+
+// CantabularConfig holds the settings of the Cantabular compatible query service the key stats recipes are run against.
+type CantabularConfig struct {
+	// URL is the base URL of the query service, queries are sent to {URL}/graphql.
+	URL string
+	// Timeout is the deadline for a single query.
+	Timeout time.Duration
 }
 
 // Get return the app config.
@@ -28,9 +64,104 @@ func Get() (*Config, error) {
 		return nil, fmt.Errorf("expected env var %q but not found", "AP_DATABASE_PASSWORD")
 	}
 
+	pool, err := getPoolConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	queryTimeout, err := GetQueryTimeout()
+	if err != nil {
+		return nil, err
+	}
+
 	return &Config{
-		Username: dbUsername,
-		Password: dbPassword,
-		Database: dbName,
+		Username:     dbUsername,
+		Password:     dbPassword,
+		Database:     dbName,
+		Pool:         pool,
+		QueryTimeout: queryTimeout,
 	}, nil
 }
+
+// GetQueryTimeout returns the per request query timeout. It does not require the database env vars to be set.
+func GetQueryTimeout() (time.Duration, error) {
+	return getDuration("AP_QUERY_TIMEOUT", defaultQueryTimeout)
+}
+
+// GetCantabularConfig returns the Cantabular query service config. It does not require the database env vars to be set.
+func GetCantabularConfig() (CantabularConfig, error) {
+	url := os.Getenv("AP_CANTABULAR_URL")
+	if url == "" {
+		url = defaultCantabularURL
+	}
+
+	timeout, err := getDuration("AP_CANTABULAR_TIMEOUT", defaultCantabularTimeout)
+	if err != nil {
+		return CantabularConfig{}, err
+	}
+
+	return CantabularConfig{URL: url, Timeout: timeout}, nil
+}
+
+func getPoolConfig() (PoolConfig, error) {
+	minConns, err := getInt32("AP_DB_MIN_CONNS", defaultMinConns, 0)
+	if err != nil {
+		return PoolConfig{}, err
+	}
+
+	maxConns, err := getInt32("AP_DB_MAX_CONNS", defaultMaxConns, 1)
+	if err != nil {
+		return PoolConfig{}, err
+	}
+
+	if minConns > maxConns {
+		return PoolConfig{}, fmt.Errorf("AP_DB_MIN_CONNS (%d) cannot be greater than AP_DB_MAX_CONNS (%d)", minConns, maxConns)
+	}
+
+	acquireTimeout, err := getDuration("AP_DB_ACQUIRE_TIMEOUT", defaultAcquireTimeout)
+	if err != nil {
+		return PoolConfig{}, err
+	}
+
+	healthCheckPeriod, err := getDuration("AP_DB_HEALTH_CHECK_PERIOD", defaultHealthCheckPeriod)
+	if err != nil {
+		return PoolConfig{}, err
+	}
+
+	return PoolConfig{
+		MinConns:          minConns,
+		MaxConns:          maxConns,
+		AcquireTimeout:    acquireTimeout,
+		HealthCheckPeriod: healthCheckPeriod,
+	}, nil
+}
+
+// getInt32 returns the value of the env var as an int32 of at least min or the default value if the env var is not set.
+func getInt32(key string, defaultVal, min int32) (int32, error) {
+	val := os.Getenv(key)
+	if val == "" {
+		return defaultVal, nil
+	}
+
+	i, err := strconv.ParseInt(val, 10, 32)
+	if err != nil || i < int64(min) {
+		return 0, fmt.Errorf("env var %q must be an integer of at least %d but was %q", key, min, val)
+	}
+
+	return int32(i), nil
+}
+
+// getDuration returns the value of the env var as a time.Duration or the default value if the env var is not set.
+func getDuration(key string, defaultVal time.Duration) (time.Duration, error) {
+	val := os.Getenv(key)
+	if val == "" {
+		return defaultVal, nil
+	}
+
+	d, err := time.ParseDuration(val)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("env var %q must be a positive duration e.g. 5s but was %q", key, val)
+	}
+
+	return d, nil
+}
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestGetPoolConfigConns(t *testing.T) {
+	cases := []struct {
+		name     string
+		min, max string
+		expected PoolConfig
+		err      string
+	}{
+		{name: "defaults", expected: PoolConfig{MinConns: defaultMinConns, MaxConns: defaultMaxConns}},
+		{name: "no idle connections", min: "0", max: "5", expected: PoolConfig{MinConns: 0, MaxConns: 5}},
+		{name: "negative min conns", min: "-1", err: `env var "AP_DB_MIN_CONNS" must be an integer of at least 0 but was "-1"`},
+		{name: "zero max conns", min: "0", max: "0", err: `env var "AP_DB_MAX_CONNS" must be an integer of at least 1 but was "0"`},
+		{name: "min conns above max conns", min: "6", max: "5", err: "AP_DB_MIN_CONNS (6) cannot be greater than AP_DB_MAX_CONNS (5)"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Setenv("AP_DB_MIN_CONNS", c.min)
+			t.Setenv("AP_DB_MAX_CONNS", c.max)
+
+			cfg, err := getPoolConfig()
+			if c.err != "" {
+				if err == nil || err.Error() != c.err {
+					t.Errorf("expected %q, got %v", c.err, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if cfg.MinConns != c.expected.MinConns || cfg.MaxConns != c.expected.MaxConns {
+				t.Errorf("expected min %d and max %d conns, got min %d and max %d", c.expected.MinConns,
+					c.expected.MaxConns, cfg.MinConns, cfg.MaxConns)
+			}
+		})
+	}
+}
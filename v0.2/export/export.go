@@ -0,0 +1,308 @@
+package export
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/load"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store"
+	"github.com/pkg/errors"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Supported export formats.
+const (
+	// CSV is a CSV data file in the format accepted by the loader.
+	CSV = "csv"
+	// JSON is a JSON array of rows, the keys are the column names accepted by the loader.
+	JSON = "json"
+)
+
+// The extra columns of a history export, ignored by the loader.
+const (
+	ColumnVersion     = "version"
+	ColumnVersionDate = "version_date"
+)
+
+// ErrInvalidVersion is returned when a version is not a version number, the "latest" alias or a timestamp.
+var ErrInvalidVersion = errors.New("invalid version")
+
+// Store represents the area profiles data store.
+type Store interface {
+	GetAreaProfiles(ctx context.Context) ([]store.AreaProfile, error)
+	GetProfileByAreaCode(ctx context.Context, areaCode string) (*store.AreaProfile, error)
+	GetKeyStatsForProfile(ctx context.Context, profile *store.AreaProfile) (store.KeyStatistics, error)
+	GetKeyStatsVersionsForProfile(ctx context.Context, profile *store.AreaProfile) ([]store.KeyStatVersion, error)
+	GetKeyStatsVersionByNumber(ctx context.Context, profile *store.AreaProfile, number int) (*store.KeyStatVersion, error)
+	GetLatestKeyStatsVersion(ctx context.Context, profile *store.AreaProfile) (*store.KeyStatVersion, error)
+	GetKeyStatsVersion(ctx context.Context, profile *store.AreaProfile, date time.Time) (store.KeyStatistics, error)
+}
+
+// Options configures what is exported. Version is the key stats version of each area profile to export, a version
+// number, "latest" or a version timestamp, the current key stats are exported if blank. History exports every version
+// of the key stats, Version is ignored.
+type Options struct {
+	Version string
+	History bool
+}
+
+// Row is an exported key stat, a row of a data file. The area profile name is exported as the title. Version and
+// VersionDate are only set by a history export.
+//
+// A row only has the columns of a data file. The name, parent and geography type of areas, dataset descriptions,
+// editions and release dates, the definitions of the key stat types (value type, precision, category and default
+// unit) and the labels and sources of the key stats versions are not exported, a key stat type must exist or be
+// registered when the file is imported.
+type Row struct {
+	AreaCode    string     `json:"area_code"`
+	Title       string     `json:"title"`
+	Name        string     `json:"name"`
+	Value       float64    `json:"value"`
+	Unit        string     `json:"unit"`
+	DatasetID   string     `json:"dataset_id"`
+	DatasetName string     `json:"dataset_name"`
+	Version     int        `json:"version,omitempty"`
+	VersionDate *time.Time `json:"version_date,omitempty"`
+}
+
+// Profiles returns the key stats of the area profiles with the specified area codes, every area profile in area code
+// order if none are specified. Returns store.ErrNotFound if an area profile or version does not exist.
+func Profiles(ctx context.Context, s Store, areaCodes []string, opts Options) ([]Row, error) {
+	profiles, err := getProfiles(ctx, s, areaCodes)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]Row, 0)
+	for i := range profiles {
+		profileRows, err := profileRows(ctx, s, &profiles[i], opts)
+		if err != nil {
+			return nil, errors.Wrapf(err, "area %q", profiles[i].AreaCode)
+		}
+		rows = append(rows, profileRows...)
+	}
+
+	return rows, nil
+}
+
+func getProfiles(ctx context.Context, s Store, areaCodes []string) ([]store.AreaProfile, error) {
+	if len(areaCodes) == 0 {
+		profiles, err := s.GetAreaProfiles(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		sort.Slice(profiles, func(i, j int) bool { return profiles[i].AreaCode < profiles[j].AreaCode })
+		return profiles, nil
+	}
+
+	profiles := make([]store.AreaProfile, 0, len(areaCodes))
+	for _, code := range areaCodes {
+		p, err := s.GetProfileByAreaCode(ctx, code)
+		if err != nil {
+			return nil, errors.Wrapf(err, "area profile %q", code)
+		}
+		profiles = append(profiles, *p)
+	}
+
+	return profiles, nil
+}
+
+// profileRows returns the key stats of the area profile to export.
+func profileRows(ctx context.Context, s Store, profile *store.AreaProfile, opts Options) ([]Row, error) {
+	if opts.History {
+		versions, err := s.GetKeyStatsVersionsForProfile(ctx, profile)
+		if err != nil {
+			return nil, err
+		}
+
+		// versions are listed most recent first, export them in the order they were created.
+		rows := make([]Row, 0)
+		for i := len(versions) - 1; i >= 0; i-- {
+			v := versions[i]
+			stats, err := s.GetKeyStatsVersion(ctx, profile, v.DateCreated)
+			if err != nil {
+				return nil, errors.Wrapf(err, "version %d", v.Version)
+			}
+
+			date := v.DateCreated
+			for _, r := range toRows(profile, stats) {
+				r.Version = v.Version
+				r.VersionDate = &date
+				rows = append(rows, r)
+			}
+		}
+
+		return rows, nil
+	}
+
+	if opts.Version == "" {
+		stats, err := s.GetKeyStatsForProfile(ctx, profile)
+		if err != nil {
+			return nil, err
+		}
+		return toRows(profile, stats), nil
+	}
+
+	date, err := resolveVersion(ctx, s, profile, opts.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := s.GetKeyStatsVersion(ctx, profile, date)
+	if err != nil {
+		return nil, err
+	}
+
+	return toRows(profile, stats), nil
+}
+
+// resolveVersion returns the date created of the version of the area profile specified by a version number, "latest"
+// or a version timestamp.
+func resolveVersion(ctx context.Context, s Store, profile *store.AreaProfile, ref string) (time.Time, error) {
+	if ref == store.LatestVersion {
+		v, err := s.GetLatestKeyStatsVersion(ctx, profile)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return v.DateCreated, nil
+	}
+
+	if number, err := strconv.Atoi(ref); err == nil {
+		v, err := s.GetKeyStatsVersionByNumber(ctx, profile, number)
+		if err != nil {
+			return time.Time{}, errors.Wrapf(err, "version %d", number)
+		}
+		return v.DateCreated, nil
+	}
+
+	date, err := store.ParseVersionTimestamp(ref)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(ErrInvalidVersion, "%q, expected a version number, %q or a version timestamp", ref, store.LatestVersion)
+	}
+
+	return date, nil
+}
+
+func toRows(profile *store.AreaProfile, stats store.KeyStatistics) []Row {
+	rows := make([]Row, 0, len(stats))
+	for _, s := range stats {
+		rows = append(rows, Row{
+			AreaCode:    profile.AreaCode,
+			Title:       profile.Name,
+			Name:        s.Name,
+			Value:       s.Value,
+			Unit:        s.Unit,
+			DatasetID:   s.Metadata.DatasetID,
+			DatasetName: s.Metadata.DatasetName,
+		})
+	}
+	return rows
+}
+
+// ByVersion splits the rows of a history export into the rows of each version number in order. The rows of each
+// version are a data file that can be imported as is, importing them in order reproduces the key stats of each version
+// of each area profile. The split is lossy: a file holds the same version number of every area profile whatever its
+// date, and the version columns are cleared as the loader ignores them, so imported versions are dated when imported.
+func ByVersion(rows []Row) [][]Row {
+	byVersion := make(map[int][]Row)
+	numbers := make([]int, 0)
+
+	for _, r := range rows {
+		n := r.Version
+		if _, ok := byVersion[n]; !ok {
+			numbers = append(numbers, n)
+		}
+
+		r.Version, r.VersionDate = 0, nil
+		byVersion[n] = append(byVersion[n], r)
+	}
+
+	sort.Ints(numbers)
+	files := make([][]Row, 0, len(numbers))
+	for _, n := range numbers {
+		files = append(files, byVersion[n])
+	}
+
+	return files
+}
+
+// Write writes the rows in the specified format. The version columns are included if history is true.
+func Write(w io.Writer, format string, rows []Row, history bool) error {
+	switch format {
+	case CSV:
+		return WriteCSV(w, rows, history)
+	case JSON:
+		return WriteJSON(w, rows)
+	default:
+		return errors.Errorf("unknown export format %q, expected %q or %q", format, CSV, JSON)
+	}
+}
+
+// WriteCSV writes the rows as a CSV data file. Values are written without rounding and the unit is always written so
+// the file imports the same key stats. The version columns are included if history is true.
+func WriteCSV(w io.Writer, rows []Row, history bool) error {
+	header := []string{
+		load.ColumnAreaCode,
+		load.ColumnTitle,
+		load.ColumnName,
+		load.ColumnValue,
+		load.ColumnUnit,
+		load.ColumnDatasetID,
+		load.ColumnDatasetName,
+	}
+
+	if history {
+		header = append(header, ColumnVersion, ColumnVersionDate)
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return errors.Wrap(err, "error writing CSV header")
+	}
+
+	for _, r := range rows {
+		record := []string{
+			r.AreaCode,
+			r.Title,
+			r.Name,
+			strconv.FormatFloat(r.Value, 'f', -1, 64),
+			r.Unit,
+			r.DatasetID,
+			r.DatasetName,
+		}
+
+		if history {
+			date := ""
+			if r.VersionDate != nil {
+				date = r.VersionDate.UTC().Format(time.RFC3339Nano)
+			}
+			record = append(record, strconv.Itoa(r.Version), date)
+		}
+
+		if err := cw.Write(record); err != nil {
+			return errors.Wrap(err, "error writing CSV row")
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteJSON writes the rows as a JSON array, the format accepted by the JSON reader of the loader.
+func WriteJSON(w io.Writer, rows []Row) error {
+	if rows == nil {
+		rows = make([]Row, 0)
+	}
+
+	b, err := json.MarshalIndent(rows, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "error marshalling export rows")
+	}
+
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
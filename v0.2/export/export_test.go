@@ -0,0 +1,240 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/load"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store/memory"
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testAreaCode is the area code of the area profile in the test data files.
+const testAreaCode = "E05011362"
+
+// testFiles are the test data files, each is loaded as the next key stats version of the test area profile.
+var testFiles = []string{"../load/1.csv", "../load/2.csv", "../load/3.csv", "../load/4.csv"}
+
+// newTestStore returns a memory store with a key stats version of the test area profile for each test data file and
+// the values of the current key stats, by name, after each file was loaded.
+func newTestStore(t *testing.T) (*memory.Store, []map[string]float64) {
+	t.Helper()
+	ctx := context.Background()
+
+	s := memory.New()
+	if err := s.Seed(ctx, testAreaCode, "Disbury East", "Disbury East profile"); err != nil {
+		t.Fatal(err)
+	}
+
+	versions := make([]map[string]float64, 0, len(testFiles))
+	for _, f := range testFiles {
+		if _, err := load.DataFromFile(ctx, f, s, load.DefaultOptions()); err != nil {
+			t.Fatal(err)
+		}
+
+		rows, err := Profiles(ctx, s, []string{testAreaCode}, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		versions = append(versions, values(rows))
+	}
+
+	return s, versions
+}
+
+// values returns the value of each key stat of the rows by name.
+func values(rows []Row) map[string]float64 {
+	v := make(map[string]float64)
+	for _, r := range rows {
+		v[r.Name] = r.Value
+	}
+	return v
+}
+
+func TestProfilesVersion(t *testing.T) {
+	ctx := context.Background()
+	s, expected := newTestStore(t)
+
+	profile, err := s.GetProfileByAreaCode(ctx, testAreaCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := s.GetKeyStatsVersionsForProfile(ctx, profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(versions) != len(expected) {
+		t.Fatalf("expected %d key stats versions, got %d", len(expected), len(versions))
+	}
+
+	for _, v := range versions {
+		want := expected[v.Version-1]
+
+		for _, ref := range []string{strconv.Itoa(v.Version), v.DateCreated.Format(time.RFC3339Nano)} {
+			rows, err := Profiles(ctx, s, []string{testAreaCode}, Options{Version: ref})
+			if err != nil {
+				t.Fatalf("version %q: %s", ref, err)
+			}
+
+			if got := values(rows); !reflect.DeepEqual(got, want) {
+				t.Errorf("version %q: expected key stats %v, got %v", ref, want, got)
+			}
+		}
+	}
+
+	latest, err := Profiles(ctx, s, []string{testAreaCode}, Options{Version: store.LatestVersion})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	current, err := Profiles(ctx, s, []string{testAreaCode}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(latest, current) || !reflect.DeepEqual(values(current), expected[len(expected)-1]) {
+		t.Errorf("expected the latest version and current key stats to be %v, got %+v and %+v", expected[len(expected)-1], latest, current)
+	}
+}
+
+func TestProfilesInvalidVersion(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStore(t)
+
+	cases := map[string]error{
+		"first":       ErrInvalidVersion,
+		"99":          store.ErrNotFound,
+		"2022-13-01Z": ErrInvalidVersion,
+	}
+
+	for ref, expected := range cases {
+		if _, err := Profiles(ctx, s, []string{testAreaCode}, Options{Version: ref}); !errors.Is(err, expected) {
+			t.Errorf("version %q: expected %q, got %v", ref, expected, err)
+		}
+	}
+
+	if _, err := Profiles(ctx, s, []string{"E05000001"}, Options{}); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("expected %q for an area without a profile, got %v", store.ErrNotFound, err)
+	}
+}
+
+func TestProfilesHistory(t *testing.T) {
+	ctx := context.Background()
+	s, expected := newTestStore(t)
+
+	rows, err := Profiles(ctx, s, []string{testAreaCode}, Options{History: true, Version: "ignored"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := ByVersion(rows)
+	if len(files) != len(expected) {
+		t.Fatalf("expected %d versions, got %d", len(expected), len(files))
+	}
+
+	// rows are exported oldest version first, each with its version number and date.
+	last := 0
+	for _, r := range rows {
+		if r.Version < last || r.VersionDate == nil {
+			t.Fatalf("expected rows in version order with a version date, got %+v", r)
+		}
+		last = r.Version
+	}
+
+	// importing the rows of each version in order reproduces the history.
+	target := memory.New()
+	dir := t.TempDir()
+	opts := load.DefaultOptions()
+	opts.Profiles = load.CreateMissingProfiles
+
+	for i, file := range files {
+		if got := values(file); !reflect.DeepEqual(got, expected[i]) {
+			t.Errorf("version %d: expected key stats %v, got %v", i+1, expected[i], got)
+		}
+
+		filename := filepath.Join(dir, fmt.Sprintf("version-%03d.csv", i+1))
+		writeFile(t, filename, file)
+
+		if _, err := load.DataFromFile(ctx, filename, target, opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	imported, err := Profiles(ctx, target, []string{testAreaCode}, Options{History: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(imported) != len(rows) {
+		t.Fatalf("expected %d imported history rows, got %d", len(rows), len(imported))
+	}
+
+	for i := range rows {
+		got, want := imported[i], rows[i]
+		got.VersionDate, want.VersionDate = nil, nil
+
+		if got != want {
+			t.Errorf("row %d: expected %+v, got %+v", i, want, got)
+		}
+	}
+}
+
+func TestWriteCSVHistory(t *testing.T) {
+	date := time.Date(2022, 4, 11, 16, 12, 25, 302470000, time.UTC)
+	rows := []Row{{
+		AreaCode:    testAreaCode,
+		Title:       "Disbury East profile",
+		Name:        "Resident population",
+		Value:       12500,
+		Unit:        "people",
+		DatasetID:   "TS001",
+		DatasetName: "Census 2021",
+		Version:     2,
+		VersionDate: &date,
+	}}
+
+	var b bytes.Buffer
+	if err := WriteCSV(&b, rows, true); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [][]string{
+		{"area_code", "title", "name", "value", "unit", "dataset_id", "dataset_name", "version", "version_date"},
+		{testAreaCode, "Disbury East profile", "Resident population", "12500", "people", "TS001", "Census 2021", "2", "2022-04-11T16:12:25.30247Z"},
+	}
+
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("expected %q, got %q", expected, records)
+	}
+}
+
+// writeFile writes the rows to a CSV data file.
+func writeFile(t *testing.T, filename string, rows []Row) {
+	t.Helper()
+
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	if err := WriteCSV(f, rows, false); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -12,9 +12,9 @@ func GetAreaProfilesHandlerFunc(db DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		log.Info("handling %s request", "GET /profiles")
 
-		profiles, err := db.GetAreaProfiles()
+		profiles, err := db.GetAreaProfiles(r.Context())
 		if err != nil {
-			http.Error(w, "error getting area profiles list", http.StatusInternalServerError)
+			writeStoreError(w, err, "error getting area profiles list")
 			return
 		}
 
@@ -36,15 +36,15 @@ func GetAreaProfileHandlerFunc(db DB) http.HandlerFunc {
 			return
 		}
 
-		profile, err := db.GetProfileByAreaCode(areaCode)
+		profile, err := db.GetProfileByAreaCode(r.Context(), areaCode)
 		if err != nil {
 			if err == store.ErrNotFound {
 				http.Error(w, "profile not found", http.StatusNotFound)
 				return
 			}
 
-			log.Err("error querying for profile: %s", err.Error())
-			http.Error(w, "internal server error", http.StatusInternalServerError)
+			writeStoreError(w, err, "error querying for profile")
+			return
 		}
 
 		if err := writeEntity(w, profile, http.StatusOK); err != nil {
@@ -53,3 +53,119 @@ func GetAreaProfileHandlerFunc(db DB) http.HandlerFunc {
 		}
 	}
 }
+
+// AreaProfileRequest is the request body to create or update an area profile. AreaCode is ignored on update.
+type AreaProfileRequest struct {
+	AreaCode string `json:"area_code"`
+	Name     string `json:"name"`
+}
+
+func (p AreaProfileRequest) validate(create bool) ValidationErrors {
+	var v ValidationErrors
+	if create {
+		v.required("area_code", p.AreaCode)
+		v.maxLen("area_code", p.AreaCode, 50)
+	}
+	v.required("name", p.Name)
+	v.maxLen("name", p.Name, 100)
+	return v
+}
+
+// PostAreaProfileHandlerFunc HTTP handler creates a new area profile. Returns 409 if the area already has a profile and
+// 422 if the area does not exist.
+func PostAreaProfileHandlerFunc(db DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Info("handling %s request", "POST /profiles")
+
+		var req AreaProfileRequest
+		if !readJSON(w, r, &req) {
+			return
+		}
+
+		if v := req.validate(true); v.hasErrors() {
+			writeValidationErrors(w, v)
+			return
+		}
+
+		if _, err := db.AddAreaProfile(r.Context(), req.AreaCode, req.Name); err != nil {
+			writeStoreError(w, err, "error adding area profile")
+			return
+		}
+
+		writeAreaProfile(w, r, db, req.AreaCode, http.StatusCreated)
+	}
+}
+
+// PutAreaProfileHandlerFunc HTTP handler updates the name of an existing area profile.
+func PutAreaProfileHandlerFunc(db DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Info("handling %s request", "PUT /profiles/{area_code}")
+
+		areaCode := mux.Vars(r)["area_code"]
+		if areaCode == "" {
+			http.Error(w, "area code required but none provided", http.StatusBadRequest)
+			return
+		}
+
+		var req AreaProfileRequest
+		if !readJSON(w, r, &req) {
+			return
+		}
+
+		if v := req.validate(false); v.hasErrors() {
+			writeValidationErrors(w, v)
+			return
+		}
+
+		if err := db.UpdateAreaProfile(r.Context(), areaCode, req.Name); err != nil {
+			if err == store.ErrNotFound {
+				http.Error(w, "profile not found", http.StatusNotFound)
+				return
+			}
+
+			writeStoreError(w, err, "error updating area profile")
+			return
+		}
+
+		writeAreaProfile(w, r, db, areaCode, http.StatusOK)
+	}
+}
+
+// DeleteAreaProfileHandlerFunc HTTP handler deletes an area profile. Returns 409 if the profile has key stats.
+func DeleteAreaProfileHandlerFunc(db DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Info("handling %s request", "DELETE /profiles/{area_code}")
+
+		areaCode := mux.Vars(r)["area_code"]
+		if areaCode == "" {
+			http.Error(w, "area code required but none provided", http.StatusBadRequest)
+			return
+		}
+
+		if err := db.DeleteAreaProfile(r.Context(), areaCode); err != nil {
+			if err == store.ErrNotFound {
+				http.Error(w, "profile not found", http.StatusNotFound)
+				return
+			}
+
+			writeStoreError(w, err, "error deleting area profile")
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// writeAreaProfile writes the current state of the area profile to the response.
+func writeAreaProfile(w http.ResponseWriter, r *http.Request, db DB, areaCode string, status int) {
+	profile, err := db.GetProfileByAreaCode(r.Context(), areaCode)
+	if err != nil {
+		writeStoreError(w, err, "error querying for profile")
+		return
+	}
+
+	if err := writeEntity(w, profile, status); err != nil {
+		log.Err("error writing area profile entity to response: %s", err.Error())
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
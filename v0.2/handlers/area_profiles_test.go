@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestPostAreaProfile(t *testing.T) {
+	r := Initalise(newTestStore(t), time.Minute)
+
+	rec := serve(t, r, http.MethodPost, "/areas", AreaRequest{Code: "E05000001", Name: "Ward one"})
+	expectStatus(t, rec, http.StatusCreated)
+
+	rec = serve(t, r, http.MethodPost, "/profiles", AreaProfileRequest{AreaCode: "E05000001", Name: "Ward one profile"})
+	expectStatus(t, rec, http.StatusCreated)
+
+	var profile store.AreaProfile
+	decode(t, rec, &profile)
+
+	if profile.AreaCode != "E05000001" || profile.Name != "Ward one profile" {
+		t.Errorf("expected the profile of E05000001 named %q, got %+v", "Ward one profile", profile)
+	}
+}
+
+func TestPostAreaProfileConflict(t *testing.T) {
+	r := Initalise(newTestStore(t), time.Minute)
+
+	rec := serve(t, r, http.MethodPost, "/areas", AreaRequest{Code: testAreaCode, Name: "Disbury East"})
+	expectStatus(t, rec, http.StatusConflict)
+
+	rec = serve(t, r, http.MethodPost, "/profiles", AreaProfileRequest{AreaCode: testAreaCode, Name: "Another profile"})
+	expectStatus(t, rec, http.StatusConflict)
+}
+
+func TestPostAreaProfileUnprocessable(t *testing.T) {
+	r := Initalise(newTestStore(t), time.Minute)
+
+	// the area does not exist.
+	rec := serve(t, r, http.MethodPost, "/profiles", AreaProfileRequest{AreaCode: "E05000002", Name: "Ward two profile"})
+	expectStatus(t, rec, http.StatusUnprocessableEntity)
+
+	rec = serve(t, r, http.MethodPost, "/profiles", AreaProfileRequest{AreaCode: "E05000002"})
+	expectStatus(t, rec, http.StatusUnprocessableEntity)
+
+	var v ValidationErrors
+	decode(t, rec, &v)
+
+	if len(v.Errors) != 1 {
+		t.Errorf("expected 1 validation error, got %q", v.Errors)
+	}
+}
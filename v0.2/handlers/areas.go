@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"context"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store"
+	log "github.com/daiLlew/funkylog"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+// AreaRequest is the request body to create or update an area. Code is ignored on update.
+type AreaRequest struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+func (a AreaRequest) validate(create bool) ValidationErrors {
+	var v ValidationErrors
+	if create {
+		v.required("code", a.Code)
+		v.maxLen("code", a.Code, 50)
+	}
+	v.required("name", a.Name)
+	v.maxLen("name", a.Name, 100)
+	return v
+}
+
+// GetAreaHandlerFunc HTTP handler returns the area with the specified code including its geography type and parent.
+func GetAreaHandlerFunc(db DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Info("handling %s request", "GET /areas/{code}")
+
+		code := mux.Vars(r)["code"]
+		if code == "" {
+			http.Error(w, "area code required but none provided", http.StatusBadRequest)
+			return
+		}
+
+		writeArea(w, r, db, code, http.StatusOK)
+	}
+}
+
+// GetAreaChildrenHandlerFunc HTTP handler returns the areas one level below the specified area in the geography hierarchy.
+func GetAreaChildrenHandlerFunc(db DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Info("handling %s request", "GET /areas/{code}/children")
+		writeRelatedAreas(w, r, db.GetAreaChildren, "children")
+	}
+}
+
+// GetAreaAncestorsHandlerFunc HTTP handler returns the areas above the specified area in the geography hierarchy,
+// nearest first.
+func GetAreaAncestorsHandlerFunc(db DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Info("handling %s request", "GET /areas/{code}/ancestors")
+		writeRelatedAreas(w, r, db.GetAreaAncestors, "ancestors")
+	}
+}
+
+// GetGeographyTypesHandlerFunc HTTP handler returns a list of the geography types.
+func GetGeographyTypesHandlerFunc(db DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Info("handling %s request", "GET /geography-types")
+
+		types, err := db.GetGeographyTypes(r.Context())
+		if err != nil {
+			writeStoreError(w, err, "error getting geography types")
+			return
+		}
+
+		if err := writeEntity(w, types, http.StatusOK); err != nil {
+			log.Err("error writing geography types entity to response: %s", err.Error())
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+	}
+}
+
+// PostAreaHandlerFunc HTTP handler creates a new area. Returns 409 if an area with the code already exists.
+func PostAreaHandlerFunc(db DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Info("handling %s request", "POST /areas")
+
+		var req AreaRequest
+		if !readJSON(w, r, &req) {
+			return
+		}
+
+		if v := req.validate(true); v.hasErrors() {
+			writeValidationErrors(w, v)
+			return
+		}
+
+		if _, err := db.AddArea(r.Context(), req.Code, req.Name); err != nil {
+			writeStoreError(w, err, "error adding area")
+			return
+		}
+
+		writeArea(w, r, db, req.Code, http.StatusCreated)
+	}
+}
+
+// PutAreaHandlerFunc HTTP handler updates the name of an existing area.
+func PutAreaHandlerFunc(db DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Info("handling %s request", "PUT /areas/{code}")
+
+		code := mux.Vars(r)["code"]
+		if code == "" {
+			http.Error(w, "area code required but none provided", http.StatusBadRequest)
+			return
+		}
+
+		var req AreaRequest
+		if !readJSON(w, r, &req) {
+			return
+		}
+
+		if v := req.validate(false); v.hasErrors() {
+			writeValidationErrors(w, v)
+			return
+		}
+
+		if err := db.UpdateArea(r.Context(), code, req.Name); err != nil {
+			if err == store.ErrNotFound {
+				http.Error(w, "area not found", http.StatusNotFound)
+				return
+			}
+
+			writeStoreError(w, err, "error updating area")
+			return
+		}
+
+		writeArea(w, r, db, code, http.StatusOK)
+	}
+}
+
+// DeleteAreaHandlerFunc HTTP handler deletes an area. Returns 409 if the area has an area profile.
+func DeleteAreaHandlerFunc(db DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Info("handling %s request", "DELETE /areas/{code}")
+
+		code := mux.Vars(r)["code"]
+		if code == "" {
+			http.Error(w, "area code required but none provided", http.StatusBadRequest)
+			return
+		}
+
+		if err := db.DeleteArea(r.Context(), code); err != nil {
+			if err == store.ErrNotFound {
+				http.Error(w, "area not found", http.StatusNotFound)
+				return
+			}
+
+			writeStoreError(w, err, "error deleting area")
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// writeArea writes the current state of the area to the response.
+func writeArea(w http.ResponseWriter, r *http.Request, db DB, code string, status int) {
+	area, err := db.GetArea(r.Context(), code)
+	if err != nil {
+		if err == store.ErrNotFound {
+			http.Error(w, "area not found", http.StatusNotFound)
+			return
+		}
+
+		writeStoreError(w, err, "error querying for area")
+		return
+	}
+
+	if err := writeEntity(w, area, status); err != nil {
+		log.Err("error writing area entity to response: %s", err.Error())
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+// writeRelatedAreas writes the areas returned by the get func for the area code in the request path to the response.
+func writeRelatedAreas(w http.ResponseWriter, r *http.Request, get func(ctx context.Context, code string) ([]store.Area, error), relation string) {
+	code := mux.Vars(r)["code"]
+	if code == "" {
+		http.Error(w, "area code required but none provided", http.StatusBadRequest)
+		return
+	}
+
+	areas, err := get(r.Context(), code)
+	if err != nil {
+		if err == store.ErrNotFound {
+			http.Error(w, "area not found", http.StatusNotFound)
+			return
+		}
+
+		writeStoreError(w, err, "error querying for area "+relation)
+		return
+	}
+
+	if err := writeEntity(w, areas, http.StatusOK); err != nil {
+		log.Err("error writing area %s entity to response: %s", relation, err.Error())
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"context"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store/memory"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newHierarchyStore returns the test store with a local authority district containing the test ward and a second ward.
+func newHierarchyStore(t *testing.T) *memory.Store {
+	t.Helper()
+
+	s := newTestStore(t)
+	err := s.InTransaction(context.Background(), func(tx store.Tx) error {
+		if err := tx.UpsertArea(context.Background(), "E08000003", "Manchester", "LAD", ""); err != nil {
+			return err
+		}
+
+		if err := tx.UpsertArea(context.Background(), testAreaCode, "", "", "E08000003"); err != nil {
+			return err
+		}
+
+		return tx.UpsertArea(context.Background(), "E05011363", "Disbury West", "", "E08000003")
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+// areaCodes returns the codes of the areas in the response.
+func areaCodes(t *testing.T, areas []store.Area) []string {
+	t.Helper()
+
+	codes := make([]string, 0, len(areas))
+	for _, a := range areas {
+		codes = append(codes, a.Code)
+	}
+
+	return codes
+}
+
+func TestGetArea(t *testing.T) {
+	r := Initalise(newHierarchyStore(t), time.Minute)
+
+	rec := serve(t, r, http.MethodGet, "/areas/E08000003", nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	var area store.Area
+	decode(t, rec, &area)
+
+	if area.Name != "Manchester" || area.GeographyType == nil || area.GeographyType.Code != "LAD" || area.ParentCode != "" {
+		t.Errorf("expected Manchester local authority district without a parent, got %+v", area)
+	}
+
+	rec = serve(t, r, http.MethodGet, "/areas/"+testAreaCode, nil)
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &area)
+
+	if area.Name != "Disbury East" || area.ParentCode != "E08000003" {
+		t.Errorf("expected Disbury East in E08000003, got %+v", area)
+	}
+
+	rec = serve(t, r, http.MethodGet, "/areas/E05000001", nil)
+	expectStatus(t, rec, http.StatusNotFound)
+}
+
+func TestGetAreaChildren(t *testing.T) {
+	r := Initalise(newHierarchyStore(t), time.Minute)
+
+	cases := []struct {
+		code     string
+		expected []string
+	}{
+		{"E08000003", []string{"E05011362", "E05011363"}},
+		{testAreaCode, []string{}},
+	}
+
+	for _, c := range cases {
+		rec := serve(t, r, http.MethodGet, "/areas/"+c.code+"/children", nil)
+		expectStatus(t, rec, http.StatusOK)
+
+		var areas []store.Area
+		decode(t, rec, &areas)
+
+		if got := areaCodes(t, areas); !reflect.DeepEqual(got, c.expected) {
+			t.Errorf("expected the children of %s to be %v, got %v", c.code, c.expected, got)
+		}
+	}
+
+	rec := serve(t, r, http.MethodGet, "/areas/E05000001/children", nil)
+	expectStatus(t, rec, http.StatusNotFound)
+}
+
+func TestGetAreaAncestors(t *testing.T) {
+	r := Initalise(newHierarchyStore(t), time.Minute)
+
+	rec := serve(t, r, http.MethodGet, "/areas/"+testAreaCode+"/ancestors", nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	var areas []store.Area
+	decode(t, rec, &areas)
+
+	if got := areaCodes(t, areas); len(got) != 1 || got[0] != "E08000003" {
+		t.Errorf("expected the ancestors of %s to be [E08000003], got %v", testAreaCode, got)
+	}
+
+	rec = serve(t, r, http.MethodGet, "/areas/E08000003/ancestors", nil)
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &areas)
+
+	if len(areas) != 0 {
+		t.Errorf("expected a top level area to have no ancestors, got %+v", areas)
+	}
+
+	rec = serve(t, r, http.MethodGet, "/areas/E05000001/ancestors", nil)
+	expectStatus(t, rec, http.StatusNotFound)
+}
+
+func TestGetGeographyTypes(t *testing.T) {
+	r := Initalise(newTestStore(t), time.Minute)
+
+	rec := serve(t, r, http.MethodGet, "/geography-types", nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	var types []store.GeographyType
+	decode(t, rec, &types)
+
+	if len(types) != 4 || types[0].Code != "OA" || types[3].Code != "LAD" {
+		t.Errorf("expected the geography types from output area to local authority district, got %+v", types)
+	}
+}
+
+func TestPutArea(t *testing.T) {
+	r := Initalise(newHierarchyStore(t), time.Minute)
+
+	rec := serve(t, r, http.MethodPut, "/areas/"+testAreaCode, AreaRequest{Name: "Didsbury East"})
+	expectStatus(t, rec, http.StatusOK)
+
+	var area store.Area
+	decode(t, rec, &area)
+
+	if area.Name != "Didsbury East" || area.ParentCode != "E08000003" {
+		t.Errorf("expected the area to be renamed keeping its parent, got %+v", area)
+	}
+
+	rec = serve(t, r, http.MethodPut, "/areas/E05000001", AreaRequest{Name: "Ward one"})
+	expectStatus(t, rec, http.StatusNotFound)
+
+	rec = serve(t, r, http.MethodPut, "/areas/"+testAreaCode, AreaRequest{})
+	expectStatus(t, rec, http.StatusUnprocessableEntity)
+}
+
+func TestDeleteArea(t *testing.T) {
+	r := Initalise(newHierarchyStore(t), time.Minute)
+
+	// an area with an area profile cannot be deleted.
+	rec := serve(t, r, http.MethodDelete, "/areas/"+testAreaCode, nil)
+	expectStatus(t, rec, http.StatusConflict)
+
+	rec = serve(t, r, http.MethodDelete, "/areas/E05011363", nil)
+	expectStatus(t, rec, http.StatusNoContent)
+
+	rec = serve(t, r, http.MethodGet, "/areas/E05011363", nil)
+	expectStatus(t, rec, http.StatusNotFound)
+
+	rec = serve(t, r, http.MethodDelete, "/areas/E05011363", nil)
+	expectStatus(t, rec, http.StatusNotFound)
+}
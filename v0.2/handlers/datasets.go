@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store"
+	log "github.com/daiLlew/funkylog"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+// GetDatasetsHandlerFunc HTTP handler returns all datasets.
+func GetDatasetsHandlerFunc(db DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Info("handling %s request", "GET /datasets")
+
+		datasets, err := db.GetDatasets(r.Context())
+		if err != nil {
+			writeStoreError(w, err, "error getting datasets")
+			return
+		}
+
+		if err := writeEntity(w, datasets, http.StatusOK); err != nil {
+			log.Err("error writing datasets entity to response: %s", err.Error())
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+	}
+}
+
+// GetDatasetHandlerFunc HTTP handler returns the dataset with the specified ID.
+func GetDatasetHandlerFunc(db DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Info("handling %s request", "GET /datasets/{id}")
+
+		id := mux.Vars(r)["id"]
+		if id == "" {
+			http.Error(w, "dataset id required but none provided", http.StatusBadRequest)
+			return
+		}
+
+		dataset, err := db.GetDataset(r.Context(), id)
+		if err != nil {
+			if err == store.ErrNotFound {
+				http.Error(w, "dataset not found", http.StatusNotFound)
+				return
+			}
+
+			writeStoreError(w, err, "error querying for dataset")
+			return
+		}
+
+		if err := writeEntity(w, dataset, http.StatusOK); err != nil {
+			log.Err("error writing dataset entity to response: %s", err.Error())
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+	}
+}
+
+// GetDatasetStatsHandlerFunc HTTP handler returns the area profiles and key stat types the current key stats of which
+// are sourced from the specified dataset.
+func GetDatasetStatsHandlerFunc(db DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Info("handling %s request", "GET /datasets/{id}/stats")
+
+		id := mux.Vars(r)["id"]
+		if id == "" {
+			http.Error(w, "dataset id required but none provided", http.StatusBadRequest)
+			return
+		}
+
+		stats, err := db.GetDatasetStats(r.Context(), id)
+		if err != nil {
+			if err == store.ErrNotFound {
+				http.Error(w, "dataset not found", http.StatusNotFound)
+				return
+			}
+
+			writeStoreError(w, err, "error querying for dataset stats")
+			return
+		}
+
+		if err := writeEntity(w, stats, http.StatusOK); err != nil {
+			log.Err("error writing dataset stats entity to response: %s", err.Error())
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"context"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store/memory"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// newDatasetStore returns the test store with key stats for the test area sourced from two datasets and a dataset
+// edition registered without key stats.
+func newDatasetStore(t *testing.T) *memory.Store {
+	t.Helper()
+	ctx := context.Background()
+
+	s := newTestStore(t)
+	created := time.Date(2022, 6, 1, 9, 0, 0, 0, time.UTC)
+
+	stats := []struct {
+		name, datasetID, datasetName string
+		value                        float64
+	}{
+		{"Resident population", "TS001", "Number of usual residents", 12890},
+		{"Population density (Hectares)", "TS001", "Number of usual residents", 41.2},
+		{"Average (mean) age", "TS007", "Age by single year", 39.5},
+	}
+
+	for _, stat := range stats {
+		if _, err := s.InsertKeyStat(ctx, testAreaCode, stat.name, stat.value, "", stat.datasetID, stat.datasetName, created); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := s.InTransaction(ctx, func(tx store.Tx) error {
+		return tx.UpsertDataset(ctx, store.Dataset{ID: "TS037", Name: "General health", Editions: []string{"2021"}})
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func TestGetDatasets(t *testing.T) {
+	r := Initalise(newDatasetStore(t), time.Minute)
+
+	rec := serve(t, r, http.MethodGet, "/datasets", nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	var datasets []store.Dataset
+	decode(t, rec, &datasets)
+
+	if len(datasets) != 3 || datasets[0].ID != "TS001" || datasets[1].ID != "TS007" || datasets[2].ID != "TS037" {
+		t.Fatalf("expected datasets TS001, TS007 and TS037, got %+v", datasets)
+	}
+
+	if datasets[0].Name != "Number of usual residents" {
+		t.Errorf("expected the dataset name of the key stats, got %q", datasets[0].Name)
+	}
+}
+
+func TestGetDataset(t *testing.T) {
+	r := Initalise(newDatasetStore(t), time.Minute)
+
+	rec := serve(t, r, http.MethodGet, "/datasets/TS037", nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	var dataset store.Dataset
+	decode(t, rec, &dataset)
+
+	if dataset.ID != "TS037" || dataset.Name != "General health" || len(dataset.Editions) != 1 || dataset.Editions[0] != "2021" {
+		t.Errorf("expected the TS037 general health dataset with the 2021 edition, got %+v", dataset)
+	}
+
+	if dataset.Links.Stats != "http://localhost:8080/datasets/TS037/stats" {
+		t.Errorf("expected a link to the dataset stats, got %q", dataset.Links.Stats)
+	}
+
+	rec = serve(t, r, http.MethodGet, "/datasets/TS999", nil)
+	expectStatus(t, rec, http.StatusNotFound)
+}
+
+func TestGetDatasetStats(t *testing.T) {
+	r := Initalise(newDatasetStore(t), time.Minute)
+
+	rec := serve(t, r, http.MethodGet, "/datasets/TS001/stats", nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	var stats store.DatasetStats
+	decode(t, rec, &stats)
+
+	if len(stats.Profiles) != 1 || stats.Profiles[0].AreaCode != testAreaCode || len(stats.Profiles[0].StatTypes) != 2 {
+		t.Fatalf("expected the 2 key stats of the test area profile, got %+v", stats)
+	}
+
+	if len(stats.StatTypes) != 2 {
+		t.Errorf("expected the 2 key stat types sourced from TS001, got %+v", stats.StatTypes)
+	}
+
+	// a dataset without current key stats has no stats.
+	rec = serve(t, r, http.MethodGet, "/datasets/TS037/stats", nil)
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &stats)
+
+	if len(stats.Profiles) != 0 || len(stats.StatTypes) != 0 {
+		t.Errorf("expected no stats, got %+v", stats)
+	}
+
+	rec = serve(t, r, http.MethodGet, "/datasets/TS999/stats", nil)
+	expectStatus(t, rec, http.StatusNotFound)
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/export"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store"
+	log "github.com/daiLlew/funkylog"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"net/http"
+	"strconv"
+)
+
+// exportContentTypes is the content type of each export format.
+var exportContentTypes = map[string]string{
+	export.CSV:  "text/csv",
+	export.JSON: "application/json",
+}
+
+// GetProfileExportHandlerFunc HTTP handler returns the key stats of the area profile as a data file that can be
+// imported. The optional query parameters are format, csv (default) or json, version, a version number, "latest" or a
+// version timestamp, the current key stats if not set, and history=true to export every version.
+func GetProfileExportHandlerFunc(db DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Info("handling %s request", "GET /profiles/{area_code}/export")
+
+		areaCode := mux.Vars(r)["area_code"]
+		query := r.URL.Query()
+
+		format := query.Get("format")
+		if format == "" {
+			format = export.CSV
+		}
+
+		contentType, ok := exportContentTypes[format]
+		if !ok {
+			http.Error(w, fmt.Sprintf("invalid format %q, expected %q or %q", format, export.CSV, export.JSON), http.StatusBadRequest)
+			return
+		}
+
+		opts := export.Options{Version: query.Get("version")}
+		if h := query.Get("history"); h != "" {
+			history, err := strconv.ParseBool(h)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid history %q, expected true or false", h), http.StatusBadRequest)
+				return
+			}
+			opts.History = history
+		}
+
+		rows, err := export.Profiles(r.Context(), db, []string{areaCode}, opts)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				http.Error(w, err.Error(), http.StatusNotFound)
+			case errors.Is(err, export.ErrInvalidVersion):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			default:
+				writeStoreError(w, err, "error exporting profile")
+			}
+			return
+		}
+
+		var body bytes.Buffer
+		if err := export.Write(&body, format, rows, opts.History); err != nil {
+			log.Err("error writing profile export: %s", err.Error())
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("content-type", contentType)
+		w.Header().Set("content-disposition", fmt.Sprintf("attachment; filename=%q", areaCode+"."+format))
+		w.WriteHeader(http.StatusOK)
+		if _, err := w.Write(body.Bytes()); err != nil {
+			log.Err("error writing profile export to response: %s", err.Error())
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/export"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetProfileExport(t *testing.T) {
+	r := Initalise(newTestStore(t), time.Minute)
+	postStats(t, r, stat("Resident population", 100, ""))
+	postStats(t, r, stat("Resident population", 110, ""))
+
+	rec := serve(t, r, http.MethodGet, "/profiles/"+testAreaCode+"/export", nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	if ct := rec.Header().Get("content-type"); ct != "text/csv" {
+		t.Errorf("expected content type %q, got %q", "text/csv", ct)
+	}
+
+	expected := "area_code,title,name,value,unit,dataset_id,dataset_name\n" +
+		testAreaCode + ",Disbury East profile,Resident population,110,,TS001,Census 2021\n"
+	if rec.Body.String() != expected {
+		t.Errorf("expected export %q, got %q", expected, rec.Body.String())
+	}
+
+	rec = serve(t, r, http.MethodGet, "/profiles/"+testAreaCode+"/export?format=json&version=1", nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	var rows []export.Row
+	if err := json.Unmarshal(rec.Body.Bytes(), &rows); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 1 || rows[0].Value != 100 {
+		t.Errorf("expected version 1 of the key stats, got %+v", rows)
+	}
+
+	rec = serve(t, r, http.MethodGet, "/profiles/"+testAreaCode+"/export?history=true", nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	if lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n"); len(lines) != 3 || !strings.HasSuffix(lines[0], ",version,version_date") {
+		t.Errorf("expected a header and a row of each version, got %q", lines)
+	}
+}
+
+func TestGetProfileExportErrors(t *testing.T) {
+	cases := map[string]int{
+		"/profiles/" + testAreaCode + "/export?format=xml":    http.StatusBadRequest,
+		"/profiles/" + testAreaCode + "/export?history=maybe": http.StatusBadRequest,
+		"/profiles/" + testAreaCode + "/export?version=first": http.StatusBadRequest,
+		"/profiles/" + testAreaCode + "/export?version=99":    http.StatusNotFound,
+		"/profiles/E05000001/export":                          http.StatusNotFound,
+	}
+
+	r := Initalise(newTestStore(t), time.Minute)
+	postStats(t, r, stat("Resident population", 100, ""))
+
+	for path, expected := range cases {
+		t.Run(path, func(t *testing.T) {
+			expectStatus(t, serve(t, r, http.MethodGet, path, nil), expected)
+		})
+	}
+}
@@ -1,34 +1,117 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store"
+	log "github.com/daiLlew/funkylog"
 	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
 	"net/http"
 	"time"
 )
 
 // DB represents the area profiles data store.
 type DB interface {
-	GetAreaProfiles() ([]store.AreaProfile, error)
-	GetProfileByAreaCode(areaCode string) (*store.AreaProfile, error)
-	GetKeyStatsForProfile(profile *store.AreaProfile) (store.KeyStatistics, error)
-	GetKeyStatsVersionsForProfile(profile *store.AreaProfile) ([]time.Time, error)
-	GetKeyStatsVersion(profile *store.AreaProfile, date string) (store.KeyStatistics, error)
+	GetAreaProfiles(ctx context.Context) ([]store.AreaProfile, error)
+	GetProfileByAreaCode(ctx context.Context, areaCode string) (*store.AreaProfile, error)
+	GetKeyStatsForProfile(ctx context.Context, profile *store.AreaProfile) (store.KeyStatistics, error)
+	GetKeyStatsVersionsForProfile(ctx context.Context, profile *store.AreaProfile) ([]store.KeyStatVersion, error)
+	GetKeyStatsVersionByNumber(ctx context.Context, profile *store.AreaProfile, number int) (*store.KeyStatVersion, error)
+	GetLatestKeyStatsVersion(ctx context.Context, profile *store.AreaProfile) (*store.KeyStatVersion, error)
+	GetKeyStatsVersion(ctx context.Context, profile *store.AreaProfile, date time.Time) (store.KeyStatistics, error)
+	GetKeyStatHistory(ctx context.Context, profile *store.AreaProfile, statType int) (*store.KeyStatHistory, error)
+	GetStatTypeByName(ctx context.Context, name string) (int, error)
+	GetStatTypes(ctx context.Context, status string) ([]store.KeyStatType, error)
+	GetStatTypeByID(ctx context.Context, id int) (*store.KeyStatType, error)
+	AddStatType(ctx context.Context, t store.KeyStatType) (int, error)
+	UpdateStatType(ctx context.Context, t store.KeyStatType) error
+	GetUnits(ctx context.Context) ([]store.Unit, error)
+	AddArea(ctx context.Context, code, name string) (string, error)
+	GetArea(ctx context.Context, code string) (*store.Area, error)
+	GetAreaChildren(ctx context.Context, code string) ([]store.Area, error)
+	GetAreaAncestors(ctx context.Context, code string) ([]store.Area, error)
+	GetGeographyTypes(ctx context.Context) ([]store.GeographyType, error)
+	UpdateArea(ctx context.Context, code, name string) error
+	DeleteArea(ctx context.Context, code string) error
+	AddAreaProfile(ctx context.Context, areaCode, name string) (int, error)
+	UpdateAreaProfile(ctx context.Context, areaCode, name string) error
+	DeleteAreaProfile(ctx context.Context, areaCode string) error
+	DeleteKeyStats(ctx context.Context, areaCode string) error
+	InTransaction(ctx context.Context, fn func(tx store.Tx) error) error
+	GetRecipes(ctx context.Context, datasetID, edition string) ([]store.KeyStatsRecipe, error)
+	GetRecipe(ctx context.Context, id int) (*store.KeyStatsRecipe, error)
+	AddRecipe(ctx context.Context, recipe store.KeyStatsRecipe) (int, error)
+	UpdateRecipe(ctx context.Context, recipe store.KeyStatsRecipe) error
+	DeleteRecipe(ctx context.Context, id int) error
+	GetDatasets(ctx context.Context) ([]store.Dataset, error)
+	GetDataset(ctx context.Context, id string) (*store.Dataset, error)
+	GetDatasetStats(ctx context.Context, id string) (*store.DatasetStats, error)
+	GetImports(ctx context.Context, status string) ([]store.Import, error)
+	GetImport(ctx context.Context, id int) (*store.Import, error)
+	Ping(ctx context.Context) error
+	PoolStats() store.PoolStats
 }
 
-// Initalise registers the API handler functions.
-func Initalise(db DB) *mux.Router {
+// Initalise registers the API handler functions. Database queries made while handling a request are cancelled if the
+// client disconnects or they have not completed within the query timeout.
+func Initalise(db DB, queryTimeout time.Duration) *mux.Router {
 	r := mux.NewRouter()
+	r.Use(timeoutMiddleware(queryTimeout))
 
+	r.Path("/areas").Methods(http.MethodPost).HandlerFunc(PostAreaHandlerFunc(db))
+	r.Path("/areas/{code}").Methods(http.MethodGet).HandlerFunc(GetAreaHandlerFunc(db))
+	r.Path("/areas/{code}").Methods(http.MethodPut).HandlerFunc(PutAreaHandlerFunc(db))
+	r.Path("/areas/{code}").Methods(http.MethodDelete).HandlerFunc(DeleteAreaHandlerFunc(db))
+	r.Path("/areas/{code}/children").Methods(http.MethodGet).HandlerFunc(GetAreaChildrenHandlerFunc(db))
+	r.Path("/areas/{code}/ancestors").Methods(http.MethodGet).HandlerFunc(GetAreaAncestorsHandlerFunc(db))
+	r.Path("/geography-types").Methods(http.MethodGet).HandlerFunc(GetGeographyTypesHandlerFunc(db))
+	r.Path("/stat-types").Methods(http.MethodGet).HandlerFunc(GetStatTypesHandlerFunc(db))
+	r.Path("/stat-types").Methods(http.MethodPost).HandlerFunc(PostStatTypeHandlerFunc(db))
+	r.Path("/stat-types/{id}").Methods(http.MethodGet).HandlerFunc(GetStatTypeHandlerFunc(db))
+	r.Path("/stat-types/{id}").Methods(http.MethodPatch).HandlerFunc(PatchStatTypeHandlerFunc(db))
+	r.Path("/units").Methods(http.MethodGet).HandlerFunc(GetUnitsHandlerFunc(db))
 	r.Path("/profiles").Methods(http.MethodGet).HandlerFunc(GetAreaProfilesHandlerFunc(db))
+	r.Path("/profiles").Methods(http.MethodPost).HandlerFunc(PostAreaProfileHandlerFunc(db))
 	r.Path("/profiles/{area_code}").Methods(http.MethodGet).HandlerFunc(GetAreaProfileHandlerFunc(db))
+	r.Path("/profiles/{area_code}").Methods(http.MethodPut).HandlerFunc(PutAreaProfileHandlerFunc(db))
+	r.Path("/profiles/{area_code}").Methods(http.MethodDelete).HandlerFunc(DeleteAreaProfileHandlerFunc(db))
+	r.Path("/profiles/{area_code}/export").Methods(http.MethodGet).HandlerFunc(GetProfileExportHandlerFunc(db))
 	r.Path("/profiles/{area_code}/stats").Methods(http.MethodGet).HandlerFunc(GetProfileStatsHandlerFunc(db))
+	r.Path("/profiles/{area_code}/stats").Methods(http.MethodPost).HandlerFunc(PostProfileStatsHandlerFunc(db))
+	r.Path("/profiles/{area_code}/stats").Methods(http.MethodDelete).HandlerFunc(DeleteProfileStatsHandlerFunc(db))
 	r.Path("/profiles/{area_code}/stats/versions").Methods(http.MethodGet).HandlerFunc(GetStatsVersionsHandlerFunc(db))
 	r.Path("/profiles/{area_code}/stats/versions/{version}").Methods(http.MethodGet).HandlerFunc(GetStatsVersionHandlerFunc(db))
+	r.Path("/profiles/{area_code}/stats/versions/{from}/diff/{to}").Methods(http.MethodGet).HandlerFunc(GetStatsVersionsDiffHandlerFunc(db))
+	r.Path("/profiles/{area_code}/stats/{stat_type}").Methods(http.MethodPut).HandlerFunc(PutProfileStatHandlerFunc(db))
+	r.Path("/profiles/{area_code}/stats/{stat_type}/history").Methods(http.MethodGet).HandlerFunc(GetStatHistoryHandlerFunc(db))
+	r.Path("/recipes").Methods(http.MethodGet).HandlerFunc(GetRecipesHandlerFunc(db))
+	r.Path("/recipes").Methods(http.MethodPost).HandlerFunc(PostRecipeHandlerFunc(db))
+	r.Path("/recipes/{id}").Methods(http.MethodGet).HandlerFunc(GetRecipeHandlerFunc(db))
+	r.Path("/recipes/{id}").Methods(http.MethodPut).HandlerFunc(PutRecipeHandlerFunc(db))
+	r.Path("/recipes/{id}").Methods(http.MethodDelete).HandlerFunc(DeleteRecipeHandlerFunc(db))
+	r.Path("/datasets").Methods(http.MethodGet).HandlerFunc(GetDatasetsHandlerFunc(db))
+	r.Path("/datasets/{id}").Methods(http.MethodGet).HandlerFunc(GetDatasetHandlerFunc(db))
+	r.Path("/datasets/{id}/stats").Methods(http.MethodGet).HandlerFunc(GetDatasetStatsHandlerFunc(db))
+	r.Path("/imports").Methods(http.MethodGet).HandlerFunc(GetImportsHandlerFunc(db))
+	r.Path("/imports/{id}").Methods(http.MethodGet).HandlerFunc(GetImportHandlerFunc(db))
+	r.Path("/health").Methods(http.MethodGet).HandlerFunc(GetHealthHandlerFunc(db))
 	return r
 }
 
+// timeoutMiddleware sets a deadline on the request context so that any queries made using it are cancelled once the
+// timeout has elapsed.
+func timeoutMiddleware(timeout time.Duration) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
 func writeEntity(w http.ResponseWriter, entity interface{}, status int) error {
 	body, err := json.MarshalIndent(entity, "", "  ")
 	if err != nil {
@@ -43,3 +126,27 @@ func writeEntity(w http.ResponseWriter, entity interface{}, status int) error {
 
 	return nil
 }
+
+// writeStoreError logs an error returned by the store and writes an error response with an appropriate status code.
+// Requests that exceeded the query deadline return 504, requests unable to get a database connection return 503. Writes
+// that conflict with existing data return 409, writes referencing records that do not exist or with invalid key stat
+// values return 422.
+func writeStoreError(w http.ResponseWriter, err error, msg string) {
+	switch {
+	case errors.Is(err, store.ErrConflict):
+		log.Warn("%s: %s", msg, err.Error())
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, store.ErrMissingReference), errors.Is(err, store.ErrInvalidValue), errors.Is(err, store.ErrStatTypeNotActive):
+		log.Warn("%s: %s", msg, err.Error())
+		writeValidationErrors(w, ValidationErrors{Errors: []string{err.Error()}})
+	case errors.Is(err, context.DeadlineExceeded):
+		log.Warn("%s: query deadline exceeded: %s", msg, err.Error())
+		http.Error(w, "timed out waiting for the database", http.StatusGatewayTimeout)
+	case errors.Is(err, store.ErrConnUnavailable), errors.Is(err, context.Canceled):
+		log.Warn("%s: %s", msg, err.Error())
+		http.Error(w, "service unavailable", http.StatusServiceUnavailable)
+	default:
+		log.Err("%s: %s", msg, err.Error())
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store/memory"
+	"github.com/pkg/errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testAreaCode is the code of the area with an area profile in the test store.
+const testAreaCode = "E05011362"
+
+// newTestStore returns a memory store with an area profile for the test area.
+func newTestStore(t *testing.T) *memory.Store {
+	t.Helper()
+
+	s := memory.New()
+	if err := s.Seed(context.Background(), testAreaCode, "Disbury East", "Disbury East profile"); err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+// serve sends a request to the handler and returns the response. The body is marshalled as JSON if not nil.
+func serve(t *testing.T, h http.Handler, method, path string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var b []byte
+	if body != nil {
+		var err error
+		if b, err = json.Marshal(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, path, bytes.NewReader(b)))
+	return rec
+}
+
+// expectStatus fails the test if the response does not have the expected status code.
+func expectStatus(t *testing.T, rec *httptest.ResponseRecorder, expected int) {
+	t.Helper()
+
+	if rec.Code != expected {
+		t.Fatalf("expected status %d, got %d: %s", expected, rec.Code, rec.Body.String())
+	}
+}
+
+// decode unmarshals the JSON body of the response into v.
+func decode(t *testing.T, rec *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("error decoding response body %q: %s", rec.Body.String(), err)
+	}
+}
+
+func TestWriteStoreError(t *testing.T) {
+	cases := []struct {
+		err      error
+		expected int
+	}{
+		{errors.Wrap(store.ErrConflict, "area profile exists"), http.StatusConflict},
+		{errors.Wrap(store.ErrMissingReference, "area does not exist"), http.StatusUnprocessableEntity},
+		{errors.Wrap(store.ErrInvalidValue, "not a whole number"), http.StatusUnprocessableEntity},
+		{errors.Wrap(store.ErrStatTypeNotActive, "deprecated"), http.StatusUnprocessableEntity},
+		{errors.Wrap(context.DeadlineExceeded, "error querying"), http.StatusGatewayTimeout},
+		{errors.Wrap(store.ErrConnUnavailable, "error acquiring connection"), http.StatusServiceUnavailable},
+		{errors.Wrap(context.Canceled, "error querying"), http.StatusServiceUnavailable},
+		{errors.New("boom"), http.StatusInternalServerError},
+	}
+
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		writeStoreError(rec, c.err, "test")
+
+		if rec.Code != c.expected {
+			t.Errorf("%q: expected status %d, got %d", c.err, c.expected, rec.Code)
+		}
+	}
+}
+
+func TestQueryTimeout(t *testing.T) {
+	r := Initalise(newTestStore(t), time.Nanosecond)
+
+	rec := serve(t, r, http.MethodGet, "/profiles/"+testAreaCode, nil)
+	expectStatus(t, rec, http.StatusGatewayTimeout)
+}
+
+func TestRequestCanceled(t *testing.T) {
+	r := Initalise(newTestStore(t), time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/profiles/"+testAreaCode, nil).WithContext(ctx))
+	expectStatus(t, rec, http.StatusServiceUnavailable)
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store"
+	log "github.com/daiLlew/funkylog"
+	"net/http"
+)
+
+// Health is the response entity for the health endpoint.
+type Health struct {
+	Status string          `json:"status"`
+	Error  string          `json:"error,omitempty"`
+	Pool   store.PoolStats `json:"pool"`
+}
+
+// GetHealthHandlerFunc HTTP handler returning the database status and a snapshot of the connection pool stats.
+func GetHealthHandlerFunc(db DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Info("handling %s request", "GET /health")
+
+		health := Health{Status: "OK"}
+		status := http.StatusOK
+
+		if err := db.Ping(r.Context()); err != nil {
+			log.Err("database health check failed: %s", err.Error())
+			health.Status = "UNAVAILABLE"
+			health.Error = err.Error()
+			status = http.StatusServiceUnavailable
+		}
+
+		health.Pool = db.PoolStats()
+
+		if err := writeEntity(w, health, status); err != nil {
+			log.Err("error writing health entity to response: %s", err.Error())
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+	}
+}
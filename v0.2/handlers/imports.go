@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store"
+	log "github.com/daiLlew/funkylog"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+// GetImportsHandlerFunc HTTP handler returns the imports ledger most recent first. The optional status query parameter
+// filters the list to the imports with the status.
+func GetImportsHandlerFunc(db DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Info("handling %s request", "GET /imports")
+
+		imports, err := db.GetImports(r.Context(), r.URL.Query().Get("status"))
+		if err != nil {
+			writeStoreError(w, err, "error getting imports")
+			return
+		}
+
+		if err := writeEntity(w, imports, http.StatusOK); err != nil {
+			log.Err("error writing imports entity to response: %s", err.Error())
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+	}
+}
+
+// GetImportHandlerFunc HTTP handler returns the import with the specified ID.
+func GetImportHandlerFunc(db DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Info("handling %s request", "GET /imports/{id}")
+
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "invalid import id", http.StatusBadRequest)
+			return
+		}
+
+		i, err := db.GetImport(r.Context(), id)
+		if err != nil {
+			if err == store.ErrNotFound {
+				http.Error(w, "import not found", http.StatusNotFound)
+				return
+			}
+
+			writeStoreError(w, err, "error querying for import")
+			return
+		}
+
+		if err := writeEntity(w, i, http.StatusOK); err != nil {
+			log.Err("error writing import entity to response: %s", err.Error())
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+	}
+}
@@ -1,10 +1,15 @@
 package handlers
 
 import (
+	"encoding/json"
+	"fmt"
 	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store"
 	log "github.com/daiLlew/funkylog"
 	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 // GetProfileStatsHandlerFunc HTTP handler returns the current key stats for the specified area profile.
@@ -18,21 +23,21 @@ func GetProfileStatsHandlerFunc(db DB) http.HandlerFunc {
 			return
 		}
 
-		profile, err := db.GetProfileByAreaCode(areaCode)
+		profile, err := db.GetProfileByAreaCode(r.Context(), areaCode)
 		if err != nil {
 			if err == store.ErrNotFound {
 				http.Error(w, "profile not found", http.StatusNotFound)
 				return
 			}
 
-			log.Err("error querying for profile: %s", err.Error())
-			http.Error(w, "internal server error", http.StatusInternalServerError)
+			writeStoreError(w, err, "error querying for profile")
+			return
 		}
 
-		stats, err := db.GetKeyStatsForProfile(profile)
+		stats, err := db.GetKeyStatsForProfile(r.Context(), profile)
 		if err != nil {
-			log.Err("error querying for profile stats: %s", err.Error())
-			http.Error(w, "internal server error", http.StatusInternalServerError)
+			writeStoreError(w, err, "error querying for profile stats")
+			return
 		}
 
 		if err := writeEntity(w, stats, http.StatusOK); err != nil {
@@ -41,3 +46,344 @@ func GetProfileStatsHandlerFunc(db DB) http.HandlerFunc {
 		}
 	}
 }
+
+// GetStatHistoryHandlerFunc HTTP handler returns every historical value of a single key stat of the specified area
+// profile. The stat type may be specified by ID or by name.
+func GetStatHistoryHandlerFunc(db DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Info("handling %s request", "GET /profiles/{area_code}/stats/{stat_type}/history")
+
+		areaCode := mux.Vars(r)["area_code"]
+		if areaCode == "" {
+			http.Error(w, "area code required but none provided", http.StatusBadRequest)
+			return
+		}
+
+		statTypeParam := mux.Vars(r)["stat_type"]
+		if statTypeParam == "" {
+			http.Error(w, "stat type required but none provided", http.StatusBadRequest)
+			return
+		}
+
+		profile, err := db.GetProfileByAreaCode(r.Context(), areaCode)
+		if err != nil {
+			if err == store.ErrNotFound {
+				http.Error(w, "profile not found", http.StatusNotFound)
+				return
+			}
+
+			writeStoreError(w, err, "error querying for profile")
+			return
+		}
+
+		statType, err := strconv.Atoi(statTypeParam)
+		if err != nil {
+			statType, err = db.GetStatTypeByName(r.Context(), statTypeParam)
+			if err != nil {
+				if errors.Is(err, store.ErrNotFound) {
+					http.Error(w, "stat type not found", http.StatusNotFound)
+					return
+				}
+
+				writeStoreError(w, err, "error querying for stat type")
+				return
+			}
+		}
+
+		history, err := db.GetKeyStatHistory(r.Context(), profile, statType)
+		if err != nil {
+			if err == store.ErrNotFound {
+				http.Error(w, "no history found for stat type", http.StatusNotFound)
+				return
+			}
+
+			writeStoreError(w, err, "error querying for stat history")
+			return
+		}
+
+		if err := writeEntity(w, history, http.StatusOK); err != nil {
+			log.Err("error writing stat history entity to response: %s", err.Error())
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+	}
+}
+
+// KeyStatRequest is a single key stat value in a write request. A blank unit defaults to the default unit of the key
+// stat type. A blank dataset name keeps the name of an existing dataset and names a new dataset by its ID, the same as
+// a blank dataset_name in a data file.
+type KeyStatRequest struct {
+	Name        string       `json:"name"`
+	Value       KeyStatValue `json:"value"`
+	Unit        string       `json:"unit"`
+	DatasetID   string       `json:"dataset_id"`
+	DatasetName string       `json:"dataset_name"`
+}
+
+// KeyStatValue is a key stat value in a write request. Values may be sent as a JSON number or as a string which is
+// parsed ignoring thousands separators and a trailing percent sign.
+type KeyStatValue struct {
+	raw    string
+	number bool
+}
+
+// UnmarshalJSON reads the value from a JSON number or string.
+func (v *KeyStatValue) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		v.raw, v.number = s, false
+		return nil
+	}
+
+	var n json.Number
+	if err := json.Unmarshal(b, &n); err != nil {
+		return errors.New("value must be a number or a string")
+	}
+
+	v.raw, v.number = n.String(), true
+	return nil
+}
+
+func (v KeyStatValue) parse() (float64, error) {
+	if v.number {
+		return strconv.ParseFloat(v.raw, 64)
+	}
+	return store.ParseValue(v.raw)
+}
+
+// KeyStatsRequest is the request body to add a batch of key stats to an area profile. Each batch creates a new version
+// of the profile's key stats.
+type KeyStatsRequest struct {
+	Label  string           `json:"label"`
+	Source string           `json:"source"`
+	Stats  []KeyStatRequest `json:"stats"`
+}
+
+// KeyStatUpdateRequest is the request body to update a single key stat of an area profile. The key stat name is taken
+// from the request path.
+type KeyStatUpdateRequest struct {
+	Label       string       `json:"label"`
+	Source      string       `json:"source"`
+	Value       KeyStatValue `json:"value"`
+	Unit        string       `json:"unit"`
+	DatasetID   string       `json:"dataset_id"`
+	DatasetName string       `json:"dataset_name"`
+}
+
+func (k KeyStatsRequest) validate() ValidationErrors {
+	var v ValidationErrors
+	v.maxLen("label", k.Label, 100)
+	v.maxLen("source", k.Source, 255)
+
+	if len(k.Stats) == 0 {
+		v.add("stats must contain at least one key stat")
+	}
+
+	names := make(map[string]bool)
+	for i, s := range k.Stats {
+		field := fmt.Sprintf("stats[%d]", i)
+		v.required(field+".name", s.Name)
+		v.maxLen(field+".name", s.Name, 100)
+		v.required(field+".value", s.Value.raw)
+		if _, err := s.Value.parse(); s.Value.raw != "" && err != nil {
+			v.add("%s.value %q is not a number", field, s.Value.raw)
+		}
+		v.maxLen(field+".unit", s.Unit, 25)
+		v.required(field+".dataset_id", s.DatasetID)
+		v.maxLen(field+".dataset_id", s.DatasetID, 100)
+		v.maxLen(field+".dataset_name", s.DatasetName, 100)
+
+		if names[s.Name] {
+			v.add("%s.name %q appears more than once", field, s.Name)
+		}
+		names[s.Name] = true
+	}
+
+	return v
+}
+
+// PostProfileStatsHandlerFunc HTTP handler adds a batch of key stats to the specified area profile. The batch is written
+// in a single transaction as a new key stats version which is returned in the response.
+func PostProfileStatsHandlerFunc(db DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Info("handling %s request", "POST /profiles/{area_code}/stats")
+
+		areaCode := mux.Vars(r)["area_code"]
+		if areaCode == "" {
+			http.Error(w, "area code required but none provided", http.StatusBadRequest)
+			return
+		}
+
+		var req KeyStatsRequest
+		if !readJSON(w, r, &req) {
+			return
+		}
+
+		writeKeyStats(w, r, db, areaCode, req, http.StatusCreated)
+	}
+}
+
+// PutProfileStatHandlerFunc HTTP handler updates a single key stat of the specified area profile, creating a new key
+// stats version. The stat type is specified by name.
+func PutProfileStatHandlerFunc(db DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Info("handling %s request", "PUT /profiles/{area_code}/stats/{stat_type}")
+
+		areaCode := mux.Vars(r)["area_code"]
+		if areaCode == "" {
+			http.Error(w, "area code required but none provided", http.StatusBadRequest)
+			return
+		}
+
+		statType := mux.Vars(r)["stat_type"]
+		if statType == "" {
+			http.Error(w, "stat type required but none provided", http.StatusBadRequest)
+			return
+		}
+
+		var req KeyStatUpdateRequest
+		if !readJSON(w, r, &req) {
+			return
+		}
+
+		batch := KeyStatsRequest{
+			Label:  req.Label,
+			Source: req.Source,
+			Stats: []KeyStatRequest{{
+				Name:        statType,
+				Value:       req.Value,
+				Unit:        req.Unit,
+				DatasetID:   req.DatasetID,
+				DatasetName: req.DatasetName,
+			}},
+		}
+
+		writeKeyStats(w, r, db, areaCode, batch, http.StatusOK)
+	}
+}
+
+// DeleteProfileStatsHandlerFunc HTTP handler deletes the current key stats of the specified area profile. The deletion
+// is recorded as a new, empty, key stats version, earlier versions and the key stats history are kept.
+func DeleteProfileStatsHandlerFunc(db DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Info("handling %s request", "DELETE /profiles/{area_code}/stats")
+
+		areaCode := mux.Vars(r)["area_code"]
+		if areaCode == "" {
+			http.Error(w, "area code required but none provided", http.StatusBadRequest)
+			return
+		}
+
+		if err := db.DeleteKeyStats(r.Context(), areaCode); err != nil {
+			if err == store.ErrNotFound {
+				http.Error(w, "profile not found", http.StatusNotFound)
+				return
+			}
+
+			writeStoreError(w, err, "error deleting profile stats")
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// writeKeyStats validates the key stats and inserts them as a new version of the area profile's key stats. The new
+// version is written to the response.
+func writeKeyStats(w http.ResponseWriter, r *http.Request, db DB, areaCode string, req KeyStatsRequest, status int) {
+	if _, err := db.GetProfileByAreaCode(r.Context(), areaCode); err != nil {
+		if err == store.ErrNotFound {
+			http.Error(w, "profile not found", http.StatusNotFound)
+			return
+		}
+
+		writeStoreError(w, err, "error querying for profile")
+		return
+	}
+
+	v := req.validate()
+	for i, s := range req.Stats {
+		if s.Name == "" {
+			continue
+		}
+
+		id, err := db.GetStatTypeByName(r.Context(), s.Name)
+		if err != nil {
+			if !errors.Is(err, store.ErrNotFound) {
+				writeStoreError(w, err, "error querying for stat type")
+				return
+			}
+			v.add("stats[%d].name %q is not a known key stat type", i, s.Name)
+			continue
+		}
+
+		reason, err := inactiveStatTypeReason(r, db, id)
+		if err != nil {
+			writeStoreError(w, err, "error querying for stat type")
+			return
+		}
+
+		if reason != "" {
+			v.add("stats[%d].name %s, values can only be written for active key stat types", i, reason)
+		}
+	}
+
+	if v.hasErrors() {
+		writeValidationErrors(w, v)
+		return
+	}
+
+	var version *store.KeyStatVersion
+	created := time.Now()
+
+	err := db.InTransaction(r.Context(), func(tx store.Tx) error {
+		var err error
+		version, err = tx.CreateKeyStatsVersion(r.Context(), areaCode, req.Label, req.Source, created)
+		if err != nil {
+			return err
+		}
+
+		for _, s := range req.Stats {
+			value, err := s.Value.parse()
+			if err != nil {
+				return errors.Wrapf(store.ErrInvalidValue, "value %q of key stat %q is not a number", s.Value.raw, s.Name)
+			}
+
+			if _, err := tx.InsertKeyStat(r.Context(), areaCode, s.Name, value, s.Unit, s.DatasetID, s.DatasetName, created); err != nil {
+				return errors.Wrapf(err, "error inserting key stat %q", s.Name)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		writeStoreError(w, err, "error inserting profile stats")
+		return
+	}
+
+	if err := writeEntity(w, version, status); err != nil {
+		log.Err("error writing key stats version entity to response: %s", err.Error())
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+// inactiveStatTypeReason returns why values of the key stat type cannot be written if it is deprecated or replaced,
+// blank if it is active.
+func inactiveStatTypeReason(r *http.Request, db DB, id int) (string, error) {
+	t, err := db.GetStatTypeByID(r.Context(), id)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case t.Status == store.StatTypeReplaced && t.ReplacedBy != nil:
+		replacement, err := db.GetStatTypeByID(r.Context(), *t.ReplacedBy)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%q is replaced by %q", t.Name, replacement.Name), nil
+	case t.Status != "" && t.Status != store.StatTypeActive:
+		return fmt.Sprintf("%q is %s", t.Name, t.Status), nil
+	default:
+		return "", nil
+	}
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store"
+	log "github.com/daiLlew/funkylog"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+// KeyStatsVersionsDiff is the response entity for the key stats versions diff endpoint.
+type KeyStatsVersionsDiff struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	store.KeyStatsDiff
+}
+
+// GetStatsVersionsDiffHandlerFunc HTTP handler func returning the key stats added, removed and changed between two
+// versions of an area profile.
+func GetStatsVersionsDiffHandlerFunc(db DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Info("handling %s request", "GET /profiles/{area_code}/stats/versions/{from}/diff/{to}")
+
+		vars := mux.Vars(r)
+
+		areaCode := vars["area_code"]
+		if areaCode == "" {
+			http.Error(w, "area code required but none provided", http.StatusBadRequest)
+			return
+		}
+
+		from, to := vars["from"], vars["to"]
+		if from == "" || to == "" {
+			http.Error(w, "from and to versions required but none provided", http.StatusBadRequest)
+			return
+		}
+
+		profile, err := db.GetProfileByAreaCode(r.Context(), areaCode)
+		if err != nil {
+			if err == store.ErrNotFound {
+				http.Error(w, "profile not found", http.StatusNotFound)
+				return
+			}
+
+			writeStoreError(w, err, "error querying for profile")
+			return
+		}
+
+		fromStats, ok := getVersionStats(w, r, db, profile, from)
+		if !ok {
+			return
+		}
+
+		toStats, ok := getVersionStats(w, r, db, profile, to)
+		if !ok {
+			return
+		}
+
+		diff := KeyStatsVersionsDiff{
+			From:         from,
+			To:           to,
+			KeyStatsDiff: store.DiffKeyStatistics(profile.AreaCode, fromStats, toStats),
+		}
+
+		if err := writeEntity(w, diff, http.StatusOK); err != nil {
+			log.Err("error writing versions diff entity to response: %s", err.Error())
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+	}
+}
+
+// getVersionStats returns the key stats of the specified version of the profile. If the version cannot be found an
+// error response is written and false returned.
+func getVersionStats(w http.ResponseWriter, r *http.Request, db DB, profile *store.AreaProfile, version string) (store.KeyStatistics, bool) {
+	date, err := resolveVersion(r.Context(), db, profile, version)
+	if err != nil {
+		writeVersionError(w, err, version)
+		return nil, false
+	}
+
+	stats, err := db.GetKeyStatsVersion(r.Context(), profile, date)
+	if err != nil {
+		writeStoreError(w, err, "error querying for stats version")
+		return nil, false
+	}
+
+	return stats, true
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// stat returns a key stat of a write request body.
+func stat(name string, value interface{}, unit string) map[string]interface{} {
+	return map[string]interface{}{"name": name, "value": value, "unit": unit, "dataset_id": "TS001", "dataset_name": "Census 2021"}
+}
+
+// postStats adds a batch of key stats to the test area profile and returns the key stats version created.
+func postStats(t *testing.T, h http.Handler, stats ...map[string]interface{}) store.KeyStatVersion {
+	t.Helper()
+
+	rec := serve(t, h, http.MethodPost, "/profiles/"+testAreaCode+"/stats", map[string]interface{}{"label": "test", "stats": stats})
+	expectStatus(t, rec, http.StatusCreated)
+
+	var v store.KeyStatVersion
+	decode(t, rec, &v)
+	return v
+}
+
+func TestPostProfileStats(t *testing.T) {
+	r := Initalise(newTestStore(t), time.Minute)
+
+	v := postStats(t, r, stat("Resident population", 100, ""), stat("Average (mean) age", "40.5", "years"))
+	if v.Version != 1 || v.Label != "test" {
+		t.Errorf("expected version 1 labelled %q, got %+v", "test", v)
+	}
+
+	rec := serve(t, r, http.MethodGet, "/profiles/"+testAreaCode+"/stats", nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	var stats store.KeyStatistics
+	decode(t, rec, &stats)
+
+	if len(stats) != 2 {
+		t.Fatalf("expected 2 key stats, got %+v", stats)
+	}
+}
+
+func TestPostProfileStatsBlankDatasetName(t *testing.T) {
+	r := Initalise(newTestStore(t), time.Minute)
+
+	// a new dataset is named by its ID.
+	postStats(t, r, map[string]interface{}{"name": "Resident population", "value": 100, "dataset_id": "TS001"})
+	expectDatasetName(t, r, "TS001", "TS001")
+
+	// a blank name keeps the name of the existing dataset.
+	postStats(t, r, stat("Resident population", 110, ""))
+	postStats(t, r, map[string]interface{}{"name": "Resident population", "value": 120, "dataset_id": "TS001", "dataset_name": ""})
+	expectDatasetName(t, r, "TS001", "Census 2021")
+}
+
+// expectDatasetName fails the test if the dataset does not have the expected name.
+func expectDatasetName(t *testing.T, h http.Handler, id, expected string) {
+	t.Helper()
+
+	rec := serve(t, h, http.MethodGet, "/datasets/"+id, nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	var d store.Dataset
+	decode(t, rec, &d)
+
+	if d.Name != expected {
+		t.Errorf("expected dataset %q to be named %q, got %q", id, expected, d.Name)
+	}
+}
+
+func TestPostProfileStatsNotFound(t *testing.T) {
+	r := Initalise(newTestStore(t), time.Minute)
+
+	body := map[string]interface{}{"stats": []interface{}{stat("Resident population", 100, "")}}
+	rec := serve(t, r, http.MethodPost, "/profiles/E05000001/stats", body)
+	expectStatus(t, rec, http.StatusNotFound)
+}
+
+func TestPostProfileStatsUnprocessable(t *testing.T) {
+	cases := map[string]map[string]interface{}{
+		"unknown stat type":   stat("Median age", 40, "years"),
+		"not a number":        stat("Resident population", "lots", ""),
+		"invalid value":       stat("Resident population", 100.5, ""),
+		"unknown unit":        stat("Resident population", 100, "furlongs"),
+		"missing dataset":     {"name": "Resident population", "value": 100},
+		"percentage over 100": stat("People think their general health is good", 101, "%"),
+	}
+
+	for name, s := range cases {
+		t.Run(name, func(t *testing.T) {
+			r := Initalise(newTestStore(t), time.Minute)
+
+			body := map[string]interface{}{"stats": []interface{}{s}}
+			rec := serve(t, r, http.MethodPost, "/profiles/"+testAreaCode+"/stats", body)
+			expectStatus(t, rec, http.StatusUnprocessableEntity)
+
+			// nothing is written.
+			rec = serve(t, r, http.MethodGet, "/profiles/"+testAreaCode+"/stats/versions", nil)
+			expectStatus(t, rec, http.StatusOK)
+
+			var versions store.KeyStatisticVersions
+			decode(t, rec, &versions)
+
+			if len(versions.Versions) != 0 {
+				t.Errorf("expected no key stats versions, got %+v", versions.Versions)
+			}
+		})
+	}
+}
+
+func TestPutProfileStat(t *testing.T) {
+	r := Initalise(newTestStore(t), time.Minute)
+	postStats(t, r, stat("Resident population", 100, ""))
+
+	body := map[string]interface{}{"value": 150, "dataset_id": "TS001", "dataset_name": "Census 2021"}
+	rec := serve(t, r, http.MethodPut, "/profiles/"+testAreaCode+"/stats/Resident%20population", body)
+	expectStatus(t, rec, http.StatusOK)
+
+	var v store.KeyStatVersion
+	decode(t, rec, &v)
+
+	if v.Version != 2 {
+		t.Errorf("expected version 2, got %+v", v)
+	}
+}
+
+func TestGetStatHistory(t *testing.T) {
+	r := Initalise(newTestStore(t), time.Minute)
+	postStats(t, r, stat("Resident population", 100, ""))
+	postStats(t, r, stat("Resident population", 150, ""))
+
+	rec := serve(t, r, http.MethodGet, "/profiles/"+testAreaCode+"/stats/Resident%20population/history", nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	var history store.KeyStatHistory
+	decode(t, rec, &history)
+
+	if len(history.History) != 2 {
+		t.Fatalf("expected 2 history entries, got %+v", history.History)
+	}
+
+	first, second := history.History[0], history.History[1]
+	if first.Value != 100 || second.Value != 150 {
+		t.Errorf("expected the values 100 then 150, got %v then %v", first.Value, second.Value)
+	}
+
+	if second.AbsoluteChange == nil || *second.AbsoluteChange != 50 || second.PercentageChange == nil || *second.PercentageChange != 50 {
+		t.Errorf("expected a change of 50 (50%%), got %+v", second)
+	}
+
+	rec = serve(t, r, http.MethodGet, "/profiles/"+testAreaCode+"/stats/Median%20age/history", nil)
+	expectStatus(t, rec, http.StatusNotFound)
+}
@@ -1,12 +1,20 @@
 package handlers
 
 import (
+	"context"
+	"fmt"
 	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store"
 	log "github.com/daiLlew/funkylog"
 	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
 	"net/http"
+	"strconv"
+	"time"
 )
 
+// errInvalidVersion is returned when a version is not a version number, the "latest" alias or a timestamp.
+var errInvalidVersion = errors.New("invalid version")
+
 // GetStatsVersionsHandlerFunc HTTP handler func returns a list of available key status versions for the specified area code.
 func GetStatsVersionsHandlerFunc(db DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -18,21 +26,21 @@ func GetStatsVersionsHandlerFunc(db DB) http.HandlerFunc {
 			return
 		}
 
-		profile, err := db.GetProfileByAreaCode(areaCode)
+		profile, err := db.GetProfileByAreaCode(r.Context(), areaCode)
 		if err != nil {
 			if err == store.ErrNotFound {
 				http.Error(w, "profile not found", http.StatusNotFound)
 				return
 			}
 
-			log.Err("error querying for profile: %s", err.Error())
-			http.Error(w, "internal server error", http.StatusInternalServerError)
+			writeStoreError(w, err, "error querying for profile")
+			return
 		}
 
-		versionsList, err := db.GetKeyStatsVersionsForProfile(profile)
+		versionsList, err := db.GetKeyStatsVersionsForProfile(r.Context(), profile)
 		if err != nil {
-			log.Err("error querying for profile stats versions: %s", err.Error())
-			http.Error(w, "internal server error", http.StatusInternalServerError)
+			writeStoreError(w, err, "error querying for profile stats versions")
+			return
 		}
 
 		versions := store.KeyStatisticVersions{
@@ -64,21 +72,27 @@ func GetStatsVersionHandlerFunc(db DB) http.HandlerFunc {
 			return
 		}
 
-		profile, err := db.GetProfileByAreaCode(areaCode)
+		profile, err := db.GetProfileByAreaCode(r.Context(), areaCode)
 		if err != nil {
 			if err == store.ErrNotFound {
 				http.Error(w, "profile not found", http.StatusNotFound)
 				return
 			}
 
-			log.Err("error querying for profile: %s", err.Error())
-			http.Error(w, "internal server error", http.StatusInternalServerError)
+			writeStoreError(w, err, "error querying for profile")
+			return
 		}
 
-		stats, err := db.GetKeyStatsVersion(profile, version)
+		date, err := resolveVersion(r.Context(), db, profile, version)
 		if err != nil {
-			log.Err("error querying for stats version: %s", err.Error())
-			http.Error(w, "internal server error", http.StatusInternalServerError)
+			writeVersionError(w, err, version)
+			return
+		}
+
+		stats, err := db.GetKeyStatsVersion(r.Context(), profile, date)
+		if err != nil {
+			writeStoreError(w, err, "error querying for stats version")
+			return
 		}
 
 		if err := writeEntity(w, stats, http.StatusOK); err != nil {
@@ -87,3 +101,42 @@ func GetStatsVersionHandlerFunc(db DB) http.HandlerFunc {
 		}
 	}
 }
+
+// resolveVersion returns the timestamp of the key stats version identified by ref. ref may be a version number, the
+// "latest" alias or, for backwards compatibility, a version timestamp.
+func resolveVersion(ctx context.Context, db DB, profile *store.AreaProfile, ref string) (time.Time, error) {
+	if ref == store.LatestVersion {
+		v, err := db.GetLatestKeyStatsVersion(ctx, profile)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return v.DateCreated, nil
+	}
+
+	if number, err := strconv.Atoi(ref); err == nil {
+		v, err := db.GetKeyStatsVersionByNumber(ctx, profile, number)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return v.DateCreated, nil
+	}
+
+	date, err := store.ParseVersionTimestamp(ref)
+	if err != nil {
+		return time.Time{}, errInvalidVersion
+	}
+
+	return date, nil
+}
+
+// writeVersionError writes an error response for an error returned by resolveVersion.
+func writeVersionError(w http.ResponseWriter, err error, version string) {
+	switch err {
+	case store.ErrNotFound:
+		http.Error(w, fmt.Sprintf("version %q not found", version), http.StatusNotFound)
+	case errInvalidVersion:
+		http.Error(w, fmt.Sprintf("invalid version %q, expected a version number, %q or a version timestamp", version, store.LatestVersion), http.StatusBadRequest)
+	default:
+		writeStoreError(w, err, "error resolving stats version")
+	}
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// versionValue returns the value of the named key stat in the key stats version of the test area profile.
+func versionValue(t *testing.T, h http.Handler, version, name string) float64 {
+	t.Helper()
+
+	rec := serve(t, h, http.MethodGet, "/profiles/"+testAreaCode+"/stats/versions/"+version, nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	var stats store.KeyStatistics
+	decode(t, rec, &stats)
+
+	for _, s := range stats {
+		if s.Name == name {
+			return s.Value
+		}
+	}
+
+	t.Fatalf("version %s has no %q key stat: %+v", version, name, stats)
+	return 0
+}
+
+func TestGetStatsVersions(t *testing.T) {
+	r := Initalise(newTestStore(t), time.Minute)
+	postStats(t, r, stat("Resident population", 100, ""))
+	postStats(t, r, stat("Resident population", 150, ""))
+
+	rec := serve(t, r, http.MethodGet, "/profiles/"+testAreaCode+"/stats/versions", nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	var versions store.KeyStatisticVersions
+	decode(t, rec, &versions)
+
+	if len(versions.Versions) != 2 || versions.Versions[0].Version != 2 || versions.Versions[1].Version != 1 {
+		t.Fatalf("expected versions 2 and 1, most recent first, got %+v", versions.Versions)
+	}
+}
+
+func TestGetStatsVersion(t *testing.T) {
+	r := Initalise(newTestStore(t), time.Minute)
+	first := postStats(t, r, stat("Resident population", 100, ""))
+	postStats(t, r, stat("Resident population", 150, ""))
+
+	if v := versionValue(t, r, "1", "Resident population"); v != 100 {
+		t.Errorf("version 1: expected 100, got %v", v)
+	}
+
+	if v := versionValue(t, r, "2", "Resident population"); v != 150 {
+		t.Errorf("version 2: expected 150, got %v", v)
+	}
+
+	if v := versionValue(t, r, store.LatestVersion, "Resident population"); v != 150 {
+		t.Errorf("latest version: expected 150, got %v", v)
+	}
+
+	timestamp := url.PathEscape(first.DateCreated.Format(time.RFC3339Nano))
+	if v := versionValue(t, r, timestamp, "Resident population"); v != 100 {
+		t.Errorf("version %s: expected 100, got %v", timestamp, v)
+	}
+
+	rec := serve(t, r, http.MethodGet, "/profiles/"+testAreaCode+"/stats/versions/3", nil)
+	expectStatus(t, rec, http.StatusNotFound)
+
+	rec = serve(t, r, http.MethodGet, "/profiles/"+testAreaCode+"/stats/versions/first", nil)
+	expectStatus(t, rec, http.StatusBadRequest)
+}
+
+func TestGetStatsVersionsDiff(t *testing.T) {
+	r := Initalise(newTestStore(t), time.Minute)
+	postStats(t, r, stat("Resident population", 100, ""), stat("Average (mean) age", 40, "years"), stat("Population density (Hectares)", 2, ""))
+	postStats(t, r, stat("Resident population", 150, ""), stat("Households where English is not the main language", 12.5, "%"))
+
+	rec := serve(t, r, http.MethodGet, "/profiles/"+testAreaCode+"/stats/versions/1/diff/latest", nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	var diff KeyStatsVersionsDiff
+	decode(t, rec, &diff)
+
+	if diff.From != "1" || diff.To != store.LatestVersion {
+		t.Errorf("expected the diff from 1 to latest, got %q to %q", diff.From, diff.To)
+	}
+
+	if len(diff.Added) != 1 || diff.Added[0].Name != "Households where English is not the main language" {
+		t.Errorf("expected 1 added key stat, got %+v", diff.Added)
+	}
+
+	if len(diff.Changed) != 1 || diff.Changed[0].OldValue != 100 || diff.Changed[0].NewValue != 150 {
+		t.Errorf("expected Resident population changed from 100 to 150, got %+v", diff.Changed)
+	}
+
+	if len(diff.Unchanged) != 2 || len(diff.Removed) != 0 {
+		t.Errorf("expected 2 unchanged and no removed key stats, got %+v and %+v", diff.Unchanged, diff.Removed)
+	}
+
+	rec = serve(t, r, http.MethodGet, "/profiles/"+testAreaCode+"/stats/versions/1/diff/3", nil)
+	expectStatus(t, rec, http.StatusNotFound)
+}
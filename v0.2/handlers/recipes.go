@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store"
+	log "github.com/daiLlew/funkylog"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+// RecipeRequest is the request body to create or update a key stats recipe. The stat type may be specified by type_id
+// or name and each geography by geography type name or code. ID is ignored, the recipe ID is taken from the request path
+// on update.
+type RecipeRequest struct {
+	ID             int               `json:"id"`
+	DatasetID      string            `json:"dataset_id"`
+	DatasetEdition string            `json:"dataset_edition"`
+	Query          string            `json:"query"`
+	StatType       store.KeyStatType `json:"stat_type"`
+	Geographies    []string          `json:"geographies"`
+}
+
+func (req RecipeRequest) validate() ValidationErrors {
+	var v ValidationErrors
+	v.required("dataset_id", req.DatasetID)
+	v.maxLen("dataset_id", req.DatasetID, 100)
+	v.required("dataset_edition", req.DatasetEdition)
+	v.maxLen("dataset_edition", req.DatasetEdition, 100)
+	v.required("query", req.Query)
+
+	if req.StatType.ID == 0 && req.StatType.Name == "" {
+		v.add("stat_type.type_id or stat_type.name is required")
+	}
+
+	if len(req.Geographies) == 0 {
+		v.add("geographies must contain at least one geography type")
+	}
+
+	for i, g := range req.Geographies {
+		v.required("geographies["+strconv.Itoa(i)+"]", g)
+	}
+
+	return v
+}
+
+func (req RecipeRequest) toRecipe(id int) store.KeyStatsRecipe {
+	return store.KeyStatsRecipe{
+		ID:              id,
+		DatasetID:       req.DatasetID,
+		DatasetEdition:  req.DatasetEdition,
+		CantabularQuery: req.Query,
+		StatType:        req.StatType,
+		Geographies:     req.Geographies,
+	}
+}
+
+// GetRecipesHandlerFunc HTTP handler returns a list of key stats recipes. The optional dataset_id and edition query
+// parameters filter the list to the recipes for a dataset/edition.
+func GetRecipesHandlerFunc(db DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Info("handling %s request", "GET /recipes")
+
+		datasetID := r.URL.Query().Get("dataset_id")
+		edition := r.URL.Query().Get("edition")
+
+		recipes, err := db.GetRecipes(r.Context(), datasetID, edition)
+		if err != nil {
+			writeStoreError(w, err, "error getting recipes list")
+			return
+		}
+
+		if err := writeEntity(w, recipes, http.StatusOK); err != nil {
+			log.Err("error writing recipes entity to response: %s", err.Error())
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+	}
+}
+
+// GetRecipeHandlerFunc HTTP handler returns the key stats recipe with the specified ID.
+func GetRecipeHandlerFunc(db DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Info("handling %s request", "GET /recipes/{id}")
+
+		id, ok := recipeID(w, r)
+		if !ok {
+			return
+		}
+
+		writeRecipe(w, r, db, id, http.StatusOK)
+	}
+}
+
+// PostRecipeHandlerFunc HTTP handler creates a new key stats recipe. Returns 422 if the stat type or any of the
+// geography types do not exist.
+func PostRecipeHandlerFunc(db DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Info("handling %s request", "POST /recipes")
+
+		var req RecipeRequest
+		if !readJSON(w, r, &req) {
+			return
+		}
+
+		if v := req.validate(); v.hasErrors() {
+			writeValidationErrors(w, v)
+			return
+		}
+
+		id, err := db.AddRecipe(r.Context(), req.toRecipe(0))
+		if err != nil {
+			writeStoreError(w, err, "error adding recipe")
+			return
+		}
+
+		writeRecipe(w, r, db, id, http.StatusCreated)
+	}
+}
+
+// PutRecipeHandlerFunc HTTP handler replaces the key stats recipe with the specified ID.
+func PutRecipeHandlerFunc(db DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Info("handling %s request", "PUT /recipes/{id}")
+
+		id, ok := recipeID(w, r)
+		if !ok {
+			return
+		}
+
+		var req RecipeRequest
+		if !readJSON(w, r, &req) {
+			return
+		}
+
+		if v := req.validate(); v.hasErrors() {
+			writeValidationErrors(w, v)
+			return
+		}
+
+		if err := db.UpdateRecipe(r.Context(), req.toRecipe(id)); err != nil {
+			if err == store.ErrNotFound {
+				http.Error(w, "recipe not found", http.StatusNotFound)
+				return
+			}
+
+			writeStoreError(w, err, "error updating recipe")
+			return
+		}
+
+		writeRecipe(w, r, db, id, http.StatusOK)
+	}
+}
+
+// DeleteRecipeHandlerFunc HTTP handler deletes the key stats recipe with the specified ID.
+func DeleteRecipeHandlerFunc(db DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Info("handling %s request", "DELETE /recipes/{id}")
+
+		id, ok := recipeID(w, r)
+		if !ok {
+			return
+		}
+
+		if err := db.DeleteRecipe(r.Context(), id); err != nil {
+			if err == store.ErrNotFound {
+				http.Error(w, "recipe not found", http.StatusNotFound)
+				return
+			}
+
+			writeStoreError(w, err, "error deleting recipe")
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// recipeID returns the recipe ID from the request path. Returns false and writes a 400 response if the ID is invalid.
+func recipeID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid recipe id", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// writeRecipe writes the current state of the recipe to the response.
+func writeRecipe(w http.ResponseWriter, r *http.Request, db DB, id, status int) {
+	recipe, err := db.GetRecipe(r.Context(), id)
+	if err != nil {
+		if err == store.ErrNotFound {
+			http.Error(w, "recipe not found", http.StatusNotFound)
+			return
+		}
+
+		writeStoreError(w, err, "error querying for recipe")
+		return
+	}
+
+	if err := writeEntity(w, recipe, status); err != nil {
+		log.Err("error writing recipe entity to response: %s", err.Error())
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPostRecipeSample(t *testing.T) {
+	r := Initalise(newTestStore(t), time.Minute)
+
+	b, err := os.ReadFile("../../v0.5/j.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serve(t, r, http.MethodPost, "/recipes", json.RawMessage(b))
+	expectStatus(t, rec, http.StatusCreated)
+
+	var recipe store.KeyStatsRecipe
+	decode(t, rec, &recipe)
+
+	if recipe.StatType.Name != "Resident population" {
+		t.Errorf("expected the stat type to be matched by name, got %+v", recipe.StatType)
+	}
+
+	if expected := []string{"lower layer super output area"}; !reflect.DeepEqual(recipe.Geographies, expected) {
+		t.Errorf("expected geographies %v, got %v", expected, recipe.Geographies)
+	}
+}
+
+// recipe returns a key stats recipe request body.
+func recipe(statType store.KeyStatType, geographies ...string) RecipeRequest {
+	return RecipeRequest{
+		DatasetID:      "TS001",
+		DatasetEdition: "2021",
+		Query:          "select * from some_table where geography_type = $1;",
+		StatType:       statType,
+		Geographies:    geographies,
+	}
+}
+
+func TestPostRecipeUnprocessable(t *testing.T) {
+	cases := map[string]func(req *RecipeRequest){
+		"missing dataset_id":      func(req *RecipeRequest) { req.DatasetID = "" },
+		"dataset_id too long":     func(req *RecipeRequest) { req.DatasetID = strings.Repeat("a", 101) },
+		"missing dataset_edition": func(req *RecipeRequest) { req.DatasetEdition = " " },
+		"missing query":           func(req *RecipeRequest) { req.Query = "" },
+		"missing stat type":       func(req *RecipeRequest) { req.StatType = store.KeyStatType{} },
+		"unknown stat type":       func(req *RecipeRequest) { req.StatType = store.KeyStatType{ID: 1, Name: "Median age"} },
+		"no geographies":          func(req *RecipeRequest) { req.Geographies = nil },
+		"blank geography":         func(req *RecipeRequest) { req.Geographies = []string{"LSOA", ""} },
+		"unknown geography":       func(req *RecipeRequest) { req.Geographies = []string{"lower output area"} },
+	}
+
+	for name, modify := range cases {
+		t.Run(name, func(t *testing.T) {
+			r := Initalise(newTestStore(t), time.Minute)
+
+			req := recipe(store.KeyStatType{Name: "Resident population"}, "LSOA")
+			modify(&req)
+
+			rec := serve(t, r, http.MethodPost, "/recipes", req)
+			expectStatus(t, rec, http.StatusUnprocessableEntity)
+
+			// nothing is written.
+			rec = serve(t, r, http.MethodGet, "/recipes", nil)
+			expectStatus(t, rec, http.StatusOK)
+
+			var recipes []store.KeyStatsRecipe
+			decode(t, rec, &recipes)
+
+			if len(recipes) != 0 {
+				t.Errorf("expected no recipes, got %+v", recipes)
+			}
+		})
+	}
+}
+
+func TestPostRecipeUnknownField(t *testing.T) {
+	r := Initalise(newTestStore(t), time.Minute)
+
+	rec := serve(t, r, http.MethodPost, "/recipes", map[string]interface{}{"dataset": "TS001"})
+	expectStatus(t, rec, http.StatusBadRequest)
+}
+
+func TestPutRecipe(t *testing.T) {
+	r := Initalise(newTestStore(t), time.Minute)
+
+	rec := serve(t, r, http.MethodPost, "/recipes", recipe(store.KeyStatType{Name: "Resident population"}, "LSOA", "MSOA"))
+	expectStatus(t, rec, http.StatusCreated)
+
+	var created store.KeyStatsRecipe
+	decode(t, rec, &created)
+	path := "/recipes/" + strconv.Itoa(created.ID)
+
+	// the stat type ID takes precedence over the name.
+	rec = serve(t, r, http.MethodPut, path, recipe(store.KeyStatType{ID: created.StatType.ID, Name: "Average (mean) age"}, "OA"))
+	expectStatus(t, rec, http.StatusOK)
+
+	var updated store.KeyStatsRecipe
+	decode(t, rec, &updated)
+
+	if updated.ID != created.ID || updated.StatType.Name != "Resident population" {
+		t.Errorf("expected recipe %d for stat type %q, got %+v", created.ID, "Resident population", updated)
+	}
+
+	if expected := []string{"output area"}; !reflect.DeepEqual(updated.Geographies, expected) {
+		t.Errorf("expected geographies %v, got %v", expected, updated.Geographies)
+	}
+
+	// an invalid update leaves the recipe unchanged.
+	rec = serve(t, r, http.MethodPut, path, recipe(store.KeyStatType{Name: "Resident population"}, "lower output area"))
+	expectStatus(t, rec, http.StatusUnprocessableEntity)
+
+	rec = serve(t, r, http.MethodGet, path, nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	var current store.KeyStatsRecipe
+	decode(t, rec, &current)
+
+	if !reflect.DeepEqual(current, updated) {
+		t.Errorf("expected recipe %+v, got %+v", updated, current)
+	}
+}
+
+func TestRecipeNotFound(t *testing.T) {
+	r := Initalise(newTestStore(t), time.Minute)
+
+	expectStatus(t, serve(t, r, http.MethodGet, "/recipes/1000", nil), http.StatusNotFound)
+	expectStatus(t, serve(t, r, http.MethodPut, "/recipes/1000", recipe(store.KeyStatType{Name: "Resident population"}, "LSOA")), http.StatusNotFound)
+	expectStatus(t, serve(t, r, http.MethodDelete, "/recipes/1000", nil), http.StatusNotFound)
+	expectStatus(t, serve(t, r, http.MethodGet, "/recipes/abc", nil), http.StatusBadRequest)
+}
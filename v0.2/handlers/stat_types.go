@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store"
+	log "github.com/daiLlew/funkylog"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// StatTypeRequest is the request body to create a key stat type. A display order of 0 places the new type after the
+// existing types, a blank status defaults to active and a blank value type defaults to count.
+type StatTypeRequest struct {
+	Name         string `json:"name"`
+	Description  string `json:"description"`
+	Category     string `json:"category"`
+	DefaultUnit  string `json:"default_unit"`
+	DisplayOrder int    `json:"display_order"`
+	Status       string `json:"status"`
+	ReplacedBy   *int   `json:"replaced_by"`
+	ValueType    string `json:"value_type"`
+	Precision    int    `json:"precision"`
+}
+
+func (req StatTypeRequest) toStatType() store.KeyStatType {
+	status := req.Status
+	if status == "" {
+		status = store.StatTypeActive
+	}
+
+	valueType := req.ValueType
+	if valueType == "" {
+		valueType = store.ValueTypeCount
+	}
+
+	return store.KeyStatType{
+		Name:         req.Name,
+		Description:  req.Description,
+		Category:     req.Category,
+		DefaultUnit:  req.DefaultUnit,
+		DisplayOrder: req.DisplayOrder,
+		Status:       status,
+		ReplacedBy:   req.ReplacedBy,
+		ValueType:    valueType,
+		Precision:    req.Precision,
+	}
+}
+
+// StatTypePatchRequest is the request body to update a key stat type. Only the fields present in the request are
+// updated. Setting a status other than replaced clears replaced_by.
+type StatTypePatchRequest struct {
+	Name         *string `json:"name"`
+	Description  *string `json:"description"`
+	Category     *string `json:"category"`
+	DefaultUnit  *string `json:"default_unit"`
+	DisplayOrder *int    `json:"display_order"`
+	Status       *string `json:"status"`
+	ReplacedBy   *int    `json:"replaced_by"`
+	ValueType    *string `json:"value_type"`
+	Precision    *int    `json:"precision"`
+}
+
+// apply returns a copy of the key stat type with the patch applied.
+func (req StatTypePatchRequest) apply(t store.KeyStatType) store.KeyStatType {
+	if req.Name != nil {
+		t.Name = *req.Name
+	}
+	if req.Description != nil {
+		t.Description = *req.Description
+	}
+	if req.Category != nil {
+		t.Category = *req.Category
+	}
+	if req.DefaultUnit != nil {
+		t.DefaultUnit = *req.DefaultUnit
+	}
+	if req.DisplayOrder != nil {
+		t.DisplayOrder = *req.DisplayOrder
+	}
+	if req.Status != nil {
+		t.Status = *req.Status
+		if t.Status != store.StatTypeReplaced {
+			t.ReplacedBy = nil
+		}
+	}
+	if req.ReplacedBy != nil {
+		t.ReplacedBy = req.ReplacedBy
+	}
+	if req.ValueType != nil {
+		t.ValueType = *req.ValueType
+	}
+	if req.Precision != nil {
+		t.Precision = *req.Precision
+	}
+	return t
+}
+
+// validateStatType validates a key stat type to be written.
+func validateStatType(t store.KeyStatType) ValidationErrors {
+	var v ValidationErrors
+	v.required("name", t.Name)
+	v.maxLen("name", t.Name, 100)
+	v.maxLen("category", t.Category, 100)
+	v.maxLen("default_unit", t.DefaultUnit, 25)
+
+	if t.DisplayOrder < 0 {
+		v.add("display_order must be 0 or greater")
+	}
+
+	valid := false
+	for _, s := range store.StatTypeStatuses() {
+		valid = valid || t.Status == s
+	}
+
+	if !valid {
+		v.add("status must be one of %s", strings.Join(store.StatTypeStatuses(), ", "))
+	}
+
+	if t.Status == store.StatTypeReplaced && t.ReplacedBy == nil {
+		v.add("replaced_by is required if status is %s", store.StatTypeReplaced)
+	}
+
+	if t.Status != store.StatTypeReplaced && t.ReplacedBy != nil {
+		v.add("replaced_by is only allowed if status is %s", store.StatTypeReplaced)
+	}
+
+	if t.ReplacedBy != nil && *t.ReplacedBy == t.ID {
+		v.add("replaced_by must not be the stat type itself")
+	}
+
+	valid = false
+	for _, vt := range store.ValueTypes() {
+		valid = valid || t.ValueType == vt
+	}
+
+	if !valid {
+		v.add("value_type must be one of %s", strings.Join(store.ValueTypes(), ", "))
+	}
+
+	if t.Precision < 0 || t.Precision > store.MaxPrecision {
+		v.add("precision must be between 0 and %d", store.MaxPrecision)
+	}
+
+	return v
+}
+
+// GetStatTypesHandlerFunc HTTP handler returns the key stat types in display order. The optional status query parameter
+// filters the list to the key stat types with the status.
+func GetStatTypesHandlerFunc(db DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Info("handling %s request", "GET /stat-types")
+
+		types, err := db.GetStatTypes(r.Context(), r.URL.Query().Get("status"))
+		if err != nil {
+			writeStoreError(w, err, "error getting stat types")
+			return
+		}
+
+		if err := writeEntity(w, types, http.StatusOK); err != nil {
+			log.Err("error writing stat types entity to response: %s", err.Error())
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+	}
+}
+
+// GetStatTypeHandlerFunc HTTP handler returns the key stat type with the specified ID.
+func GetStatTypeHandlerFunc(db DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Info("handling %s request", "GET /stat-types/{id}")
+
+		id, ok := statTypeID(w, r)
+		if !ok {
+			return
+		}
+
+		writeStatType(w, r, db, id, http.StatusOK)
+	}
+}
+
+// PostStatTypeHandlerFunc HTTP handler creates a new key stat type. Returns 409 if a key stat type with the name
+// already exists.
+func PostStatTypeHandlerFunc(db DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Info("handling %s request", "POST /stat-types")
+
+		var req StatTypeRequest
+		if !readJSON(w, r, &req) {
+			return
+		}
+
+		statType := req.toStatType()
+		if v := validateStatType(statType); v.hasErrors() {
+			writeValidationErrors(w, v)
+			return
+		}
+
+		id, err := db.AddStatType(r.Context(), statType)
+		if err != nil {
+			writeStoreError(w, err, "error adding stat type")
+			return
+		}
+
+		writeStatType(w, r, db, id, http.StatusCreated)
+	}
+}
+
+// PatchStatTypeHandlerFunc HTTP handler updates the fields of the key stat type present in the request body.
+func PatchStatTypeHandlerFunc(db DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Info("handling %s request", "PATCH /stat-types/{id}")
+
+		id, ok := statTypeID(w, r)
+		if !ok {
+			return
+		}
+
+		var req StatTypePatchRequest
+		if !readJSON(w, r, &req) {
+			return
+		}
+
+		existing, err := db.GetStatTypeByID(r.Context(), id)
+		if err != nil {
+			if err == store.ErrNotFound {
+				http.Error(w, "stat type not found", http.StatusNotFound)
+				return
+			}
+
+			writeStoreError(w, err, "error querying for stat type")
+			return
+		}
+
+		statType := req.apply(*existing)
+		if v := validateStatType(statType); v.hasErrors() {
+			writeValidationErrors(w, v)
+			return
+		}
+
+		if err := db.UpdateStatType(r.Context(), statType); err != nil {
+			if err == store.ErrNotFound {
+				http.Error(w, "stat type not found", http.StatusNotFound)
+				return
+			}
+
+			writeStoreError(w, err, "error updating stat type")
+			return
+		}
+
+		writeStatType(w, r, db, id, http.StatusOK)
+	}
+}
+
+// statTypeID returns the key stat type ID from the request path. Returns false and writes a 400 response if the ID is
+// invalid.
+func statTypeID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid stat type id", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// writeStatType writes the current state of the key stat type to the response.
+func writeStatType(w http.ResponseWriter, r *http.Request, db DB, id, status int) {
+	statType, err := db.GetStatTypeByID(r.Context(), id)
+	if err != nil {
+		if err == store.ErrNotFound {
+			http.Error(w, "stat type not found", http.StatusNotFound)
+			return
+		}
+
+		writeStoreError(w, err, "error querying for stat type")
+		return
+	}
+
+	if err := writeEntity(w, statType, status); err != nil {
+		log.Err("error writing stat type entity to response: %s", err.Error())
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
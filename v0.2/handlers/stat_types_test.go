@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// statTypeIDByName returns the ID of the key stat type with the specified name.
+func statTypeIDByName(t *testing.T, r http.Handler, name string) int {
+	t.Helper()
+
+	rec := serve(t, r, http.MethodGet, "/stat-types", nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	var types []store.KeyStatType
+	decode(t, rec, &types)
+
+	for _, st := range types {
+		if st.Name == name {
+			return st.ID
+		}
+	}
+
+	t.Fatalf("expected a key stat type named %q, got %+v", name, types)
+	return 0
+}
+
+func TestGetStatTypes(t *testing.T) {
+	r := Initalise(newTestStore(t), time.Minute)
+
+	rec := serve(t, r, http.MethodGet, "/stat-types", nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	var types []store.KeyStatType
+	decode(t, rec, &types)
+
+	if len(types) == 0 || types[0].Name != "Resident population" {
+		t.Fatalf("expected the default key stat types in display order, got %+v", types)
+	}
+
+	for i := 1; i < len(types); i++ {
+		if types[i].DisplayOrder < types[i-1].DisplayOrder {
+			t.Errorf("expected the key stat types in display order, got %+v", types)
+		}
+	}
+
+	id := strconv.Itoa(types[0].ID)
+	rec = serve(t, r, http.MethodPatch, "/stat-types/"+id, map[string]string{"status": store.StatTypeDeprecated})
+	expectStatus(t, rec, http.StatusOK)
+
+	// the status query parameter filters the key stat types.
+	rec = serve(t, r, http.MethodGet, "/stat-types?status="+store.StatTypeDeprecated, nil)
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &types)
+
+	if len(types) != 1 || types[0].Name != "Resident population" {
+		t.Errorf("expected only the deprecated key stat type, got %+v", types)
+	}
+}
+
+func TestGetStatType(t *testing.T) {
+	r := Initalise(newTestStore(t), time.Minute)
+	id := statTypeIDByName(t, r, "Average (mean) age")
+
+	rec := serve(t, r, http.MethodGet, "/stat-types/"+strconv.Itoa(id), nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	var statType store.KeyStatType
+	decode(t, rec, &statType)
+
+	if statType.ID != id || statType.Name != "Average (mean) age" || statType.DefaultUnit != "years" || statType.ValueType != store.ValueTypeMean {
+		t.Errorf("expected the mean age key stat type, got %+v", statType)
+	}
+
+	rec = serve(t, r, http.MethodGet, "/stat-types/999999", nil)
+	expectStatus(t, rec, http.StatusNotFound)
+
+	rec = serve(t, r, http.MethodGet, "/stat-types/age", nil)
+	expectStatus(t, rec, http.StatusBadRequest)
+}
+
+func TestPostStatType(t *testing.T) {
+	r := Initalise(newTestStore(t), time.Minute)
+
+	rec := serve(t, r, http.MethodPost, "/stat-types", StatTypeRequest{Name: "Median age", DefaultUnit: "years", ValueType: store.ValueTypeMean, Precision: 1})
+	expectStatus(t, rec, http.StatusCreated)
+
+	var statType store.KeyStatType
+	decode(t, rec, &statType)
+
+	// a blank status is active and a display order of 0 places the new type last.
+	if statType.ID == 0 || statType.Status != store.StatTypeActive || statType.DisplayOrder == 0 {
+		t.Errorf("expected an active key stat type after the existing types, got %+v", statType)
+	}
+
+	rec = serve(t, r, http.MethodGet, "/stat-types/"+strconv.Itoa(statType.ID), nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	// the name is unique.
+	rec = serve(t, r, http.MethodPost, "/stat-types", StatTypeRequest{Name: "Median age"})
+	expectStatus(t, rec, http.StatusConflict)
+}
+
+func TestPostStatTypeUnprocessable(t *testing.T) {
+	r := Initalise(newTestStore(t), time.Minute)
+	replacedBy := statTypeIDByName(t, r, "Resident population")
+	missing := 999999
+
+	cases := map[string]StatTypeRequest{
+		"missing name":              {},
+		"negative display order":    {Name: "Median age", DisplayOrder: -1},
+		"unknown status":            {Name: "Median age", Status: "retired"},
+		"replaced without a type":   {Name: "Median age", Status: store.StatTypeReplaced},
+		"replaced_by when active":   {Name: "Median age", ReplacedBy: &replacedBy},
+		"unknown value type":        {Name: "Median age", ValueType: "median"},
+		"precision out of range":    {Name: "Median age", Precision: store.MaxPrecision + 1},
+		"unknown unit":              {Name: "Median age", DefaultUnit: "decades"},
+		"unknown replacing type":    {Name: "Median age", Status: store.StatTypeReplaced, ReplacedBy: &missing},
+		"default unit is too long":  {Name: "Median age", DefaultUnit: "abcdefghijklmnopqrstuvwxyz"},
+		"category name is too long": {Name: "Median age", Category: string(make([]byte, 101))},
+	}
+
+	for name, req := range cases {
+		t.Run(name, func(t *testing.T) {
+			rec := serve(t, r, http.MethodPost, "/stat-types", req)
+			expectStatus(t, rec, http.StatusUnprocessableEntity)
+
+			var v ValidationErrors
+			decode(t, rec, &v)
+
+			if len(v.Errors) == 0 {
+				t.Errorf("expected a validation error, got %s", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestPatchStatType(t *testing.T) {
+	r := Initalise(newTestStore(t), time.Minute)
+	id := statTypeIDByName(t, r, "Population density (Hectares)")
+	replacement := statTypeIDByName(t, r, "Resident population")
+	path := "/stat-types/" + strconv.Itoa(id)
+
+	// only the fields in the request are updated.
+	rec := serve(t, r, http.MethodPatch, path, map[string]interface{}{"status": store.StatTypeReplaced, "replaced_by": replacement})
+	expectStatus(t, rec, http.StatusOK)
+
+	var statType store.KeyStatType
+	decode(t, rec, &statType)
+
+	if statType.Status != store.StatTypeReplaced || statType.ReplacedBy == nil || *statType.ReplacedBy != replacement {
+		t.Errorf("expected the key stat type to be replaced by %d, got %+v", replacement, statType)
+	}
+
+	if statType.Name != "Population density (Hectares)" || statType.DefaultUnit != "per hectare" {
+		t.Errorf("expected the other fields to be unchanged, got %+v", statType)
+	}
+
+	// setting a status other than replaced clears replaced_by.
+	rec = serve(t, r, http.MethodPatch, path, map[string]string{"status": store.StatTypeActive})
+	expectStatus(t, rec, http.StatusOK)
+
+	var active store.KeyStatType
+	decode(t, rec, &active)
+
+	if active.Status != store.StatTypeActive || active.ReplacedBy != nil {
+		t.Errorf("expected an active key stat type without replaced_by, got %+v", active)
+	}
+
+	rec = serve(t, r, http.MethodPatch, "/stat-types/999999", map[string]string{"name": "Density"})
+	expectStatus(t, rec, http.StatusNotFound)
+
+	rec = serve(t, r, http.MethodPatch, "/stat-types/density", map[string]string{"name": "Density"})
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	// renaming to the name of another key stat type conflicts.
+	rec = serve(t, r, http.MethodPatch, path, map[string]string{"name": "Resident population"})
+	expectStatus(t, rec, http.StatusConflict)
+
+	// a key stat type cannot replace itself.
+	rec = serve(t, r, http.MethodPatch, path, map[string]interface{}{"status": store.StatTypeReplaced, "replaced_by": id})
+	expectStatus(t, rec, http.StatusUnprocessableEntity)
+
+	rec = serve(t, r, http.MethodPatch, path, map[string]string{"name": ""})
+	expectStatus(t, rec, http.StatusUnprocessableEntity)
+}
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	log "github.com/daiLlew/funkylog"
+	"net/http"
+)
+
+// GetUnitsHandlerFunc HTTP handler returns the units key stat values can be measured in.
+func GetUnitsHandlerFunc(db DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Info("handling %s request", "GET /units")
+
+		units, err := db.GetUnits(r.Context())
+		if err != nil {
+			writeStoreError(w, err, "error getting units")
+			return
+		}
+
+		if err := writeEntity(w, units, http.StatusOK); err != nil {
+			log.Err("error writing units entity to response: %s", err.Error())
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+	}
+}
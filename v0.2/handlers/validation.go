@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/daiLlew/funkylog"
+	"net/http"
+	"strings"
+)
+
+// maxRequestBodySize is the largest request body the write endpoints will accept.
+const maxRequestBodySize = 1 << 20
+
+// ValidationErrors is the response entity returned when a request body is well formed but its values are invalid.
+type ValidationErrors struct {
+	Errors []string `json:"errors"`
+}
+
+// required adds an error if the field value is blank.
+func (v *ValidationErrors) required(field, val string) {
+	if strings.TrimSpace(val) == "" {
+		v.Errors = append(v.Errors, fmt.Sprintf("%s is required", field))
+	}
+}
+
+// maxLen adds an error if the field value is longer than the database column allows.
+func (v *ValidationErrors) maxLen(field, val string, max int) {
+	if len(val) > max {
+		v.Errors = append(v.Errors, fmt.Sprintf("%s must be %d characters or fewer", field, max))
+	}
+}
+
+func (v *ValidationErrors) add(format string, args ...interface{}) {
+	v.Errors = append(v.Errors, fmt.Sprintf(format, args...))
+}
+
+func (v *ValidationErrors) hasErrors() bool {
+	return len(v.Errors) > 0
+}
+
+// readJSON decodes the request body into entity. Returns false and writes a 400 response if the body is not valid JSON
+// or contains unknown fields.
+func readJSON(w http.ResponseWriter, r *http.Request, entity interface{}) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(entity); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body: %s", err.Error()), http.StatusBadRequest)
+		return false
+	}
+
+	if dec.More() {
+		http.Error(w, "invalid request body: expected a single JSON object", http.StatusBadRequest)
+		return false
+	}
+
+	return true
+}
+
+// writeValidationErrors writes a 422 response listing the validation errors.
+func writeValidationErrors(w http.ResponseWriter, v ValidationErrors) {
+	if err := writeEntity(w, v, http.StatusUnprocessableEntity); err != nil {
+		log.Err("error writing validation errors entity to response: %s", err.Error())
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,238 @@
+package listen
+
+import (
+	"context"
+	"encoding/json"
+	log "github.com/daiLlew/funkylog"
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// filePollInterval is how often the file queue checks for new messages.
+const filePollInterval = 500 * time.Millisecond
+
+// File queue sub directories.
+const (
+	pendingDir    = "pending"
+	processingDir = "processing"
+	deadDir       = "dead"
+	badDir        = "bad"
+)
+
+// FileQueue is a Queue persisting each message as a JSON file so messages survive a restart. Pending messages are kept
+// in {dir}/pending, received messages are moved to {dir}/processing until they are acknowledged and dead letters are
+// kept in {dir}/dead. Other processes may publish events by writing message files to the pending directory - files
+// should be written elsewhere and renamed into the directory so they are never read partially written. A pending file
+// that is not a valid message is moved to {dir}/bad the first time it is read.
+type FileQueue struct {
+	dir string
+}
+
+// NewFileQueue construct a new FileQueue in the directory, creating it if it does not exist. Messages left in the
+// processing directory by a previous run are returned to the pending directory to be redelivered.
+func NewFileQueue(dir string) (*FileQueue, error) {
+	for _, sub := range []string{pendingDir, processingDir, deadDir, badDir} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return nil, errors.Wrapf(err, "error creating queue directory %q", sub)
+		}
+	}
+
+	q := &FileQueue{dir: dir}
+
+	files, err := q.list(processingDir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range files {
+		if err := os.Rename(q.path(processingDir, f), q.path(pendingDir, f)); err != nil {
+			return nil, errors.Wrapf(err, "error returning message %q to the pending queue", f)
+		}
+	}
+
+	return q, nil
+}
+
+// Publish writes the message to the pending directory.
+func (q *FileQueue) Publish(ctx context.Context, msg Message) error {
+	return q.write(pendingDir, msg)
+}
+
+// Receive blocks until a message is due for delivery or the context is done. Due messages are delivered in order of
+// NotBefore.
+func (q *FileQueue) Receive(ctx context.Context) (Message, error) {
+	for {
+		msg, ok, err := q.next()
+		if err != nil {
+			return Message{}, err
+		}
+
+		if ok {
+			return msg, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return Message{}, ctx.Err()
+		case <-time.After(filePollInterval):
+		}
+	}
+}
+
+// next moves the first due message from the pending to the processing directory and returns it.
+func (q *FileQueue) next() (Message, bool, error) {
+	files, err := q.list(pendingDir)
+	if err != nil {
+		return Message{}, false, err
+	}
+
+	type pending struct {
+		name string
+		msg  Message
+	}
+
+	due := make([]pending, 0)
+	now := time.Now()
+
+	for _, f := range files {
+		msg, err := q.read(pendingDir, f)
+		if os.IsNotExist(err) {
+			// The file has been claimed by another consumer.
+			continue
+		}
+
+		if err != nil {
+			// The file will never be readable, move it aside so it is not read again on every poll.
+			log.Err("moving invalid message file %q to the %s directory: %s", f, badDir, err.Error())
+			if err := os.Rename(q.path(pendingDir, f), q.path(badDir, f)); err != nil && !os.IsNotExist(err) {
+				return Message{}, false, errors.Wrapf(err, "error moving invalid message file %q", f)
+			}
+			continue
+		}
+
+		if msg.ID == "" {
+			msg.ID = strings.TrimSuffix(f, ".json")
+		}
+
+		if !msg.NotBefore.After(now) {
+			due = append(due, pending{name: f, msg: msg})
+		}
+	}
+
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].msg.NotBefore.Before(due[j].msg.NotBefore)
+	})
+
+	for _, p := range due {
+		if err := os.Rename(q.path(pendingDir, p.name), q.path(processingDir, p.msg.ID+".json")); err == nil {
+			return p.msg, true, nil
+		}
+	}
+
+	return Message{}, false, nil
+}
+
+// Ack deletes the message from the processing directory.
+func (q *FileQueue) Ack(ctx context.Context, msg Message) error {
+	if err := os.Remove(q.path(processingDir, msg.ID+".json")); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "error acknowledging message %q", msg.ID)
+	}
+	return nil
+}
+
+// DeadLetter writes the message to the dead letter directory and deletes it from the processing directory.
+func (q *FileQueue) DeadLetter(ctx context.Context, msg Message) error {
+	if err := q.write(deadDir, msg); err != nil {
+		return err
+	}
+	return q.Ack(ctx, msg)
+}
+
+// DeadLetters returns the messages in the dead letter directory.
+func (q *FileQueue) DeadLetters(ctx context.Context) ([]Message, error) {
+	files, err := q.list(deadDir)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]Message, 0, len(files))
+	for _, f := range files {
+		msg, err := q.read(deadDir, f)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, nil
+}
+
+// write writes the message to a temp file and renames it into the sub directory so readers never see a partial file.
+func (q *FileQueue) write(sub string, msg Message) error {
+	b, err := json.MarshalIndent(msg, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(q.dir, "msg-*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "error creating message file")
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return errors.Wrapf(err, "error writing message %q", msg.ID)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return errors.Wrapf(err, "error writing message %q", msg.ID)
+	}
+
+	if err := os.Rename(tmp.Name(), q.path(sub, msg.ID+".json")); err != nil {
+		return errors.Wrapf(err, "error writing message %q", msg.ID)
+	}
+
+	return nil
+}
+
+func (q *FileQueue) read(sub, name string) (Message, error) {
+	var msg Message
+
+	b, err := os.ReadFile(q.path(sub, name))
+	if err != nil {
+		return msg, err
+	}
+
+	if err := json.Unmarshal(b, &msg); err != nil {
+		return msg, errors.Wrapf(err, "error unmarshalling message file %q", name)
+	}
+
+	return msg, nil
+}
+
+// list returns the names of the message files in the sub directory in name order.
+func (q *FileQueue) list(sub string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(q.dir, sub))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error listing queue directory %q", sub)
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".json") {
+			names = append(names, e.Name())
+		}
+	}
+
+	return names, nil
+}
+
+func (q *FileQueue) path(sub, name string) string {
+	return filepath.Join(q.dir, sub, name)
+}
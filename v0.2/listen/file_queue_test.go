@@ -0,0 +1,139 @@
+package listen
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// files returns the names of the message files in the sub directory of the queue.
+func files(t *testing.T, q *FileQueue, sub string) []string {
+	t.Helper()
+
+	names, err := q.list(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return names
+}
+
+func TestFileQueueRestart(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	q, err := NewFileQueue(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	published := NewMessage(testEvent)
+	if err := q.Publish(ctx, published); err != nil {
+		t.Fatal(err)
+	}
+
+	// a received message is in the processing directory until it is acknowledged.
+	received := receive(t, q)
+	if received.ID != published.ID {
+		t.Fatalf("expected message %s, got %s", published.ID, received.ID)
+	}
+
+	processing := []string{published.ID + ".json"}
+	if got := files(t, q, processingDir); !reflect.DeepEqual(got, processing) {
+		t.Fatalf("expected processing files %q, got %q", processing, got)
+	}
+
+	// restarting returns the unacknowledged message to the pending directory to be redelivered.
+	q, err = NewFileQueue(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := files(t, q, processingDir); len(got) != 0 {
+		t.Errorf("expected no processing files after a restart, got %q", got)
+	}
+
+	redelivered := receive(t, q)
+	if !reflect.DeepEqual(redelivered.Event, published.Event) || redelivered.ID != published.ID {
+		t.Errorf("expected message %+v to be redelivered, got %+v", published, redelivered)
+	}
+
+	if err := q.Ack(ctx, redelivered); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := files(t, q, processingDir); len(got) != 0 {
+		t.Errorf("expected the acknowledged message to be deleted, got %q", got)
+	}
+}
+
+func TestFileQueueOrder(t *testing.T) {
+	ctx := context.Background()
+
+	q, err := NewFileQueue(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	messages := []Message{
+		{ID: "b", Event: testEvent, NotBefore: now.Add(-time.Minute)},
+		{ID: "a", Event: testEvent, NotBefore: now.Add(-time.Second)},
+		{ID: "c", Event: testEvent, NotBefore: now.Add(time.Hour)},
+	}
+
+	for _, msg := range messages {
+		if err := q.Publish(ctx, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// due messages are delivered in order of NotBefore, c is not due.
+	for _, id := range []string{"b", "a"} {
+		if msg := receive(t, q); msg.ID != id {
+			t.Errorf("expected message %s, got %s", id, msg.ID)
+		}
+	}
+
+	expectEmpty(t, q)
+}
+
+func TestFileQueueInvalidMessage(t *testing.T) {
+	ctx := context.Background()
+
+	q, err := NewFileQueue(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(q.path(pendingDir, "invalid.json"), []byte(`{"id": `), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	published := NewMessage(testEvent)
+	if err := q.Publish(ctx, published); err != nil {
+		t.Fatal(err)
+	}
+
+	if msg := receive(t, q); msg.ID != published.ID {
+		t.Errorf("expected message %s, got %s", published.ID, msg.ID)
+	}
+
+	// the invalid file is moved aside the first time it is read rather than on every poll.
+	if got := files(t, q, pendingDir); len(got) != 0 {
+		t.Errorf("expected no pending files, got %q", got)
+	}
+
+	if _, err := os.Stat(filepath.Join(q.dir, badDir, "invalid.json")); err != nil {
+		t.Errorf("expected the invalid message file to be moved to the %s directory, got %v", badDir, err)
+	}
+
+	expectEmpty(t, q)
+
+	if dead, err := q.DeadLetters(ctx); err != nil || len(dead) != 0 {
+		t.Errorf("expected no dead letters, got %+v %v", dead, err)
+	}
+}
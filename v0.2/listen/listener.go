@@ -0,0 +1,114 @@
+package listen
+
+import (
+	"context"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/recipes"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store"
+	log "github.com/daiLlew/funkylog"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// maxRetryDelay caps the exponential back off between retries.
+const maxRetryDelay = 5 * time.Minute
+
+// RecipeStore is the store functionality required to find the recipes matching an event.
+type RecipeStore interface {
+	GetRecipes(ctx context.Context, datasetID, edition string) ([]store.KeyStatsRecipe, error)
+}
+
+// RecipeRunner runs the key stats recipes of a dataset edition.
+type RecipeRunner interface {
+	Run(ctx context.Context, datasetID, edition string) (*recipes.Result, error)
+}
+
+// Listener consumes dataset version published events from the queue and runs the matching key stats recipes. Events
+// are processed one at a time. A failed event is retried with exponential back off until it has failed MaxAttempts
+// times, after which it is moved to the dead letters.
+type Listener struct {
+	Queue       Queue
+	Store       RecipeStore
+	Runner      RecipeRunner
+	MaxAttempts int
+	RetryDelay  time.Duration
+}
+
+// Listen processes events until the context is done.
+func (l *Listener) Listen(ctx context.Context) error {
+	log.Info("listening for dataset version published events")
+
+	for {
+		msg, err := l.Queue.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				log.Info("listener stopped")
+				return nil
+			}
+			return errors.Wrap(err, "error receiving message")
+		}
+
+		if err := l.handle(ctx, msg); err != nil {
+			return err
+		}
+	}
+}
+
+// handle processes a single message. An error is only returned if the message could not be acknowledged, retried or
+// dead lettered.
+func (l *Listener) handle(ctx context.Context, msg Message) error {
+	e := msg.Event
+	log.Info("processing event %s dataset=%s, edition=%s, version=%s, attempt=%d", msg.ID, e.DatasetID, e.Edition, e.Version, msg.Attempts+1)
+
+	matches, err := l.Store.GetRecipes(ctx, e.DatasetID, e.Edition)
+	if err != nil {
+		return l.retry(ctx, msg, errors.Wrap(err, "error getting recipes"))
+	}
+
+	if len(matches) == 0 {
+		log.Info("no recipes found for event %s dataset=%s, edition=%s, ignoring", msg.ID, e.DatasetID, e.Edition)
+		return l.Queue.Ack(ctx, msg)
+	}
+
+	result, err := l.Runner.Run(ctx, e.DatasetID, e.Edition)
+	if err != nil {
+		return l.retry(ctx, msg, err)
+	}
+
+	log.Info("event %s ran %d recipes, inserted %d key stats for %d area profiles", msg.ID, result.Recipes, result.KeyStats, result.Profiles)
+	return l.Queue.Ack(ctx, msg)
+}
+
+// retry republishes the failed message to be redelivered after the retry delay or, if it has failed MaxAttempts times,
+// moves it to the dead letters. If the context is done the message is left unacknowledged.
+func (l *Listener) retry(ctx context.Context, msg Message, cause error) error {
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	msg.Attempts++
+	msg.LastError = cause.Error()
+
+	if msg.Attempts >= l.MaxAttempts {
+		log.Err("event %s failed %d times, moving to dead letters: %s", msg.ID, msg.Attempts, cause.Error())
+		return l.Queue.DeadLetter(ctx, msg)
+	}
+
+	// double the delay for each failed attempt, stopping at the cap so a large number of attempts cannot overflow.
+	delay := l.RetryDelay
+	for i := 1; i < msg.Attempts && delay > 0 && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > maxRetryDelay || delay <= 0 {
+		delay = maxRetryDelay
+	}
+
+	msg.NotBefore = time.Now().Add(delay)
+	log.Warn("event %s failed, retrying in %s: %s", msg.ID, delay, cause.Error())
+
+	if err := l.Queue.Publish(ctx, msg); err != nil {
+		return errors.Wrapf(err, "error republishing message %s", msg.ID)
+	}
+
+	return l.Queue.Ack(ctx, msg)
+}
@@ -0,0 +1,305 @@
+package listen
+
+import (
+	"context"
+	"fmt"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/recipes"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store"
+	"github.com/pkg/errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testEvent is the event of the test messages, testRecipes are the recipes matching it.
+var (
+	testEvent   = Event{DatasetID: "TS001", Edition: "2021", Version: "1"}
+	testRecipes = []store.KeyStatsRecipe{{ID: 1, DatasetID: "TS001", DatasetEdition: "2021"}}
+)
+
+// fakeRecipeStore returns its recipes for any dataset edition.
+type fakeRecipeStore struct {
+	recipes []store.KeyStatsRecipe
+}
+
+func (s fakeRecipeStore) GetRecipes(ctx context.Context, datasetID, edition string) ([]store.KeyStatsRecipe, error) {
+	return s.recipes, nil
+}
+
+// fakeRunner fails the first failures runs and succeeds after that, sending on succeeded if it is not nil.
+type fakeRunner struct {
+	failures  int
+	calls     int
+	succeeded chan struct{}
+}
+
+func (r *fakeRunner) Run(ctx context.Context, datasetID, edition string) (*recipes.Result, error) {
+	r.calls++
+	if r.calls <= r.failures {
+		return nil, fmt.Errorf("run %d failed", r.calls)
+	}
+
+	if r.succeeded != nil {
+		r.succeeded <- struct{}{}
+	}
+	return &recipes.Result{Recipes: 1, Profiles: 1, KeyStats: 1}, nil
+}
+
+// recordingQueue records the calls made to the queue it wraps.
+type recordingQueue struct {
+	Queue
+	calls []string
+}
+
+func (q *recordingQueue) Publish(ctx context.Context, msg Message) error {
+	q.calls = append(q.calls, fmt.Sprintf("publish %d", msg.Attempts))
+	return q.Queue.Publish(ctx, msg)
+}
+
+func (q *recordingQueue) Ack(ctx context.Context, msg Message) error {
+	q.calls = append(q.calls, fmt.Sprintf("ack %d", msg.Attempts))
+	return q.Queue.Ack(ctx, msg)
+}
+
+func (q *recordingQueue) DeadLetter(ctx context.Context, msg Message) error {
+	q.calls = append(q.calls, fmt.Sprintf("dead letter %d", msg.Attempts))
+	return q.Queue.DeadLetter(ctx, msg)
+}
+
+// forEachQueue runs the test against a memory queue and a file queue in a temp directory.
+func forEachQueue(t *testing.T, test func(t *testing.T, q Queue)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, NewMemoryQueue())
+	})
+
+	t.Run("file", func(t *testing.T) {
+		q, err := NewFileQueue(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		test(t, q)
+	})
+}
+
+// receive returns the next message of the queue, failing the test if none is due within a few seconds.
+func receive(t *testing.T, q Queue) Message {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	msg, err := q.Receive(ctx)
+	if err != nil {
+		t.Fatalf("expected a message, got %v", err)
+	}
+
+	return msg
+}
+
+// expectEmpty fails the test if the queue has a message due for delivery.
+func expectEmpty(t *testing.T, q Queue) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if msg, err := q.Receive(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the queue to be empty, got %+v %v", msg, err)
+	}
+}
+
+func TestListenerRetries(t *testing.T) {
+	forEachQueue(t, func(t *testing.T, q Queue) {
+		ctx := context.Background()
+		runner := &fakeRunner{failures: 2}
+		rq := &recordingQueue{Queue: q}
+		l := &Listener{Queue: rq, Store: fakeRecipeStore{testRecipes}, Runner: runner, MaxAttempts: 3, RetryDelay: time.Millisecond}
+
+		if err := q.Publish(ctx, NewMessage(testEvent)); err != nil {
+			t.Fatal(err)
+		}
+
+		for attempt := 0; attempt < 3; attempt++ {
+			msg := receive(t, q)
+			if msg.Attempts != attempt {
+				t.Fatalf("expected attempt %d, got %d", attempt, msg.Attempts)
+			}
+
+			if attempt > 0 && msg.LastError != fmt.Sprintf("run %d failed", attempt) {
+				t.Errorf("expected the last error of attempt %d, got %q", attempt, msg.LastError)
+			}
+
+			if err := l.handle(ctx, msg); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// the failed message is republished before it is acknowledged so it is never lost.
+		expected := []string{"publish 1", "ack 1", "publish 2", "ack 2", "ack 2"}
+		if !reflect.DeepEqual(rq.calls, expected) {
+			t.Errorf("expected queue calls %q, got %q", expected, rq.calls)
+		}
+
+		if runner.calls != 3 {
+			t.Errorf("expected 3 runs, got %d", runner.calls)
+		}
+
+		expectEmpty(t, q)
+
+		if dead, err := q.DeadLetters(ctx); err != nil || len(dead) != 0 {
+			t.Errorf("expected no dead letters, got %+v %v", dead, err)
+		}
+	})
+}
+
+func TestListenerDeadLetter(t *testing.T) {
+	forEachQueue(t, func(t *testing.T, q Queue) {
+		ctx := context.Background()
+		runner := &fakeRunner{failures: 10}
+		rq := &recordingQueue{Queue: q}
+		l := &Listener{Queue: rq, Store: fakeRecipeStore{testRecipes}, Runner: runner, MaxAttempts: 2, RetryDelay: time.Millisecond}
+
+		published := NewMessage(testEvent)
+		if err := q.Publish(ctx, published); err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 2; i++ {
+			if err := l.handle(ctx, receive(t, q)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		expected := []string{"publish 1", "ack 1", "dead letter 2"}
+		if !reflect.DeepEqual(rq.calls, expected) {
+			t.Errorf("expected queue calls %q, got %q", expected, rq.calls)
+		}
+
+		if runner.calls != 2 {
+			t.Errorf("expected MaxAttempts runs, got %d", runner.calls)
+		}
+
+		expectEmpty(t, q)
+
+		dead, err := q.DeadLetters(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(dead) != 1 || dead[0].ID != published.ID || dead[0].Attempts != 2 || dead[0].LastError != "run 2 failed" {
+			t.Errorf("expected message %s dead lettered after 2 attempts, got %+v", published.ID, dead)
+		}
+	})
+}
+
+func TestListenerNoRecipes(t *testing.T) {
+	ctx := context.Background()
+	runner := &fakeRunner{}
+	rq := &recordingQueue{Queue: NewMemoryQueue()}
+	l := &Listener{Queue: rq, Store: fakeRecipeStore{}, Runner: runner, MaxAttempts: 2, RetryDelay: time.Millisecond}
+
+	if err := l.handle(ctx, NewMessage(testEvent)); err != nil {
+		t.Fatal(err)
+	}
+
+	if runner.calls != 0 || !reflect.DeepEqual(rq.calls, []string{"ack 0"}) {
+		t.Errorf("expected the event to be acknowledged without a run, got %d runs and queue calls %q", runner.calls, rq.calls)
+	}
+}
+
+func TestListenerRetryDelay(t *testing.T) {
+	cases := []struct {
+		attempts int
+		delay    time.Duration
+		expected time.Duration
+	}{
+		{attempts: 0, delay: time.Second, expected: time.Second},
+		{attempts: 1, delay: time.Second, expected: 2 * time.Second},
+		{attempts: 3, delay: time.Second, expected: 8 * time.Second},
+		{attempts: 8, delay: time.Second, expected: 256 * time.Second},
+		{attempts: 9, delay: time.Second, expected: maxRetryDelay},
+		{attempts: 40, delay: time.Second, expected: maxRetryDelay},
+		{attempts: 1, delay: time.Hour, expected: maxRetryDelay},
+		{attempts: 70, delay: time.Second, expected: maxRetryDelay},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("%d attempts of %s", c.attempts, c.delay), func(t *testing.T) {
+			q := NewMemoryQueue()
+			l := &Listener{Queue: q, MaxAttempts: 100, RetryDelay: c.delay}
+
+			msg := NewMessage(testEvent)
+			msg.Attempts = c.attempts
+
+			before := time.Now()
+			if err := l.retry(context.Background(), msg, errors.New("failed")); err != nil {
+				t.Fatal(err)
+			}
+			after := time.Now()
+
+			if len(q.pending) != 1 {
+				t.Fatalf("expected the message to be republished, got %+v", q.pending)
+			}
+
+			if notBefore := q.pending[0].NotBefore; notBefore.Before(before.Add(c.expected)) || notBefore.After(after.Add(c.expected)) {
+				t.Errorf("expected a delay of %s, got %s", c.expected, notBefore.Sub(before))
+			}
+		})
+	}
+}
+
+func TestListenerRetryCancelled(t *testing.T) {
+	rq := &recordingQueue{Queue: NewMemoryQueue()}
+	l := &Listener{Queue: rq, MaxAttempts: 2, RetryDelay: time.Millisecond}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// a run failing because the listener is stopping is not counted as an attempt.
+	if err := l.retry(ctx, NewMessage(testEvent), context.Canceled); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rq.calls) != 0 {
+		t.Errorf("expected the message to be left unacknowledged, got queue calls %q", rq.calls)
+	}
+}
+
+func TestListen(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q := NewMemoryQueue()
+	runner := &fakeRunner{failures: 1, succeeded: make(chan struct{}, 1)}
+	l := &Listener{Queue: q, Store: fakeRecipeStore{testRecipes}, Runner: runner, MaxAttempts: 3, RetryDelay: time.Millisecond}
+
+	if err := q.Publish(ctx, NewMessage(testEvent)); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- l.Listen(ctx)
+	}()
+
+	select {
+	case <-runner.succeeded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the retried event to succeed")
+	}
+
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("expected the listener to stop without an error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the listener to stop when the context is done")
+	}
+
+	if runner.calls != 2 {
+		t.Errorf("expected the event to be run twice, got %d runs", runner.calls)
+	}
+}
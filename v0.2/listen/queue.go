@@ -0,0 +1,167 @@
+// Package listen consumes dataset version published events and runs the key stats recipes of the dataset edition.
+// Events are received via an HTTP webhook and delivered to the consumer through a Queue.
+package listen
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Event is a notification that a new version of a dataset edition has been published.
+type Event struct {
+	DatasetID string `json:"dataset_id"`
+	Edition   string `json:"edition"`
+	Version   string `json:"version,omitempty"`
+}
+
+// Message is an Event in a Queue along with its delivery state.
+type Message struct {
+	ID    string `json:"id"`
+	Event Event  `json:"event"`
+	// Attempts is the number of times processing the message has failed.
+	Attempts int `json:"attempts"`
+	// NotBefore is the earliest time the message will be delivered, used to delay retries.
+	NotBefore  time.Time `json:"not_before"`
+	ReceivedAt time.Time `json:"received_at"`
+	LastError  string    `json:"last_error,omitempty"`
+}
+
+// Queue delivers messages to the consumer. A received message must be acknowledged once it has been processed or
+// moved to the dead letters if it cannot be.
+type Queue interface {
+	// Publish adds the message to the queue, replacing any message with the same ID.
+	Publish(ctx context.Context, msg Message) error
+	// Receive blocks until a message is due for delivery or the context is done.
+	Receive(ctx context.Context) (Message, error)
+	// Ack removes a received message from the queue.
+	Ack(ctx context.Context, msg Message) error
+	// DeadLetter removes a received message from the queue and records it as a dead letter.
+	DeadLetter(ctx context.Context, msg Message) error
+	// DeadLetters returns the dead letter messages.
+	DeadLetters(ctx context.Context) ([]Message, error)
+}
+
+// NewMessage returns a new message for the event that is due for delivery immediately.
+func NewMessage(e Event) Message {
+	b := make([]byte, 8)
+	rand.Read(b)
+
+	now := time.Now().UTC()
+	return Message{
+		ID:         now.Format("20060102T150405") + "-" + hex.EncodeToString(b),
+		Event:      e,
+		NotBefore:  now,
+		ReceivedAt: now,
+	}
+}
+
+// MemoryQueue is an in-memory Queue. Messages are lost when the process exits.
+type MemoryQueue struct {
+	mu      sync.Mutex
+	pending []Message
+	dead    []Message
+	notify  chan struct{}
+}
+
+// NewMemoryQueue construct a new empty in-memory queue.
+func NewMemoryQueue() *MemoryQueue {
+	return &MemoryQueue{notify: make(chan struct{}, 1)}
+}
+
+// Publish adds the message to the queue.
+func (q *MemoryQueue) Publish(ctx context.Context, msg Message) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, m := range q.pending {
+		if m.ID == msg.ID {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			break
+		}
+	}
+
+	q.pending = append(q.pending, msg)
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Receive blocks until a message is due for delivery or the context is done. Due messages are delivered in the order
+// they were published.
+func (q *MemoryQueue) Receive(ctx context.Context) (Message, error) {
+	for {
+		msg, wait, ok := q.next()
+		if ok {
+			return msg, nil
+		}
+
+		var timer *time.Timer
+		var due <-chan time.Time
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			due = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+			return Message{}, ctx.Err()
+		case <-q.notify:
+		case <-due:
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// next removes and returns the first due message. If no message is due it returns how long until the next message is
+// due, 0 if the queue is empty.
+func (q *MemoryQueue) next() (Message, time.Duration, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	var wait time.Duration
+
+	for i, m := range q.pending {
+		if !m.NotBefore.After(now) {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			return m, 0, true
+		}
+
+		if d := m.NotBefore.Sub(now); wait == 0 || d < wait {
+			wait = d
+		}
+	}
+
+	return Message{}, wait, false
+}
+
+// Ack is a no-op, received messages are removed from the in-memory queue on delivery.
+func (q *MemoryQueue) Ack(ctx context.Context, msg Message) error {
+	return nil
+}
+
+// DeadLetter records the message as a dead letter.
+func (q *MemoryQueue) DeadLetter(ctx context.Context, msg Message) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.dead = append(q.dead, msg)
+	return nil
+}
+
+// DeadLetters returns the dead letter messages.
+func (q *MemoryQueue) DeadLetters(ctx context.Context) ([]Message, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return append(make([]Message, 0, len(q.dead)), q.dead...), nil
+}
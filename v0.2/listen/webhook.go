@@ -0,0 +1,93 @@
+package listen
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/daiLlew/funkylog"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strings"
+)
+
+// maxEventSize is the largest event request body the webhook will accept.
+const maxEventSize = 1 << 16
+
+// NewWebhook returns the listener's HTTP API. Events are published with POST /events and the dead letters listed
+// with GET /dead-letters.
+func NewWebhook(q Queue) *mux.Router {
+	r := mux.NewRouter()
+	r.Path("/events").Methods(http.MethodPost).HandlerFunc(PostEventHandlerFunc(q))
+	r.Path("/dead-letters").Methods(http.MethodGet).HandlerFunc(GetDeadLettersHandlerFunc(q))
+	return r
+}
+
+// PostEventHandlerFunc HTTP handler publishes a dataset version published event to the queue. Returns 202 and the
+// queued message, the event is processed asynchronously.
+func PostEventHandlerFunc(q Queue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Info("handling %s request", "POST /events")
+
+		var e Event
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxEventSize))
+		dec.DisallowUnknownFields()
+
+		if err := dec.Decode(&e); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request body: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		errs := make([]string, 0)
+		if strings.TrimSpace(e.DatasetID) == "" {
+			errs = append(errs, "dataset_id is required")
+		}
+		if strings.TrimSpace(e.Edition) == "" {
+			errs = append(errs, "edition is required")
+		}
+
+		if len(errs) > 0 {
+			writeJSON(w, map[string][]string{"errors": errs}, http.StatusUnprocessableEntity)
+			return
+		}
+
+		msg := NewMessage(e)
+		if err := q.Publish(r.Context(), msg); err != nil {
+			log.Err("error publishing event: %s", err.Error())
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		log.Info("queued event %s dataset=%s, edition=%s, version=%s", msg.ID, e.DatasetID, e.Edition, e.Version)
+		writeJSON(w, msg, http.StatusAccepted)
+	}
+}
+
+// GetDeadLettersHandlerFunc HTTP handler returns the events that failed too many times to be processed.
+func GetDeadLettersHandlerFunc(q Queue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Info("handling %s request", "GET /dead-letters")
+
+		messages, err := q.DeadLetters(r.Context())
+		if err != nil {
+			log.Err("error getting dead letters: %s", err.Error())
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, messages, http.StatusOK)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, entity interface{}, status int) {
+	body, err := json.MarshalIndent(entity, "", "  ")
+	if err != nil {
+		log.Err("error marshalling response entity: %s", err.Error())
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(status)
+	if _, err := w.Write(body); err != nil {
+		log.Err("error writing response entity: %s", err.Error())
+	}
+}
@@ -0,0 +1,119 @@
+package load
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"os"
+	"sort"
+	"strings"
+)
+
+// The columns of a data file.
+const (
+	ColumnAreaCode    = "area_code"
+	ColumnTitle       = "title"
+	ColumnName        = "name"
+	ColumnValue       = "value"
+	ColumnUnit        = "unit"
+	ColumnDatasetID   = "dataset_id"
+	ColumnDatasetName = "dataset_name"
+)
+
+// requiredColumns are the columns a data file must have. The other columns are optional.
+var requiredColumns = []string{ColumnAreaCode, ColumnName, ColumnValue, ColumnDatasetID}
+
+// ColumnAliases are the header names accepted for each column of a data file. Header names are matched ignoring case,
+// spaces, underscores and hyphens so "AreaCode", "Area Code" and "area_code" are all the same header.
+type ColumnAliases map[string][]string
+
+// DefaultColumnAliases returns the header names accepted for each column by default.
+func DefaultColumnAliases() ColumnAliases {
+	return ColumnAliases{
+		ColumnAreaCode:    {"area code", "geography code"},
+		ColumnTitle:       {"title", "profile name"},
+		ColumnName:        {"name", "stat type", "key stat"},
+		ColumnValue:       {"value", "observation"},
+		ColumnUnit:        {"unit", "units"},
+		ColumnDatasetID:   {"dataset id"},
+		ColumnDatasetName: {"dataset name"},
+	}
+}
+
+// ColumnAliasesFromFile returns the default column aliases plus the aliases in the JSON file. The file is an object
+// of column name to a list of extra header names e.g. {"area_code": ["LSOA21CD"], "value": ["Count"]}.
+func ColumnAliasesFromFile(filename string) (ColumnAliases, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading column aliases file %q", filename)
+	}
+
+	var extra map[string][]string
+	if err := json.Unmarshal(b, &extra); err != nil {
+		return nil, errors.Wrapf(err, "error parsing column aliases file %q", filename)
+	}
+
+	aliases := DefaultColumnAliases()
+	for col, names := range extra {
+		if _, ok := aliases[col]; !ok {
+			return nil, fmt.Errorf("column aliases file %q: unknown column %q", filename, col)
+		}
+		aliases[col] = append(aliases[col], names...)
+	}
+
+	return aliases, nil
+}
+
+// columns returns the index of each column in the header row. Returns an error if a required column is missing, unless
+// it is one of the fixed columns given a value for every row, or if more than one header matches the same column.
+// Unrecognised headers are ignored.
+func (a ColumnAliases) columns(header []string, fixed map[string]string) (map[string]int, error) {
+	lookup := a.lookup()
+
+	cols := make(map[string]int)
+	for i, h := range header {
+		col, ok := lookup[normaliseHeader(h)]
+		if !ok {
+			continue
+		}
+
+		if prev, ok := cols[col]; ok {
+			return nil, fmt.Errorf("headers %q and %q are both the %s column", header[prev], h, col)
+		}
+		cols[col] = i
+	}
+
+	missing := make([]string, 0)
+	for _, col := range requiredColumns {
+		if _, ok := fixed[col]; ok {
+			continue
+		}
+		if _, ok := cols[col]; !ok {
+			missing = append(missing, col)
+		}
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("missing required columns %q", missing)
+	}
+
+	return cols, nil
+}
+
+// lookup returns the column of each normalised header name.
+func (a ColumnAliases) lookup() map[string]string {
+	lookup := make(map[string]string)
+	for col, names := range a {
+		lookup[normaliseHeader(col)] = col
+		for _, name := range names {
+			lookup[normaliseHeader(name)] = col
+		}
+	}
+	return lookup
+}
+
+func normaliseHeader(h string) string {
+	h = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+	return strings.NewReplacer(" ", "", "_", "", "-", "").Replace(h)
+}
@@ -0,0 +1,125 @@
+package load
+
+import (
+	"context"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// diffRows compares the rows with the current key stats of each area profile. Each row is added, a key stat the area
+// profile does not have, changed, a new value, unit or dataset, or unchanged. The counts are added to the report and
+// the diff of each area profile returned in the order the areas first appear in the rows. The rows are compared as key
+// stats created at the specified time.
+func diffRows(ctx context.Context, tx store.Tx, rows []RowData, report *Report, created time.Time) ([]store.KeyStatsDiff, error) {
+	units, err := tx.GetUnits(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting units")
+	}
+
+	symbols := make(map[string]string, len(units))
+	for _, u := range units {
+		symbols[u.Code] = u.Symbol
+	}
+
+	areaCodes := make([]string, 0)
+	imported := make(map[string]store.KeyStatistics)
+	statTypes := make(map[string]*store.KeyStatType)
+
+	for _, r := range rows {
+		statType, ok := statTypes[r.Name]
+		if !ok {
+			if statType, err = getStatType(ctx, tx, r.Name); err != nil {
+				return nil, err
+			}
+			if statType == nil {
+				return nil, errors.Wrapf(store.ErrNotFound, "stat type %q", r.Name)
+			}
+			statTypes[r.Name] = statType
+		}
+
+		if _, ok := imported[r.AreaCode]; !ok {
+			areaCodes = append(areaCodes, r.AreaCode)
+		}
+
+		stat := store.KeyStatistic{
+			StatType:    statType.ID,
+			AreaCode:    r.AreaCode,
+			Name:        r.Name,
+			Value:       r.Value,
+			ValueType:   statType.ValueType,
+			Precision:   statType.Precision,
+			Unit:        r.Unit,
+			DateCreated: created,
+			Metadata:    store.KeyStatisticMetadata{DatasetID: r.DatasetID, DatasetName: r.DatasetName},
+		}
+		stat.SetDisplay(symbols[r.Unit])
+		imported[r.AreaCode] = append(imported[r.AreaCode], stat)
+	}
+
+	diffs := make([]store.KeyStatsDiff, 0, len(areaCodes))
+	for _, areaCode := range areaCodes {
+		profile, err := tx.GetProfileByAreaCode(ctx, areaCode)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error getting area profile for area code %q", areaCode)
+		}
+
+		current, err := tx.GetKeyStatsForProfile(ctx, profile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error getting current key stats for area code %q", areaCode)
+		}
+
+		existing := make(map[int]store.KeyStatistic, len(current))
+		for _, s := range current {
+			existing[s.StatType] = s
+		}
+
+		from := make(store.KeyStatistics, 0)
+		to := imported[areaCode]
+		for i, s := range to {
+			prev, ok := existing[s.StatType]
+			if !ok {
+				continue
+			}
+
+			// A blank dataset name keeps the existing name of the dataset.
+			if s.Metadata.DatasetID == prev.Metadata.DatasetID {
+				to[i].Metadata.Href = prev.Metadata.Href
+				if s.Metadata.DatasetName == "" {
+					to[i].Metadata.DatasetName = prev.Metadata.DatasetName
+				}
+			}
+			from = append(from, prev)
+		}
+
+		diff := store.DiffKeyStatistics(areaCode, from, to)
+		report.Inserted += len(diff.Added)
+		report.Updated += len(diff.Changed)
+		report.Unchanged += len(diff.Unchanged)
+		diffs = append(diffs, diff)
+	}
+
+	return diffs, nil
+}
+
+// changedRows returns the rows that add or change a key stat according to the diffs of each area profile.
+func changedRows(rows []RowData, diffs []store.KeyStatsDiff) []RowData {
+	changed := make(map[string]bool)
+	for _, d := range diffs {
+		for _, s := range d.Added {
+			changed[d.AreaCode+"|"+s.Name] = true
+		}
+		for _, c := range d.Changed {
+			changed[d.AreaCode+"|"+c.Name] = true
+		}
+	}
+
+	result := make([]RowData, 0, len(changed))
+	for _, r := range rows {
+		if changed[r.AreaCode+"|"+r.Name] {
+			result = append(result, r)
+		}
+	}
+
+	return result
+}
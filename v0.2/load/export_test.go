@@ -0,0 +1,4 @@
+package load
+
+// ReadFile exposes readFile to the external tests of the package.
+var ReadFile = readFile
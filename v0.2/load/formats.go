@@ -0,0 +1,373 @@
+package load
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Format is the format of a data file.
+type Format string
+
+// Supported data file formats.
+const (
+	// FormatCSV is a CSV file with a header row.
+	FormatCSV Format = "csv"
+	// FormatJSON is a JSON array of objects, one per row.
+	FormatJSON Format = "json"
+	// FormatNDJSON is newline delimited JSON, one object per line.
+	FormatNDJSON Format = "ndjson"
+)
+
+// maxNDJSONLine is the maximum length in bytes of a line of an NDJSON data file.
+const maxNDJSONLine = 1024 * 1024
+
+// extensionFormats are the formats of file extensions that differ from the format name.
+var extensionFormats = map[string]Format{
+	"jsonl": FormatNDJSON,
+}
+
+// RowFunc is called with each row of a data file that is not rejected, in the order the rows are read. Returning an
+// error stops the read.
+type RowFunc func(row RowData) error
+
+// Reader reads the rows of a data file in a particular format, handing each row to the row func as it is read. Fields
+// are mapped to columns using the column aliases. Rows missing a required field or with a value that is not a number
+// are rejected in the report and not handed on. Returns an error if the file cannot be read or the row func returns an
+// error.
+type Reader interface {
+	Read(r io.Reader, aliases ColumnAliases, report *Report, fn RowFunc) error
+}
+
+// Readers are the readers of each data file format.
+type Readers map[Format]Reader
+
+// DefaultReaders returns the CSV, JSON, NDJSON and XLSX readers. The XLSX reader reads every sheet of a workbook with
+// its headers on the first row.
+func DefaultReaders() Readers {
+	return Readers{
+		FormatCSV:    csvReader{},
+		FormatJSON:   jsonReader{},
+		FormatNDJSON: ndjsonReader{},
+		FormatXLSX:   xlsxReader{},
+	}
+}
+
+// Formats returns the names of the supported formats in order.
+func (r Readers) Formats() []string {
+	formats := make([]string, 0, len(r))
+	for f := range r {
+		formats = append(formats, string(f))
+	}
+
+	sort.Strings(formats)
+	return formats
+}
+
+// IsDataFile returns true if the file extension is a supported format.
+func (r Readers) IsDataFile(filename string) bool {
+	_, ok := r[formatOf(filename)]
+	return ok
+}
+
+// reader returns the reader of the file. The format is used if set otherwise the format is determined by the file
+// extension.
+func (r Readers) reader(filename string, format Format) (Reader, error) {
+	if format == "" {
+		format = formatOf(filename)
+	}
+
+	reader, ok := r[format]
+	if !ok {
+		return nil, errors.Errorf("unsupported data file format %q, expected one of %q", format, r.Formats())
+	}
+
+	return reader, nil
+}
+
+// formatOf returns the format of a file from its extension.
+func formatOf(filename string) Format {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), "."))
+	if f, ok := extensionFormats[ext]; ok {
+		return f
+	}
+	return Format(ext)
+}
+
+// readFile reads the rows of a data file using the reader of its format, calling fn with each row as it is read.
+// Returns an error if the format is not supported, the file cannot be read or fn returns an error.
+func readFile(filename string, readers Readers, format Format, aliases ColumnAliases, fn RowFunc) (*Report, error) {
+	report := newReport(filename)
+
+	reader, err := readers.reader(filename, format)
+	if err != nil {
+		return report, err
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return report, err
+	}
+	defer f.Close()
+
+	err = reader.Read(f, aliases, report, fn)
+	report.values = nil
+	return report, err
+}
+
+// parseRow maps the fields of a record to a row, field returns the trimmed value of a column or blank if the record
+// does not have the column and parseValue parses the value. The sheet is blank unless the record is from a workbook.
+// The text fields are interned, see Report.intern. Returns false if the row is rejected.
+func parseRow(sheet string, line int, field func(col string) string, parseValue func(raw string) (float64, error), report *Report) (RowData, bool) {
+	data := RowData{
+		Sheet:       sheet,
+		Line:        line,
+		AreaCode:    report.intern(field(ColumnAreaCode)),
+		Title:       report.intern(field(ColumnTitle)),
+		Name:        report.intern(field(ColumnName)),
+		Unit:        report.intern(field(ColumnUnit)),
+		DatasetID:   report.intern(field(ColumnDatasetID)),
+		DatasetName: report.intern(field(ColumnDatasetName)),
+	}
+
+	valid := true
+	for _, col := range requiredColumns {
+		if field(col) == "" {
+			report.reject(data, "%s is required", col)
+			valid = false
+		}
+	}
+
+	if raw := field(ColumnValue); raw != "" {
+		var err error
+		if data.Value, err = parseValue(raw); err != nil {
+			report.reject(data, "value %q is not a number", raw)
+			valid = false
+		}
+	}
+
+	return data, valid
+}
+
+// csvReader reads a CSV data file mapping columns by header name. Returns an error if the header is invalid.
+type csvReader struct{}
+
+func (csvReader) Read(in io.Reader, aliases ColumnAliases, report *Report, fn RowFunc) error {
+	r := csv.NewReader(in)
+	r.FieldsPerRecord = -1
+
+	header, err := r.Read()
+	if err != nil {
+		return errors.Wrap(err, "error reading header row")
+	}
+
+	cols, err := aliases.columns(header, nil)
+	if err != nil {
+		return err
+	}
+
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Wrap(err, "error reading input CSV file")
+		}
+
+		line, _ := r.FieldPos(0)
+		report.Rows++
+
+		if len(row) != len(header) {
+			report.reject(RowData{Line: line}, "expected %d fields but found %d", len(header), len(row))
+			continue
+		}
+
+		field := func(col string) string {
+			if i, ok := cols[col]; ok {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+
+		if data, ok := parseRow("", line, field, store.ParseValue, report); ok {
+			if err := fn(data); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// jsonReader reads a JSON array of objects, each object is a row. Keys are mapped to columns in the same way as CSV
+// headers, values may be strings or numbers and unrecognised keys are ignored. The line of a row is the line its
+// object starts on.
+type jsonReader struct{}
+
+func (jsonReader) Read(in io.Reader, aliases ColumnAliases, report *Report, fn RowFunc) error {
+	b, err := io.ReadAll(in)
+	if err != nil {
+		return errors.Wrap(err, "error reading input JSON file")
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	if t, err := dec.Token(); err != nil {
+		return errors.Wrap(err, "error reading input JSON file")
+	} else if t != json.Delim('[') {
+		return errors.New("expected a JSON array of rows")
+	}
+
+	lookup := aliases.lookup()
+
+	for dec.More() {
+		start := dec.InputOffset()
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return errors.Wrap(err, "error reading input JSON file")
+		}
+
+		// skip the separator and whitespace preceding the object to find the line it starts on.
+		skipped := b[start:dec.InputOffset()]
+		offset := start + int64(len(skipped)-len(bytes.TrimLeft(skipped, " \t\r\n,")))
+		line := bytes.Count(b[:offset], []byte("\n")) + 1
+		report.Rows++
+
+		if data, ok := parseObject(line, raw, lookup, report); ok {
+			if err := fn(data); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return errors.Wrap(err, "error reading input JSON file")
+	}
+
+	return nil
+}
+
+// ndjsonReader reads newline delimited JSON, each line is an object mapped to a row in the same way as the JSON
+// reader. Blank lines are ignored. The file is streamed, each line is scanned and its row handed on before the next
+// line is read, so unlike the JSON reader only one line of the file is held in memory at a time. A line longer than
+// maxNDJSONLine is an error.
+type ndjsonReader struct{}
+
+func (ndjsonReader) Read(in io.Reader, aliases ColumnAliases, report *Report, fn RowFunc) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), maxNDJSONLine)
+
+	lookup := aliases.lookup()
+	line := 0
+
+	for scanner.Scan() {
+		line++
+		b := bytes.TrimSpace(scanner.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+
+		report.Rows++
+
+		if data, ok := parseObject(line, b, lookup, report); ok {
+			if err := fn(data); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return errors.Wrapf(err, "error reading input NDJSON file after line %d", line)
+	}
+
+	return nil
+}
+
+// parseObject maps the keys of a JSON object to columns using the lookup of normalised header names and parses the
+// row. Returns false if the row is rejected.
+func parseObject(line int, raw []byte, lookup map[string]string, report *Report) (RowData, bool) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &obj); err != nil || obj == nil {
+		report.reject(RowData{Line: line}, "expected a JSON object")
+		return RowData{}, false
+	}
+
+	fields := make(map[string]string)
+	keys := make(map[string]string)
+	numbers := make(map[string]bool)
+	valid := true
+
+	names := make([]string, 0, len(obj))
+	for k := range obj {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	for _, k := range names {
+		col, ok := lookup[normaliseHeader(k)]
+		if !ok {
+			continue
+		}
+
+		if prev, dup := keys[col]; dup {
+			report.reject(RowData{Line: line}, "keys %q and %q are both the %s column", prev, k, col)
+			valid = false
+			continue
+		}
+		keys[col] = k
+
+		value, number, err := jsonField(obj[k])
+		if err != nil {
+			report.reject(RowData{Line: line}, "%s: %s", k, err.Error())
+			valid = false
+			continue
+		}
+		fields[col] = value
+		numbers[col] = number
+	}
+
+	// a JSON number is parsed as a JSON number e.g. 1e3, a string value as a data file cell e.g. "12,500".
+	parseValue := store.ParseValue
+	if numbers[ColumnValue] {
+		parseValue = func(raw string) (float64, error) {
+			return strconv.ParseFloat(raw, 64)
+		}
+	}
+
+	data, ok := parseRow("", line, func(col string) string { return fields[col] }, parseValue, report)
+	return data, ok && valid
+}
+
+// jsonField returns the trimmed text of a JSON string or number and true if it is a number, null is blank.
+func jsonField(raw json.RawMessage) (string, bool, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return "", false, err
+	}
+
+	switch t := v.(type) {
+	case nil:
+		return "", false, nil
+	case string:
+		return strings.TrimSpace(t), false, nil
+	case json.Number:
+		return t.String(), true, nil
+	default:
+		return "", false, fmt.Errorf("expected a string or number")
+	}
+}
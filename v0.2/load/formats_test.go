@@ -0,0 +1,208 @@
+package load
+
+import (
+	"bufio"
+	"github.com/pkg/errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// readerCase is a data file read by a reader with the lines and values of the rows handed out and the rows rejected.
+type readerCase struct {
+	name     string
+	in       string
+	lines    []int
+	values   []float64
+	rejected []RowError
+}
+
+// read reads the data file content with the reader returning the rows handed out and the report.
+func read(r Reader, in string) ([]RowData, *Report, error) {
+	report := newReport("test")
+	rows := make([]RowData, 0)
+
+	err := r.Read(strings.NewReader(in), DefaultColumnAliases(), report, func(row RowData) error {
+		rows = append(rows, row)
+		return nil
+	})
+
+	return rows, report, err
+}
+
+func testReader(t *testing.T, r Reader, cases []readerCase) {
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rows, report, err := read(r, c.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			lines := make([]int, 0, len(rows))
+			values := make([]float64, 0, len(rows))
+			for _, row := range rows {
+				lines = append(lines, row.Line)
+				values = append(values, row.Value)
+			}
+
+			if !reflect.DeepEqual(lines, c.lines) || !reflect.DeepEqual(values, c.values) {
+				t.Errorf("expected rows on lines %v with values %v, got lines %v values %v", c.lines, c.values, lines, values)
+			}
+
+			rejected := c.rejected
+			if rejected == nil {
+				rejected = []RowError{}
+			}
+
+			if !reflect.DeepEqual(report.Rejected, rejected) {
+				t.Errorf("expected rejected rows\n%+v\ngot\n%+v", rejected, report.Rejected)
+			}
+
+			if report.Rows != len(c.lines)+len(c.rejected) {
+				t.Errorf("expected %d rows counted, got %d", len(c.lines)+len(c.rejected), report.Rows)
+			}
+		})
+	}
+}
+
+func TestJSONReader(t *testing.T) {
+	testReader(t, jsonReader{}, []readerCase{
+		{
+			name: "line numbers after leading whitespace and commas",
+			in: "[\n\n" +
+				`  {"area_code": "E05011362", "name": "Resident population", "value": 1, "dataset_id": "TS001"}` + "\n" +
+				"  ,\n\n" +
+				`  {"area_code": "E05011362", "name": "Average (mean) age", "value": 2, "dataset_id": "TS001"}` + "\n" +
+				"]",
+			lines:  []int{3, 6},
+			values: []float64{1, 2},
+		},
+		{
+			name: "key colliding with an alias",
+			in: `[{"area_code": "E05011362", "Geography Code": "E05011363", "name": "Resident population", ` +
+				`"value": 1, "dataset_id": "TS001"}]`,
+			lines:  []int{},
+			values: []float64{},
+			rejected: []RowError{{Line: 1, Errors: []string{
+				`keys "Geography Code" and "area_code" are both the area_code column`,
+			}}},
+		},
+		{
+			name: "null fields",
+			in: "[\n" +
+				`{"area_code": "E05011362", "name": "Resident population", "value": 1, "unit": null, "dataset_id": "TS001"},` + "\n" +
+				`{"area_code": "E05011362", "name": "Resident population", "value": null, "dataset_id": "TS001"}` + "\n" +
+				"]",
+			lines:  []int{2},
+			values: []float64{1},
+			rejected: []RowError{{Line: 3, AreaCode: "E05011362", Name: "Resident population", Errors: []string{
+				"value is required",
+			}}},
+		},
+		{
+			name:   "non-object items",
+			in:     "[\n1,\n\"E05011362\",\nnull,\n[],\ntrue\n]",
+			lines:  []int{},
+			values: []float64{},
+			rejected: []RowError{
+				{Line: 2, Errors: []string{"expected a JSON object"}},
+				{Line: 3, Errors: []string{"expected a JSON object"}},
+				{Line: 4, Errors: []string{"expected a JSON object"}},
+				{Line: 5, Errors: []string{"expected a JSON object"}},
+				{Line: 6, Errors: []string{"expected a JSON object"}},
+			},
+		},
+		{
+			name: "number and string values",
+			in: "[\n" +
+				`{"area_code": "E05011362", "name": "Resident population", "value": 1e3, "dataset_id": "TS001"},` + "\n" +
+				`{"area_code": "E05011362", "name": "Resident population", "value": 2.5E-1, "dataset_id": "TS001"},` + "\n" +
+				`{"area_code": "E05011362", "name": "Resident population", "value": " 12,500 ", "dataset_id": "TS001"},` + "\n" +
+				`{"area_code": "E05011362", "name": "Resident population", "value": "1e3", "dataset_id": "TS001"},` + "\n" +
+				`{"area_code": "E05011362", "name": "Resident population", "value": true, "dataset_id": "TS001"}` + "\n" +
+				"]",
+			lines:  []int{2, 3, 4},
+			values: []float64{1000, 0.25, 12500},
+			rejected: []RowError{
+				{Line: 5, AreaCode: "E05011362", Name: "Resident population", Errors: []string{`value "1e3" is not a number`}},
+				{Line: 6, Errors: []string{"value: expected a string or number", "value is required"}},
+			},
+		},
+	})
+}
+
+func TestJSONReaderInvalid(t *testing.T) {
+	for _, in := range []string{`{"area_code": "E05011362"}`, `[{"area_code": "E05011362"}`, `[{"area_code": }]`} {
+		if _, _, err := read(jsonReader{}, in); err == nil {
+			t.Errorf("expected an error reading %q", in)
+		}
+	}
+}
+
+func TestNDJSONReader(t *testing.T) {
+	testReader(t, ndjsonReader{}, []readerCase{
+		{
+			name: "blank lines",
+			in: "\n" +
+				`{"area_code": "E05011362", "name": "Resident population", "value": 1, "dataset_id": "TS001"}` + "\n" +
+				"   \n\n" +
+				`  {"area_code": "E05011362", "name": "Average (mean) age", "value": 2.5e1, "dataset_id": "TS001"}  ` + "\n",
+			lines:  []int{2, 5},
+			values: []float64{1, 25},
+		},
+		{
+			name:   "key colliding with an alias",
+			in:     `{"Key Stat": "Resident population", "name": "Average (mean) age", "area_code": "E05011362", "value": 1, "dataset_id": "TS001"}`,
+			lines:  []int{},
+			values: []float64{},
+			rejected: []RowError{{Line: 1, Errors: []string{
+				`keys "Key Stat" and "name" are both the name column`,
+			}}},
+		},
+		{
+			name: "null fields and non-object lines",
+			in: `{"area_code": "E05011362", "name": "Resident population", "value": 1, "dataset_name": null, "dataset_id": "TS001"}` + "\n" +
+				`{"area_code": null, "name": "Resident population", "value": 1, "dataset_id": "TS001"}` + "\n" +
+				"null\n" +
+				`[{"area_code": "E05011362"}]` + "\n" +
+				"{not json}\n",
+			lines:  []int{1},
+			values: []float64{1},
+			rejected: []RowError{
+				{Line: 2, Name: "Resident population", Errors: []string{"area_code is required"}},
+				{Line: 3, Errors: []string{"expected a JSON object"}},
+				{Line: 4, Errors: []string{"expected a JSON object"}},
+				{Line: 5, Errors: []string{"expected a JSON object"}},
+			},
+		},
+	})
+}
+
+func TestNDJSONReaderLongLine(t *testing.T) {
+	row := `{"area_code": "E05011362", "name": "Resident population", "value": 1, "dataset_id": "TS001"}`
+	long := `{"area_code": "E05011362", "title": "` + strings.Repeat("x", maxNDJSONLine) + `"}`
+
+	rows, _, err := read(ndjsonReader{}, row+"\n"+long+"\n"+row+"\n")
+	if !errors.Is(err, bufio.ErrTooLong) {
+		t.Errorf("expected %q, got %v", bufio.ErrTooLong, err)
+	}
+
+	if len(rows) != 1 {
+		t.Errorf("expected the row before the long line to be read, got %d rows", len(rows))
+	}
+}
+
+func TestNDJSONReaderStops(t *testing.T) {
+	row := `{"area_code": "E05011362", "name": "Resident population", "value": 1, "dataset_id": "TS001"}` + "\n"
+	stop := errors.New("stop")
+
+	calls := 0
+	err := ndjsonReader{}.Read(strings.NewReader(strings.Repeat(row, 3)), DefaultColumnAliases(), newReport("test"), func(RowData) error {
+		calls++
+		return stop
+	})
+
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("expected the read to stop at the first row with %q, got %d calls and %v", stop, calls, err)
+	}
+}
@@ -0,0 +1,625 @@
+package load_test
+
+import (
+	"context"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/load"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store/memory"
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// testAreaCode is the code of the area with an area profile in the test store.
+const testAreaCode = "E05011362"
+
+// newTestStore returns a memory store with an area profile for the test area.
+func newTestStore(t *testing.T) *memory.Store {
+	t.Helper()
+
+	s := memory.New()
+	if err := s.Seed(context.Background(), testAreaCode, "Disbury East", "Disbury East profile"); err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+// writeFile writes a data file with the content to a temp directory and returns its filename.
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	filename := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return filename
+}
+
+// counts are the row counts of a report.
+type counts struct {
+	Rows, Loaded, Inserted, Updated, Unchanged, Rejected, Warnings int
+}
+
+// expectCounts fails the test if the report does not have the expected row counts.
+func expectCounts(t *testing.T, report *load.Report, expected counts) {
+	t.Helper()
+
+	got := counts{
+		Rows:      report.Rows,
+		Loaded:    report.Loaded,
+		Inserted:  report.Inserted,
+		Updated:   report.Updated,
+		Unchanged: report.Unchanged,
+		Rejected:  len(report.Rejected),
+		Warnings:  len(report.Warnings),
+	}
+
+	if got != expected {
+		t.Errorf("expected report counts %+v, got %+v", expected, got)
+	}
+}
+
+// keyStats returns the value and unit, e.g. "39.5 years", of each key stat of the area profile by key stat name.
+func keyStats(t *testing.T, s *memory.Store, areaCode string) map[string]string {
+	t.Helper()
+	ctx := context.Background()
+
+	profile, err := s.GetProfileByAreaCode(ctx, areaCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := s.GetKeyStatsForProfile(ctx, profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := make(map[string]string)
+	for _, stat := range stats {
+		values[stat.Name] = strconv.FormatFloat(stat.Value, 'f', -1, 64) + " " + stat.Unit
+	}
+
+	return values
+}
+
+// validationFile is a data file with headers matched by alias in a different order to the default columns and a mix of
+// valid and invalid rows.
+const validationFile = `Key Stat,Geography Code,Observation,Units,Dataset ID,Dataset Name,Profile Name
+Resident population,E05011362,"12,890",,TS001,Census 2021,Disbury East profile
+Resident population,E05011363,10345,,TS001,Census 2021,Disbury West profile
+Number of dogs,E05011362,12,,TS001,Census 2021,Disbury East profile
+Average (mean) age,E05011362,not a number,,TS007,Census 2021,Disbury East profile
+Average (mean) age,E05011362,39.5,,,Census 2021,Disbury East profile
+Average (mean) age,E05011362,39.5,,TS007,Census 2021,Disbury West profile
+Resident population,E05011362,12891,,TS001,Census 2021,Disbury East profile
+People think their general health is good,E05011362,120,,TS037,Census 2021,
+Population density (Hectares),E05011362,41.2,miles,TS006,Census 2021,
+`
+
+// validationRejected are the rejected rows of the validation file.
+var validationRejected = []load.RowError{
+	{Line: 3, AreaCode: "E05011363", Name: "Resident population", Errors: []string{`area "E05011363" has no area profile`}},
+	{Line: 4, AreaCode: "E05011362", Name: "Number of dogs", Errors: []string{`unknown key stat type "Number of dogs"`}},
+	{Line: 5, AreaCode: "E05011362", Name: "Average (mean) age", Errors: []string{`value "not a number" is not a number`}},
+	{Line: 6, AreaCode: "E05011362", Name: "Average (mean) age", Errors: []string{"dataset_id is required"}},
+	{Line: 8, AreaCode: "E05011362", Name: "Resident population", Errors: []string{
+		`duplicate value of "Resident population" for area "E05011362", first given on line 2`,
+	}},
+	{Line: 9, AreaCode: "E05011362", Name: "People think their general health is good", Errors: []string{
+		"percentage 120 must be between 0 and 100: key stat value is not valid",
+	}},
+	{Line: 10, AreaCode: "E05011362", Name: "Population density (Hectares)", Errors: []string{`unknown unit "miles"`}},
+}
+
+func TestDataFromFileFailAll(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+
+	report, err := load.DataFromFile(ctx, writeFile(t, "validation.csv", validationFile), s, load.DefaultOptions())
+	if !errors.Is(err, load.ErrRowsRejected) {
+		t.Fatalf("expected %q, got %v", load.ErrRowsRejected, err)
+	}
+
+	// every row is validated and each rejected row reported, nothing is loaded.
+	expectCounts(t, report, counts{Rows: 9, Rejected: 7, Warnings: 1})
+
+	if !reflect.DeepEqual(report.Rejected, validationRejected) {
+		t.Errorf("expected rejected rows\n%+v\ngot\n%+v", validationRejected, report.Rejected)
+	}
+
+	if got := keyStats(t, s, testAreaCode); len(got) != 0 {
+		t.Errorf("expected no key stats to be written, got %v", got)
+	}
+
+	imports, err := s.GetImports(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(imports) != 1 || imports[0].Status != store.ImportFailed || imports[0].Rejected != 7 || imports[0].ID != report.ImportID {
+		t.Errorf("expected the import to be recorded as failed with 7 rejected rows, got %+v", imports)
+	}
+}
+
+func TestDataFromFileLoadValidRows(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+
+	opts := load.DefaultOptions()
+	opts.Rows = load.LoadValidRows
+
+	report, err := load.DataFromFile(ctx, writeFile(t, "validation.csv", validationFile), s, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectCounts(t, report, counts{Rows: 9, Loaded: 2, Inserted: 2, Rejected: 7, Warnings: 1})
+
+	if !reflect.DeepEqual(report.Rejected, validationRejected) {
+		t.Errorf("expected rejected rows\n%+v\ngot\n%+v", validationRejected, report.Rejected)
+	}
+
+	// the row with a title that differs from the area profile name is loaded with a warning.
+	warnings := []load.RowError{{Line: 7, AreaCode: "E05011362", Name: "Average (mean) age", Errors: []string{
+		`title "Disbury West profile" does not match the area profile name "Disbury East profile"`,
+	}}}
+
+	if !reflect.DeepEqual(report.Warnings, warnings) {
+		t.Errorf("expected warnings\n%+v\ngot\n%+v", warnings, report.Warnings)
+	}
+
+	// a blank unit is the default unit of the key stat type.
+	expected := map[string]string{"Resident population": "12890 ", "Average (mean) age": "39.5 years"}
+	if got := keyStats(t, s, testAreaCode); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected key stats %v, got %v", expected, got)
+	}
+
+	if report.Versions[testAreaCode] != 1 {
+		t.Errorf("expected key stats version 1, got %v", report.Versions)
+	}
+}
+
+func TestDataFromFileColumnAliases(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+
+	content := "Ward,Statistic,Count,Dataset ID\nE05011362,Resident population,12890,TS001\n"
+
+	// the headers are not accepted by default.
+	if _, err := load.DataFromFile(ctx, writeFile(t, "ward.csv", content), s, load.DefaultOptions()); err == nil {
+		t.Fatal("expected an error reading a file without the required headers")
+	}
+
+	opts := load.DefaultOptions()
+	opts.Columns = load.DefaultColumnAliases()
+	opts.Columns[load.ColumnAreaCode] = append(opts.Columns[load.ColumnAreaCode], "Ward")
+	opts.Columns[load.ColumnName] = append(opts.Columns[load.ColumnName], "Statistic")
+	opts.Columns[load.ColumnValue] = append(opts.Columns[load.ColumnValue], "Count")
+
+	report, err := load.DataFromFile(ctx, writeFile(t, "ward.csv", content), s, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectCounts(t, report, counts{Rows: 1, Loaded: 1, Inserted: 1})
+
+	expected := map[string]string{"Resident population": "12890 "}
+	if got := keyStats(t, s, testAreaCode); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected key stats %v, got %v", expected, got)
+	}
+}
+
+// currentFile and updateFile are the key stats of the test area before and after an update. The update changes the
+// resident population, leaves the mean age unchanged and adds the general health.
+const (
+	currentFile = `area_code,name,value,unit,dataset_id
+E05011362,Resident population,12890,,TS001
+E05011362,Average (mean) age,39.5,years,TS007
+`
+	updateFile = `area_code,name,value,unit,dataset_id
+E05011362,Resident population,13000,,TS001
+E05011362,Average (mean) age,39.5,years,TS007
+E05011362,People think their general health is good,81.2,%,TS037
+`
+)
+
+func TestDataFromFileDryRun(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+
+	if _, err := load.DataFromFile(ctx, writeFile(t, "current.csv", currentFile), s, load.DefaultOptions()); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := load.DefaultOptions()
+	opts.DryRun = true
+
+	report, err := load.DataFromFile(ctx, writeFile(t, "update.csv", updateFile), s, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !report.DryRun || report.ImportID != 0 {
+		t.Errorf("expected an unrecorded dry run report, got %+v", report)
+	}
+
+	expectCounts(t, report, counts{Rows: 3, Loaded: 3, Inserted: 1, Updated: 1, Unchanged: 1})
+
+	if len(report.Diffs) != 1 {
+		t.Fatalf("expected the diff of the test area, got %+v", report.Diffs)
+	}
+
+	diff := report.Diffs[0]
+	if diff.AreaCode != testAreaCode || len(diff.Added) != 1 || len(diff.Changed) != 1 || len(diff.Unchanged) != 1 || len(diff.Removed) != 0 {
+		t.Fatalf("expected 1 added, 1 changed and 1 unchanged key stat, got %+v", diff)
+	}
+
+	if diff.Added[0].Name != "People think their general health is good" || diff.Added[0].Value != 81.2 {
+		t.Errorf("expected the general health to be added, got %+v", diff.Added[0])
+	}
+
+	if c := diff.Changed[0]; c.Name != "Resident population" || c.OldValue != 12890 || c.NewValue != 13000 {
+		t.Errorf("expected the resident population to change from 12890 to 13000, got %+v", c)
+	}
+
+	if diff.Unchanged[0].Name != "Average (mean) age" {
+		t.Errorf("expected the mean age to be unchanged, got %+v", diff.Unchanged[0])
+	}
+
+	// nothing is written: the key stats, versions and imports ledger are unchanged.
+	expected := map[string]string{"Resident population": "12890 ", "Average (mean) age": "39.5 years"}
+	if got := keyStats(t, s, testAreaCode); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected key stats %v, got %v", expected, got)
+	}
+
+	profile, err := s.GetProfileByAreaCode(ctx, testAreaCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if versions, err := s.GetKeyStatsVersionsForProfile(ctx, profile); err != nil || len(versions) != 1 {
+		t.Errorf("expected a single key stats version, got %+v %v", versions, err)
+	}
+
+	if imports, err := s.GetImports(ctx, ""); err != nil || len(imports) != 1 {
+		t.Errorf("expected only the first import in the ledger, got %+v %v", imports, err)
+	}
+}
+
+func TestDataFromFileDryRunRejectedRows(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+
+	opts := load.DefaultOptions()
+	opts.DryRun = true
+
+	// a dry run reports the rejected rows in the same way as an import.
+	report, err := load.DataFromFile(ctx, writeFile(t, "validation.csv", validationFile), s, opts)
+	if !errors.Is(err, load.ErrRowsRejected) {
+		t.Fatalf("expected %q, got %v", load.ErrRowsRejected, err)
+	}
+
+	if !reflect.DeepEqual(report.Rejected, validationRejected) {
+		t.Errorf("expected rejected rows\n%+v\ngot\n%+v", validationRejected, report.Rejected)
+	}
+
+	if imports, err := s.GetImports(ctx, ""); err != nil || len(imports) != 0 {
+		t.Errorf("expected a dry run not to be recorded in the ledger, got %+v %v", imports, err)
+	}
+}
+
+// versionCount returns the number of key stats versions of the test area profile.
+func versionCount(t *testing.T, s *memory.Store) int {
+	t.Helper()
+	ctx := context.Background()
+
+	profile, err := s.GetProfileByAreaCode(ctx, testAreaCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := s.GetKeyStatsVersionsForProfile(ctx, profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return len(versions)
+}
+
+func TestDataFromFileLedger(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	filename := writeFile(t, "current.csv", currentFile)
+
+	first, err := load.DataFromFile(ctx, filename, s, load.DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first.Skipped || first.Checksum == "" || first.Version == nil {
+		t.Fatalf("expected the first import to be loaded as a new version, got %+v", first)
+	}
+
+	// an identical file is skipped whatever it is called.
+	for _, f := range []string{filename, writeFile(t, "renamed.csv", currentFile)} {
+		report, err := load.DataFromFile(ctx, f, s, load.DefaultOptions())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !report.Skipped || report.DuplicateOf != first.ImportID || report.Checksum != first.Checksum {
+			t.Errorf("expected %s to be skipped as a duplicate of import %d, got %+v", f, first.ImportID, report)
+		}
+
+		expectCounts(t, report, counts{Rows: 2})
+	}
+
+	if n := versionCount(t, s); n != 1 {
+		t.Errorf("expected the skipped imports not to create a version, got %d versions", n)
+	}
+
+	// forcing the import loads the file again, the key stats are unchanged so no version is created.
+	opts := load.DefaultOptions()
+	opts.Force = true
+
+	forced, err := load.DataFromFile(ctx, filename, s, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if forced.Skipped || forced.Version != nil {
+		t.Errorf("expected the forced import to be loaded without a new version, got %+v", forced)
+	}
+
+	expectCounts(t, forced, counts{Rows: 2, Loaded: 2, Unchanged: 2})
+
+	if n := versionCount(t, s); n != 1 {
+		t.Errorf("expected an unchanged import not to create a version, got %d versions", n)
+	}
+
+	imports, err := s.GetImports(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := make(map[string]int)
+	for _, i := range imports {
+		statuses[i.Status]++
+
+		if i.Checksum != first.Checksum {
+			t.Errorf("expected every import to have checksum %s, got %+v", first.Checksum, i)
+		}
+
+		if i.Status == store.ImportSkipped && (i.DuplicateOf == nil || *i.DuplicateOf != first.ImportID) {
+			t.Errorf("expected skipped import %d to be a duplicate of import %d, got %+v", i.ID, first.ImportID, i)
+		}
+	}
+
+	expected := map[string]int{store.ImportCompleted: 2, store.ImportSkipped: 2}
+	if !reflect.DeepEqual(statuses, expected) {
+		t.Errorf("expected imports %v, got %+v", expected, imports)
+	}
+
+	completed, err := s.GetImport(ctx, first.ImportID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if completed.Rows != 2 || completed.Loaded != 2 || completed.Inserted != 2 || completed.Version == nil || !completed.Version.Equal(*first.Version) {
+		t.Errorf("expected the ledger entry to record the counts and version of the import, got %+v", completed)
+	}
+}
+
+func TestDataFromFileLedgerFailedImport(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	filename := writeFile(t, "validation.csv", validationFile)
+
+	if _, err := load.DataFromFile(ctx, filename, s, load.DefaultOptions()); !errors.Is(err, load.ErrRowsRejected) {
+		t.Fatalf("expected %q, got %v", load.ErrRowsRejected, err)
+	}
+
+	// a failed import is not a duplicate, importing the file again is attempted again.
+	opts := load.DefaultOptions()
+	opts.Rows = load.LoadValidRows
+
+	report, err := load.DataFromFile(ctx, filename, s, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Skipped || report.Loaded != 2 {
+		t.Errorf("expected the valid rows to be loaded, got %+v", report)
+	}
+
+	failed, err := s.GetImports(ctx, store.ImportFailed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(failed) != 1 || failed[0].Error == "" || failed[0].Version != nil {
+		t.Errorf("expected a failed import with an error and no version, got %+v", failed)
+	}
+}
+
+// provisionFile has rows for an area with an area profile, an area without an area profile, an area that does not exist
+// and key stat types that do not exist.
+const provisionFile = `area_code,title,name,value,unit,dataset_id
+E05011362,Disbury East profile,Resident population,12890,,TS001
+E05011363,,Resident population,10345,,TS001
+E05011364,Disbury North profile,Resident population,9870,,TS001
+E05011364,,Average (mean) age,41.3,years,TS007
+E05011362,,Number of dogs,12,,TS099
+E05011362,,Dogs per household,0.4,,TS099
+E05011362,,Households with a dog,23.5,%,TS099
+E05011362,,Dog walkers,7,walkers,TS099
+`
+
+func TestDataFromFileRejectPolicies(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+
+	if _, err := s.AddArea(ctx, "E05011363", "Disbury West"); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := load.DefaultOptions()
+	opts.Rows = load.LoadValidRows
+
+	report, err := load.DataFromFile(ctx, writeFile(t, "provision.csv", provisionFile), s, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// rows for areas without an area profile and of unknown key stat types are rejected, nothing is created.
+	expectCounts(t, report, counts{Rows: 8, Loaded: 1, Inserted: 1, Rejected: 7})
+
+	if report.AreasCreated != 0 || report.ProfilesCreated != 0 {
+		t.Errorf("expected no areas or profiles to be created, got %d areas and %d profiles", report.AreasCreated, report.ProfilesCreated)
+	}
+
+	for _, code := range []string{"E05011363", "E05011364"} {
+		if _, err := s.GetProfileByAreaCode(ctx, code); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("expected area %s to have no area profile, got %v", code, err)
+		}
+	}
+
+	if _, err := s.GetArea(ctx, "E05011364"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("expected area E05011364 not to be created, got %v", err)
+	}
+
+	if _, err := s.GetStatTypeByName(ctx, "Number of dogs"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("expected the unknown key stat type not to be registered, got %v", err)
+	}
+}
+
+func TestDataFromFileRegisterStatTypes(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+
+	opts := load.DefaultOptions()
+	opts.Rows = load.LoadValidRows
+	opts.StatTypes = load.RegisterUnknownStatTypes
+
+	report, err := load.DataFromFile(ctx, writeFile(t, "provision.csv", provisionFile), s, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the rows of the other areas are still rejected, the rows of the unknown key stat types are loaded.
+	expectCounts(t, report, counts{Rows: 8, Loaded: 4, Inserted: 4, Rejected: 4})
+
+	// the value type is inferred from the values and the default unit is the unit of the rows if it exists.
+	cases := []struct {
+		name      string
+		valueType string
+		unit      string
+	}{
+		{"Number of dogs", store.ValueTypeCount, ""},
+		{"Dogs per household", store.ValueTypeMean, ""},
+		{"Households with a dog", store.ValueTypePercentage, "%"},
+		{"Dog walkers", store.ValueTypeCount, ""},
+	}
+
+	for _, c := range cases {
+		id, err := s.GetStatTypeByName(ctx, c.name)
+		if err != nil {
+			t.Fatalf("expected %q to be registered, got %v", c.name, err)
+		}
+
+		statType, err := s.GetStatTypeByID(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if statType.ValueType != c.valueType || statType.DefaultUnit != c.unit || statType.Status != store.StatTypeActive {
+			t.Errorf("expected an active %s key stat type with default unit %q, got %+v", c.valueType, c.unit, statType)
+		}
+	}
+
+	// the row with a unit that does not exist registers its key stat type but is rejected.
+	rejected := load.RowError{Line: 9, AreaCode: "E05011362", Name: "Dog walkers", Errors: []string{`unknown unit "walkers"`}}
+	if n := len(report.Rejected); n == 0 || !reflect.DeepEqual(report.Rejected[n-1], rejected) {
+		t.Errorf("expected %+v to be rejected, got %+v", rejected, report.Rejected)
+	}
+}
+
+func TestDataFromFileCreateProfiles(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+
+	if _, err := s.AddArea(ctx, "E05011363", "Disbury West"); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := load.DefaultOptions()
+	opts.Rows = load.LoadValidRows
+	opts.Profiles = load.CreateMissingProfiles
+	opts.AreaNames = load.AreaNames{"E05011364": "Disbury North"}
+
+	report, err := load.DataFromFile(ctx, writeFile(t, "provision.csv", provisionFile), s, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the area without a profile gets a profile, the area that does not exist gets an area and a profile.
+	expectCounts(t, report, counts{Rows: 8, Loaded: 4, Inserted: 4, Rejected: 4})
+
+	if report.AreasCreated != 1 || report.ProfilesCreated != 2 {
+		t.Errorf("expected 1 area and 2 profiles to be created, got %d areas and %d profiles", report.AreasCreated, report.ProfilesCreated)
+	}
+
+	// a profile is named by the first title of the area, the area name if the area has no title.
+	profiles := map[string]string{"E05011363": "Disbury West", "E05011364": "Disbury North profile"}
+	for code, name := range profiles {
+		profile, err := s.GetProfileByAreaCode(ctx, code)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if profile.Name != name {
+			t.Errorf("expected area %s profile %q, got %q", code, name, profile.Name)
+		}
+	}
+
+	area, err := s.GetArea(ctx, "E05011364")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if area.Name != "Disbury North" {
+		t.Errorf("expected the area to be named from the area names, got %q", area.Name)
+	}
+
+	expected := map[string]string{"Resident population": "9870 ", "Average (mean) age": "41.3 years"}
+	if got := keyStats(t, s, "E05011364"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected key stats %v, got %v", expected, got)
+	}
+}
+
+func TestDataFromFileCreateProfilesRolledBack(t *testing.T) {
+	ctx := context.Background()
+	s := memory.New()
+
+	opts := load.DefaultOptions()
+	opts.Profiles = load.CreateMissingProfiles
+
+	// the areas and profiles created are rolled back with the rest of a failed import.
+	report, err := load.DataFromFile(ctx, writeFile(t, "provision.csv", provisionFile), s, opts)
+	if !errors.Is(err, load.ErrRowsRejected) {
+		t.Fatalf("expected %q, got %v", load.ErrRowsRejected, err)
+	}
+
+	if report.AreasCreated != 0 || report.ProfilesCreated != 0 {
+		t.Errorf("expected the report counts to be reset, got %d areas and %d profiles", report.AreasCreated, report.ProfilesCreated)
+	}
+
+	if profiles, err := s.GetAreaProfiles(ctx); err != nil || len(profiles) != 0 {
+		t.Errorf("expected no area profiles, got %+v %v", profiles, err)
+	}
+}
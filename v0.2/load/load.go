@@ -1,83 +1,492 @@
 package load
 
 import (
-	"encoding/csv"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store"
+	log "github.com/daiLlew/funkylog"
 	"github.com/pkg/errors"
 	"io"
+	"math"
 	"os"
 	"time"
 )
 
+// StatTypePolicy determines how rows with a key stat type that does not exist are handled.
+type StatTypePolicy string
+
+// Supported stat type policies.
+const (
+	// RejectUnknownStatTypes rejects each row with an unknown key stat type.
+	RejectUnknownStatTypes StatTypePolicy = "reject"
+	// RegisterUnknownStatTypes adds each unknown key stat type as a new active key stat type.
+	RegisterUnknownStatTypes StatTypePolicy = "register"
+)
+
+// RowPolicy determines whether the valid rows of a data file with rejected rows are loaded.
+type RowPolicy string
+
+// Supported row policies.
+const (
+	// FailAll loads nothing if any row is rejected.
+	FailAll RowPolicy = "fail-all"
+	// LoadValidRows loads the valid rows skipping the rejected rows.
+	LoadValidRows RowPolicy = "load-valid"
+)
+
+// ErrRowsRejected is returned when a data file has rejected rows and the row policy is FailAll.
+var ErrRowsRejected = errors.New("data file has rejected rows")
+
+// errDryRun rolls back the transaction of a dry run.
+var errDryRun = errors.New("dry run")
+
+// Options configures how data files are loaded.
+type Options struct {
+	StatTypes StatTypePolicy
+	Rows      RowPolicy
+	Profiles  ProfilePolicy
+	// AreaNames names the areas created by the CreateMissingProfiles policy, areas without a name are named by code.
+	AreaNames AreaNames
+	// Columns are the header names accepted for each column, the default aliases are used if nil.
+	Columns ColumnAliases
+	// Format is the format of every data file, if blank the format of each file is determined by its extension.
+	Format Format
+	// Readers are the readers of each data file format, the default readers are used if nil.
+	Readers Readers
+	// DryRun loads the files as normal then rolls back the transaction so nothing is written. The reports include the
+	// diff of the key stats of each area profile.
+	DryRun bool
+	// Bulk stages the valid rows of each file with the postgres COPY protocol and merges them into the key stats
+	// set-wise instead of inserting them row by row. Ignored by a dry run.
+	Bulk bool
+	// Force imports files identical to a previously completed import instead of skipping them.
+	Force bool
+}
+
+// DefaultOptions returns the options rejecting unknown key stat types and rows for areas without an area profile and
+// loading nothing from a file with rejected rows.
+func DefaultOptions() Options {
+	return Options{StatTypes: RejectUnknownStatTypes, Rows: FailAll, Profiles: RejectMissingProfiles, Columns: DefaultColumnAliases(), Readers: DefaultReaders()}
+}
+
+func (o Options) validate() error {
+	if o.StatTypes != RejectUnknownStatTypes && o.StatTypes != RegisterUnknownStatTypes {
+		return errors.Errorf("unknown stat type policy %q, expected %q or %q", o.StatTypes, RejectUnknownStatTypes, RegisterUnknownStatTypes)
+	}
+
+	if o.Rows != FailAll && o.Rows != LoadValidRows {
+		return errors.Errorf("unknown row policy %q, expected %q or %q", o.Rows, FailAll, LoadValidRows)
+	}
+
+	if o.Profiles != RejectMissingProfiles && o.Profiles != CreateMissingProfiles {
+		return errors.Errorf("unknown profile policy %q, expected %q or %q", o.Profiles, RejectMissingProfiles, CreateMissingProfiles)
+	}
+
+	return nil
+}
+
 // Store represents the area profiles data store.
 type Store interface {
-	Init(areaCode, areaName, areaProfileName string) error
-	GetProfileByAreaCode(areaCode string) (*store.AreaProfile, error)
-	InsertKeyStat(areaCode, name, value, unit string, datasetID, datasetName string, dateCreated time.Time) (int, error)
+	GetProfileByAreaCode(ctx context.Context, areaCode string) (*store.AreaProfile, error)
+	InsertKeyStat(ctx context.Context, areaCode, name string, value float64, unit, datasetID, datasetName string, dateCreated time.Time) (int, error)
+	InTransaction(ctx context.Context, fn func(tx store.Tx) error) error
+	AddImport(ctx context.Context, i store.Import) (int, error)
 	Close() error
 }
 
-// ImportRow is a Go representation of an area profiles key statistic in an import cvs row.
+// RowData is a Go representation of an area profiles key statistic in a row of a data file. Line is the line number of
+// the row in the file, for a workbook Sheet is the name of the sheet and Line the row number in the sheet.
 type RowData struct {
+	Sheet       string
+	Line        int
 	AreaCode    string
 	Title       string
 	Name        string
-	Value       string
+	Value       float64
 	Unit        string
 	DatasetID   string
 	DatasetName string
 }
 
-// DataFromFile load test data into the postgres database from the specified file.
-func DataFromFile(filename string, store Store) error {
-	rows, err := readFile(filename)
+// DataFromFile load test data into the postgres database from the specified file. The file is imported in a single
+// transaction as a new version of the key stats. Returns the report of the rows loaded and rejected.
+func DataFromFile(ctx context.Context, filename string, s Store, opts Options) (*Report, error) {
+	reports, err := DataFromFiles(ctx, []string{filename}, s, opts)
+	if len(reports) == 0 {
+		return nil, err
+	}
+	return reports[0], err
+}
+
+// DataFromFiles load test data from each of the specified files in a single transaction. Each file is imported as a
+// new version of the key stats. Every row is validated, rejected rows are listed in the report of each file. If a file
+// has rejected rows and the row policy is FailAll the whole set is rolled back and ErrRowsRejected returned, otherwise
+// the valid rows are loaded. Unknown key stat types are handled according to the stat type policy and areas without an
+// area profile according to the profile policy. A dry run is always rolled back. Each file is read by the reader of its
+// format, see Readers.
+//
+// Each import is recorded in the imports ledger. A file with the same checksum as a completed import is skipped unless
+// the Force option is set. If the transaction is rolled back each file is recorded as failed.
+func DataFromFiles(ctx context.Context, filenames []string, s Store, opts Options) ([]*Report, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	if opts.Columns == nil {
+		opts.Columns = DefaultColumnAliases()
+	}
+
+	if opts.Readers == nil {
+		opts.Readers = DefaultReaders()
+	}
+
+	if _, ok := opts.Readers[opts.Format]; opts.Format != "" && !ok {
+		return nil, errors.Errorf("unsupported data file format %q, expected one of %q", opts.Format, opts.Readers.Formats())
+	}
+
+	started := time.Now()
+	files := make([][]RowData, 0, len(filenames))
+	reports := make([]*Report, 0, len(filenames))
+
+	for _, filename := range filenames {
+		// every row of a file is validated before any is written so the rows handed out by the reader are collected.
+		rows := make([]RowData, 0)
+		report, err := readFile(filename, opts.Readers, opts.Format, opts.Columns, func(r RowData) error {
+			rows = append(rows, r)
+			return nil
+		})
+		report.DryRun = opts.DryRun
+		reports = append(reports, report)
+
+		if err == nil {
+			report.Checksum, err = fileChecksum(filename)
+		}
+
+		if err != nil {
+			err = errors.Wrapf(err, "error reading import file %q", filename)
+			recordFailures(ctx, s, reports, started, err)
+			return reports, err
+		}
+
+		files = append(files, rows)
+	}
+
+	err := s.InTransaction(ctx, func(tx store.Tx) error {
+		for i, rows := range files {
+			if err := importRows(ctx, tx, rows, reports[i], opts, started); err != nil {
+				return errors.Wrapf(err, "error importing file %q", filenames[i])
+			}
+		}
+
+		if opts.DryRun {
+			return errDryRun
+		}
+		return nil
+	})
+
+	if errors.Is(err, errDryRun) {
+		return reports, nil
+	}
+
 	if err != nil {
-		return err
+		for _, r := range reports {
+			r.reset()
+		}
+		recordFailures(ctx, s, reports, started, err)
 	}
 
-	created := time.Now()
-	for _, r := range rows {
-		if _, err := store.InsertKeyStat(r.AreaCode, r.Name, r.Value, r.Unit, r.DatasetID, r.DatasetName, created); err != nil {
-			return err
+	return reports, err
+}
+
+// importRows imports the rows of a single file recording the import in the imports ledger. The file is skipped if it
+// is identical to a completed import unless the Force option is set. A dry run is not recorded.
+func importRows(ctx context.Context, tx store.Tx, rows []RowData, report *Report, opts Options, started time.Time) error {
+	if !opts.Force {
+		prev, err := tx.GetCompletedImportByChecksum(ctx, report.Checksum)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return errors.Wrap(err, "error checking the imports ledger")
 		}
+
+		if prev != nil {
+			report.skip(prev.ID)
+			log.Info("skipping %s, identical to import %d of %s", report.File, prev.ID, prev.File)
+			return record(ctx, tx, report, store.ImportSkipped, started, "")
+		}
+	}
+
+	created := time.Now()
+	if err := loadRows(ctx, tx, rows, report, opts, created); err != nil {
+		return err
+	}
+
+	if len(report.Versions) > 0 {
+		report.Version = &created
+	}
+
+	return record(ctx, tx, report, store.ImportCompleted, started, "")
+}
+
+// record adds the import of the file to the imports ledger. A dry run is not recorded.
+func record(ctx context.Context, tx store.Tx, report *Report, status string, started time.Time, errMsg string) error {
+	if report.DryRun {
+		return nil
 	}
 
+	id, err := tx.AddImport(ctx, report.ledgerEntry(status, started, errMsg))
+	if err != nil {
+		return errors.Wrap(err, "error recording import")
+	}
+
+	report.ImportID = id
 	return nil
 }
 
-func readFile(filename string) ([]RowData, error) {
+// recordFailures records the import of each file as failed after the import transaction is rolled back. Skipped
+// files are recorded as skipped. Errors recording the failures are logged, the import error is what matters.
+func recordFailures(ctx context.Context, s Store, reports []*Report, started time.Time, importErr error) {
+	for _, r := range reports {
+		if r.DryRun {
+			continue
+		}
+
+		status := store.ImportFailed
+		if r.DuplicateOf != 0 {
+			status = store.ImportSkipped
+		}
+
+		id, err := s.AddImport(ctx, r.ledgerEntry(status, started, importErr.Error()))
+		if err != nil {
+			log.Warn("error recording failed import of %s: %s", r.File, err.Error())
+			continue
+		}
+		r.ImportID = id
+	}
+}
+
+// fileChecksum returns the hex encoded SHA-256 checksum of the file.
+func fileChecksum(filename string) (string, error) {
 	f, err := os.Open(filename)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 	defer f.Close()
 
-	r := csv.NewReader(f)
-	_, err = r.Read() // read/discard the header row
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", errors.Wrap(err, "error calculating checksum")
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// loadRows validates the rows of a single file and inserts the valid rows that add or change a key stat as a new key
+// stats version, created at the specified time, of each area profile with changes. Unchanged rows are counted but not
+// written.
+func loadRows(ctx context.Context, tx store.Tx, rows []RowData, report *Report, opts Options, created time.Time) error {
+	if opts.StatTypes == RegisterUnknownStatTypes {
+		if err := registerStatTypes(ctx, tx, rows); err != nil {
+			return err
+		}
+	}
+
+	if opts.Profiles == CreateMissingProfiles {
+		if err := provisionProfiles(ctx, tx, rows, opts.AreaNames, report); err != nil {
+			return err
+		}
+	}
+
+	valid, err := validateRows(ctx, tx, rows, report)
+	if err != nil {
+		return err
+	}
+
+	report.sort()
+
+	if len(report.Rejected) > 0 && opts.Rows == FailAll {
+		return errors.Wrapf(ErrRowsRejected, "%d of %d rows rejected", len(report.Rejected), report.Rows)
+	}
+
+	if opts.Bulk && !opts.DryRun {
+		if err := bulkInsertRows(ctx, tx, valid, report, created); err != nil {
+			return err
+		}
+
+		report.Loaded = len(valid)
+		return nil
+	}
+
+	diffs, err := diffRows(ctx, tx, valid, report, created)
+	if err != nil {
+		return err
+	}
+
+	if opts.DryRun {
+		report.Diffs = diffs
+	}
+
+	// only added and changed key stats are written, an area profile with no changes does not get a new version.
+	changed := changedRows(valid, diffs)
+
+	if err := createVersions(ctx, tx, changed, report, created); err != nil {
+		return err
+	}
+
+	if err := insertRows(ctx, tx, changed, created); err != nil {
+		return err
+	}
+
+	report.Loaded = len(valid)
+	return nil
+}
+
+// registerStatTypes adds each unknown key stat type using the unit of the first row of the type as its default unit,
+// or no default unit if the unit does not exist. The value type of a registered key stat type is inferred from its
+// values.
+func registerStatTypes(ctx context.Context, tx store.Tx, rows []RowData) error {
+	knownUnits, err := unitCodes(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+
+	for _, r := range rows {
+		if seen[r.Name] {
+			continue
+		}
+
+		seen[r.Name] = true
+		if _, err := tx.GetStatTypeByName(ctx, r.Name); err == nil {
+			continue
+		} else if !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+
+		unit := r.Unit
+		if !knownUnits[unit] {
+			unit = ""
+		}
+
+		valueType, precision := inferValueType(rows, r.Name, r.Unit)
+
+		id, err := tx.AddStatType(ctx, store.KeyStatType{
+			Name:        r.Name,
+			DefaultUnit: unit,
+			Status:      store.StatTypeActive,
+			ValueType:   valueType,
+			Precision:   precision,
+		})
+		if err != nil {
+			return errors.Wrapf(err, "error registering key stat type %q", r.Name)
+		}
+		log.Info("registered new key stat type %q type_id=%d, value_type=%s", r.Name, id, valueType)
+	}
+
+	return nil
+}
+
+// unitCodes returns the set of unit codes.
+func unitCodes(ctx context.Context, tx store.Tx) (map[string]bool, error) {
+	units, err := tx.GetUnits(ctx)
 	if err != nil {
-		return nil, errors.Wrap(err, "error reading input CSV file")
+		return nil, errors.Wrap(err, "error getting units")
+	}
+
+	codes := make(map[string]bool, len(units))
+	for _, u := range units {
+		codes[u.Code] = true
 	}
 
-	stats := make([]RowData, 0)
-	for {
-		row, err := r.Read()
-		if err == io.EOF {
-			break
+	return codes, nil
+}
+
+// inferValueType returns the value type and precision of an unknown key stat type. Values in percent are percentages,
+// any fractional or negative value makes the type a mean otherwise the type is a count.
+func inferValueType(rows []RowData, name, unit string) (string, int) {
+	if unit == "%" {
+		return store.ValueTypePercentage, 1
+	}
+
+	for _, r := range rows {
+		if r.Name == name && (r.Value != math.Trunc(r.Value) || r.Value < 0) {
+			return store.ValueTypeMean, 2
 		}
+	}
+
+	return store.ValueTypeCount, 0
+}
+
+// createVersions creates a new key stats version, recording the source file, for each area profile in the import rows.
+// The version number of each area profile is added to the report.
+func createVersions(ctx context.Context, tx store.Tx, rows []RowData, report *Report, created time.Time) error {
+	for _, r := range rows {
+		if _, seen := report.Versions[r.AreaCode]; seen {
+			continue
+		}
+
+		version, err := tx.CreateKeyStatsVersion(ctx, r.AreaCode, "", report.File, created)
 		if err != nil {
-			return nil, errors.Wrap(err, "error reading input CSV file")
+			return errors.Wrapf(err, "error creating key stats version for area code %q", r.AreaCode)
 		}
+		report.Versions[r.AreaCode] = version.Version
+	}
 
-		stats = append(stats, RowData{
-			AreaCode:    row[0],
-			Title:       row[1],
-			Name:        row[2],
-			Value:       row[3],
-			Unit:        row[4],
-			DatasetID:   row[5],
-			DatasetName: row[6],
+	return nil
+}
+
+// insertRows inserts each row as a key stat created at the specified time.
+func insertRows(ctx context.Context, tx store.Tx, rows []RowData, created time.Time) error {
+	for _, r := range rows {
+		if _, err := tx.InsertKeyStat(ctx, r.AreaCode, r.Name, r.Value, r.Unit, r.DatasetID, r.DatasetName, created); err != nil {
+			return errors.Wrapf(err, "error inserting %s", location(r.Sheet, r.Line))
+		}
+	}
+
+	return nil
+}
+
+// bulkInsertRows loads the rows as a new key stats version of each area profile using the bulk load of the store,
+// logging progress and throughput. The counts and version numbers are added to the report.
+func bulkInsertRows(ctx context.Context, tx store.Tx, rows []RowData, report *Report, created time.Time) error {
+	keyStats := make([]store.KeyStatRow, 0, len(rows))
+	for _, r := range rows {
+		keyStats = append(keyStats, store.KeyStatRow{
+			AreaCode:    r.AreaCode,
+			Name:        r.Name,
+			Value:       r.Value,
+			Unit:        r.Unit,
+			DatasetID:   r.DatasetID,
+			DatasetName: r.DatasetName,
 		})
 	}
 
-	return stats, nil
+	start := time.Now()
+	progress := func(staged int) {
+		log.Info("%s: staged %d of %d rows", report.File, staged, len(keyStats))
+	}
+
+	result, err := tx.CopyKeyStats(ctx, keyStats, report.File, created, progress)
+	if err != nil {
+		return errors.Wrap(err, "error bulk loading key stats")
+	}
+
+	report.Inserted = result.Inserted
+	report.Updated = result.Updated
+	report.Unchanged = result.Unchanged
+	for code, version := range result.Versions {
+		report.Versions[code] = version
+	}
+
+	elapsed := time.Since(start)
+	log.Info("%s: bulk loaded %d rows in %s (%.0f rows/min)", report.File, len(keyStats), elapsed.Round(time.Millisecond), rowsPerMinute(len(keyStats), elapsed))
+	return nil
+}
+
+// rowsPerMinute returns the throughput of loading n rows in the elapsed time.
+func rowsPerMinute(n int, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(n) / elapsed.Minutes()
 }
@@ -0,0 +1,122 @@
+package load
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store/memory"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// nationalAreas is the number of areas in a national-scale data file, about the number of output areas in England and
+// Wales.
+const nationalAreas = 190000
+
+// nationalStatTypes are the key stat types of each area in a national-scale data file.
+var nationalStatTypes = []string{
+	"Resident population",
+	"Population density (Hectares)",
+	"Average (mean) age",
+	"People think their general health is good",
+	"Households where English is not the main language",
+}
+
+// writeNationalFile writes a CSV data file with a row of each national stat type for each area without an area
+// profile, returning the filename and number of rows.
+func writeNationalFile(b *testing.B) (string, int) {
+	b.Helper()
+
+	filename := filepath.Join(b.TempDir(), "national.csv")
+	f, err := os.Create(filename)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"area_code", "title", "name", "value", "unit", "dataset_id", "dataset_name"})
+
+	for i := 0; i < nationalAreas; i++ {
+		code := fmt.Sprintf("E%08d", i)
+		for j, name := range nationalStatTypes {
+			w.Write([]string{code, "Census 2021 profile", name, strconv.Itoa((i + j) % 100), "", "TS001", "Census 2021"})
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		b.Fatal(err)
+	}
+
+	return filename, nationalAreas * len(nationalStatTypes)
+}
+
+// BenchmarkReadFileNational measures reading a national-scale data file, heap-B/row is the memory held by the rows
+// once read.
+func BenchmarkReadFileNational(b *testing.B) {
+	filename, n := writeNationalFile(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	var held uint64
+	for i := 0; i < b.N; i++ {
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+
+		rows := make([]RowData, 0)
+		_, err := readFile(filename, DefaultReaders(), "", DefaultColumnAliases(), func(r RowData) error {
+			rows = append(rows, r)
+			return nil
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		held = after.HeapAlloc - before.HeapAlloc
+		runtime.KeepAlive(rows)
+	}
+
+	b.ReportMetric(float64(held)/float64(n), "heap-B/row")
+}
+
+// BenchmarkDataFromFilesNationalBulk measures bulk importing a national-scale data file into the memory store, creating
+// every area and area profile.
+func BenchmarkDataFromFilesNationalBulk(b *testing.B) {
+	filename, n := writeNationalFile(b)
+	ctx := context.Background()
+
+	opts := DefaultOptions()
+	opts.Profiles = CreateMissingProfiles
+	opts.Bulk = true
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	var elapsed time.Duration
+	for i := 0; i < b.N; i++ {
+		s := memory.New()
+
+		start := time.Now()
+		report, err := DataFromFile(ctx, filename, s, opts)
+		elapsed += time.Since(start)
+
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		if report.Loaded != n || report.ProfilesCreated != nationalAreas {
+			b.Fatalf("expected %d rows and %d profiles loaded, got %d rows and %d profiles", n, nationalAreas, report.Loaded, report.ProfilesCreated)
+		}
+	}
+
+	b.ReportMetric(rowsPerMinute(n*b.N, elapsed), "rows/min")
+}
@@ -0,0 +1,173 @@
+package load
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// lookupLevels are the geography types supported in a lookup file ordered from the top of the hierarchy down.
+var lookupLevels = []string{"LAD", "MSOA", "LSOA", "OA"}
+
+// lookupHeaderRegex matches ONS lookup file column names e.g. LSOA21CD or LAD22NM capturing the geography type and
+// whether the column is the area code or name.
+var lookupHeaderRegex = regexp.MustCompile(`(?i)^(OA|LSOA|MSOA|LAD)\d{2}(CD|NM)$`)
+
+// lookupArea is an area read from a lookup file.
+type lookupArea struct {
+	Code          string
+	Name          string
+	GeographyType string
+	ParentCode    string
+	Line          int
+}
+
+// lookupColumns is the index of the code and name column of each geography type in a lookup file. A name index of -1
+// means the file has no name column for the geography type.
+type lookupColumns map[string][2]int
+
+// AreasFromLookupFile loads the area hierarchy from an ONS style lookup file e.g. an OA to LSOA to MSOA to LAD lookup
+// with the columns OA21CD,LSOA21CD,LSOA21NM,MSOA21CD,MSOA21NM,LAD22CD,LAD22NM. Any subset of the levels is supported,
+// the parent of each area is the area in the next level up present in the file. Areas are created or updated with
+// their geography type and parent in a single transaction. Returns the number of areas loaded.
+func AreasFromLookupFile(ctx context.Context, filename string, s Store) (int, error) {
+	areas, err := readLookupFile(filename)
+	if err != nil {
+		return 0, errors.Wrapf(err, "error reading lookup file %q", filename)
+	}
+
+	err = s.InTransaction(ctx, func(tx store.Tx) error {
+		for _, a := range areas {
+			if err := tx.UpsertArea(ctx, a.Code, a.Name, a.GeographyType, a.ParentCode); err != nil {
+				return errors.Wrapf(err, "error loading area %q from line %d", a.Code, a.Line)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, errors.Wrapf(err, "error loading lookup file %q", filename)
+	}
+
+	return len(areas), nil
+}
+
+// readLookupFile returns the distinct areas in the lookup file ordered so each parent precedes its children.
+func readLookupFile(filename string) ([]lookupArea, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	r := csv.NewReader(f)
+
+	header, err := r.Read()
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading header row")
+	}
+
+	cols, err := parseLookupHeader(header)
+	if err != nil {
+		return nil, err
+	}
+
+	byLevel := make(map[string][]lookupArea)
+	seen := make(map[string]lookupArea)
+	line := 1
+
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+
+		line++
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading line %d", line)
+		}
+
+		parent := ""
+		for _, level := range lookupLevels {
+			idx, ok := cols[level]
+			if !ok {
+				continue
+			}
+
+			a := lookupArea{
+				Code:          strings.TrimSpace(row[idx[0]]),
+				GeographyType: level,
+				ParentCode:    parent,
+				Line:          line,
+			}
+
+			if a.Code == "" {
+				return nil, fmt.Errorf("line %d: %s code is blank", line, level)
+			}
+
+			if idx[1] >= 0 {
+				a.Name = strings.TrimSpace(row[idx[1]])
+			}
+
+			if prev, ok := seen[a.Code]; ok {
+				if prev.ParentCode != a.ParentCode || prev.GeographyType != a.GeographyType {
+					return nil, fmt.Errorf("line %d: area %q conflicts with line %d, expected %s with parent %q", line, a.Code, prev.Line, prev.GeographyType, prev.ParentCode)
+				}
+			} else {
+				seen[a.Code] = a
+				byLevel[level] = append(byLevel[level], a)
+			}
+
+			parent = a.Code
+		}
+	}
+
+	areas := make([]lookupArea, 0, len(seen))
+	for _, level := range lookupLevels {
+		areas = append(areas, byLevel[level]...)
+	}
+
+	return areas, nil
+}
+
+// parseLookupHeader returns the code and name column index of each geography type in the lookup file header. Columns
+// that are not geography codes or names are ignored.
+func parseLookupHeader(header []string) (lookupColumns, error) {
+	codes := make(map[string]int)
+	names := make(map[string]int)
+
+	for i, h := range header {
+		match := lookupHeaderRegex.FindStringSubmatch(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		if match == nil {
+			continue
+		}
+
+		level := strings.ToUpper(match[1])
+		if strings.ToUpper(match[2]) == "CD" {
+			codes[level] = i
+		} else {
+			names[level] = i
+		}
+	}
+
+	if len(codes) == 0 {
+		return nil, errors.New("header row does not contain any geography code columns e.g. LSOA21CD")
+	}
+
+	cols := make(lookupColumns)
+	for level, codeIdx := range codes {
+		nameIdx, ok := names[level]
+		if !ok {
+			nameIdx = -1
+		}
+		cols[level] = [2]int{codeIdx, nameIdx}
+	}
+
+	return cols, nil
+}
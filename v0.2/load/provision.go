@@ -0,0 +1,123 @@
+package load
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store"
+	log "github.com/daiLlew/funkylog"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"regexp"
+)
+
+// ProfilePolicy determines how rows for an area without an area profile are handled.
+type ProfilePolicy string
+
+// Supported profile policies.
+const (
+	// RejectMissingProfiles rejects each row for an area without an area profile.
+	RejectMissingProfiles ProfilePolicy = "reject"
+	// CreateMissingProfiles creates the area, if it does not exist, and the area profile of each area without a profile.
+	CreateMissingProfiles ProfilePolicy = "create"
+)
+
+// AreaNames is a lookup of area code to area name used to name the areas created by the loader.
+type AreaNames map[string]string
+
+// namesHeaderRegex matches ONS names and codes file column names e.g. WD22CD or LAD22NM capturing whether the column is
+// the area code or name.
+var namesHeaderRegex = regexp.MustCompile(`(?i)^[A-Z]+\d{2}(CD|NM)$`)
+
+// AreaNamesFromFile reads an area names lookup file. The file is a CSV with an area code and an area name column, either
+// an ONS style names and codes file e.g. WD22CD,WD22NM or a file with area_code and area_name columns. If there is more
+// than one code or name column the first is used, other columns are ignored.
+func AreaNamesFromFile(filename string) (AreaNames, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error opening area names file %q", filename)
+	}
+
+	defer f.Close()
+
+	r := csv.NewReader(f)
+
+	header, err := r.Read()
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading area names file %q header row", filename)
+	}
+
+	codeCol, nameCol := -1, -1
+	for i, h := range header {
+		col := normaliseHeader(h)
+		if m := namesHeaderRegex.FindStringSubmatch(col); m != nil {
+			col = "area" + m[1]
+		}
+
+		switch col {
+		case "areacode", "areacd", "code":
+			if codeCol < 0 {
+				codeCol = i
+			}
+		case "areaname", "areanm", "name":
+			if nameCol < 0 {
+				nameCol = i
+			}
+		}
+	}
+
+	if codeCol < 0 || nameCol < 0 {
+		return nil, fmt.Errorf("area names file %q: expected an area code and an area name column e.g. WD22CD,WD22NM", filename)
+	}
+
+	names := make(AreaNames)
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading area names file %q", filename)
+		}
+
+		if row[codeCol] != "" {
+			names[row[codeCol]] = row[nameCol]
+		}
+	}
+
+	return names, nil
+}
+
+// provisionProfiles creates the area profile of each area in the rows without an area profile. The area is created
+// first if it does not exist, named from the area names or by its code if it has no name. The profile is named by the
+// title of the first row of the area with a title, the area name if none of the rows have a title. The profiles are
+// created set-wise in a fixed number of round trips however many areas the rows have.
+func provisionProfiles(ctx context.Context, tx store.Tx, rows []RowData, names AreaNames, report *Report) error {
+	titles := make(map[string]string)
+	for _, r := range rows {
+		if titles[r.AreaCode] == "" {
+			titles[r.AreaCode] = r.Title
+		}
+	}
+
+	areaCodes := distinctAreaCodes(rows)
+	profiles := make([]store.NewAreaProfile, 0, len(areaCodes))
+	for _, code := range areaCodes {
+		profiles = append(profiles, store.NewAreaProfile{AreaCode: code, AreaName: names[code], Name: titles[code]})
+	}
+
+	result, err := tx.CopyAreaProfiles(ctx, profiles)
+	if err != nil {
+		return errors.Wrap(err, "error creating area profiles")
+	}
+
+	report.AreasCreated = result.AreasCreated
+	report.ProfilesCreated = result.ProfilesCreated
+
+	if report.ProfilesCreated > 0 {
+		log.Info("%s: created %d areas and %d area profiles", report.File, report.AreasCreated, report.ProfilesCreated)
+	}
+
+	return nil
+}
@@ -0,0 +1,179 @@
+package load
+
+import (
+	"fmt"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Report is the outcome of loading a data file. Loaded rows are counted as inserted, a key stat the area profile did not
+// have, updated, a new value, unit or dataset, or unchanged. Versions is the new key stats version number of each area
+// profile. Rejected lists every row that failed validation, warnings are rows that were loaded but may need attention.
+// A dry run report has the same counts plus the diff of each area profile's key stats but nothing is written.
+//
+// ImportID is the ID of the file's entry in the imports ledger and Version the date created of the key stats versions
+// created by the import. A file identical to a completed import is skipped, DuplicateOf is the ID of the completed
+// import.
+type Report struct {
+	File        string         `json:"file"`
+	Checksum    string         `json:"checksum"`
+	ImportID    int            `json:"import_id,omitempty"`
+	DryRun      bool           `json:"dry_run,omitempty"`
+	Skipped     bool           `json:"skipped,omitempty"`
+	DuplicateOf int            `json:"duplicate_of,omitempty"`
+	Version     *time.Time     `json:"version,omitempty"`
+	Rows        int            `json:"rows"`
+	Loaded      int            `json:"loaded"`
+	Inserted    int            `json:"inserted"`
+	Updated     int            `json:"updated"`
+	Unchanged   int            `json:"unchanged"`
+	Versions    map[string]int `json:"versions"`
+	// AreasCreated and ProfilesCreated are the number of areas and area profiles created for areas without a profile.
+	AreasCreated    int                  `json:"areas_created"`
+	ProfilesCreated int                  `json:"profiles_created"`
+	Rejected        []RowError           `json:"rejected"`
+	Warnings        []RowError           `json:"warnings"`
+	Diffs           []store.KeyStatsDiff `json:"diffs,omitempty"`
+	// values are the distinct field values of the rows read from the file, see intern.
+	values map[string]string
+}
+
+// RowError lists the problems with a single row of a data file. Line is the line number of the row in the file, for a
+// workbook the row number in the sheet.
+type RowError struct {
+	Sheet    string   `json:"sheet,omitempty"`
+	Line     int      `json:"line"`
+	AreaCode string   `json:"area_code,omitempty"`
+	Name     string   `json:"name,omitempty"`
+	Errors   []string `json:"errors"`
+}
+
+func newReport(filename string) *Report {
+	return &Report{
+		File:     filepath.Base(filename),
+		Versions: make(map[string]int),
+		Rejected: make([]RowError, 0),
+		Warnings: make([]RowError, 0),
+	}
+}
+
+// Location returns the line of the row e.g. "line 4", or the sheet and row of a workbook row e.g. "sheet TS001 row 4".
+func (e RowError) Location() string {
+	return location(e.Sheet, e.Line)
+}
+
+func location(sheet string, line int) string {
+	if sheet != "" {
+		return fmt.Sprintf("sheet %s row %d", sheet, line)
+	}
+	return fmt.Sprintf("line %d", line)
+}
+
+// Summary returns a one line summary of the report.
+func (r *Report) Summary() string {
+	if r.Skipped {
+		return fmt.Sprintf("%s: skipped, identical to import %d", r.File, r.DuplicateOf)
+	}
+
+	loaded := "loaded"
+	if r.DryRun {
+		loaded = "dry run, would load"
+	}
+
+	return fmt.Sprintf("%s: %s %d of %d rows (%d inserted, %d updated, %d unchanged), %d rejected, %d warnings",
+		r.File, loaded, r.Loaded, r.Rows, r.Inserted, r.Updated, r.Unchanged, len(r.Rejected), len(r.Warnings))
+}
+
+// reset clears the counts of loaded rows and the versions created, used when the load is rolled back.
+func (r *Report) reset() {
+	r.Loaded, r.Inserted, r.Updated, r.Unchanged = 0, 0, 0, 0
+	r.AreasCreated, r.ProfilesCreated = 0, 0
+	r.Versions = make(map[string]int)
+	r.Version = nil
+	r.Diffs = nil
+}
+
+// intern returns the shared copy of a field value. The rows of a large file repeat the same key stat types, units,
+// datasets and titles, and each area code once per key stat, so the rows share one copy of each value.
+func (r *Report) intern(value string) string {
+	if shared, ok := r.values[value]; ok {
+		return shared
+	}
+
+	if r.values == nil {
+		r.values = make(map[string]string)
+	}
+
+	// copy the value, a field of a CSV record shares the memory of the whole record.
+	shared := string([]byte(value))
+	r.values[shared] = shared
+	return shared
+}
+
+// skip marks the file as skipped as it is identical to the completed import with the specified ID.
+func (r *Report) skip(duplicateOf int) {
+	r.Skipped = true
+	r.DuplicateOf = duplicateOf
+}
+
+// ledgerEntry returns the imports ledger entry of the report.
+func (r *Report) ledgerEntry(status string, started time.Time, errMsg string) store.Import {
+	i := store.Import{
+		File:       r.File,
+		Checksum:   r.Checksum,
+		Status:     status,
+		Rows:       r.Rows,
+		Loaded:     r.Loaded,
+		Rejected:   len(r.Rejected),
+		Inserted:   r.Inserted,
+		Updated:    r.Updated,
+		Unchanged:  r.Unchanged,
+		StartedAt:  started,
+		FinishedAt: time.Now(),
+		Version:    r.Version,
+		Error:      errMsg,
+	}
+
+	if r.DuplicateOf != 0 {
+		i.DuplicateOf = &r.DuplicateOf
+	}
+
+	return i
+}
+
+// reject adds an error for the row to the rejected rows.
+func (r *Report) reject(row RowData, format string, args ...interface{}) {
+	r.Rejected = addRowError(r.Rejected, row, fmt.Sprintf(format, args...))
+}
+
+// warn adds a warning for the row.
+func (r *Report) warn(row RowData, format string, args ...interface{}) {
+	r.Warnings = addRowError(r.Warnings, row, fmt.Sprintf(format, args...))
+}
+
+// addRowError adds the message to the row's entry, rows are expected to be reported in line order.
+func addRowError(errs []RowError, row RowData, msg string) []RowError {
+	if n := len(errs); n > 0 && errs[n-1].Line == row.Line && errs[n-1].Sheet == row.Sheet {
+		errs[n-1].Errors = append(errs[n-1].Errors, msg)
+		return errs
+	}
+
+	return append(errs, RowError{Sheet: row.Sheet, Line: row.Line, AreaCode: row.AreaCode, Name: row.Name, Errors: []string{msg}})
+}
+
+// sort orders the rejected rows and warnings by sheet and line number.
+func (r *Report) sort() {
+	sortRowErrors(r.Rejected)
+	sortRowErrors(r.Warnings)
+}
+
+func sortRowErrors(errs []RowError) {
+	sort.SliceStable(errs, func(i, j int) bool {
+		if errs[i].Sheet != errs[j].Sheet {
+			return errs[i].Sheet < errs[j].Sheet
+		}
+		return errs[i].Line < errs[j].Line
+	})
+}
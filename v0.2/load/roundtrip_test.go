@@ -0,0 +1,102 @@
+package load_test
+
+import (
+	"context"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/export"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/load"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store/memory"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestExportRoundTrip checks an export of each format is read back as the exported rows and that importing it into an
+// empty store recreates the area, area profile and key stats.
+func TestExportRoundTrip(t *testing.T) {
+	ctx := context.Background()
+
+	s := memory.New()
+	if err := s.Seed(ctx, "E05011362", "Disbury East", "Disbury East profile"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := load.DataFromFile(ctx, "1.csv", s, load.DefaultOptions()); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := export.Profiles(ctx, s, nil, export.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 6 {
+		t.Fatalf("expected 6 exported rows, got %d", len(rows))
+	}
+
+	for _, format := range []string{export.CSV, export.JSON} {
+		t.Run(format, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "E05011362."+format)
+
+			f, err := os.Create(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := export.Write(f, format, rows, false); err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+
+			var read []load.RowData
+			report, err := load.ReadFile(filename, load.DefaultReaders(), "", load.DefaultColumnAliases(), func(r load.RowData) error {
+				read = append(read, r)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(report.Rejected) > 0 {
+				t.Fatalf("expected no rejected rows, got %+v", report.Rejected)
+			}
+
+			if len(read) != len(rows) {
+				t.Fatalf("expected %d rows, got %d", len(rows), len(read))
+			}
+
+			for i, r := range read {
+				got := export.Row{
+					AreaCode:    r.AreaCode,
+					Title:       r.Title,
+					Name:        r.Name,
+					Value:       r.Value,
+					Unit:        r.Unit,
+					DatasetID:   r.DatasetID,
+					DatasetName: r.DatasetName,
+				}
+
+				if got != rows[i] {
+					t.Errorf("row %d: expected %+v, got %+v", i, rows[i], got)
+				}
+			}
+
+			target := memory.New()
+			opts := load.DefaultOptions()
+			opts.Profiles = load.CreateMissingProfiles
+
+			if _, err := load.DataFromFile(ctx, filename, target, opts); err != nil {
+				t.Fatal(err)
+			}
+
+			imported, err := export.Profiles(ctx, target, nil, export.Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(imported, rows) {
+				t.Errorf("expected the imported key stats to export as\n%+v\ngot\n%+v", rows, imported)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package load
+
+import (
+	"context"
+	"fmt"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store"
+	"github.com/pkg/errors"
+)
+
+// distinctAreaCodes returns the area codes of the rows in the order they first appear.
+func distinctAreaCodes(rows []RowData) []string {
+	seen := make(map[string]bool)
+	codes := make([]string, 0)
+
+	for _, r := range rows {
+		if !seen[r.AreaCode] {
+			seen[r.AreaCode] = true
+			codes = append(codes, r.AreaCode)
+		}
+	}
+
+	return codes
+}
+
+// validateRows checks each row against the store: the area must have an area profile, the key stat type must exist
+// and be active, the value must be valid for the value type, the unit must exist and each area profile may only have
+// one value of each key stat type. Invalid rows are rejected in the report and the valid rows returned, with a blank
+// unit set to the default unit of the key stat type. A valid row with a title that differs from the area profile name
+// is loaded with a warning.
+func validateRows(ctx context.Context, tx store.Tx, rows []RowData, report *Report) ([]RowData, error) {
+	knownUnits, err := unitCodes(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	profiles, err := tx.GetProfilesByAreaCodes(ctx, distinctAreaCodes(rows))
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting area profiles")
+	}
+
+	statTypes := make(map[string]*store.KeyStatType)
+	inactive := make(map[string]string)
+	seen := make(map[string]string)
+	valid := make([]RowData, 0, len(rows))
+
+	for _, r := range rows {
+		ok := true
+
+		profile, found := profiles[r.AreaCode]
+		if !found {
+			report.reject(r, "area %q has no area profile", r.AreaCode)
+			ok = false
+		}
+
+		statType, cached := statTypes[r.Name]
+		if !cached {
+			if statType, err = getStatType(ctx, tx, r.Name); err != nil {
+				return nil, err
+			}
+			statTypes[r.Name] = statType
+
+			if inactive[r.Name], err = inactiveReason(ctx, tx, statType); err != nil {
+				return nil, err
+			}
+		}
+
+		if statType == nil {
+			report.reject(r, "unknown key stat type %q", r.Name)
+			ok = false
+		} else {
+			if reason := inactive[r.Name]; reason != "" {
+				report.reject(r, "%s", reason)
+				ok = false
+			}
+
+			if err := store.ValidateValue(statType.ValueType, r.Value); err != nil {
+				report.reject(r, "%s", err.Error())
+				ok = false
+			}
+
+			if r.Unit == "" {
+				r.Unit = statType.DefaultUnit
+			}
+
+			if !knownUnits[r.Unit] {
+				report.reject(r, "unknown unit %q", r.Unit)
+				ok = false
+			}
+		}
+
+		key := r.AreaCode + "|" + r.Name
+		if first, dup := seen[key]; dup {
+			report.reject(r, "duplicate value of %q for area %q, first given on %s", r.Name, r.AreaCode, first)
+			ok = false
+		} else {
+			seen[key] = location(r.Sheet, r.Line)
+		}
+
+		if !ok {
+			continue
+		}
+
+		if r.Title != "" && r.Title != profile.Name {
+			report.warn(r, "title %q does not match the area profile name %q", r.Title, profile.Name)
+		}
+
+		valid = append(valid, r)
+	}
+
+	return valid, nil
+}
+
+// inactiveReason returns why values of the key stat type cannot be loaded if it is deprecated or replaced, blank if the
+// key stat type is active or nil. The reason for a replaced key stat type names the replacing type.
+func inactiveReason(ctx context.Context, tx store.Tx, t *store.KeyStatType) (string, error) {
+	if t == nil || t.Status == "" || t.Status == store.StatTypeActive {
+		return "", nil
+	}
+
+	if t.Status == store.StatTypeReplaced && t.ReplacedBy != nil {
+		replacement, err := tx.GetStatTypeByID(ctx, *t.ReplacedBy)
+		if err != nil {
+			return "", errors.Wrapf(err, "error getting the key stat type replacing %q", t.Name)
+		}
+		return fmt.Sprintf("key stat type %q is replaced by %q", t.Name, replacement.Name), nil
+	}
+
+	return fmt.Sprintf("key stat type %q is %s", t.Name, t.Status), nil
+}
+
+// getStatType returns the key stat type with the specified name, nil if there is no such type.
+func getStatType(ctx context.Context, tx store.Tx, name string) (*store.KeyStatType, error) {
+	id, err := tx.GetStatTypeByName(ctx, name)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return tx.GetStatTypeByID(ctx, id)
+}
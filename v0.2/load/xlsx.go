@@ -0,0 +1,207 @@
+package load
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store"
+	"github.com/pkg/errors"
+	"github.com/xuri/excelize/v2"
+	"io"
+	"os"
+	"strings"
+)
+
+// FormatXLSX is an Excel workbook, the rows of each sheet are read as described by an XLSXMapping.
+const FormatXLSX Format = "xlsx"
+
+// errEmptySheet is returned when a sheet has no rows from the header row down. Empty sheets are skipped unless the sheet
+// is mapped.
+var errEmptySheet = errors.New("sheet is empty")
+
+// XLSXMapping describes how the sheets of a workbook map onto data file columns. If no sheets are listed every sheet is
+// read with its headers on the first row, empty sheets are skipped.
+type XLSXMapping struct {
+	Sheets []SheetMapping `json:"sheets"`
+}
+
+// SheetMapping maps a sheet of a workbook onto data file columns. HeaderRow is the row number of the headers, rows above
+// it e.g. titles and notes are ignored, the first row if not set. Columns maps a column to the header of the sheet
+// column it is read from, columns not mapped are matched by the column aliases. Values are the value of a column for
+// every row of the sheet e.g. the dataset of a sheet per dataset.
+type SheetMapping struct {
+	Sheet     string            `json:"sheet"`
+	HeaderRow int               `json:"header_row"`
+	Columns   map[string]string `json:"columns"`
+	Values    map[string]string `json:"values"`
+}
+
+// XLSXMappingFromFile returns the workbook mapping in the JSON file e.g.
+//
+//	{"sheets": [{"sheet": "TS001", "header_row": 3, "columns": {"area_code": "Ward code"}, "values": {"dataset_id": "TS001"}}]}
+func XLSXMappingFromFile(filename string) (*XLSXMapping, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading XLSX mapping file %q", filename)
+	}
+
+	var m XLSXMapping
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, errors.Wrapf(err, "error parsing XLSX mapping file %q", filename)
+	}
+
+	if err := m.validate(); err != nil {
+		return nil, errors.Wrapf(err, "XLSX mapping file %q", filename)
+	}
+
+	return &m, nil
+}
+
+func (m XLSXMapping) validate() error {
+	known := DefaultColumnAliases()
+	seen := make(map[string]bool)
+
+	for i, s := range m.Sheets {
+		if s.Sheet == "" {
+			return fmt.Errorf("sheet %d: sheet name is required", i+1)
+		}
+
+		if seen[s.Sheet] {
+			return fmt.Errorf("sheet %q is mapped more than once", s.Sheet)
+		}
+		seen[s.Sheet] = true
+
+		if s.HeaderRow < 0 {
+			return fmt.Errorf("sheet %q: invalid header row %d", s.Sheet, s.HeaderRow)
+		}
+
+		for col := range s.Columns {
+			if _, ok := known[col]; !ok {
+				return fmt.Errorf("sheet %q: unknown column %q", s.Sheet, col)
+			}
+
+			if _, ok := s.Values[col]; ok {
+				return fmt.Errorf("sheet %q: column %q has both a header and a value", s.Sheet, col)
+			}
+		}
+
+		for col := range s.Values {
+			if _, ok := known[col]; !ok {
+				return fmt.Errorf("sheet %q: unknown column %q", s.Sheet, col)
+			}
+		}
+	}
+
+	return nil
+}
+
+// xlsxReader reads the rows of the sheets of an Excel workbook. Cells are read as displayed so formatted numbers e.g.
+// "12,500" or "81.2%" are accepted, blank rows are ignored. The line of a row is its row number in the sheet.
+type xlsxReader struct {
+	mapping XLSXMapping
+}
+
+// NewXLSXReader returns a reader of Excel workbooks using the mapping.
+func NewXLSXReader(mapping XLSXMapping) Reader {
+	return xlsxReader{mapping: mapping}
+}
+
+func (x xlsxReader) Read(in io.Reader, aliases ColumnAliases, report *Report, fn RowFunc) error {
+	f, err := excelize.OpenReader(in)
+	if err != nil {
+		return errors.Wrap(err, "error opening XLSX workbook")
+	}
+	defer f.Close()
+
+	sheets := x.mapping.Sheets
+	mapped := len(sheets) > 0
+	if !mapped {
+		for _, name := range f.GetSheetList() {
+			sheets = append(sheets, SheetMapping{Sheet: name})
+		}
+	}
+
+	for _, s := range sheets {
+		err := readSheet(f, s, aliases, report, fn)
+		if errors.Is(err, errEmptySheet) && !mapped {
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "sheet %q", s.Sheet)
+		}
+	}
+
+	return nil
+}
+
+// readSheet reads the rows below the header row of the sheet calling fn with each row. Returns an error if the sheet
+// does not exist, the header is invalid or fn returns an error.
+func readSheet(f *excelize.File, s SheetMapping, aliases ColumnAliases, report *Report, fn RowFunc) error {
+	if idx, err := f.GetSheetIndex(s.Sheet); err != nil || idx < 0 {
+		return errors.New("sheet does not exist")
+	}
+
+	cells, err := f.GetRows(s.Sheet)
+	if err != nil {
+		return errors.Wrap(err, "error reading sheet")
+	}
+
+	headerRow := s.HeaderRow
+	if headerRow == 0 {
+		headerRow = 1
+	}
+
+	if len(cells) < headerRow {
+		return errors.Wrapf(errEmptySheet, "header row %d", headerRow)
+	}
+
+	cols, err := s.aliases(aliases).columns(cells[headerRow-1], s.Values)
+	if err != nil {
+		return errors.Wrapf(err, "header row %d", headerRow)
+	}
+
+	for i := headerRow; i < len(cells); i++ {
+		row := cells[i]
+		if strings.TrimSpace(strings.Join(row, "")) == "" {
+			continue
+		}
+
+		report.Rows++
+
+		field := func(col string) string {
+			if v, ok := s.Values[col]; ok {
+				return strings.TrimSpace(v)
+			}
+			if j, ok := cols[col]; ok && j < len(row) {
+				return strings.TrimSpace(row[j])
+			}
+			return ""
+		}
+
+		if data, ok := parseRow(s.Sheet, i+1, field, store.ParseValue, report); ok {
+			if err := fn(data); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// aliases returns the column aliases of the sheet. A column mapped to a header matches that header instead of the
+// default aliases and a column with a value is not read from the sheet.
+func (s SheetMapping) aliases(defaults ColumnAliases) ColumnAliases {
+	aliases := make(ColumnAliases, len(defaults))
+	for col, names := range defaults {
+		aliases[col] = names
+	}
+
+	for col, header := range s.Columns {
+		aliases[col] = []string{header}
+	}
+
+	for col := range s.Values {
+		delete(aliases, col)
+	}
+
+	return aliases
+}
@@ -0,0 +1,247 @@
+package load
+
+import (
+	"github.com/xuri/excelize/v2"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testSheet is a sheet of a test workbook, cells are written from A1.
+type testSheet struct {
+	name string
+	rows [][]interface{}
+}
+
+// formatted is a number cell displayed with an Excel built in number format e.g. 3 "#,##0" or 10 "0.00%".
+type formatted struct {
+	value  float64
+	numFmt int
+}
+
+// workbook returns the content of an Excel workbook with the sheets in order.
+func workbook(t *testing.T, sheets ...testSheet) string {
+	t.Helper()
+
+	f := excelize.NewFile()
+	defer f.Close()
+
+	for i, s := range sheets {
+		if i == 0 {
+			if err := f.SetSheetName("Sheet1", s.name); err != nil {
+				t.Fatal(err)
+			}
+		} else if _, err := f.NewSheet(s.name); err != nil {
+			t.Fatal(err)
+		}
+
+		for r, row := range s.rows {
+			for c, v := range row {
+				cell, err := excelize.CoordinatesToCellName(c+1, r+1)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if fv, ok := v.(formatted); ok {
+					style, err := f.NewStyle(&excelize.Style{NumFmt: fv.numFmt})
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					if err := f.SetCellStyle(s.name, cell, cell, style); err != nil {
+						t.Fatal(err)
+					}
+					v = fv.value
+				}
+
+				if err := f.SetCellValue(s.name, cell, v); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	}
+
+	buf, err := f.WriteToBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.String()
+}
+
+// header is the header row of a test sheet using the default column names.
+var header = []interface{}{"area_code", "name", "value", "unit", "dataset_id"}
+
+func TestXLSXReaderSheets(t *testing.T) {
+	in := workbook(t,
+		testSheet{name: "Notes"},
+		testSheet{name: "TS001", rows: [][]interface{}{
+			header,
+			{"E05011362", "Resident population", 12890, "", "TS001"},
+			{},
+			{"E05011363", "Resident population", 10345, "", "TS001"},
+		}},
+		testSheet{name: "TS007", rows: [][]interface{}{
+			{"Geography Code", "Key Stat", "Value", "Unit", "Dataset ID"},
+			{"E05011362", "Average (mean) age", 39.5, "years", "TS007"},
+		}},
+	)
+
+	rows, report, err := read(xlsxReader{}, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every sheet is read with its headers on the first row, the empty sheet and blank rows are skipped.
+	expected := []RowData{
+		{Sheet: "TS001", Line: 2, AreaCode: "E05011362", Name: "Resident population", Value: 12890, DatasetID: "TS001"},
+		{Sheet: "TS001", Line: 4, AreaCode: "E05011363", Name: "Resident population", Value: 10345, DatasetID: "TS001"},
+		{Sheet: "TS007", Line: 2, AreaCode: "E05011362", Name: "Average (mean) age", Value: 39.5, Unit: "years", DatasetID: "TS007"},
+	}
+
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("expected rows\n%+v\ngot\n%+v", expected, rows)
+	}
+
+	if report.Rows != 3 || len(report.Rejected) != 0 {
+		t.Errorf("expected 3 rows and none rejected, got %d rows and %+v", report.Rows, report.Rejected)
+	}
+}
+
+func TestXLSXReaderMapping(t *testing.T) {
+	in := workbook(t,
+		testSheet{name: "Contents", rows: [][]interface{}{{"area_code"}, {"E05011362"}}},
+		testSheet{name: "Census 2021", rows: [][]interface{}{
+			{"Key statistics for wards"},
+			{"Source: Census 2021"},
+			{"Ward code", "Key Stat", "Value", "Unit", "Notes"},
+			{"E05011362", "Resident population", formatted{12500, 3}, "", "ignored"},
+			{"E05011362", "Percentage of households with 1 person", formatted{0.812, 10}, "%", "ignored"},
+			{"E05011363", "Resident population", "n/a", "", "ignored"},
+			{"", "Resident population", 10345, "", "ignored"},
+		}},
+	)
+
+	mapping := XLSXMapping{Sheets: []SheetMapping{{
+		Sheet:     "Census 2021",
+		HeaderRow: 3,
+		Columns:   map[string]string{ColumnAreaCode: "Ward code"},
+		Values:    map[string]string{ColumnDatasetID: "TS001"},
+	}}}
+
+	rows, report, err := read(NewXLSXReader(mapping), in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only the mapped sheet is read, the area code is read from the mapped header and the dataset is the sheet value.
+	expected := []RowData{
+		{Sheet: "Census 2021", Line: 4, AreaCode: "E05011362", Name: "Resident population", Value: 12500, DatasetID: "TS001"},
+		{Sheet: "Census 2021", Line: 5, AreaCode: "E05011362", Name: "Percentage of households with 1 person", Value: 81.2,
+			Unit: "%", DatasetID: "TS001"},
+	}
+
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("expected rows\n%+v\ngot\n%+v", expected, rows)
+	}
+
+	rejected := []RowError{
+		{Sheet: "Census 2021", Line: 6, AreaCode: "E05011363", Name: "Resident population", Errors: []string{`value "n/a" is not a number`}},
+		{Sheet: "Census 2021", Line: 7, Name: "Resident population", Errors: []string{"area_code is required"}},
+	}
+
+	if !reflect.DeepEqual(report.Rejected, rejected) {
+		t.Errorf("expected rejected rows\n%+v\ngot\n%+v", rejected, report.Rejected)
+	}
+
+	if report.Rows != 4 {
+		t.Errorf("expected 4 rows, got %d", report.Rows)
+	}
+}
+
+func TestXLSXReaderErrors(t *testing.T) {
+	in := workbook(t,
+		testSheet{name: "TS001", rows: [][]interface{}{header, {"E05011362", "Resident population", 1, "", "TS001"}}},
+		testSheet{name: "Empty"},
+		testSheet{name: "No headers", rows: [][]interface{}{{"a", "b"}, {"1", "2"}}},
+	)
+
+	cases := []struct {
+		name  string
+		sheet SheetMapping
+		err   string
+	}{
+		{name: "missing sheet", sheet: SheetMapping{Sheet: "TS002"}, err: `sheet "TS002": sheet does not exist`},
+		{name: "empty mapped sheet", sheet: SheetMapping{Sheet: "Empty"}, err: `sheet "Empty": header row 1: sheet is empty`},
+		{name: "header row below the data", sheet: SheetMapping{Sheet: "TS001", HeaderRow: 5}, err: `sheet "TS001": header row 5`},
+		{name: "invalid header", sheet: SheetMapping{Sheet: "No headers"}, err: `sheet "No headers": header row 1`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, _, err := read(NewXLSXReader(XLSXMapping{Sheets: []SheetMapping{c.sheet}}), in)
+			if err == nil || !strings.HasPrefix(err.Error(), c.err) {
+				t.Errorf("expected an error starting %q, got %v", c.err, err)
+			}
+		})
+	}
+}
+
+func TestXLSXMappingValidate(t *testing.T) {
+	cases := []struct {
+		name    string
+		mapping XLSXMapping
+		err     string
+	}{
+		{
+			name:    "valid",
+			mapping: XLSXMapping{Sheets: []SheetMapping{{Sheet: "TS001", HeaderRow: 3, Columns: map[string]string{ColumnAreaCode: "Ward code"}}}},
+		},
+		{
+			name:    "sheet name required",
+			mapping: XLSXMapping{Sheets: []SheetMapping{{HeaderRow: 3}}},
+			err:     "sheet 1: sheet name is required",
+		},
+		{
+			name:    "sheet mapped twice",
+			mapping: XLSXMapping{Sheets: []SheetMapping{{Sheet: "TS001"}, {Sheet: "TS001"}}},
+			err:     `sheet "TS001" is mapped more than once`,
+		},
+		{
+			name:    "negative header row",
+			mapping: XLSXMapping{Sheets: []SheetMapping{{Sheet: "TS001", HeaderRow: -1}}},
+			err:     `sheet "TS001": invalid header row -1`,
+		},
+		{
+			name:    "unknown column",
+			mapping: XLSXMapping{Sheets: []SheetMapping{{Sheet: "TS001", Columns: map[string]string{"ward": "Ward code"}}}},
+			err:     `sheet "TS001": unknown column "ward"`,
+		},
+		{
+			name: "column with a header and a value",
+			mapping: XLSXMapping{Sheets: []SheetMapping{{
+				Sheet:   "TS001",
+				Columns: map[string]string{ColumnDatasetID: "Dataset"},
+				Values:  map[string]string{ColumnDatasetID: "TS001"},
+			}}},
+			err: `sheet "TS001": column "dataset_id" has both a header and a value`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.mapping.validate()
+
+			if c.err == "" {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+				return
+			}
+
+			if err == nil || err.Error() != c.err {
+				t.Errorf("expected %q, got %v", c.err, err)
+			}
+		})
+	}
+}
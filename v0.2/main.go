@@ -1,10 +1,17 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/config"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/export"
 	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/handlers"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/listen"
 	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/load"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/recipes"
 	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store/memory"
 	log "github.com/daiLlew/funkylog"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
@@ -12,7 +19,12 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"syscall"
+	"text/tabwriter"
+	"time"
 )
 
 // Test data.
@@ -24,9 +36,66 @@ var (
 
 // Flags
 var (
-	fLoadFiles []string
+	fLoadFiles   []string
+	fImportFiles []string
+	fLookupFiles []string
+	fReset       bool
+	fSeed        bool
+	fAtomic      bool
+	fStatTypes   string
+	fRows        string
+	fProfiles    string
+	fAreaNames   string
+	fColumns     string
+	fReport      string
+	fDryRun      bool
+	fForce       bool
+	fBulk        bool
+	fFormat      string
+	fXLSXMapping string
+	fExportFile  string
+	fExportDir   string
+	fExportFmt   string
+	fVersion     string
+	fHistory     bool
+	fOutput      string
+	fStore       string
+	fDataset     string
+	fEdition     string
+	fFixtures    string
+	fPort        int
+	fQueue       string
+	fQueueDir    string
+	fMaxAttempts int
+	fRetryDelay  time.Duration
 )
 
+// Supported store types.
+const (
+	postgresStore = "postgres"
+	memoryStore   = "memory"
+)
+
+// Supported import output formats.
+const (
+	tableOutput = "table"
+	jsonOutput  = "json"
+)
+
+// Supported queue types.
+const (
+	fileQueue   = "file"
+	memoryQueue = "memory"
+)
+
+// appStore is the store functionality required by the poc commands.
+type appStore interface {
+	handlers.DB
+	load.Store
+	Init(ctx context.Context, reset bool) error
+	Seed(ctx context.Context, areaCode, areaName, areaProfileName string) error
+}
+
 func main() {
 	if err := run(); err != nil {
 		log.Err("application error: %+v\n", err)
@@ -36,80 +105,486 @@ func main() {
 
 func run() error {
 	cmd := &cobra.Command{}
-	cmd.AddCommand(initCMD(), apiCMD())
+	cmd.AddCommand(initCMD(), migrateCMD(), importCMD(), exportCMD(), apiCMD(), recipesCMD(), listenCMD())
 
-	return cmd.Execute()
+	return cmd.ExecuteContext(context.Background())
 }
 
 func initCMD() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "init",
-		Short: "Initalise the database, drops existing tables/data, recreates the schema and populates with a default area",
-		Long: `The init command re-initalises the area_profiles database. Any existing tables are dropped, recreated and populated with a default area.
-Use the init command to create the database for the first time or to tear down and recreate an existing database from scratch.
+		Short: "Initalise the database, applies any outstanding schema migrations and optionally adds a test area profile",
+		Long: `The init command initalises the area_profiles database by applying any outstanding schema migrations. Existing
+data is retained. Use the --reset flag to roll back all migrations first, dropping any existing tables/data, including
+the tables of a database created before schema migrations were introduced, and recreating the schema from scratch. Use the --seed flag to add the test area/area profile only, the default key stat
+types are added by the schema migrations.
+
+Using the -l flag you can specify 1 or more data files to load. If no file(s) are specified the key stats tables will
+be empty. Each file is loaded in its own transaction, either all of its rows are imported as a new version of the key
+stats or none are. Use the --atomic flag to load all of the specified files in a single transaction.
+
+Data files may be CSV, a JSON array of objects, newline delimited JSON or an Excel workbook, the format is determined
+by the file extension (.csv, .json, .ndjson, .jsonl or .xlsx) or set for every file with --format. Every sheet of a
+workbook is read with its headers on the first row, use --xlsx-mapping to specify a JSON file choosing the sheets,
+header row, column headers and fixed column values of each sheet. Columns are mapped by CSV header or JSON key name,
+use --columns to specify a JSON file of extra names for each column.
+
+Every row is validated and rejected rows are listed, with their line numbers, in the load report. Use --report to write
+the report to a JSON file. By default a file with any rejected rows is not loaded, use --rows=load-valid to load the
+valid rows instead. Rows with a key stat type that does not exist are rejected, use --stat-types=register to add
+unknown key stat types instead. Each file loaded is recorded in the imports ledger, a file identical to a previously
+completed import is skipped unless --force is set.
 
-Using the -l flag you can specify 1 or more data files to load. If no file(s) are specified the key stats tables will be empty.`,
+Rows for an area without an area profile are rejected, use --profiles=create to create the area, if it does not exist,
+and its area profile instead. The profile is named by the title column, use --area-names to name the new areas from a
+CSV file of area codes and names e.g. an ONS names and codes file with the columns WD22CD,WD22NM.
+
+Use --bulk for large files e.g. census key stats for every output area. The valid rows of each file are copied into a
+staging table using the postgres COPY protocol and merged into the key stats and key stats history in a few set-wise
+statements instead of being inserted row by row. Progress and throughput are logged as the rows are loaded.
+
+Use the --lookup flag to load the area hierarchy from 1 or more ONS style geography lookup files, e.g. an OA to LSOA
+to MSOA to LAD lookup with the columns OA21CD,LSOA21CD,LSOA21NM,MSOA21CD,MSOA21NM,LAD22CD,LAD22NM. Lookup files are
+loaded before the data files. Format --lookup=file1 --lookup=file2
+
+Use --store=memory to run against an in-memory store instead of postgres, e.g. to check the data files load without
+error.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cfg, err := config.Get()
+			db, err := newStore(cmd.Context())
 			if err != nil {
 				return err
 			}
 
-			db, err := store.New(cfg.Username, cfg.Password, cfg.Database)
+			defer db.Close()
+
+			if err := db.Init(cmd.Context(), fReset); err != nil {
+				return err
+			}
+
+			if fSeed {
+				if err := db.Seed(cmd.Context(), TestAreaCode, TestAreaName, TestAreaProfileName); err != nil {
+					return err
+				}
+			}
+
+			if err := loadLookupFiles(cmd.Context(), db); err != nil {
+				return err
+			}
+
+			if err := loadFiles(cmd.Context(), db); err != nil {
+				return err
+			}
+
+			log.Info("init completed successfully")
+			return nil
+		},
+	}
+	cmd.Flags().StringArrayVarP(&fLoadFiles, "load", "l", []string{}, "A list of data import files to load (Optional). Format -l=file1 -l=file2 -l=fileN")
+	cmd.Flags().StringArrayVar(&fLookupFiles, "lookup", []string{}, "A list of geography lookup files to load the area hierarchy from (Optional). Format --lookup=file1 --lookup=file2")
+	cmd.Flags().BoolVar(&fReset, "reset", false, "Roll back all migrations, dropping existing tables and data, before migrating up (Optional)")
+	cmd.Flags().BoolVar(&fAtomic, "atomic", false, "Load all of the specified data files in a single transaction (Optional)")
+	addLoadFlags(cmd)
+	cmd.Flags().BoolVar(&fForce, "force", false, "Load files identical to a previously completed import instead of skipping them (Optional)")
+	cmd.Flags().BoolVar(&fSeed, "seed", false, "Add the test area and area profile, the default key stat types are added by the schema migrations (Optional)")
+	cmd.Flags().StringVar(&fStore, "store", postgresStore, "The store implementation to use: postgres or memory. The memory store is discarded when the command exits (Optional)")
+	return cmd
+}
+
+// addLoadFlags registers the flags configuring how data files are loaded, shared by the commands that load data files.
+func addLoadFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&fStatTypes, "stat-types", string(load.RejectUnknownStatTypes), "How data files with unknown key stat types are handled: reject or register (Optional)")
+	cmd.Flags().StringVar(&fRows, "rows", string(load.FailAll), "How data files with rejected rows are handled: fail-all or load-valid (Optional)")
+	cmd.Flags().StringVar(&fProfiles, "profiles", string(load.RejectMissingProfiles), "How rows for areas without an area profile are handled: reject or create (Optional)")
+	cmd.Flags().StringVar(&fAreaNames, "area-names", "", "A CSV file of area code and name used to name the areas created by --profiles=create (Optional)")
+	cmd.Flags().BoolVar(&fBulk, "bulk", false, "Stage the rows of each data file with COPY and merge them into the key stats set-wise (Optional)")
+	cmd.Flags().StringVar(&fColumns, "columns", "", "A JSON file of extra header names for each data file column (Optional)")
+	cmd.Flags().StringVar(&fFormat, "format", "", "The format of the data files: csv, json, ndjson or xlsx. Determined by the file extension if not set (Optional)")
+	cmd.Flags().StringVar(&fXLSXMapping, "xlsx-mapping", "", "A JSON file mapping the sheets of XLSX workbooks onto data file columns (Optional)")
+	cmd.Flags().StringVar(&fReport, "report", "", "Write the JSON load report to the specified file (Optional)")
+}
+
+func importCMD() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import [file|glob|dir]...",
+		Short: "Import data files into the existing database as a new version of the key stats",
+		Long: `The import command loads 1 or more data files into the existing area_profiles database without applying
+migrations or removing any existing data. Files are specified as arguments or using the -f flag and may be a file, a
+glob or a directory, a directory imports each .csv, .json, .ndjson, .jsonl and .xlsx file in it. Paths are relative
+to the current directory e.g.
+	./poc import data/2023.csv "data/wards-*.csv" -f=data/lsoa
+
+Each file is imported as described in the init command help, the --atomic, --columns, --rows, --stat-types,
+--profiles, --area-names, --bulk, --format, --xlsx-mapping and --report flags are supported. The number of key stats
+inserted, updated and unchanged and the new key stats version of each area profile are printed. Use --output=json to
+print the import reports as JSON instead of a table. Files identical to a previously completed import are skipped, use
+--force to import them again.
+
+Use --dry-run to preview an import without writing anything. Each file is validated and compared with the current key
+stats of each area profile, the key stats that would be added, changed (old and new value) or left unchanged are
+printed. Files are previewed in turn as if the previous files had been imported. The preview is included in the
+--report file. A dry run compares each key stat so --bulk is ignored.
+
+Use --store=memory to check the files import without error. The in-memory store is seeded with the default area
+profile.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			fNames, err := expandFiles(append(args, fImportFiles...))
 			if err != nil {
 				return err
 			}
 
-			defer db.Close()
+			if len(fNames) == 0 {
+				return errors.New("no data files specified, pass 1 or more files, globs or directories")
+			}
 
-			if err := db.Init(TestAreaCode, TestAreaName, TestAreaProfileName); err != nil {
+			db, err := newStore(cmd.Context())
+			if err != nil {
 				return err
 			}
 
-			if len(fLoadFiles) == 0 {
-				log.Info("init completed successfully")
-				return nil
+			defer db.Close()
+
+			if fStore == memoryStore {
+				if err := db.Init(cmd.Context(), false); err != nil {
+					return err
+				}
+
+				if err := db.Seed(cmd.Context(), TestAreaCode, TestAreaName, TestAreaProfileName); err != nil {
+					return err
+				}
 			}
 
-			log.Info("loading test data into area_profiles database")
-			for _, f := range fLoadFiles {
-				fName := filepath.Join("load", f)
+			if fOutput != tableOutput && fOutput != jsonOutput {
+				return errors.Errorf("unknown output format %q, expected %q or %q", fOutput, tableOutput, jsonOutput)
+			}
+
+			reports, err := importFiles(cmd.Context(), db, fNames)
+
+			if outErr := writeImportOutput(reports); outErr != nil && err == nil {
+				err = outErr
+			}
+
+			return err
+		},
+	}
+	cmd.Flags().BoolVarP(&fDryRun, "dry-run", "d", false, "Preview the changes to the key stats without writing anything (Optional)")
+	cmd.Flags().StringVar(&fOutput, "output", tableOutput, "The output format: table or json (Optional)")
+	cmd.Flags().BoolVar(&fForce, "force", false, "Import files identical to a previously completed import instead of skipping them (Optional)")
+	cmd.Flags().StringArrayVarP(&fImportFiles, "file", "f", []string{}, "A list of data files, globs or directories to import (Optional). Format -f=file1 -f=dir -f=\"*.csv\"")
+	cmd.Flags().BoolVar(&fAtomic, "atomic", false, "Import all of the specified data files in a single transaction (Optional)")
+	addLoadFlags(cmd)
+	cmd.Flags().StringVar(&fStore, "store", postgresStore, "The store implementation to use: postgres or memory. The memory store is discarded when the command exits (Optional)")
+	return cmd
+}
+
+func exportCMD() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export [area_code]...",
+		Short: "Export the key stats of area profiles as a data file that can be imported",
+		Long: `The export command writes the key stats of the specified area profiles, every area profile if none are specified, as a 
+data file in the format accepted by the init and import commands. Each row is a key stat with the area profile name as 
+the title, values are written without rounding and the unit is always written so importing the file into another 
+database loads the same key stats e.g.
+	./poc export E05011362 -o=E05011362.csv
+	./poc import --profiles=create E05011362.csv
+
+Use --format=json to write a JSON array of rows instead of CSV, the format is determined by the -o file extension if 
+not set. The current key stats are exported by default, use --version to export a version of each area profile, a 
+version number, latest or a version timestamp. Use --history to export every version, the version number and date of 
+each row are added as extra columns which are ignored by the loader. To move the history to another database use 
+--history with --dir, one data file is written per version number and importing the files in order recreates the 
+versions of each area profile e.g.
+	./poc export --history --dir=history
+	./poc import history/version-001.csv history/version-002.csv
+
+The version dates are not kept: each file holds that version number of every area profile whatever its date, and the 
+imported versions are dated when they are imported.
+
+Use --store=memory with the -l and --lookup flags to export data files loaded into an in-memory store.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			format := fExportFmt
+			if format == "" {
+				format = export.CSV
+				if strings.EqualFold(filepath.Ext(fExportFile), ".json") {
+					format = export.JSON
+				}
+			}
+
+			if format != export.CSV && format != export.JSON {
+				return errors.Errorf("unknown export format %q, expected %q or %q", format, export.CSV, export.JSON)
+			}
+
+			if fExportDir != "" && !fHistory {
+				return errors.New("--dir is only supported with --history")
+			}
+
+			if fStore != memoryStore && (len(fLoadFiles) > 0 || len(fLookupFiles) > 0) {
+				return errors.New("the -l and --lookup flags are only supported with --store=memory")
+			}
+
+			db, err := newStore(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			defer db.Close()
+
+			if fStore == memoryStore {
+				if err := db.Init(cmd.Context(), false); err != nil {
+					return err
+				}
+
+				if err := db.Seed(cmd.Context(), TestAreaCode, TestAreaName, TestAreaProfileName); err != nil {
+					return err
+				}
 
-				if err := load.DataFromFile(fName, db); err != nil {
+				if err := loadLookupFiles(cmd.Context(), db); err != nil {
 					return err
 				}
 
-				log.Info("successfully loaded test data: %s", fName)
+				if err := loadFiles(cmd.Context(), db); err != nil {
+					return err
+				}
+			}
+
+			opts := export.Options{Version: fVersion, History: fHistory}
+			rows, err := export.Profiles(cmd.Context(), db, args, opts)
+			if err != nil {
+				return err
 			}
 
+			if fExportDir != "" {
+				return writeExportDir(fExportDir, format, rows)
+			}
+
+			filename := fExportFile
+			if filename == "" {
+				filename = "export." + format
+			}
+
+			if err := writeExportFile(filename, format, rows, fHistory); err != nil {
+				return err
+			}
+
+			log.Info("exported %d key stats to %s", len(rows), filename)
 			return nil
 		},
 	}
-	cmd.Flags().StringArrayVarP(&fLoadFiles, "load", "l", []string{}, "A list of data import files to load (Optional). Format -l=file1 -l=file2 -l=fileN")
+	cmd.Flags().StringVarP(&fExportFile, "out", "o", "", "The file to write the export to (Optional). Default export.csv or export.json")
+	cmd.Flags().StringVar(&fExportDir, "dir", "", "Write a data file per key stats version number into the directory, requires --history. The version dates are not kept (Optional)")
+	cmd.Flags().StringVar(&fExportFmt, "format", "", "The export format: csv or json. Determined by the -o file extension if not set (Optional)")
+	cmd.Flags().StringVar(&fVersion, "version", "", "The key stats version of each area profile to export: a version number, latest or a version timestamp (Optional)")
+	cmd.Flags().BoolVar(&fHistory, "history", false, "Export every version of the key stats (Optional)")
+	cmd.Flags().StringVar(&fStore, "store", postgresStore, "The store implementation to use: postgres or memory (Optional)")
+	cmd.Flags().StringArrayVarP(&fLoadFiles, "load", "l", []string{}, "A list of data import files to load into the in-memory store (Optional)")
+	cmd.Flags().StringArrayVar(&fLookupFiles, "lookup", []string{}, "A list of geography lookup files to load into the in-memory store (Optional)")
 	return cmd
 }
 
+// writeExportFile writes the exported rows to the file in the specified format.
+func writeExportFile(filename, format string, rows []export.Row, history bool) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return errors.Wrapf(err, "error creating export file %q", filename)
+	}
+
+	if err := export.Write(f, format, rows, history); err != nil {
+		f.Close()
+		return errors.Wrapf(err, "error writing export file %q", filename)
+	}
+
+	return f.Close()
+}
+
+// writeExportDir writes the rows of a history export to a data file per version number e.g. version-001.csv.
+func writeExportDir(dir, format string, rows []export.Row) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrapf(err, "error creating export directory %q", dir)
+	}
+
+	for i, versionRows := range export.ByVersion(rows) {
+		filename := filepath.Join(dir, fmt.Sprintf("version-%03d.%s", i+1, format))
+		if err := writeExportFile(filename, format, versionRows, false); err != nil {
+			return err
+		}
+		log.Info("exported %d key stats to %s", len(versionRows), filename)
+	}
+
+	return nil
+}
+
+func migrateCMD() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Manage the versioned database schema migrations",
+		Long: `The migrate command applies or rolls back the versioned schema migrations embedded in the poc binary. 
+Applied migrations are recorded in the schema_migrations table.`,
+	}
+
+	up := &cobra.Command{
+		Use:   "up",
+		Short: "Apply all outstanding migrations",
+		Args:  cobra.NoArgs,
+		RunE: withStore(func(ctx context.Context, db *store.AreaProfileStore, args []string) error {
+			return db.MigrateUp(ctx)
+		}),
+	}
+
+	down := &cobra.Command{
+		Use:   "down",
+		Short: "Roll back the most recently applied migration",
+		Args:  cobra.NoArgs,
+		RunE: withStore(func(ctx context.Context, db *store.AreaProfileStore, args []string) error {
+			return db.MigrateDown(ctx)
+		}),
+	}
+
+	to := &cobra.Command{
+		Use:   "to <version>",
+		Short: "Apply or roll back migrations until the schema is at the specified version. Version 0 is an empty schema",
+		Args:  cobra.ExactArgs(1),
+		RunE: withStore(func(ctx context.Context, db *store.AreaProfileStore, args []string) error {
+			version, err := strconv.Atoi(args[0])
+			if err != nil {
+				return errors.Errorf("invalid migration version %q", args[0])
+			}
+			return db.MigrateTo(ctx, version)
+		}),
+	}
+
+	status := &cobra.Command{
+		Use:   "status",
+		Short: "List the migrations and whether each has been applied",
+		Args:  cobra.NoArgs,
+		RunE: withStore(func(ctx context.Context, db *store.AreaProfileStore, args []string) error {
+			statuses, err := db.MigrationStatus(ctx)
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+			for _, m := range statuses {
+				appliedAt := "pending"
+				if m.Applied {
+					appliedAt = m.AppliedAt.Format(time.RFC3339)
+				}
+				fmt.Fprintf(w, "%d\t%s\t%s\n", m.Version, m.Name, appliedAt)
+			}
+			return w.Flush()
+		}),
+	}
+
+	cmd.AddCommand(up, down, to, status)
+	return cmd
+}
+
+// withStore returns a cobra RunE func that opens the area profiles store, invokes fn and closes the store once fn returns.
+func withStore(fn func(ctx context.Context, db *store.AreaProfileStore, args []string) error) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Get()
+		if err != nil {
+			return err
+		}
+
+		db, err := store.New(cmd.Context(), cfg)
+		if err != nil {
+			return err
+		}
+
+		defer db.Close()
+		return fn(cmd.Context(), db, args)
+	}
+}
+
 func apiCMD() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "api",
 		Short: "Start the demo area profiles API.",
 		Long: `Start the demo area profiles API. The API runs on port :8080 and exposes the following endpoints:
+	POST: /areas
+	GET: /areas/{code}
+	PUT: /areas/{code}
+	DELETE: /areas/{code}
+	GET: /areas/{code}/children
+	GET: /areas/{code}/ancestors
+	GET: /geography-types
+	GET: /stat-types?status={status}
+	POST: /stat-types
+	GET: /stat-types/{id}
+	PATCH: /stat-types/{id}
+	GET: /units
 	GET: /profiles
+	POST: /profiles
 	GET: /profiles/{area_code}
+	PUT: /profiles/{area_code}
+	DELETE: /profiles/{area_code}
+	GET: /profiles/{area_code}/export?format={csv|json}&version={version}&history={true|false}
 	GET: /profiles/{area_code}/stats
+	POST: /profiles/{area_code}/stats
+	DELETE: /profiles/{area_code}/stats
+	PUT: /profiles/{area_code}/stats/{stat_type}
+	GET: /profiles/{area_code}/stats/{stat_type}/history
 	GET: /profiles/{area_code}/stats/versions
-	GET: /profiles/{area_code}/stats/versions/{version}`,
+	GET: /profiles/{area_code}/stats/versions/{version}
+	GET: /profiles/{area_code}/stats/versions/{from}/diff/{to}
+	GET: /recipes?dataset_id={dataset_id}&edition={edition}
+	POST: /recipes
+	GET: /recipes/{id}
+	PUT: /recipes/{id}
+	DELETE: /recipes/{id}
+	GET: /datasets
+	GET: /datasets/{id}
+	GET: /datasets/{id}/stats
+	GET: /imports?status={status}
+	GET: /imports/{id}
+	GET: /health
+
+{version}, {from} and {to} are each a version number, "latest" or a version timestamp e.g. 2022-04-11T16:12:25.30247Z
+
+The database connection pool can be tuned using the following env vars:
+	AP_DB_MIN_CONNS            (default 2)
+	AP_DB_MAX_CONNS            (default 10)
+	AP_DB_ACQUIRE_TIMEOUT      (default 5s)
+	AP_DB_HEALTH_CHECK_PERIOD  (default 30s)
+
+Each request's database queries must complete within AP_QUERY_TIMEOUT (default 10s) or the request fails with a 504.
+
+Use --store=memory to run the API without postgres. The in-memory store is seeded with the default area profile and 
+the geography lookup files and data files specified using the --lookup and -l flags are loaded on start up. 
+Format -l=file1 -l=file2 -l=fileN`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cfg, err := config.Get()
+			queryTimeout, err := config.GetQueryTimeout()
 			if err != nil {
 				return err
 			}
 
-			db, err := store.New(cfg.Username, cfg.Password, cfg.Database)
+			if fStore != memoryStore && (len(fLoadFiles) > 0 || len(fLookupFiles) > 0) {
+				return errors.New("the -l and --lookup flags are only supported with --store=memory, use the init command to load data into postgres")
+			}
+
+			db, err := newStore(cmd.Context())
 			if err != nil {
 				return err
 			}
 
+			if fStore == memoryStore {
+				if err := db.Init(cmd.Context(), false); err != nil {
+					return err
+				}
+
+				if err := db.Seed(cmd.Context(), TestAreaCode, TestAreaName, TestAreaProfileName); err != nil {
+					return err
+				}
+
+				if err := loadLookupFiles(cmd.Context(), db); err != nil {
+					return err
+				}
+
+				if err := loadFiles(cmd.Context(), db); err != nil {
+					return err
+				}
+			}
+
 			sigChan := make(chan os.Signal, 0)
 			signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT)
 
@@ -120,7 +595,7 @@ func apiCMD() *cobra.Command {
 				os.Exit(0)
 			}()
 
-			r := handlers.Initalise(db)
+			r := handlers.Initalise(db, queryTimeout)
 
 			log.Info("api ready to receive requests port :8080")
 			if err := http.ListenAndServe(":8080", r); err != nil {
@@ -129,4 +604,466 @@ func apiCMD() *cobra.Command {
 			return nil
 		},
 	}
+	cmd.Flags().StringVar(&fStore, "store", postgresStore, "The store implementation to use: postgres or memory (Optional)")
+	cmd.Flags().StringArrayVarP(&fLoadFiles, "load", "l", []string{}, "A list of data import files to load into the in-memory store (Optional)")
+	cmd.Flags().StringArrayVar(&fLookupFiles, "lookup", []string{}, "A list of geography lookup files to load into the in-memory store (Optional)")
+	addLoadFlags(cmd)
+	return cmd
+}
+
+func recipesCMD() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "recipes",
+		Short: "Run the key stats recipes of a dataset edition",
+	}
+
+	run := &cobra.Command{
+		Use:   "run",
+		Short: "Run the key stats recipes of a dataset edition writing the results as a new version of the key stats",
+		Long: `The run command runs each key stats recipe of the dataset edition. Each recipe's query template is expanded for each of 
+its geography types and sent to a Cantabular compatible GraphQL endpoint. The values in the response tables are written 
+as a new key stats version of each area profile in a single transaction. Values for areas without a profile are skipped.
+
+The query template is a Go template, {{.DatasetID}}, {{.Edition}} and {{.GeographyType}} (e.g. LSOA) are available. The 
+dataset, edition and geography are also sent as GraphQL variables.
+
+The query service can be configured using the following env vars:
+	AP_CANTABULAR_URL      (default http://localhost:8491)
+	AP_CANTABULAR_TIMEOUT  (default 30s)
+
+Use the stub command to run a local stub query service.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cantabular, err := config.GetCantabularConfig()
+			if err != nil {
+				return err
+			}
+
+			db, err := newStore(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			defer db.Close()
+
+			runner := &recipes.Runner{
+				Store:  db,
+				Client: recipes.NewHTTPClient(cantabular.URL, cantabular.Timeout),
+			}
+
+			result, err := runner.Run(cmd.Context(), fDataset, fEdition)
+			if err != nil {
+				return err
+			}
+
+			log.Info("ran %d recipes, inserted %d key stats for %d area profiles, skipped %d values for areas without a profile", result.Recipes, result.KeyStats, result.Profiles, result.Skipped)
+			if result.Inactive > 0 {
+				log.Warn("skipped %d recipes for deprecated or replaced key stat types", result.Inactive)
+			}
+			return nil
+		},
+	}
+	run.Flags().StringVar(&fDataset, "dataset", "", "The ID of the dataset to run the recipes of")
+	run.Flags().StringVar(&fEdition, "edition", "", "The dataset edition to run the recipes of")
+	run.Flags().StringVar(&fStore, "store", postgresStore, "The store implementation to use: postgres or memory (Optional)")
+	run.MarkFlagRequired("dataset")
+	run.MarkFlagRequired("edition")
+
+	stub := &cobra.Command{
+		Use:   "stub",
+		Short: "Run a stub Cantabular compatible query service for testing recipes locally",
+		Long: `The stub command runs a stub Cantabular GraphQL endpoint on /graphql. The query text is ignored, each query returns the 
+fixture values for the geography variable. Fixtures are a JSON object of geography type code to a list of 
+{"code", "label", "value"} objects.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			fixtures, err := recipes.LoadStubFixtures(fFixtures)
+			if err != nil {
+				return err
+			}
+
+			addr := fmt.Sprintf(":%d", fPort)
+			log.Info("stub query service ready to receive requests port %s", addr)
+			return http.ListenAndServe(addr, recipes.NewStubHandler(fixtures))
+		},
+	}
+	stub.Flags().StringVar(&fFixtures, "fixtures", filepath.Join("load", "cantabular_stub.json"), "The stub fixtures file (Optional)")
+	stub.Flags().IntVar(&fPort, "port", 8491, "The port to listen on (Optional)")
+
+	cmd.AddCommand(run, stub)
+	return cmd
+}
+
+func listenCMD() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "listen",
+		Short: "Listen for dataset version published events and run the matching key stats recipes",
+		Long: `The listen command runs a webhook accepting dataset version published events. Each event is queued and the key stats 
+recipes matching the event's dataset_id and edition are run, see the recipes run command. Events without any matching 
+recipes are ignored. A failed run is retried with exponential back off starting at --retry-delay, after --max-attempts 
+failures the event is moved to the dead letters. The webhook exposes the following endpoints:
+	POST: /events
+	GET: /dead-letters
+
+The file queue persists events in --queue-dir so queued events survive a restart, the memory queue discards them on 
+exit. The query service is configured using the AP_CANTABULAR_URL and AP_CANTABULAR_TIMEOUT env vars.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if fMaxAttempts < 1 {
+				return errors.New("--max-attempts must be at least 1")
+			}
+
+			cantabular, err := config.GetCantabularConfig()
+			if err != nil {
+				return err
+			}
+
+			q, err := newQueue()
+			if err != nil {
+				return err
+			}
+
+			db, err := newStore(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			defer db.Close()
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), syscall.SIGTERM, syscall.SIGINT)
+			defer stop()
+
+			srv := &http.Server{Addr: fmt.Sprintf(":%d", fPort), Handler: listen.NewWebhook(q)}
+			go func() {
+				log.Info("listener ready to receive events port %s", srv.Addr)
+				if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					log.Err("error running webhook server: %s", err.Error())
+					stop()
+				}
+			}()
+
+			l := &listen.Listener{
+				Queue:       q,
+				Store:       db,
+				Runner:      &recipes.Runner{Store: db, Client: recipes.NewHTTPClient(cantabular.URL, cantabular.Timeout)},
+				MaxAttempts: fMaxAttempts,
+				RetryDelay:  fRetryDelay,
+			}
+
+			err = l.Listen(ctx)
+
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			if shutdownErr := srv.Shutdown(shutdownCtx); shutdownErr != nil {
+				log.Warn("error shutting down webhook server: %s", shutdownErr.Error())
+			}
+
+			return err
+		},
+	}
+	cmd.Flags().StringVar(&fQueue, "queue", fileQueue, "The queue implementation to use: file or memory (Optional)")
+	cmd.Flags().StringVar(&fQueueDir, "queue-dir", "queue", "The directory the file queue stores events in (Optional)")
+	cmd.Flags().IntVar(&fPort, "port", 8081, "The port the webhook listens on (Optional)")
+	cmd.Flags().IntVar(&fMaxAttempts, "max-attempts", 5, "The number of times an event is attempted before it is moved to the dead letters (Optional)")
+	cmd.Flags().DurationVar(&fRetryDelay, "retry-delay", 2*time.Second, "The delay before the first retry of a failed event, doubled for each further retry (Optional)")
+	cmd.Flags().StringVar(&fStore, "store", postgresStore, "The store implementation to use: postgres or memory (Optional)")
+	return cmd
+}
+
+// newQueue returns the queue implementation selected by the --queue flag.
+func newQueue() (listen.Queue, error) {
+	switch fQueue {
+	case fileQueue:
+		return listen.NewFileQueue(fQueueDir)
+	case memoryQueue:
+		return listen.NewMemoryQueue(), nil
+	default:
+		return nil, errors.Errorf("unknown queue type %q, expected %q or %q", fQueue, fileQueue, memoryQueue)
+	}
+}
+
+// newStore returns the store implementation selected by the --store flag.
+func newStore(ctx context.Context) (appStore, error) {
+	switch fStore {
+	case postgresStore:
+		cfg, err := config.Get()
+		if err != nil {
+			return nil, err
+		}
+
+		db, err := store.New(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	case memoryStore:
+		log.Info("using in-memory store, data will be discarded on exit")
+		return memory.New(), nil
+	default:
+		return nil, errors.Errorf("unknown store type %q, expected %q or %q", fStore, postgresStore, memoryStore)
+	}
+}
+
+// loadFiles loads the data files specified by the -l flag into the store. The load report of each file is logged and
+// written to the file specified by the --report flag.
+func loadFiles(ctx context.Context, db load.Store) error {
+	if len(fLoadFiles) == 0 {
+		return nil
+	}
+
+	fNames := make([]string, 0, len(fLoadFiles))
+	for _, f := range fLoadFiles {
+		fNames = append(fNames, filepath.Join("load", f))
+	}
+
+	log.Info("loading test data into area_profiles database")
+
+	_, err := importFiles(ctx, db, fNames)
+	return err
+}
+
+// importFiles loads the data files into the store, in a single transaction if the --atomic or --dry-run flag is set
+// otherwise a transaction per file stopping at the first file that fails. The load report of each file is logged and written to
+// the file specified by the --report flag. Returns the reports of the files attempted.
+func importFiles(ctx context.Context, db load.Store, fNames []string) ([]*load.Report, error) {
+	opts, err := loadOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	var reports []*load.Report
+	if fAtomic || fDryRun {
+		reports, err = load.DataFromFiles(ctx, fNames, db, opts)
+	} else {
+		for _, fName := range fNames {
+			var report *load.Report
+			report, err = load.DataFromFile(ctx, fName, db, opts)
+			if report != nil {
+				reports = append(reports, report)
+			}
+
+			if err != nil {
+				break
+			}
+		}
+	}
+
+	logReports(reports)
+
+	if fReport != "" {
+		if err := writeReports(fReport, reports); err != nil {
+			return reports, err
+		}
+	}
+
+	return reports, err
+}
+
+// expandFiles returns the data files matching each file, glob or directory. A directory matches each file in it with
+// the extension of a supported format e.g. .csv, .json, .ndjson or .xlsx. Returns an error if nothing matches a path.
+func expandFiles(paths []string) ([]string, error) {
+	fNames := make([]string, 0, len(paths))
+	readers := load.DefaultReaders()
+
+	for _, p := range paths {
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid data file pattern %q", p)
+		}
+
+		if len(matches) == 0 {
+			return nil, errors.Errorf("no data files found matching %q", p)
+		}
+
+		for _, m := range matches {
+			info, err := os.Stat(m)
+			if err != nil {
+				return nil, errors.Wrapf(err, "error reading data file %q", m)
+			}
+
+			if !info.IsDir() {
+				fNames = append(fNames, m)
+				continue
+			}
+
+			entries, err := os.ReadDir(m)
+			if err != nil {
+				return nil, errors.Wrapf(err, "error listing data files in %q", m)
+			}
+
+			files := make([]string, 0, len(entries))
+			for _, e := range entries {
+				if !e.IsDir() && readers.IsDataFile(e.Name()) {
+					files = append(files, filepath.Join(m, e.Name()))
+				}
+			}
+
+			if len(files) == 0 {
+				return nil, errors.Errorf("no data files found in directory %q", m)
+			}
+			fNames = append(fNames, files...)
+		}
+	}
+
+	return fNames, nil
+}
+
+// writeImportOutput prints the import reports in the format specified by the --output flag. The table lists the counts
+// and versions of each file, for a dry run the change to each key stat is listed instead.
+func writeImportOutput(reports []*load.Report) error {
+	if fOutput == jsonOutput {
+		if reports == nil {
+			reports = make([]*load.Report, 0)
+		}
+
+		b, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "error marshalling import reports")
+		}
+
+		fmt.Println(string(b))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	if !fDryRun {
+		fmt.Fprintln(w, "FILE\tIMPORT\tINSERTED\tUPDATED\tUNCHANGED\tREJECTED\tVERSIONS")
+		for _, r := range reports {
+			versions := versionsSummary(r.Versions)
+			if r.Skipped {
+				versions = fmt.Sprintf("skipped, identical to import %d", r.DuplicateOf)
+			}
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%s\n", r.File, r.ImportID, r.Inserted, r.Updated, r.Unchanged, len(r.Rejected), versions)
+		}
+		return w.Flush()
+	}
+
+	fmt.Fprintln(w, "FILE\tAREA CODE\tKEY STAT\tCHANGE\tOLD\tNEW")
+	for _, r := range reports {
+		for _, d := range r.Diffs {
+			for _, s := range d.Added {
+				fmt.Fprintf(w, "%s\t%s\t%s\tadded\t-\t%s\n", r.File, d.AreaCode, s.Name, s.Display)
+			}
+			for _, c := range d.Changed {
+				fmt.Fprintf(w, "%s\t%s\t%s\tchanged\t%s\t%s\n", r.File, d.AreaCode, c.Name, c.OldDisplay, c.NewDisplay)
+			}
+			for _, s := range d.Unchanged {
+				fmt.Fprintf(w, "%s\t%s\t%s\tunchanged\t%s\t%s\n", r.File, d.AreaCode, s.Name, s.Display, s.Display)
+			}
+		}
+	}
+	return w.Flush()
+}
+
+// maxVersionsSummary is the number of area profiles listed in the versions column of the import table.
+const maxVersionsSummary = 10
+
+// versionsSummary returns the new key stats version of each area profile in area code order e.g. "E05011362 v3". Only
+// the first maxVersionsSummary area profiles are listed, followed by the number of others.
+func versionsSummary(versions map[string]int) string {
+	if len(versions) == 0 {
+		return "-"
+	}
+
+	summary := make([]string, 0, len(versions))
+	for areaCode, v := range versions {
+		summary = append(summary, fmt.Sprintf("%s v%d", areaCode, v))
+	}
+
+	sort.Strings(summary)
+	if len(summary) > maxVersionsSummary {
+		return fmt.Sprintf("%s and %d others", strings.Join(summary[:maxVersionsSummary], ", "), len(summary)-maxVersionsSummary)
+	}
+	return strings.Join(summary, ", ")
+}
+
+// loadOptions returns the data file load options specified by the --stat-types, --rows, --profiles, --area-names,
+// --columns, --format, --xlsx-mapping, --dry-run, --force and --bulk flags.
+func loadOptions() (load.Options, error) {
+	opts := load.DefaultOptions()
+	opts.StatTypes = load.StatTypePolicy(fStatTypes)
+	opts.Rows = load.RowPolicy(fRows)
+	opts.Profiles = load.ProfilePolicy(fProfiles)
+	opts.DryRun = fDryRun
+	opts.Force = fForce
+	opts.Bulk = fBulk
+	opts.Format = load.Format(fFormat)
+
+	if fColumns != "" {
+		columns, err := load.ColumnAliasesFromFile(fColumns)
+		if err != nil {
+			return opts, err
+		}
+		opts.Columns = columns
+	}
+
+	if fXLSXMapping != "" {
+		mapping, err := load.XLSXMappingFromFile(fXLSXMapping)
+		if err != nil {
+			return opts, err
+		}
+		opts.Readers[load.FormatXLSX] = load.NewXLSXReader(*mapping)
+	}
+
+	if fAreaNames != "" {
+		names, err := load.AreaNamesFromFile(fAreaNames)
+		if err != nil {
+			return opts, err
+		}
+		opts.AreaNames = names
+	}
+
+	return opts, nil
+}
+
+// logReports logs the summary of each load report and each rejected row and warning.
+func logReports(reports []*load.Report) {
+	for _, r := range reports {
+		log.Info("%s", r.Summary())
+
+		for _, e := range r.Rejected {
+			log.Warn("%s %s rejected: %s", r.File, e.Location(), strings.Join(e.Errors, "; "))
+		}
+
+		for _, e := range r.Warnings {
+			log.Warn("%s %s: %s", r.File, e.Location(), strings.Join(e.Errors, "; "))
+		}
+	}
+}
+
+// writeReports writes the load reports to the specified file as JSON.
+func writeReports(filename string, reports []*load.Report) error {
+	if reports == nil {
+		reports = make([]*load.Report, 0)
+	}
+
+	b, err := json.MarshalIndent(reports, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "error marshalling load report")
+	}
+
+	if err := os.WriteFile(filename, b, 0644); err != nil {
+		return errors.Wrapf(err, "error writing load report %q", filename)
+	}
+
+	log.Info("load report written to %s", filename)
+	return nil
+}
+
+// loadLookupFiles loads the area hierarchy from the geography lookup files specified by the --lookup flag.
+func loadLookupFiles(ctx context.Context, db load.Store) error {
+	for _, f := range fLookupFiles {
+		fName := filepath.Join("load", f)
+
+		n, err := load.AreasFromLookupFile(ctx, fName, db)
+		if err != nil {
+			return err
+		}
+
+		log.Info("successfully loaded %d areas from lookup file: %s", n, fName)
+	}
+
+	return nil
 }
@@ -0,0 +1,157 @@
+package recipes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Client runs queries against a Cantabular compatible query service.
+type Client interface {
+	Query(ctx context.Context, query string, vars QueryVariables) ([]AreaValue, error)
+}
+
+// QueryVariables are the GraphQL variables sent with each query.
+type QueryVariables struct {
+	Dataset   string `json:"dataset"`
+	Edition   string `json:"edition"`
+	Geography string `json:"geography"`
+}
+
+// AreaValue is the value of a key stat for a single area parsed from a query response table.
+type AreaValue struct {
+	AreaCode string
+	Label    string
+	Value    float64
+}
+
+// queryRequest is a GraphQL request body.
+type queryRequest struct {
+	Query     string         `json:"query"`
+	Variables QueryVariables `json:"variables"`
+}
+
+// queryResponse is a Cantabular GraphQL table query response body.
+type queryResponse struct {
+	Data struct {
+		Dataset struct {
+			Table Table `json:"table"`
+		} `json:"dataset"`
+	} `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors,omitempty"`
+}
+
+// Table is a Cantabular table - the values are the flattened cross product of the dimension categories.
+type Table struct {
+	Dimensions []Dimension `json:"dimensions"`
+	Values     []float64   `json:"values"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// Dimension is a Cantabular table dimension.
+type Dimension struct {
+	Count    int `json:"count"`
+	Variable struct {
+		Name  string `json:"name"`
+		Label string `json:"label"`
+	} `json:"variable"`
+	Categories []Category `json:"categories"`
+}
+
+// Category is a value of a Cantabular table dimension e.g. an area.
+type Category struct {
+	Code  string `json:"code"`
+	Label string `json:"label"`
+}
+
+// HTTPClient is a Client sending GraphQL queries to {URL}/graphql.
+type HTTPClient struct {
+	URL  string
+	HTTP *http.Client
+}
+
+// NewHTTPClient construct a new HTTPClient for the query service at the URL.
+func NewHTTPClient(url string, timeout time.Duration) *HTTPClient {
+	return &HTTPClient{
+		URL:  strings.TrimSuffix(url, "/"),
+		HTTP: &http.Client{Timeout: timeout},
+	}
+}
+
+// Query runs the query returning the value of each area in the response table. The table must have a single geography
+// dimension.
+func (c *HTTPClient) Query(ctx context.Context, query string, vars QueryVariables) ([]AreaValue, error) {
+	body, err := json.Marshal(queryRequest{Query: query, Variables: vars})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL+"/graphql", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("content-type", "application/json")
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error sending query")
+	}
+
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading query response")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("query service returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+
+	var qr queryResponse
+	if err := json.Unmarshal(b, &qr); err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling query response")
+	}
+
+	if len(qr.Errors) > 0 {
+		return nil, fmt.Errorf("query service returned error: %s", qr.Errors[0].Message)
+	}
+
+	return qr.Data.Dataset.Table.AreaValues()
+}
+
+// AreaValues returns the value of each category of the table's single dimension.
+func (t Table) AreaValues() ([]AreaValue, error) {
+	if t.Error != "" {
+		return nil, fmt.Errorf("table error: %s", t.Error)
+	}
+
+	if len(t.Dimensions) != 1 {
+		return nil, fmt.Errorf("expected a table with a single geography dimension but found %d dimensions", len(t.Dimensions))
+	}
+
+	categories := t.Dimensions[0].Categories
+	if len(categories) != len(t.Values) {
+		return nil, fmt.Errorf("table has %d categories but %d values", len(categories), len(t.Values))
+	}
+
+	values := make([]AreaValue, 0, len(categories))
+	for i, c := range categories {
+		values = append(values, AreaValue{
+			AreaCode: c.Code,
+			Label:    c.Label,
+			Value:    t.Values[i],
+		})
+	}
+
+	return values, nil
+}
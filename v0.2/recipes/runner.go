@@ -0,0 +1,235 @@
+// Package recipes runs key stats recipes - for each recipe of a dataset edition the recipe's query is run against a
+// Cantabular compatible query service for each of its geography types and the results written as key stats.
+package recipes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store"
+	log "github.com/daiLlew/funkylog"
+	"github.com/pkg/errors"
+	"text/template"
+	"time"
+)
+
+// Store represents the area profiles data store.
+type Store interface {
+	GetRecipes(ctx context.Context, datasetID, edition string) ([]store.KeyStatsRecipe, error)
+	GetGeographyTypes(ctx context.Context) ([]store.GeographyType, error)
+	GetStatTypeByID(ctx context.Context, id int) (*store.KeyStatType, error)
+	InTransaction(ctx context.Context, fn func(tx store.Tx) error) error
+}
+
+// QueryTemplateData is the data available to a recipe's query template e.g. {{.GeographyType}}.
+type QueryTemplateData struct {
+	DatasetID     string
+	Edition       string
+	GeographyType string
+}
+
+// Result is the outcome of running the recipes of a dataset edition.
+type Result struct {
+	Recipes int
+	// Profiles is the number of area profiles a new key stats version was created for.
+	Profiles int
+	// KeyStats is the number of key stats inserted.
+	KeyStats int
+	// Skipped is the number of area values discarded because the area has no area profile.
+	Skipped int
+	// Inactive is the number of recipes not run because their key stat type is deprecated or replaced.
+	Inactive int
+}
+
+// Runner runs key stats recipes.
+type Runner struct {
+	Store  Store
+	Client Client
+}
+
+// keyStat is a key stat value produced by a recipe.
+type keyStat struct {
+	AreaCode string
+	Name     string
+	Value    float64
+}
+
+// Run runs each recipe of the dataset edition and writes the results as a new key stats version of each area profile
+// in a single transaction. The queries are all run before anything is written, if any query fails nothing is written.
+// Values for areas without an area profile are skipped. Returns an error if a recipe has a geography type that does not
+// exist.
+func (r *Runner) Run(ctx context.Context, datasetID, edition string) (*Result, error) {
+	recipes, err := r.Store.GetRecipes(ctx, datasetID, edition)
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting recipes")
+	}
+
+	if len(recipes) == 0 {
+		return nil, fmt.Errorf("no recipes found for dataset %q edition %q", datasetID, edition)
+	}
+
+	geographyCodes, err := r.geographyCodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make([]keyStat, 0)
+	seen := make(map[string]int)
+	inactive := 0
+
+	for _, recipe := range recipes {
+		active, err := r.isActive(ctx, recipe)
+		if err != nil {
+			return nil, err
+		}
+
+		if !active {
+			inactive++
+			continue
+		}
+
+		for _, geography := range recipe.Geographies {
+			code, ok := geographyCodes[geography]
+			if !ok {
+				return nil, fmt.Errorf("recipe %d has unknown geography type %q", recipe.ID, geography)
+			}
+
+			values, err := r.runQuery(ctx, recipe, code)
+			if err != nil {
+				return nil, errors.Wrapf(err, "error running recipe %d for geography type %q", recipe.ID, code)
+			}
+
+			log.Info("recipe %d returned %d values for geography type %s", recipe.ID, len(values), code)
+
+			for _, v := range values {
+				key := v.AreaCode + "|" + recipe.StatType.Name
+				if prev, ok := seen[key]; ok {
+					return nil, fmt.Errorf("recipes %d and %d both produce %q for area %q", prev, recipe.ID, recipe.StatType.Name, v.AreaCode)
+				}
+
+				seen[key] = recipe.ID
+				stats = append(stats, keyStat{AreaCode: v.AreaCode, Name: recipe.StatType.Name, Value: v.Value})
+			}
+		}
+	}
+
+	result := &Result{Recipes: len(recipes) - inactive, Inactive: inactive}
+	label := fmt.Sprintf("%s %s", datasetID, edition)
+	source := fmt.Sprintf("recipes:%s/%s", datasetID, edition)
+	created := time.Now()
+
+	err = r.Store.InTransaction(ctx, func(tx store.Tx) error {
+		// Register the edition, the blank name keeps the name of an existing dataset.
+		dataset := store.Dataset{ID: datasetID, Editions: []string{edition}, ReleaseDate: &created}
+		if err := tx.UpsertDataset(ctx, dataset); err != nil {
+			return err
+		}
+
+		hasProfile := make(map[string]bool)
+
+		for _, s := range stats {
+			exists, checked := hasProfile[s.AreaCode]
+			if !checked {
+				_, err := tx.GetProfileByAreaCode(ctx, s.AreaCode)
+				if err != nil && !errors.Is(err, store.ErrNotFound) {
+					return errors.Wrapf(err, "error getting area profile for area code %q", s.AreaCode)
+				}
+
+				exists = err == nil
+				hasProfile[s.AreaCode] = exists
+
+				if exists {
+					if _, err := tx.CreateKeyStatsVersion(ctx, s.AreaCode, label, source, created); err != nil {
+						return errors.Wrapf(err, "error creating key stats version for area code %q", s.AreaCode)
+					}
+					result.Profiles++
+				}
+			}
+
+			if !exists {
+				result.Skipped++
+				continue
+			}
+
+			if _, err := tx.InsertKeyStat(ctx, s.AreaCode, s.Name, s.Value, "", datasetID, "", created); err != nil {
+				return errors.Wrapf(err, "error inserting key stat %q for area code %q", s.Name, s.AreaCode)
+			}
+
+			result.KeyStats++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// isActive returns true if the recipe's key stat type is active. A recipe for a deprecated or replaced key stat type is
+// logged and not run, the replacing key stat type is named so the recipe can be updated.
+func (r *Runner) isActive(ctx context.Context, recipe store.KeyStatsRecipe) (bool, error) {
+	t, err := r.Store.GetStatTypeByID(ctx, recipe.StatType.ID)
+	if err != nil {
+		return false, errors.Wrapf(err, "error getting key stat type of recipe %d", recipe.ID)
+	}
+
+	replacement := ""
+	if t.ReplacedBy != nil {
+		replaced, err := r.Store.GetStatTypeByID(ctx, *t.ReplacedBy)
+		if err != nil {
+			return false, errors.Wrapf(err, "error getting key stat type replacing %q", t.Name)
+		}
+		replacement = replaced.Name
+	}
+
+	if err := t.CheckActive(replacement); err != nil {
+		log.Warn("skipping recipe %d: %s", recipe.ID, err.Error())
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// runQuery expands the recipe's query template for the geography type and runs it.
+func (r *Runner) runQuery(ctx context.Context, recipe store.KeyStatsRecipe, geographyType string) ([]AreaValue, error) {
+	tmpl, err := template.New("query").Option("missingkey=error").Parse(recipe.CantabularQuery)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing query template")
+	}
+
+	data := QueryTemplateData{
+		DatasetID:     recipe.DatasetID,
+		Edition:       recipe.DatasetEdition,
+		GeographyType: geographyType,
+	}
+
+	var query bytes.Buffer
+	if err := tmpl.Execute(&query, data); err != nil {
+		return nil, errors.Wrap(err, "error expanding query template")
+	}
+
+	vars := QueryVariables{
+		Dataset:   recipe.DatasetID,
+		Edition:   recipe.DatasetEdition,
+		Geography: geographyType,
+	}
+
+	return r.Client.Query(ctx, query.String(), vars)
+}
+
+// geographyCodes returns a map of geography type name to geography type code.
+func (r *Runner) geographyCodes(ctx context.Context) (map[string]string, error) {
+	types, err := r.Store.GetGeographyTypes(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting geography types")
+	}
+
+	codes := make(map[string]string, len(types))
+	for _, g := range types {
+		codes[g.Name] = g.Code
+	}
+
+	return codes, nil
+}
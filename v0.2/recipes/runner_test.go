@@ -0,0 +1,369 @@
+package recipes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store/memory"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testDatasetID = "TS001"
+	testEdition   = "2021"
+	residents     = "Resident population"
+	meanAge       = "Average (mean) age"
+
+	// testQuery is a query template using every field of the query template data.
+	testQuery = `{dataset(name: "{{.DatasetID}}") {table(edition: "{{.Edition}}", variables: ["{{.GeographyType}}"]) {values}}}`
+)
+
+// testFixtures are the values of the stub query service for each geography type.
+var testFixtures = StubFixtures{
+	"OA":   {{Code: "E00026343", Value: 312}},
+	"LSOA": {{Code: "E01005061", Value: 1612}, {Code: "E01005062", Value: 1540}},
+	"MSOA": {{Code: "E02001067", Value: 8764}},
+	"LAD":  {{Code: "E08000003", Value: 552858}},
+}
+
+// testAreaCodes are the areas with an area profile, E01005062 has no area profile.
+var testAreaCodes = []string{"E00026343", "E01005061", "E02001067", "E08000003"}
+
+// newTestRunner returns a runner using a memory store with an area profile for each test area and the stub query
+// service with the fixtures. Returns the store and the requests received by the stub query service.
+func newTestRunner(t *testing.T, fixtures StubFixtures) (*Runner, *memory.Store, *[]queryRequest) {
+	t.Helper()
+	ctx := context.Background()
+
+	s := memory.New()
+	for _, code := range testAreaCodes {
+		if _, err := s.AddArea(ctx, code, code); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := s.AddAreaProfile(ctx, code, code+" profile"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	requests := make([]queryRequest, 0)
+	stub := NewStubHandler(fixtures)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+
+		var req queryRequest
+		if err := json.Unmarshal(b, &req); err != nil {
+			t.Error(err)
+		}
+
+		requests = append(requests, req)
+		r.Body = io.NopCloser(bytes.NewReader(b))
+		stub.ServeHTTP(w, r)
+	}))
+
+	t.Cleanup(server.Close)
+
+	return &Runner{Store: s, Client: NewHTTPClient(server.URL, time.Second)}, s, &requests
+}
+
+// addRecipe adds a recipe of the test dataset edition for the key stat type and geography types.
+func addRecipe(t *testing.T, s *memory.Store, statType string, geographies ...string) int {
+	t.Helper()
+
+	id, err := s.AddRecipe(context.Background(), store.KeyStatsRecipe{
+		DatasetID:       testDatasetID,
+		DatasetEdition:  testEdition,
+		CantabularQuery: testQuery,
+		StatType:        store.KeyStatType{Name: statType},
+		Geographies:     geographies,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return id
+}
+
+// keyStats returns the value of each key stat of each area by area code and key stat name.
+func keyStats(t *testing.T, s *memory.Store) map[string]map[string]float64 {
+	t.Helper()
+	ctx := context.Background()
+
+	profiles, err := s.GetAreaProfiles(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := make(map[string]map[string]float64)
+	for i := range profiles {
+		stats, err := s.GetKeyStatsForProfile(ctx, &profiles[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, stat := range stats {
+			if values[profiles[i].AreaCode] == nil {
+				values[profiles[i].AreaCode] = make(map[string]float64)
+			}
+			values[profiles[i].AreaCode][stat.Name] = stat.Value
+		}
+	}
+
+	return values
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	runner, s, requests := newTestRunner(t, testFixtures)
+
+	addRecipe(t, s, residents,
+		"output area", "lower layer super output area", "middle layer super output area", "local authority district")
+
+	result, err := runner.Run(ctx, testDatasetID, testEdition)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the query template is expanded for each geography type, E01005062 has no area profile so is skipped.
+	expected := Result{Recipes: 1, Profiles: 4, KeyStats: 4, Skipped: 1}
+	if *result != expected {
+		t.Errorf("expected %+v, got %+v", expected, *result)
+	}
+
+	codes := []string{"OA", "LSOA", "MSOA", "LAD"}
+	if len(*requests) != len(codes) {
+		t.Fatalf("expected a query for each geography type, got %+v", *requests)
+	}
+
+	for i, req := range *requests {
+		query := `{dataset(name: "TS001") {table(edition: "2021", variables: ["` + codes[i] + `"]) {values}}}`
+		vars := QueryVariables{Dataset: testDatasetID, Edition: testEdition, Geography: codes[i]}
+
+		if req.Query != query || req.Variables != vars {
+			t.Errorf("expected query %q with %+v, got %q with %+v", query, vars, req.Query, req.Variables)
+		}
+	}
+
+	want := map[string]map[string]float64{
+		"E00026343": {residents: 312},
+		"E01005061": {residents: 1612},
+		"E02001067": {residents: 8764},
+		"E08000003": {residents: 552858},
+	}
+
+	if got := keyStats(t, s); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected key stats %v, got %v", want, got)
+	}
+
+	profile, err := s.GetProfileByAreaCode(ctx, "E08000003")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := s.GetKeyStatsVersionsForProfile(ctx, profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(versions) != 1 || versions[0].Label != "TS001 2021" {
+		t.Errorf("expected a single key stats version labelled %q, got %+v", "TS001 2021", versions)
+	}
+}
+
+func TestRunInactiveStatType(t *testing.T) {
+	ctx := context.Background()
+	runner, s, requests := newTestRunner(t, testFixtures)
+
+	addRecipe(t, s, residents, "local authority district")
+	addRecipe(t, s, meanAge, "local authority district")
+
+	id, err := s.GetStatTypeByName(ctx, meanAge)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statType, err := s.GetStatTypeByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statType.Status = store.StatTypeDeprecated
+	if err := s.UpdateStatType(ctx, *statType); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := runner.Run(ctx, testDatasetID, testEdition)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Result{Recipes: 1, Profiles: 1, KeyStats: 1, Inactive: 1}
+	if *result != expected {
+		t.Errorf("expected %+v, got %+v", expected, *result)
+	}
+
+	if len(*requests) != 1 {
+		t.Errorf("expected the recipe of the deprecated key stat type not to be run, got %d queries", len(*requests))
+	}
+
+	want := map[string]map[string]float64{"E08000003": {residents: 552858}}
+	if got := keyStats(t, s); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected key stats %v, got %v", want, got)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	cases := []struct {
+		name     string
+		fixtures StubFixtures
+		recipes  [][]string
+		err      string
+	}{
+		{
+			name:     "duplicate output",
+			fixtures: testFixtures,
+			recipes:  [][]string{{residents, "local authority district"}, {residents, "local authority district"}},
+			err:      `both produce "Resident population" for area "E08000003"`,
+		},
+		{
+			name:     "query fails",
+			fixtures: StubFixtures{"LAD": testFixtures["LAD"]},
+			recipes:  [][]string{{residents, "local authority district"}, {meanAge, "local authority district", "output area"}},
+			err:      `variable "OA" not found`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			runner, s, _ := newTestRunner(t, c.fixtures)
+			for _, r := range c.recipes {
+				addRecipe(t, s, r[0], r[1:]...)
+			}
+
+			if _, err := runner.Run(context.Background(), testDatasetID, testEdition); err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("expected an error containing %q, got %v", c.err, err)
+			}
+
+			// nothing is written if any recipe fails.
+			if got := keyStats(t, s); len(got) != 0 {
+				t.Errorf("expected no key stats to be written, got %v", got)
+			}
+
+			if _, err := s.GetDataset(context.Background(), testDatasetID); err == nil {
+				t.Error("expected the dataset edition not to be registered")
+			}
+		})
+	}
+}
+
+// unknownGeographyStore is a store with no geography types, as if the geography types of its recipes were removed.
+type unknownGeographyStore struct {
+	*memory.Store
+}
+
+func (unknownGeographyStore) GetGeographyTypes(ctx context.Context) ([]store.GeographyType, error) {
+	return []store.GeographyType{}, nil
+}
+
+func TestRunUnknownGeography(t *testing.T) {
+	runner, s, requests := newTestRunner(t, testFixtures)
+	id := addRecipe(t, s, residents, "local authority district")
+	runner.Store = unknownGeographyStore{Store: s}
+
+	expected := fmt.Sprintf(`recipe %d has unknown geography type "local authority district"`, id)
+	if _, err := runner.Run(context.Background(), testDatasetID, testEdition); err == nil || err.Error() != expected {
+		t.Errorf("expected %q, got %v", expected, err)
+	}
+
+	if len(*requests) != 0 {
+		t.Errorf("expected no queries, got %+v", *requests)
+	}
+}
+
+func TestRunNoRecipes(t *testing.T) {
+	runner, _, _ := newTestRunner(t, testFixtures)
+
+	if _, err := runner.Run(context.Background(), testDatasetID, testEdition); err == nil {
+		t.Error("expected an error running a dataset edition without recipes")
+	}
+}
+
+func TestTableAreaValues(t *testing.T) {
+	dimension := func(codes ...string) Dimension {
+		d := Dimension{Count: len(codes)}
+		for _, c := range codes {
+			d.Categories = append(d.Categories, Category{Code: c, Label: c + " label"})
+		}
+		return d
+	}
+
+	cases := []struct {
+		name     string
+		table    Table
+		expected []AreaValue
+		err      string
+	}{
+		{
+			name:  "single dimension",
+			table: Table{Dimensions: []Dimension{dimension("E08000003", "E08000007")}, Values: []float64{552858, 294809}},
+			expected: []AreaValue{
+				{AreaCode: "E08000003", Label: "E08000003 label", Value: 552858},
+				{AreaCode: "E08000007", Label: "E08000007 label", Value: 294809},
+			},
+		},
+		{
+			name:  "multiple dimensions",
+			table: Table{Dimensions: []Dimension{dimension("E08000003"), dimension("1", "2")}, Values: []float64{1, 2}},
+			err:   "found 2 dimensions",
+		},
+		{
+			name:  "no dimensions",
+			table: Table{Values: []float64{}},
+			err:   "found 0 dimensions",
+		},
+		{
+			name:  "category and value count mismatch",
+			table: Table{Dimensions: []Dimension{dimension("E08000003", "E08000007")}, Values: []float64{552858}},
+			err:   "table has 2 categories but 1 values",
+		},
+		{
+			name:  "table error",
+			table: Table{Error: "variable not found"},
+			err:   "table error: variable not found",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			values, err := c.table.AreaValues()
+
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Errorf("expected an error containing %q, got %v", c.err, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(values, c.expected) {
+				t.Errorf("expected %+v, got %+v", c.expected, values)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package recipes
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/daiLlew/funkylog"
+	"github.com/pkg/errors"
+	"net/http"
+	"os"
+)
+
+// StubValue is the value of a single area returned by the stub query service.
+type StubValue struct {
+	Code  string  `json:"code"`
+	Label string  `json:"label"`
+	Value float64 `json:"value"`
+}
+
+// StubFixtures are the values returned by the stub query service keyed by geography type code e.g. LSOA.
+type StubFixtures map[string][]StubValue
+
+// LoadStubFixtures reads the stub query service fixtures from a JSON file.
+func LoadStubFixtures(filename string) (StubFixtures, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading stub fixtures file %q", filename)
+	}
+
+	var fixtures StubFixtures
+	if err := json.Unmarshal(b, &fixtures); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshalling stub fixtures file %q", filename)
+	}
+
+	return fixtures, nil
+}
+
+// NewStubHandler returns an http.Handler imitating a Cantabular GraphQL endpoint for local testing. The query text is
+// ignored, the response is a single dimension table of the fixture values for the geography query variable.
+func NewStubHandler(fixtures StubFixtures) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req queryRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request body: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		log.Info("stub query service received query dataset=%s, edition=%s, geography=%s", req.Variables.Dataset, req.Variables.Edition, req.Variables.Geography)
+
+		var resp queryResponse
+		values, ok := fixtures[req.Variables.Geography]
+		if !ok {
+			resp.Errors = append(resp.Errors, struct {
+				Message string `json:"message"`
+			}{Message: fmt.Sprintf("variable %q not found", req.Variables.Geography)})
+		} else {
+			dim := Dimension{Count: len(values)}
+			dim.Variable.Name = req.Variables.Geography
+			dim.Variable.Label = req.Variables.Geography
+
+			table := Table{Values: make([]float64, 0, len(values))}
+			for _, v := range values {
+				dim.Categories = append(dim.Categories, Category{Code: v.Code, Label: v.Label})
+				table.Values = append(table.Values, v.Value)
+			}
+
+			table.Dimensions = []Dimension{dim}
+			resp.Data.Dataset.Table = table
+		}
+
+		w.Header().Set("content-type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Err("error writing stub query response: %s", err.Error())
+		}
+	})
+
+	return mux
+}
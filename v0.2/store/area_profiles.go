@@ -8,32 +8,6 @@ import (
 )
 
 var (
-	// createProfilesTableSQL is an SQL statement to create the area profiles table
-	createProfilesTableSQL = `
-		CREATE TABLE area_profiles (
-			profile_id INT PRIMARY KEY NOT NULL, 
-			area_code VARCHAR(50) NOT NULL, 
-			name VARCHAR (100) NOT NULL, 
-			UNIQUE (area_code), 
-			CONSTRAINT fk_area_code 
-				FOREIGN KEY (area_code) REFERENCES areas (code)
-		);
-	`
-
-	//createAreaProfileIDSeqSQL is a SQL statement creating a sequence for generating area profile ids.
-	createAreaProfileIDSeqSQL = `
-		CREATE SEQUENCE 
-			area_profile_id 
-		START 
-			1000 
-		INCREMENT 
-			100 
-		MINVALUE 
-			1000 
-		OWNED BY 
-			area_profiles.profile_id;
-	`
-
 	// getProfileByAreaCodeSQL SQL query returns the area profile for the specified area code.
 	getProfileByAreaCodeSQL = `
 		SELECT 
@@ -52,6 +26,16 @@ var (
 			area_profiles;
 	`
 
+	// getProfilesByAreaCodesSQL SQL query returns the area profiles of the specified area codes.
+	getProfilesByAreaCodesSQL = `
+		SELECT 
+			profile_id, name, area_code 
+		FROM 
+			area_profiles 
+		WHERE 
+			area_code = ANY($1);
+	`
+
 	// insertProfileSQL is an SQL query to insert a new area profile, required area code and profile name.
 	insertProfileSQL = `
 		INSERT INTO area_profiles 
@@ -60,25 +44,114 @@ var (
 			(nextval('area_profile_id'), $1, $2) 
 		RETURNING profile_id;
 	`
+
+	// updateProfileSQL SQL statement to update the name of the area profile for an area code.
+	updateProfileSQL = `
+		UPDATE 
+			area_profiles 
+		SET 
+			name = $2 
+		WHERE 
+			area_code = $1;
+	`
+
+	// deleteProfileSQL SQL statement to delete the area profile for an area code.
+	deleteProfileSQL = `
+		DELETE FROM 
+			area_profiles 
+		WHERE 
+			area_code = $1;
+	`
 )
 
-// NewAreaProfile insert a new area profile returns the area profile ID.
-func (s *AreaProfileStore) AddAreaProfile(areaCode, name string) (int, error) {
+// NewAreaProfile insert a new area profile returns the area profile ID. Returns ErrConflict if the area already has a
+// profile and ErrMissingReference if the area does not exist.
+func (s *AreaProfileStore) AddAreaProfile(ctx context.Context, areaCode, name string) (int, error) {
+	conn, err := s.acquire(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	defer conn.Release()
+
+	return addAreaProfile(ctx, conn, areaCode, name)
+}
+
+func addAreaProfile(ctx context.Context, q querier, areaCode, name string) (int, error) {
 	var profileID int
-	err := s.conn.QueryRow(context.Background(), insertProfileSQL, areaCode, name).Scan(&profileID)
+	err := q.QueryRow(ctx, insertProfileSQL, areaCode, name).Scan(&profileID)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return 0, nil
 		}
+		if isPgError(err, pgUniqueViolation) {
+			return 0, errors.Wrapf(ErrConflict, "area profile for area code %q already exists", areaCode)
+		}
+		if isPgError(err, pgForeignKeyViolation) {
+			return 0, errors.Wrapf(ErrMissingReference, "area %q does not exist", areaCode)
+		}
 		return 0, err
 	}
 
 	return profileID, nil
 }
 
+// UpdateAreaProfile updates the name of the area profile for the specified area code.
+func (s *AreaProfileStore) UpdateAreaProfile(ctx context.Context, areaCode, name string) error {
+	conn, err := s.acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Release()
+
+	tag, err := conn.Exec(ctx, updateProfileSQL, areaCode, name)
+	if err != nil {
+		return errors.Wrapf(err, "error updating area profile %q", areaCode)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// DeleteAreaProfile deletes the area profile for the specified area code. Returns ErrConflict if the profile has key
+// stats or key stats versions.
+func (s *AreaProfileStore) DeleteAreaProfile(ctx context.Context, areaCode string) error {
+	conn, err := s.acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Release()
+
+	tag, err := conn.Exec(ctx, deleteProfileSQL, areaCode)
+	if err != nil {
+		if isPgError(err, pgForeignKeyViolation) {
+			return errors.Wrapf(ErrConflict, "area profile %q has key stats or key stats versions", areaCode)
+		}
+		return errors.Wrapf(err, "error deleting area profile %q", areaCode)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
 // GetAreaProfiles return a list of area profiles
-func (s *AreaProfileStore) GetAreaProfiles() ([]AreaProfile, error) {
-	rows, err := s.conn.Query(context.Background(), getAreaProfilesSQL)
+func (s *AreaProfileStore) GetAreaProfiles(ctx context.Context) ([]AreaProfile, error) {
+	conn, err := s.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, getAreaProfilesSQL)
 	if err != nil {
 		return nil, err
 	}
@@ -94,12 +167,23 @@ func (s *AreaProfileStore) GetAreaProfiles() ([]AreaProfile, error) {
 }
 
 // GetProfileIDByAreaCode return the area profile ID associated with the specified area code.
-func (s *AreaProfileStore) GetProfileByAreaCode(areaCode string) (*AreaProfile, error) {
+func (s *AreaProfileStore) GetProfileByAreaCode(ctx context.Context, areaCode string) (*AreaProfile, error) {
+	conn, err := s.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Release()
+
+	return getProfileByAreaCode(ctx, conn, areaCode)
+}
+
+func getProfileByAreaCode(ctx context.Context, q querier, areaCode string) (*AreaProfile, error) {
 	var profileID int
 	var name string
 	var code string
 
-	err := s.conn.QueryRow(context.Background(), getProfileByAreaCodeSQL, areaCode).Scan(&profileID, &name, &code)
+	err := q.QueryRow(ctx, getProfileByAreaCodeSQL, areaCode).Scan(&profileID, &name, &code)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return nil, ErrNotFound
@@ -114,3 +198,26 @@ func (s *AreaProfileStore) GetProfileByAreaCode(areaCode string) (*AreaProfile,
 		Href:     fmt.Sprintf("http://localhost:8080/profiles/%s/stats", code),
 	}, nil
 }
+
+// getProfilesByAreaCodes returns the area profiles of the specified area codes keyed by area code. Area codes without an
+// area profile are omitted.
+func getProfilesByAreaCodes(ctx context.Context, q querier, areaCodes []string) (map[string]*AreaProfile, error) {
+	rows, err := q.Query(ctx, getProfilesByAreaCodesSQL, areaCodes)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	profiles, err := areaProfilesRowsMapper(rows)
+	if err != nil {
+		return nil, errors.Wrap(err, "error scanning get area profiles result rows")
+	}
+
+	byCode := make(map[string]*AreaProfile, len(profiles))
+	for i := range profiles {
+		byCode[profiles[i].AreaCode] = &profiles[i]
+	}
+
+	return byCode, nil
+}
@@ -3,17 +3,10 @@ package store
 import (
 	"context"
 	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
 )
 
 var (
-	// createAreasTableSQL is an SQL statement to create the areas table
-	createAreasTableSQL = `
-		CREATE TABLE IF NOT EXISTS areas (
-			code VARCHAR (50) PRIMARY KEY NOT NULL,
-			name VARCHAR (100) NOT NULL
-		);
-	`
-
 	// insertAreaSQL is an SQL query to insert a new area - requires area code and name.
 	insertAreaSQL = `
 		INSERT INTO areas 
@@ -22,17 +15,353 @@ var (
 			($1, $2) 
 		RETURNING code;
 	`
+
+	// getAreaSQL SQL query returns the area with the specified code.
+	getAreaSQL = `
+		SELECT 
+			a.code, a.name, COALESCE(g.id, 0), COALESCE(g.code, ''), COALESCE(g.name, ''), COALESCE(a.parent_code, ''), p.profile_id IS NOT NULL
+		FROM 
+			areas a
+		LEFT JOIN
+			geography_types g
+		ON
+			g.id = a.geography_type_id
+		LEFT JOIN
+			area_profiles p
+		ON
+			p.area_code = a.code
+		WHERE 
+			a.code = $1;
+	`
+
+	// getAreaChildrenSQL SQL query returns the areas whose parent is the area with the specified code.
+	getAreaChildrenSQL = `
+		SELECT 
+			a.code, a.name, COALESCE(g.id, 0), COALESCE(g.code, ''), COALESCE(g.name, ''), COALESCE(a.parent_code, ''), p.profile_id IS NOT NULL
+		FROM 
+			areas a
+		LEFT JOIN
+			geography_types g
+		ON
+			g.id = a.geography_type_id
+		LEFT JOIN
+			area_profiles p
+		ON
+			p.area_code = a.code
+		WHERE 
+			a.parent_code = $1
+		ORDER BY
+			a.code;
+	`
+
+	// getAreaAncestorsSQL SQL query returns the parent, grandparent etc. of the area with the specified code, nearest
+	// first. The path guards against cycles in the hierarchy.
+	getAreaAncestorsSQL = `
+		WITH RECURSIVE ancestors (code, depth, path) AS (
+			SELECT 
+				parent_code, 1, ARRAY[code]
+			FROM 
+				areas 
+			WHERE 
+				code = $1 AND parent_code IS NOT NULL
+			UNION ALL
+			SELECT 
+				a.parent_code, anc.depth + 1, anc.path || a.code
+			FROM 
+				areas a
+			INNER JOIN
+				ancestors anc
+			ON
+				a.code = anc.code
+			WHERE 
+				a.parent_code IS NOT NULL AND NOT a.code = ANY(anc.path)
+		)
+		SELECT 
+			a.code, a.name, COALESCE(g.id, 0), COALESCE(g.code, ''), COALESCE(g.name, ''), COALESCE(a.parent_code, ''), p.profile_id IS NOT NULL
+		FROM 
+			ancestors anc
+		INNER JOIN
+			areas a
+		ON
+			a.code = anc.code
+		LEFT JOIN
+			geography_types g
+		ON
+			g.id = a.geography_type_id
+		LEFT JOIN
+			area_profiles p
+		ON
+			p.area_code = a.code
+		WHERE
+			NOT anc.code = ANY(anc.path)
+		ORDER BY
+			anc.depth;
+	`
+
+	// upsertAreaSQL SQL statement to insert an area or update the name, geography type and parent of an existing area.
+	// A blank name keeps the name of an existing area, a new area without a name is named by its code.
+	upsertAreaSQL = `
+		INSERT INTO areas 
+			(code, name, geography_type_id, parent_code)
+		VALUES
+			($1, COALESCE(NULLIF($2, ''), $1), $3, NULLIF($4, ''))
+		ON CONFLICT (code) DO UPDATE SET 
+			name = COALESCE(NULLIF($2, ''), areas.name), 
+			geography_type_id = EXCLUDED.geography_type_id, 
+			parent_code = EXCLUDED.parent_code;
+	`
+
+	// getGeographyTypeSQL SQL query returns the geography type with the specified code or name.
+	getGeographyTypeSQL = `
+		SELECT 
+			id, code, name 
+		FROM 
+			geography_types 
+		WHERE 
+			code = $1 OR name = $1;
+	`
+
+	// getGeographyTypesSQL SQL query returns all geography types.
+	getGeographyTypesSQL = `
+		SELECT 
+			id, code, name 
+		FROM 
+			geography_types 
+		ORDER BY 
+			id;
+	`
+
+	// updateAreaSQL SQL statement to update the name of an area.
+	updateAreaSQL = `
+		UPDATE 
+			areas 
+		SET 
+			name = $2 
+		WHERE 
+			code = $1;
+	`
+
+	// deleteAreaSQL SQL statement to delete an area.
+	deleteAreaSQL = `
+		DELETE FROM 
+			areas 
+		WHERE 
+			code = $1;
+	`
 )
 
-// NewArea insert a new area, returns the area code.
-func (s *AreaProfileStore) AddArea(code, name string) (string, error) {
+// NewArea insert a new area, returns the area code. Returns ErrConflict if an area with the code already exists.
+func (s *AreaProfileStore) AddArea(ctx context.Context, code, name string) (string, error) {
+	conn, err := s.acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	defer conn.Release()
+
+	return addArea(ctx, conn, code, name)
+}
+
+func addArea(ctx context.Context, q querier, code, name string) (string, error) {
 	var areaCode string
-	err := s.conn.QueryRow(context.Background(), insertAreaSQL, code, name).Scan(&areaCode)
+	err := q.QueryRow(ctx, insertAreaSQL, code, name).Scan(&areaCode)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return "", nil
 		}
+		if isPgError(err, pgUniqueViolation) {
+			return "", errors.Wrapf(ErrConflict, "area with code %q already exists", code)
+		}
 		return "", err
 	}
 	return areaCode, nil
 }
+
+// GetArea returns the area with the specified code.
+func (s *AreaProfileStore) GetArea(ctx context.Context, code string) (*Area, error) {
+	conn, err := s.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Release()
+
+	return getArea(ctx, conn, code)
+}
+
+func getArea(ctx context.Context, q querier, code string) (*Area, error) {
+	rows, err := q.Query(ctx, getAreaSQL, code)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	areas, err := areasRowsMapper(rows)
+	if err != nil {
+		return nil, errors.Wrap(err, "error mapping area result rows")
+	}
+
+	if len(areas) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return &areas[0], nil
+}
+
+// GetAreaChildren returns the areas whose parent is the area with the specified code. Returns ErrNotFound if the area
+// does not exist.
+func (s *AreaProfileStore) GetAreaChildren(ctx context.Context, code string) ([]Area, error) {
+	return s.getRelatedAreas(ctx, getAreaChildrenSQL, code)
+}
+
+// GetAreaAncestors returns the parent, grandparent etc. of the area with the specified code, nearest first. Returns
+// ErrNotFound if the area does not exist.
+func (s *AreaProfileStore) GetAreaAncestors(ctx context.Context, code string) ([]Area, error) {
+	return s.getRelatedAreas(ctx, getAreaAncestorsSQL, code)
+}
+
+func (s *AreaProfileStore) getRelatedAreas(ctx context.Context, sql, code string) ([]Area, error) {
+	conn, err := s.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Release()
+
+	if _, err := getArea(ctx, conn, code); err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.Query(ctx, sql, code)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	areas, err := areasRowsMapper(rows)
+	if err != nil {
+		return nil, errors.Wrap(err, "error mapping area result rows")
+	}
+
+	return areas, nil
+}
+
+// GetGeographyTypes returns all of the geography types.
+func (s *AreaProfileStore) GetGeographyTypes(ctx context.Context) ([]GeographyType, error) {
+	conn, err := s.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, getGeographyTypesSQL)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	types := make([]GeographyType, 0)
+	for rows.Next() {
+		var g GeographyType
+		if err := rows.Scan(&g.ID, &g.Code, &g.Name); err != nil {
+			return nil, errors.Wrap(err, "error scanning geography type row")
+		}
+		types = append(types, g)
+	}
+
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	return types, nil
+}
+
+// getGeographyType returns the geography type with the specified code or name. Returns ErrMissingReference if there is
+// no such geography type.
+func getGeographyType(ctx context.Context, q querier, codeOrName string) (*GeographyType, error) {
+	g := &GeographyType{}
+	err := q.QueryRow(ctx, getGeographyTypeSQL, codeOrName).Scan(&g.ID, &g.Code, &g.Name)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, errors.Wrapf(ErrMissingReference, "geography type %q does not exist", codeOrName)
+		}
+		return nil, err
+	}
+	return g, nil
+}
+
+// upsertArea inserts the area or updates the name, geography type and parent of the existing area. A blank name keeps
+// the existing name, a new area without a name is named by its code. Returns
+// ErrMissingReference if the geography type or parent area does not exist.
+func upsertArea(ctx context.Context, q querier, code, name, geographyType, parentCode string) error {
+	var geographyTypeID *int
+	if geographyType != "" {
+		g, err := getGeographyType(ctx, q, geographyType)
+		if err != nil {
+			return err
+		}
+		geographyTypeID = &g.ID
+	}
+
+	if parentCode == code {
+		return errors.Wrapf(ErrConflict, "area %q cannot be its own parent", code)
+	}
+
+	if _, err := q.Exec(ctx, upsertAreaSQL, code, name, geographyTypeID, parentCode); err != nil {
+		if isPgError(err, pgForeignKeyViolation) {
+			return errors.Wrapf(ErrMissingReference, "parent area %q does not exist", parentCode)
+		}
+		return errors.Wrapf(err, "error upserting area %q", code)
+	}
+
+	return nil
+}
+
+// UpdateArea updates the name of the area with the specified code.
+func (s *AreaProfileStore) UpdateArea(ctx context.Context, code, name string) error {
+	conn, err := s.acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Release()
+
+	tag, err := conn.Exec(ctx, updateAreaSQL, code, name)
+	if err != nil {
+		return errors.Wrapf(err, "error updating area %q", code)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// DeleteArea deletes the area with the specified code. Returns ErrConflict if the area has an area profile.
+func (s *AreaProfileStore) DeleteArea(ctx context.Context, code string) error {
+	conn, err := s.acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Release()
+
+	tag, err := conn.Exec(ctx, deleteAreaSQL, code)
+	if err != nil {
+		if isPgError(err, pgForeignKeyViolation) {
+			return errors.Wrapf(ErrConflict, "area %q is referenced by other records", code)
+		}
+		return errors.Wrapf(err, "error deleting area %q", code)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
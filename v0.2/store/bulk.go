@@ -0,0 +1,472 @@
+package store
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// BulkProgressInterval is the number of rows staged between calls to the progress func of a bulk load.
+const BulkProgressInterval = 100000
+
+// KeyStatRow is a key stat to bulk load. A blank unit defaults to the default unit of the key stat type.
+type KeyStatRow struct {
+	AreaCode    string
+	Name        string
+	Value       float64
+	Unit        string
+	DatasetID   string
+	DatasetName string
+}
+
+// BulkLoadResult is the outcome of a bulk load. Rows are counted as inserted, a key stat the area profile did not have,
+// updated, a new value, unit or dataset, or unchanged. Versions is the number of the key stats version created for
+// each area profile.
+type BulkLoadResult struct {
+	Inserted  int
+	Updated   int
+	Unchanged int
+	Versions  map[string]int
+}
+
+// NewAreaProfile is an area profile to create for an area without one. A blank AreaName names a new area by its code
+// and a blank Name names the profile by the name of its area.
+type NewAreaProfile struct {
+	AreaCode string
+	AreaName string
+	Name     string
+}
+
+// ProvisionResult is the number of areas and area profiles created by CopyAreaProfiles.
+type ProvisionResult struct {
+	AreasCreated    int
+	ProfilesCreated int
+}
+
+// BulkProgressFunc is called with the number of rows staged as a bulk load progresses.
+type BulkProgressFunc func(staged int)
+
+// Bulk load queries/statements. The rows are copied into a temporary staging table which is merged into the key stats
+// tables set-wise, $1 is the date created of the key stats and $2 the source of the key stats versions.
+var (
+	// createStagingSQL SQL statement creating the key stats staging table, dropped when the transaction ends.
+	createStagingSQL = `
+		CREATE TEMP TABLE IF NOT EXISTS key_stats_staging (
+			area_code VARCHAR(50) NOT NULL,
+			name VARCHAR(100) NOT NULL,
+			value NUMERIC NOT NULL,
+			unit VARCHAR(25) NOT NULL,
+			dataset_id VARCHAR(100) NOT NULL,
+			dataset_name VARCHAR(100) NOT NULL,
+			changed BOOLEAN NOT NULL DEFAULT false
+		) ON COMMIT DROP;
+	`
+
+	// truncateStagingSQL SQL statement emptying the staging table, it exists from any earlier bulk load in the
+	// transaction.
+	truncateStagingSQL = `TRUNCATE key_stats_staging;`
+
+	// createProfilesStagingSQL SQL statement creating the area profiles staging table, dropped when the transaction
+	// ends.
+	createProfilesStagingSQL = `
+		CREATE TEMP TABLE IF NOT EXISTS area_profiles_staging (
+			area_code VARCHAR(50) NOT NULL,
+			area_name VARCHAR(100) NOT NULL,
+			name VARCHAR(100) NOT NULL
+		) ON COMMIT DROP;
+	`
+
+	// truncateProfilesStagingSQL SQL statement emptying the area profiles staging table.
+	truncateProfilesStagingSQL = `TRUNCATE area_profiles_staging;`
+
+	// insertStagedAreasSQL SQL statement inserting the staged areas that do not exist, an area without a name is named
+	// by its code.
+	insertStagedAreasSQL = `
+		INSERT INTO areas
+			(code, name)
+		SELECT DISTINCT ON (area_code)
+			area_code, COALESCE(NULLIF(area_name, ''), area_code)
+		FROM
+			area_profiles_staging
+		ORDER BY
+			area_code
+		ON CONFLICT (code) DO NOTHING;
+	`
+
+	// insertStagedProfilesSQL SQL statement inserting an area profile for each staged area without one, a profile
+	// without a name is named by its area.
+	insertStagedProfilesSQL = `
+		INSERT INTO area_profiles
+			(profile_id, area_code, name)
+		SELECT
+			nextval('area_profile_id'), s.area_code, COALESCE(NULLIF(s.name, ''), a.name)
+		FROM
+			(SELECT DISTINCT ON (area_code) area_code, name FROM area_profiles_staging ORDER BY area_code) s
+		INNER JOIN
+			areas a
+		ON
+			a.code = s.area_code
+		WHERE
+			NOT EXISTS (SELECT 1 FROM area_profiles p WHERE p.area_code = s.area_code);
+	`
+
+	// analyzeStagingSQL SQL statement updating the planner statistics of the staging table, temporary tables are not
+	// analyzed automatically.
+	analyzeStagingSQL = `ANALYZE key_stats_staging;`
+
+	// checkStagedReferencesSQL SQL query returns the number of staged rows for areas without an area profile, the
+	// number with a key stat type that does not exist and the number with a deprecated or replaced key stat type.
+	checkStagedReferencesSQL = `
+		SELECT
+			COUNT(*) FILTER (WHERE p.profile_id IS NULL),
+			COUNT(*) FILTER (WHERE t.type_id IS NULL),
+			COUNT(*) FILTER (WHERE t.status <> 'active')
+		FROM
+			key_stats_staging s
+		LEFT JOIN
+			area_profiles p
+		ON
+			p.area_code = s.area_code
+		LEFT JOIN
+			key_stat_types t
+		ON
+			t.name = s.name;
+	`
+
+	// lockStagedProfilesSQL SQL statement locking the area profiles of the staged rows until the end of the transaction.
+	// Used to serialise the allocation of version numbers.
+	lockStagedProfilesSQL = `
+		SELECT
+			p.profile_id
+		FROM
+			area_profiles p
+		WHERE
+			p.area_code IN (SELECT area_code FROM key_stats_staging)
+		ORDER BY
+			p.profile_id
+		FOR UPDATE;
+	`
+
+	// markStagedChangesSQL SQL statement marking each staged row inserting a new key stat or changing the value, unit or
+	// dataset of the current key stat as changed. A blank dataset name keeps the existing name of the dataset. Driven
+	// from the staging table, each staged row looks up its area profile and key stat type and the current key stat by
+	// its unique key. Only the changed rows are merged into the key stats, must be run before the key stats are upserted.
+	markStagedChangesSQL = `
+		UPDATE
+			key_stats_staging s
+		SET
+			changed = true
+		FROM
+			area_profiles p, key_stat_types t
+		WHERE
+			p.area_code = s.area_code AND t.name = s.name AND NOT EXISTS (
+				SELECT
+					1
+				FROM
+					key_stats k
+				INNER JOIN
+					datasets d
+				ON
+					d.id = k.dataset_id
+				WHERE
+					k.profile_id = p.profile_id
+					AND k.stat_type = t.type_id
+					AND k.value = s.value
+					AND k.unit = COALESCE(NULLIF(s.unit, ''), t.default_unit)
+					AND k.dataset_id = s.dataset_id
+					AND (s.dataset_name = '' OR d.name = s.dataset_name)
+			);
+	`
+
+	// countStagedChangesSQL SQL query returns the number of changed staged rows inserting a new key stat and the number
+	// updating the current key stat.
+	countStagedChangesSQL = `
+		SELECT
+			COUNT(*) FILTER (WHERE s.changed AND k.stat_id IS NULL),
+			COUNT(*) FILTER (WHERE s.changed AND k.stat_id IS NOT NULL)
+		FROM
+			key_stats_staging s
+		INNER JOIN
+			area_profiles p
+		ON
+			p.area_code = s.area_code
+		INNER JOIN
+			key_stat_types t
+		ON
+			t.name = s.name
+		LEFT JOIN
+			key_stats k
+		ON
+			k.profile_id = p.profile_id AND k.stat_type = t.type_id;
+	`
+
+	// insertStagedVersionsSQL SQL statement creating a key stats version with the next version number for each area
+	// profile of the changed staged rows, an area profile without changes does not get a new version. The source of an existing version with the same date created is updated.
+	insertStagedVersionsSQL = `
+		INSERT INTO key_stat_versions
+			(version_id, profile_id, version_number, date_created, label, source)
+		SELECT
+			nextval('key_stat_version_id'), p.profile_id, COALESCE(MAX(v.version_number), 0) + 1, $1, '', $2
+		FROM
+			area_profiles p
+		LEFT JOIN
+			key_stat_versions v
+		ON
+			v.profile_id = p.profile_id
+		WHERE
+			p.area_code IN (SELECT area_code FROM key_stats_staging WHERE changed)
+		GROUP BY
+			p.profile_id
+		ON CONFLICT
+			(profile_id, date_created)
+		DO UPDATE SET source = EXCLUDED.source;
+	`
+
+	// getStagedVersionsSQL SQL query returns the area code and version number of the key stats versions created for the
+	// changed staged rows.
+	getStagedVersionsSQL = `
+		SELECT
+			p.area_code, v.version_number
+		FROM
+			key_stat_versions v
+		INNER JOIN
+			area_profiles p
+		ON
+			p.profile_id = v.profile_id
+		WHERE
+			v.date_created = $1 AND p.area_code IN (SELECT area_code FROM key_stats_staging WHERE changed);
+	`
+
+	// insertStagedDatasetsSQL SQL statement inserting the datasets of the staged rows that do not exist, a dataset
+	// without a name is named by its ID.
+	insertStagedDatasetsSQL = `
+		INSERT INTO datasets
+			(id, name)
+		SELECT DISTINCT ON (dataset_id)
+			dataset_id, COALESCE(NULLIF(dataset_name, ''), dataset_id)
+		FROM
+			key_stats_staging
+		ORDER BY
+			dataset_id, dataset_name = ''
+		ON CONFLICT (id) DO NOTHING;
+	`
+
+	// updateStagedDatasetsSQL SQL statement setting the name of each existing dataset of the staged rows given a name.
+	updateStagedDatasetsSQL = `
+		UPDATE
+			datasets d
+		SET
+			name = s.dataset_name
+		FROM
+			(SELECT DISTINCT ON (dataset_id) dataset_id, dataset_name FROM key_stats_staging WHERE dataset_name <> '' ORDER BY dataset_id) s
+		WHERE
+			d.id = s.dataset_id AND d.name <> s.dataset_name;
+	`
+
+	// upsertStagedKeyStatsSQL SQL statement upserting the current key stat of each changed staged row.
+	upsertStagedKeyStatsSQL = `
+		INSERT INTO key_stats
+			(stat_id, profile_id, stat_type, value, unit, date_created, dataset_id)
+		SELECT
+			nextval('key_stat_id'), p.profile_id, t.type_id, s.value, COALESCE(NULLIF(s.unit, ''), t.default_unit), $1, s.dataset_id
+		FROM
+			key_stats_staging s
+		INNER JOIN
+			area_profiles p
+		ON
+			p.area_code = s.area_code
+		INNER JOIN
+			key_stat_types t
+		ON
+			t.name = s.name
+		WHERE
+			s.changed
+		ON CONFLICT ON CONSTRAINT
+			key_stats_profile_id_stat_type_key
+		DO UPDATE SET value = EXCLUDED.value, unit = EXCLUDED.unit, date_created = EXCLUDED.date_created, dataset_id = EXCLUDED.dataset_id;
+	`
+
+	// insertStagedHistorySQL SQL statement inserting a key stats history entry for each changed staged row.
+	insertStagedHistorySQL = `
+		INSERT INTO key_stats_history
+			(stat_id, profile_id, stat_type, value, unit, date_created, last_modified, dataset_id)
+		SELECT
+			nextval('key_stat_history_id'), p.profile_id, t.type_id, s.value, COALESCE(NULLIF(s.unit, ''), t.default_unit), $1, $1, s.dataset_id
+		FROM
+			key_stats_staging s
+		INNER JOIN
+			area_profiles p
+		ON
+			p.area_code = s.area_code
+		INNER JOIN
+			key_stat_types t
+		ON
+			t.name = s.name
+		WHERE
+			s.changed;
+	`
+)
+
+// CopyKeyStats bulk loads the key stats as a new key stats version of each area profile. The rows are copied into a
+// staging table using the postgres COPY protocol and the rows adding or changing a key stat merged into the key stats
+// and key stats history set-wise, an area profile without changes does not get a new version. Each area profile may
+// only have one row of each key stat type. Returns ErrMissingReference if an area has no area profile, a key stat type
+// or unit does not exist and ErrStatTypeNotActive if a key stat type is deprecated or replaced.
+func (t *areaProfileTx) CopyKeyStats(ctx context.Context, rows []KeyStatRow, source string, dateCreated time.Time, progress BulkProgressFunc) (*BulkLoadResult, error) {
+	for _, stmt := range []string{createStagingSQL, truncateStagingSQL} {
+		if _, err := t.tx.Exec(ctx, stmt); err != nil {
+			return nil, errors.Wrap(err, "error creating key stats staging table")
+		}
+	}
+
+	src := &keyStatRowSource{rows: rows, i: -1, progress: progress}
+	columns := []string{"area_code", "name", "value", "unit", "dataset_id", "dataset_name"}
+
+	if _, err := t.tx.CopyFrom(ctx, pgx.Identifier{"key_stats_staging"}, columns, src); err != nil {
+		return nil, errors.Wrap(err, "error copying key stats into staging table")
+	}
+
+	if progress != nil {
+		progress(len(rows))
+	}
+
+	if _, err := t.tx.Exec(ctx, analyzeStagingSQL); err != nil {
+		return nil, errors.Wrap(err, "error analyzing key stats staging table")
+	}
+
+	var missingProfiles, missingStatTypes, inactiveStatTypes int
+	if err := t.tx.QueryRow(ctx, checkStagedReferencesSQL).Scan(&missingProfiles, &missingStatTypes, &inactiveStatTypes); err != nil {
+		return nil, errors.Wrap(err, "error checking staged key stats")
+	}
+
+	if missingProfiles > 0 || missingStatTypes > 0 {
+		return nil, errors.Wrapf(ErrMissingReference, "%d rows for areas without an area profile, %d rows with a stat type that does not exist", missingProfiles, missingStatTypes)
+	}
+
+	if inactiveStatTypes > 0 {
+		return nil, errors.Wrapf(ErrStatTypeNotActive, "%d rows with a deprecated or replaced stat type", inactiveStatTypes)
+	}
+
+	if _, err := t.tx.Exec(ctx, lockStagedProfilesSQL); err != nil {
+		return nil, errors.Wrap(err, "error locking area profiles")
+	}
+
+	if _, err := t.tx.Exec(ctx, markStagedChangesSQL); err != nil {
+		return nil, errors.Wrap(err, "error marking staged key stat changes")
+	}
+
+	result := &BulkLoadResult{Versions: make(map[string]int)}
+
+	if err := t.tx.QueryRow(ctx, countStagedChangesSQL).Scan(&result.Inserted, &result.Updated); err != nil {
+		return nil, errors.Wrap(err, "error counting staged key stat changes")
+	}
+	result.Unchanged = len(rows) - result.Inserted - result.Updated
+
+	if _, err := t.tx.Exec(ctx, insertStagedVersionsSQL, dateCreated, source); err != nil {
+		return nil, errors.Wrap(err, "error inserting key stats versions")
+	}
+
+	if err := t.getStagedVersions(ctx, dateCreated, result.Versions); err != nil {
+		return nil, err
+	}
+
+	for _, stmt := range []string{insertStagedDatasetsSQL, updateStagedDatasetsSQL} {
+		if _, err := t.tx.Exec(ctx, stmt); err != nil {
+			return nil, errors.Wrap(err, "error upserting datasets")
+		}
+	}
+
+	if _, err := t.tx.Exec(ctx, upsertStagedKeyStatsSQL, dateCreated); err != nil {
+		if isPgError(err, pgForeignKeyViolation) {
+			return nil, errors.Wrap(ErrMissingReference, "unit does not exist")
+		}
+		return nil, errors.Wrap(err, "error upserting key stats")
+	}
+
+	if _, err := t.tx.Exec(ctx, insertStagedHistorySQL, dateCreated); err != nil {
+		return nil, errors.Wrap(err, "error inserting key stats history")
+	}
+
+	return result, nil
+}
+
+// CopyAreaProfiles creates the area profile of each area without one. The profiles are copied into a staging table
+// using the postgres COPY protocol and the missing areas and area profiles inserted set-wise, so the number of round
+// trips does not depend on the number of profiles. Existing areas and area profiles are not changed.
+func (t *areaProfileTx) CopyAreaProfiles(ctx context.Context, profiles []NewAreaProfile) (*ProvisionResult, error) {
+	for _, stmt := range []string{createProfilesStagingSQL, truncateProfilesStagingSQL} {
+		if _, err := t.tx.Exec(ctx, stmt); err != nil {
+			return nil, errors.Wrap(err, "error creating area profiles staging table")
+		}
+	}
+
+	src := pgx.CopyFromSlice(len(profiles), func(i int) ([]interface{}, error) {
+		p := profiles[i]
+		return []interface{}{p.AreaCode, p.AreaName, p.Name}, nil
+	})
+
+	if _, err := t.tx.CopyFrom(ctx, pgx.Identifier{"area_profiles_staging"}, []string{"area_code", "area_name", "name"}, src); err != nil {
+		return nil, errors.Wrap(err, "error copying area profiles into staging table")
+	}
+
+	result := &ProvisionResult{}
+
+	tag, err := t.tx.Exec(ctx, insertStagedAreasSQL)
+	if err != nil {
+		return nil, errors.Wrap(err, "error inserting areas")
+	}
+	result.AreasCreated = int(tag.RowsAffected())
+
+	if tag, err = t.tx.Exec(ctx, insertStagedProfilesSQL); err != nil {
+		return nil, errors.Wrap(err, "error inserting area profiles")
+	}
+	result.ProfilesCreated = int(tag.RowsAffected())
+
+	return result, nil
+}
+
+// getStagedVersions adds the version number of the key stats version created for each area profile to versions.
+func (t *areaProfileTx) getStagedVersions(ctx context.Context, dateCreated time.Time, versions map[string]int) error {
+	rows, err := t.tx.Query(ctx, getStagedVersionsSQL, dateCreated)
+	if err != nil {
+		return errors.Wrap(err, "error getting key stats versions")
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var areaCode string
+		var version int
+		if err := rows.Scan(&areaCode, &version); err != nil {
+			return errors.Wrap(err, "error mapping key stats version result rows")
+		}
+		versions[areaCode] = version
+	}
+
+	return rows.Err()
+}
+
+// keyStatRowSource is a pgx.CopyFromSource of key stat rows calling the progress func every BulkProgressInterval rows.
+type keyStatRowSource struct {
+	rows     []KeyStatRow
+	i        int
+	progress BulkProgressFunc
+}
+
+func (s *keyStatRowSource) Next() bool {
+	s.i++
+	if s.progress != nil && s.i > 0 && s.i%BulkProgressInterval == 0 && s.i < len(s.rows) {
+		s.progress(s.i)
+	}
+	return s.i < len(s.rows)
+}
+
+func (s *keyStatRowSource) Values() ([]interface{}, error) {
+	r := s.rows[s.i]
+	return []interface{}{r.AreaCode, r.Name, r.Value, r.Unit, r.DatasetID, r.DatasetName}, nil
+}
+
+func (s *keyStatRowSource) Err() error {
+	return nil
+}
@@ -0,0 +1,236 @@
+package store_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store"
+	"github.com/pkg/errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// nationalAreas is the number of area profiles bulk loaded by the national benchmark, about the number of output areas
+// in England and Wales.
+const nationalAreas = 190000
+
+// nationalStatTypes are the key stat types of each area profile bulk loaded by the national benchmark.
+var nationalStatTypes = []string{
+	"Resident population",
+	"Population density (Hectares)",
+	"Average (mean) age",
+	"People think their general health is good",
+	"Households where English is not the main language",
+}
+
+// copyKeyStats bulk loads the key stats rows in a transaction.
+func copyKeyStats(t *testing.T, s testStore, rows []store.KeyStatRow, dateCreated time.Time) *store.BulkLoadResult {
+	t.Helper()
+
+	var result *store.BulkLoadResult
+	err := s.InTransaction(context.Background(), func(tx store.Tx) error {
+		var err error
+		result, err = tx.CopyKeyStats(context.Background(), rows, "test", dateCreated, nil)
+		return err
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return result
+}
+
+func TestCopyAreaProfiles(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s testStore) {
+		ctx := context.Background()
+		addProfile(t, s, "E05011362")
+
+		profiles := []store.NewAreaProfile{
+			{AreaCode: "E05011362", AreaName: "Disbury East", Name: "Disbury East profile"},
+			{AreaCode: "E05011363", AreaName: "Disbury West"},
+			{AreaCode: "E05011364"},
+		}
+
+		// existing areas and area profiles are not changed, copying the profiles again creates nothing.
+		for _, expected := range []store.ProvisionResult{{AreasCreated: 2, ProfilesCreated: 2}, {}} {
+			var result *store.ProvisionResult
+			err := s.InTransaction(ctx, func(tx store.Tx) error {
+				var err error
+				result, err = tx.CopyAreaProfiles(ctx, profiles)
+				return err
+			})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if *result != expected {
+				t.Errorf("expected %+v, got %+v", expected, *result)
+			}
+		}
+
+		expected := map[string]string{
+			"E05011362": "E05011362 profile",
+			"E05011363": "Disbury West",
+			"E05011364": "E05011364",
+		}
+
+		for areaCode, name := range expected {
+			profile, err := s.GetProfileByAreaCode(ctx, areaCode)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if profile.Name != name {
+				t.Errorf("expected area profile %q of %q, got %q", name, areaCode, profile.Name)
+			}
+		}
+	})
+}
+
+func TestCopyKeyStats(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s testStore) {
+		ctx := context.Background()
+		a := addProfile(t, s, "E05011362")
+		b := addProfile(t, s, "E05011363")
+
+		d1 := time.Date(2022, 4, 11, 16, 12, 25, 0, time.UTC)
+		rows := []store.KeyStatRow{
+			{AreaCode: a.AreaCode, Name: residents, Value: 100, DatasetID: "TS001", DatasetName: "Census 2021"},
+			{AreaCode: a.AreaCode, Name: meanAge, Value: 40, DatasetID: "TS001", DatasetName: "Census 2021"},
+			{AreaCode: b.AreaCode, Name: residents, Value: 5, DatasetID: "TS001", DatasetName: "Census 2021"},
+		}
+
+		result := copyKeyStats(t, s, rows, d1)
+		expected := store.BulkLoadResult{Inserted: 3, Versions: map[string]int{a.AreaCode: 1, b.AreaCode: 1}}
+		if !reflect.DeepEqual(*result, expected) {
+			t.Errorf("expected %+v, got %+v", expected, *result)
+		}
+
+		// reloading the same rows, or the rows without a dataset name, changes nothing and creates no versions.
+		for i, datasetName := range []string{"Census 2021", ""} {
+			reload := make([]store.KeyStatRow, len(rows))
+			copy(reload, rows)
+			for j := range reload {
+				reload[j].DatasetName = datasetName
+			}
+
+			result = copyKeyStats(t, s, reload, d1.Add(time.Duration(i+1)*time.Hour))
+			expected = store.BulkLoadResult{Unchanged: 3, Versions: map[string]int{}}
+			if !reflect.DeepEqual(*result, expected) {
+				t.Errorf("dataset name %q: expected %+v, got %+v", datasetName, expected, *result)
+			}
+		}
+
+		// only the area profile with a changed key stat gets a new version.
+		rows[1].Value = 41
+		result = copyKeyStats(t, s, rows, d1.Add(3*time.Hour))
+		expected = store.BulkLoadResult{Updated: 1, Unchanged: 2, Versions: map[string]int{a.AreaCode: 2}}
+		if !reflect.DeepEqual(*result, expected) {
+			t.Errorf("expected %+v, got %+v", expected, *result)
+		}
+
+		// a new dataset name changes the key stats of the dataset.
+		rows[2].DatasetName = "Census 2021 (revised)"
+		result = copyKeyStats(t, s, rows[2:], d1.Add(4*time.Hour))
+		expected = store.BulkLoadResult{Updated: 1, Versions: map[string]int{b.AreaCode: 2}}
+		if !reflect.DeepEqual(*result, expected) {
+			t.Errorf("expected %+v, got %+v", expected, *result)
+		}
+
+		current, err := s.GetKeyStatsForProfile(ctx, a)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got, want := values(current), map[string]float64{residents: 100, meanAge: 41}; !reflect.DeepEqual(got, want) {
+			t.Errorf("expected current key stats %v, got %v", want, got)
+		}
+
+		versions, err := s.GetKeyStatsVersionsForProfile(ctx, a)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(versions) != 2 {
+			t.Errorf("expected 2 key stats versions, got %+v", versions)
+		}
+	})
+}
+
+func TestCopyKeyStatsMissingReference(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s testStore) {
+		a := addProfile(t, s, "E05011362")
+
+		cases := map[string]store.KeyStatRow{
+			"area profile":  {AreaCode: "E05000001", Name: residents, Value: 1, DatasetID: "TS001"},
+			"key stat type": {AreaCode: a.AreaCode, Name: "Not a key stat", Value: 1, DatasetID: "TS001"},
+		}
+
+		for name, row := range cases {
+			err := s.InTransaction(context.Background(), func(tx store.Tx) error {
+				_, err := tx.CopyKeyStats(context.Background(), []store.KeyStatRow{row}, "test", time.Now(), nil)
+				return err
+			})
+
+			if !errors.Is(err, store.ErrMissingReference) {
+				t.Errorf("%s: expected %q, got %v", name, store.ErrMissingReference, err)
+			}
+		}
+	})
+}
+
+// BenchmarkCopyKeyStatsNational measures bulk loading a new value of every key stat of a national-scale number of area
+// profiles into the postgres test database, each iteration updates every row. Skipped if the test database is not set.
+func BenchmarkCopyKeyStatsNational(b *testing.B) {
+	ctx := context.Background()
+	s := newPostgresStore(b)
+
+	profiles := make([]store.NewAreaProfile, 0, nationalAreas)
+	for i := 0; i < nationalAreas; i++ {
+		profiles = append(profiles, store.NewAreaProfile{AreaCode: fmt.Sprintf("E%08d", i)})
+	}
+
+	err := s.InTransaction(ctx, func(tx store.Tx) error {
+		_, err := tx.CopyAreaProfiles(ctx, profiles)
+		return err
+	})
+
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	rows := make([]store.KeyStatRow, 0, nationalAreas*len(nationalStatTypes))
+	for _, p := range profiles {
+		for _, name := range nationalStatTypes {
+			rows = append(rows, store.KeyStatRow{AreaCode: p.AreaCode, Name: name, DatasetID: "TS001", DatasetName: "Census 2021"})
+		}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	var elapsed time.Duration
+	for i := 0; i < b.N; i++ {
+		for j := range rows {
+			rows[j].Value = float64((i + j) % 100)
+		}
+
+		start := time.Now()
+		err := s.InTransaction(ctx, func(tx store.Tx) error {
+			result, err := tx.CopyKeyStats(ctx, rows, "benchmark", time.Now().UTC(), nil)
+			if err == nil && result.Inserted+result.Updated != len(rows) {
+				err = fmt.Errorf("expected %d rows inserted or updated, got %+v", len(rows), result)
+			}
+			return err
+		})
+		elapsed += time.Since(start)
+
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ReportMetric(float64(len(rows)*b.N)/elapsed.Minutes(), "rows/min")
+}
@@ -0,0 +1,170 @@
+package store
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+)
+
+// Dataset queries/statements.
+var (
+	// getDatasetsSQL SQL query returns all datasets.
+	getDatasetsSQL = `
+		SELECT
+			id, name, description, editions, release_date
+		FROM
+			datasets
+		ORDER BY
+			id;
+	`
+
+	// getDatasetSQL SQL query returns the dataset with the specified ID.
+	getDatasetSQL = `
+		SELECT
+			id, name, description, editions, release_date
+		FROM
+			datasets
+		WHERE
+			id = $1;
+	`
+
+	// getDatasetStatsSQL SQL query returns the area profiles and stat types of the current key stats sourced from the
+	// specified dataset.
+	getDatasetStatsSQL = `
+		SELECT
+			p.area_code, p.name, t.type_id, t.name
+		FROM
+			key_stats s
+		INNER JOIN
+			area_profiles p
+		ON
+			p.profile_id = s.profile_id
+		INNER JOIN
+			key_stat_types t
+		ON
+			t.type_id = s.stat_type
+		WHERE
+			s.dataset_id = $1
+		ORDER BY
+			p.area_code, t.type_id;
+	`
+
+	// upsertDatasetSQL SQL statement inserts a dataset or updates the existing dataset. A blank name or description
+	// keeps the existing value, a new dataset without a name is named by its ID. Editions are added to the existing
+	// editions and the release date is only ever moved forward.
+	upsertDatasetSQL = `
+		INSERT INTO datasets
+			(id, name, description, editions, release_date)
+		VALUES
+			($1, COALESCE(NULLIF($2, ''), $1), $3, $4, $5)
+		ON CONFLICT (id) DO UPDATE SET
+			name = COALESCE(NULLIF($2, ''), datasets.name),
+			description = COALESCE(NULLIF($3, ''), datasets.description),
+			editions = ARRAY(SELECT DISTINCT e FROM unnest(datasets.editions || EXCLUDED.editions) e ORDER BY e),
+			release_date = GREATEST(datasets.release_date, EXCLUDED.release_date);
+	`
+)
+
+// GetDatasets returns all datasets.
+func (s *AreaProfileStore) GetDatasets(ctx context.Context) ([]Dataset, error) {
+	conn, err := s.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, getDatasetsSQL)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	datasets, err := datasetsRowsMapper(rows)
+	if err != nil {
+		return nil, errors.Wrap(err, "error mapping dataset result rows")
+	}
+
+	return datasets, nil
+}
+
+// GetDataset returns the dataset with the specified ID.
+func (s *AreaProfileStore) GetDataset(ctx context.Context, id string) (*Dataset, error) {
+	conn, err := s.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Release()
+
+	return getDataset(ctx, conn, id)
+}
+
+func getDataset(ctx context.Context, q querier, id string) (*Dataset, error) {
+	var d Dataset
+	err := q.QueryRow(ctx, getDatasetSQL, id).Scan(&d.ID, &d.Name, &d.Description, &d.Editions, &d.ReleaseDate)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, errors.Wrapf(err, "error getting dataset %q", id)
+	}
+
+	d.SetLinks()
+	return &d, nil
+}
+
+// GetDatasetStats returns the area profiles and key stat types the current key stats of which are sourced from the
+// specified dataset.
+func (s *AreaProfileStore) GetDatasetStats(ctx context.Context, id string) (*DatasetStats, error) {
+	conn, err := s.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Release()
+
+	if _, err := getDataset(ctx, conn, id); err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.Query(ctx, getDatasetStatsSQL, id)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	stats := &DatasetStats{DatasetID: id, StatTypes: make([]KeyStatType, 0), Profiles: make([]DatasetProfile, 0)}
+	for rows.Next() {
+		var areaCode, profileName string
+		var t KeyStatType
+
+		if err := rows.Scan(&areaCode, &profileName, &t.ID, &t.Name); err != nil {
+			return nil, errors.Wrap(err, "error scanning dataset stats row")
+		}
+
+		stats.AddStat(areaCode, profileName, t)
+	}
+
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	return stats, nil
+}
+
+// upsertDataset inserts the dataset or updates the existing dataset with the same ID.
+func upsertDataset(ctx context.Context, q querier, d Dataset) error {
+	editions := d.Editions
+	if editions == nil {
+		editions = []string{}
+	}
+
+	if _, err := q.Exec(ctx, upsertDatasetSQL, d.ID, d.Name, d.Description, editions, d.ReleaseDate); err != nil {
+		return errors.Wrapf(err, "error upserting dataset %q", d.ID)
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package store
+
+import (
+	"math"
+	"sort"
+)
+
+// KeyStatsDiff describes the differences between two sets of key stats for an area profile.
+type KeyStatsDiff struct {
+	AreaCode  string          `json:"area_code"`
+	Added     KeyStatistics   `json:"added"`
+	Removed   KeyStatistics   `json:"removed"`
+	Changed   []KeyStatChange `json:"changed"`
+	Unchanged KeyStatistics   `json:"unchanged"`
+}
+
+// KeyStatChange describes how a key stat differs between two sets of key stats.
+type KeyStatChange struct {
+	StatType   int     `json:"stat_type"`
+	Name       string  `json:"name"`
+	OldValue   float64 `json:"old_value"`
+	NewValue   float64 `json:"new_value"`
+	OldDisplay string  `json:"old_display"`
+	NewDisplay string  `json:"new_display"`
+	OldUnit    string  `json:"old_unit"`
+	NewUnit    string  `json:"new_unit"`
+	// AbsoluteChange is the difference between the new and old value.
+	AbsoluteChange *float64 `json:"absolute_change,omitempty"`
+	// PercentageChange is the change as a percentage of the old value. Only set if the old value is not 0.
+	PercentageChange *float64             `json:"percentage_change,omitempty"`
+	DatasetChanged   bool                 `json:"dataset_changed"`
+	OldDataset       KeyStatisticMetadata `json:"old_dataset"`
+	NewDataset       KeyStatisticMetadata `json:"new_dataset"`
+}
+
+// DiffKeyStatistics compares two sets of key stats matching stats by stat type. Stats only in to are added, stats only
+// in from are removed and stats in both with a different value, unit or dataset are changed.
+func DiffKeyStatistics(areaCode string, from, to KeyStatistics) KeyStatsDiff {
+	diff := KeyStatsDiff{
+		AreaCode:  areaCode,
+		Added:     make(KeyStatistics, 0),
+		Removed:   make(KeyStatistics, 0),
+		Changed:   make([]KeyStatChange, 0),
+		Unchanged: make(KeyStatistics, 0),
+	}
+
+	old := make(map[int]KeyStatistic, len(from))
+	for _, s := range from {
+		old[s.StatType] = s
+	}
+
+	for _, s := range to {
+		prev, ok := old[s.StatType]
+		if !ok {
+			diff.Added = append(diff.Added, s)
+			continue
+		}
+
+		delete(old, s.StatType)
+
+		datasetChanged := prev.Metadata.DatasetID != s.Metadata.DatasetID || prev.Metadata.DatasetName != s.Metadata.DatasetName
+		if prev.Value == s.Value && prev.Unit == s.Unit && !datasetChanged {
+			diff.Unchanged = append(diff.Unchanged, s)
+			continue
+		}
+
+		diff.Changed = append(diff.Changed, newKeyStatChange(prev, s, datasetChanged))
+	}
+
+	for _, s := range old {
+		diff.Removed = append(diff.Removed, s)
+	}
+
+	sort.Slice(diff.Removed, func(i, j int) bool {
+		return diff.Removed[i].StatType < diff.Removed[j].StatType
+	})
+
+	return diff
+}
+
+func newKeyStatChange(prev, next KeyStatistic, datasetChanged bool) KeyStatChange {
+	change := KeyStatChange{
+		StatType:       next.StatType,
+		Name:           next.Name,
+		OldValue:       prev.Value,
+		NewValue:       next.Value,
+		OldDisplay:     prev.Display,
+		NewDisplay:     next.Display,
+		OldUnit:        prev.Unit,
+		NewUnit:        next.Unit,
+		DatasetChanged: datasetChanged,
+		OldDataset:     prev.Metadata,
+		NewDataset:     next.Metadata,
+	}
+
+	change.AbsoluteChange, change.PercentageChange = numericChange(prev.Value, next.Value)
+	return change
+}
+
+// SetPeriodChanges sets the change from the previous value on each history entry. The entries must be ordered oldest first.
+func (h *KeyStatHistory) SetPeriodChanges() {
+	for i := 1; i < len(h.History); i++ {
+		h.History[i].AbsoluteChange, h.History[i].PercentageChange = numericChange(h.History[i-1].Value, h.History[i].Value)
+	}
+}
+
+// numericChange returns the absolute and percentage change between two values. The percentage change is nil if the
+// old value is 0.
+func numericChange(oldVal, newVal float64) (*float64, *float64) {
+	abs := newVal - oldVal
+	if oldVal == 0 {
+		return &abs, nil
+	}
+
+	pct := abs / math.Abs(oldVal) * 100
+	return &abs, &pct
+}
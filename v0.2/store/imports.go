@@ -0,0 +1,142 @@
+package store
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+)
+
+// Import queries/statements.
+var (
+	// getImportsSQL SQL query returns the imports most recent first optionally filtered by status. A blank status
+	// matches every import.
+	getImportsSQL = `
+		SELECT
+			id, file_name, checksum, status, row_count, loaded, rejected, inserted, updated, unchanged, started_at, 
+			finished_at, version, duplicate_of, error
+		FROM
+			imports
+		WHERE
+			$1 = '' OR status = $1
+		ORDER BY
+			id DESC;
+	`
+
+	// getImportSQL SQL query returns the import with the specified ID.
+	getImportSQL = `
+		SELECT
+			id, file_name, checksum, status, row_count, loaded, rejected, inserted, updated, unchanged, started_at, 
+			finished_at, version, duplicate_of, error
+		FROM
+			imports
+		WHERE
+			id = $1;
+	`
+
+	// getCompletedImportByChecksumSQL SQL query returns the most recent completed import of a file with the specified
+	// checksum.
+	getCompletedImportByChecksumSQL = `
+		SELECT
+			id, file_name, checksum, status, row_count, loaded, rejected, inserted, updated, unchanged, started_at, 
+			finished_at, version, duplicate_of, error
+		FROM
+			imports
+		WHERE
+			checksum = $1 AND status = 'completed'
+		ORDER BY
+			id DESC
+		LIMIT 1;
+	`
+
+	// insertImportSQL SQL statement inserts an import.
+	insertImportSQL = `
+		INSERT INTO imports
+			(id, file_name, checksum, status, row_count, loaded, rejected, inserted, updated, unchanged, started_at, 
+			finished_at, version, duplicate_of, error)
+		VALUES
+			(nextval('import_id'), $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		RETURNING id;
+	`
+)
+
+// GetImports returns the imports with the specified status most recent first. A blank status returns every import.
+func (s *AreaProfileStore) GetImports(ctx context.Context, status string) ([]Import, error) {
+	conn, err := s.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, getImportsSQL, status)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	imports, err := importsRowsMapper(rows)
+	if err != nil {
+		return nil, errors.Wrap(err, "error mapping import result rows")
+	}
+
+	return imports, nil
+}
+
+// GetImport returns the import with the specified ID.
+func (s *AreaProfileStore) GetImport(ctx context.Context, id int) (*Import, error) {
+	conn, err := s.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Release()
+
+	return getImport(ctx, conn, getImportSQL, id)
+}
+
+// AddImport inserts an entry in the imports ledger returning its ID. Used to record imports that failed and were
+// rolled back, other imports are recorded in the transaction of the import.
+func (s *AreaProfileStore) AddImport(ctx context.Context, i Import) (int, error) {
+	conn, err := s.acquire(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	defer conn.Release()
+
+	return addImport(ctx, conn, i)
+}
+
+// GetCompletedImportByChecksum returns the most recent completed import of a file with the specified checksum.
+func (t *areaProfileTx) GetCompletedImportByChecksum(ctx context.Context, checksum string) (*Import, error) {
+	return getImport(ctx, t.tx, getCompletedImportByChecksumSQL, checksum)
+}
+
+// AddImport inserts an entry in the imports ledger returning its ID.
+func (t *areaProfileTx) AddImport(ctx context.Context, i Import) (int, error) {
+	return addImport(ctx, t.tx, i)
+}
+
+func addImport(ctx context.Context, q querier, i Import) (int, error) {
+	var id int
+	err := q.QueryRow(ctx, insertImportSQL, i.File, i.Checksum, i.Status, i.Rows, i.Loaded, i.Rejected, i.Inserted,
+		i.Updated, i.Unchanged, i.StartedAt, i.FinishedAt, i.Version, i.DuplicateOf, i.Error).Scan(&id)
+	if err != nil {
+		return 0, errors.Wrapf(err, "error inserting import of file %q", i.File)
+	}
+
+	return id, nil
+}
+
+func getImport(ctx context.Context, q querier, sql string, args ...interface{}) (*Import, error) {
+	i, err := mapRowToImport(q.QueryRow(ctx, sql, args...))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, errors.Wrap(err, "error getting import")
+	}
+
+	return i, nil
+}
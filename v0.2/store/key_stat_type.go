@@ -2,69 +2,255 @@ package store
 
 import (
 	"context"
+	"github.com/jackc/pgx/v4"
 	"github.com/pkg/errors"
 )
 
 var (
-	// createKeyStatTypeSQL SQL statement to create the key stat type table.
-	createKeyStatTypeSQL = `
-		CREATE TABLE IF NOT EXISTS key_stat_types (
-			type_id INT PRIMARY KEY NOT NULL,
-			name VARCHAR(100) NOT NULL,
-			UNIQUE (name)
-		);
+	// insertKeyStatTypeSQL SQL statement to insert a new key stat type entry. A display order of 0 places the new type
+	// after the existing types.
+	insertKeyStatTypeSQL = `
+		INSERT INTO key_stat_types
+			(type_id, name, description, category, default_unit, display_order, status, replaced_by, value_type, value_precision)
+		VALUES
+			(nextval('key_stat_type_id'), $1, $2, $3, $4,
+			COALESCE(NULLIF($5, 0), (SELECT COALESCE(MAX(display_order), 0) + 1 FROM key_stat_types)), $6, $7, $8, $9)
+		RETURNING type_id;
 	`
 
-	//createKeyStatTypeSeqSQL SQL statement to create the key stat id sequence.
-	createKeyStatTypeSeqSQL = `
-		CREATE SEQUENCE 
-			key_stat_type_id 
-		START 
-			1000 
-		INCREMENT 
-			100 
-		MINVALUE 
-			1000 
-		OWNED BY 
-			key_stat_types.type_id;
+	// updateKeyStatTypeSQL SQL statement to update a key stat type entry.
+	updateKeyStatTypeSQL = `
+		UPDATE
+			key_stat_types
+		SET
+			name = $2, description = $3, category = $4, default_unit = $5, display_order = $6, status = $7, replaced_by = $8,
+			value_type = $9, value_precision = $10
+		WHERE
+			type_id = $1;
 	`
 
-	// insertKeyStatTypeSQL SQL statement to insert a new key stat type entry.
-	insertKeyStatTypeSQL = `
-		INSERT INTO key_stat_types 
-			(type_id, name) 
-		VALUES 
-			(nextval('key_stat_type_id'), $1);
+	// getStatTypeByNameSQL SQL query returns key stat type id for the type with the specified name.
+	getStatTypeByNameSQL = `
+		SELECT
+			t.type_id
+		FROM
+			key_stat_types t
+		WHERE
+			name = $1;
 	`
 
-	//getStatTypeByName SQL query returns key stat type id for the type with the specified name.
-	getStatTypeByName = `
-		SELECT 
-			t.type_id 
-		FROM 
-			key_stat_types t 
-		WHERE 
-			name = $1;
+	// getStatTypeValueRulesSQL SQL query returns the key stat type id, value type, default unit, status and the name of
+	// the replacing key stat type, blank if not replaced, for the type with the specified name.
+	getStatTypeValueRulesSQL = `
+		SELECT
+			t.type_id, t.value_type, t.default_unit, t.status, COALESCE(r.name, '')
+		FROM
+			key_stat_types t
+		LEFT JOIN
+			key_stat_types r
+		ON
+			r.type_id = t.replaced_by
+		WHERE
+			t.name = $1;
+	`
+
+	// getStatTypesSQL SQL query returns the key stat types in display order optionally filtered by status. A blank
+	// status matches every key stat type.
+	getStatTypesSQL = `
+		SELECT
+			type_id, name, description, category, default_unit, display_order, status, replaced_by, value_type, value_precision
+		FROM
+			key_stat_types
+		WHERE
+			$1 = '' OR status = $1
+		ORDER BY
+			display_order, type_id;
+	`
+
+	// getStatTypeByIDSQL SQL query returns the key stat type with the specified ID.
+	getStatTypeByIDSQL = `
+		SELECT
+			type_id, name, description, category, default_unit, display_order, status, replaced_by, value_type, value_precision
+		FROM
+			key_stat_types
+		WHERE
+			type_id = $1;
 	`
 )
 
-// InsertKeyStatTypes create a new key stat type for each of the name values provided.
-func (s *AreaProfileStore) InsertKeyStatTypes(names ...string) error {
-	for _, name := range names {
-		_, err := s.conn.Exec(context.Background(), insertKeyStatTypeSQL, name)
-		if err != nil {
-			return errors.Wrapf(err, "error inserting key_stat_type: %q", name)
-		}
+// GetStatTypes returns the key stat types with the specified status in display order. A blank status returns every key
+// stat type.
+func (s *AreaProfileStore) GetStatTypes(ctx context.Context, status string) ([]KeyStatType, error) {
+	conn, err := s.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, getStatTypesSQL, status)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	types, err := statTypesRowsMapper(rows)
+	if err != nil {
+		return nil, errors.Wrap(err, "error mapping stat type result rows")
+	}
+
+	return types, nil
+}
+
+// GetStatTypeByID returns the key stat type with the specified ID.
+func (s *AreaProfileStore) GetStatTypeByID(ctx context.Context, id int) (*KeyStatType, error) {
+	conn, err := s.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Release()
+
+	return getStatTypeByID(ctx, conn, id)
+}
+
+func getStatTypeByID(ctx context.Context, q querier, id int) (*KeyStatType, error) {
+	rows, err := q.Query(ctx, getStatTypeByIDSQL, id)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	types, err := statTypesRowsMapper(rows)
+	if err != nil {
+		return nil, errors.Wrap(err, "error mapping stat type result rows")
+	}
+
+	if len(types) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return &types[0], nil
+}
+
+// AddStatType inserts a new key stat type returning its ID. A display order of 0 places the new type after the existing
+// types, a blank status defaults to active and a blank value type defaults to count. Returns ErrConflict if a key stat
+// type with the same name already exists or ErrMissingReference if the replacing key stat type or default unit does
+// not exist.
+func (s *AreaProfileStore) AddStatType(ctx context.Context, t KeyStatType) (int, error) {
+	conn, err := s.acquire(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	defer conn.Release()
+
+	return addStatType(ctx, conn, t)
+}
+
+func addStatType(ctx context.Context, q querier, t KeyStatType) (int, error) {
+	if t.Status == "" {
+		t.Status = StatTypeActive
+	}
+
+	if t.ValueType == "" {
+		t.ValueType = ValueTypeCount
+	}
+
+	var typeID int
+	err := q.QueryRow(ctx, insertKeyStatTypeSQL, t.Name, t.Description, t.Category, t.DefaultUnit, t.DisplayOrder, t.Status, t.ReplacedBy, t.ValueType, t.Precision).Scan(&typeID)
+	if err != nil {
+		return 0, statTypeWriteError(err, t)
+	}
+
+	return typeID, nil
+}
+
+// UpdateStatType replaces the key stat type with the ID of the key stat type provided. Returns ErrConflict if another
+// key stat type has the same name or ErrMissingReference if the replacing key stat type or default unit does not exist.
+func (s *AreaProfileStore) UpdateStatType(ctx context.Context, t KeyStatType) error {
+	conn, err := s.acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Release()
+
+	tag, err := conn.Exec(ctx, updateKeyStatTypeSQL, t.ID, t.Name, t.Description, t.Category, t.DefaultUnit, t.DisplayOrder, t.Status, t.ReplacedBy, t.ValueType, t.Precision)
+	if err != nil {
+		return statTypeWriteError(err, t)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
 	}
+
 	return nil
 }
 
+func statTypeWriteError(err error, t KeyStatType) error {
+	if isPgError(err, pgUniqueViolation) {
+		return errors.Wrapf(ErrConflict, "stat type %q already exists", t.Name)
+	}
+
+	if isPgError(err, pgForeignKeyViolation) {
+		if pgConstraint(err) == "fk_default_unit" {
+			return errors.Wrapf(ErrMissingReference, "unit %q does not exist", t.DefaultUnit)
+		}
+		return errors.Wrapf(ErrMissingReference, "replacing stat type %d does not exist", *t.ReplacedBy)
+	}
+
+	return errors.Wrapf(err, "error writing key_stat_type: %q", t.Name)
+}
+
 // GetStatTypeByName return the stat type if for the name with the specified name value.
-func (s *AreaProfileStore) GetStatTypeByName(name string) (int, error) {
+func (s *AreaProfileStore) GetStatTypeByName(ctx context.Context, name string) (int, error) {
+	conn, err := s.acquire(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	defer conn.Release()
+
+	return getStatTypeByName(ctx, conn, name)
+}
+
+func getStatTypeByName(ctx context.Context, q querier, name string) (int, error) {
 	var typeID int
-	err := s.conn.QueryRow(context.Background(), getStatTypeByName, name).Scan(&typeID)
+	err := q.QueryRow(ctx, getStatTypeByNameSQL, name).Scan(&typeID)
 	if err != nil {
+		if err == pgx.ErrNoRows {
+			return 0, errors.Wrapf(ErrNotFound, "error getting stat type for name %q", name)
+		}
 		return 0, errors.Wrapf(err, "error getting stat type for name %q", name)
 	}
 	return typeID, nil
 }
+
+// CheckActive returns ErrStatTypeNotActive if the key stat type is deprecated or replaced, values may only be written
+// for active key stat types. replacement is the name of the key stat type replacing a replaced type.
+func (t KeyStatType) CheckActive(replacement string) error {
+	switch {
+	case t.Status == StatTypeReplaced && replacement != "":
+		return errors.Wrapf(ErrStatTypeNotActive, "key stat type %q is replaced by %q", t.Name, replacement)
+	case t.Status != "" && t.Status != StatTypeActive:
+		return errors.Wrapf(ErrStatTypeNotActive, "key stat type %q is %s", t.Name, t.Status)
+	default:
+		return nil
+	}
+}
+
+// MissingReferenceError returns ErrMissingReference describing the key stat type, specified by ID and/or name, that
+// does not exist.
+func (t KeyStatType) MissingReferenceError() error {
+	switch {
+	case t.ID != 0 && t.Name != "":
+		return errors.Wrapf(ErrMissingReference, "stat type %d or %q does not exist", t.ID, t.Name)
+	case t.ID != 0:
+		return errors.Wrapf(ErrMissingReference, "stat type %d does not exist", t.ID)
+	default:
+		return errors.Wrapf(ErrMissingReference, "stat type %q does not exist", t.Name)
+	}
+}
@@ -0,0 +1,206 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// LatestVersion is an alias that can be used in place of a version number to request the most recent version.
+const LatestVersion = "latest"
+
+// versionTimestampLayouts are the timestamp formats accepted when requesting a key stats version by timestamp.
+var versionTimestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+var (
+	// lockProfileSQL SQL statement locking an area profile row until the end of the transaction. Used to serialise the
+	// allocation of version numbers.
+	lockProfileSQL = `
+		SELECT 
+			profile_id 
+		FROM 
+			area_profiles 
+		WHERE 
+			profile_id = $1 
+		FOR UPDATE;
+	`
+
+	// insertKeyStatVersionSQL SQL statement creating a key stats version with the next version number for the area
+	// profile. No action is taken if a version already exists for the profile with the same date created.
+	insertKeyStatVersionSQL = `
+		INSERT INTO key_stat_versions 
+			(version_id, profile_id, version_number, date_created, label, source)
+		SELECT 
+			nextval('key_stat_version_id'), $1, COALESCE(MAX(v.version_number), 0) + 1, $2, $3, $4
+		FROM 
+			key_stat_versions v 
+		WHERE 
+			v.profile_id = $1
+		ON CONFLICT 
+			(profile_id, date_created) 
+		DO NOTHING;
+	`
+
+	// updateKeyStatVersionSQL SQL statement setting the label and source of a key stats version.
+	updateKeyStatVersionSQL = `
+		UPDATE 
+			key_stat_versions 
+		SET 
+			label = $3, source = $4 
+		WHERE 
+			profile_id = $1 AND date_created = $2;
+	`
+
+	// getKeyStatVersionByDateSQL SQL query returns the key stats version of an area profile with the specified date created.
+	getKeyStatVersionByDateSQL = `
+		SELECT 
+			v.version_number, v.date_created, v.label, v.source 
+		FROM 
+			key_stat_versions v 
+		WHERE 
+			v.profile_id = $1 AND v.date_created = $2;
+	`
+
+	// getKeyStatVersionByNumberSQL SQL query returns the key stats version of an area profile with the specified number.
+	getKeyStatVersionByNumberSQL = `
+		SELECT 
+			v.version_number, v.date_created, v.label, v.source 
+		FROM 
+			key_stat_versions v 
+		WHERE 
+			v.profile_id = $1 AND v.version_number = $2;
+	`
+
+	// getLatestKeyStatVersionSQL SQL query returns the most recent key stats version of an area profile.
+	getLatestKeyStatVersionSQL = `
+		SELECT 
+			v.version_number, v.date_created, v.label, v.source 
+		FROM 
+			key_stat_versions v 
+		WHERE 
+			v.profile_id = $1 
+		ORDER BY 
+			v.version_number DESC 
+		LIMIT 1;
+	`
+
+	// listVersionsSQL SQL query returns a list of key stats versions for an area profile.
+	listVersionsSQL = `
+		SELECT 
+			v.version_number, v.date_created, v.label, v.source 
+		FROM 
+			key_stat_versions v 
+		WHERE 
+			v.profile_id = $1 
+		ORDER BY 
+			v.version_number DESC;
+	`
+)
+
+// ParseVersionTimestamp parses the timestamp of a key stats version.
+func ParseVersionTimestamp(value string) (time.Time, error) {
+	for _, layout := range versionTimestampLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid version timestamp %q", value)
+}
+
+// GetKeyStatsVersionsForProfile list all versions of the key stats for this area profile, most recent first.
+func (s *AreaProfileStore) GetKeyStatsVersionsForProfile(ctx context.Context, profile *AreaProfile) ([]KeyStatVersion, error) {
+	conn, err := s.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, listVersionsSQL, profile.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	versions, err := keyStatVersionsRowsMapper(profile, rows)
+	if err != nil {
+		return nil, errors.Wrap(err, "error mapping rows to key stats versions list")
+	}
+
+	return versions, nil
+}
+
+// GetKeyStatsVersionByNumber returns the key stats version of the area profile with the specified version number.
+func (s *AreaProfileStore) GetKeyStatsVersionByNumber(ctx context.Context, profile *AreaProfile, number int) (*KeyStatVersion, error) {
+	return s.getKeyStatsVersion(ctx, profile, getKeyStatVersionByNumberSQL, profile.ID, number)
+}
+
+// GetLatestKeyStatsVersion returns the most recent key stats version of the area profile.
+func (s *AreaProfileStore) GetLatestKeyStatsVersion(ctx context.Context, profile *AreaProfile) (*KeyStatVersion, error) {
+	return s.getKeyStatsVersion(ctx, profile, getLatestKeyStatVersionSQL, profile.ID)
+}
+
+func (s *AreaProfileStore) getKeyStatsVersion(ctx context.Context, profile *AreaProfile, sql string, args ...interface{}) (*KeyStatVersion, error) {
+	conn, err := s.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Release()
+
+	v, err := mapRowToKeyStatVersion(profile, conn.QueryRow(ctx, sql, args...))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, errors.Wrap(err, "error getting key stats version")
+	}
+
+	return v, nil
+}
+
+// CreateKeyStatsVersion creates a new key stats version of the area profile with the specified label and source. If a
+// version with the same date created already exists its label and source are updated.
+func (t *areaProfileTx) CreateKeyStatsVersion(ctx context.Context, areaCode, label, source string, dateCreated time.Time) (*KeyStatVersion, error) {
+	profile, err := getProfileByAreaCode(ctx, t.tx, areaCode)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := ensureKeyStatsVersion(ctx, t.tx, profile, dateCreated); err != nil {
+		return nil, err
+	}
+
+	if _, err := t.tx.Exec(ctx, updateKeyStatVersionSQL, profile.ID, dateCreated, label, source); err != nil {
+		return nil, errors.Wrapf(err, "error updating key stats version for profile_id=%d", profile.ID)
+	}
+
+	return mapRowToKeyStatVersion(profile, t.tx.QueryRow(ctx, getKeyStatVersionByDateSQL, profile.ID, dateCreated))
+}
+
+// ensureKeyStatsVersion returns the key stats version of the profile with the specified date created, creating it with
+// the next version number if it does not already exist.
+func ensureKeyStatsVersion(ctx context.Context, q querier, profile *AreaProfile, dateCreated time.Time) (*KeyStatVersion, error) {
+	if _, err := q.Exec(ctx, lockProfileSQL, profile.ID); err != nil {
+		return nil, errors.Wrapf(err, "error locking profile_id=%d", profile.ID)
+	}
+
+	if _, err := q.Exec(ctx, insertKeyStatVersionSQL, profile.ID, dateCreated, "", ""); err != nil {
+		return nil, errors.Wrapf(err, "error inserting key stats version for profile_id=%d", profile.ID)
+	}
+
+	v, err := mapRowToKeyStatVersion(profile, q.QueryRow(ctx, getKeyStatVersionByDateSQL, profile.ID, dateCreated))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting key stats version for profile_id=%d", profile.ID)
+	}
+
+	return v, nil
+}
@@ -0,0 +1,189 @@
+package store_test
+
+import (
+	"context"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store"
+	"github.com/pkg/errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const (
+	residents = "Resident population"
+	meanAge   = "Average (mean) age"
+)
+
+func TestKeyStatsVersions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s testStore) {
+		ctx := context.Background()
+		a := addProfile(t, s, "E05011362")
+		b := addProfile(t, s, "E05011363")
+
+		// dated well either side of the deletion, which is dated now, whatever the time zone.
+		d1 := time.Now().UTC().Add(-48 * time.Hour).Truncate(time.Second)
+		d2 := d1.Add(time.Minute)
+		d4 := time.Now().UTC().Add(48 * time.Hour).Truncate(time.Second)
+
+		insert := func(areaCode, name string, value float64, date time.Time) {
+			t.Helper()
+			if _, err := s.InsertKeyStat(ctx, areaCode, name, value, "", "TS001", "Census 2021", date); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// key stats with the same date created are one version, versions are numbered per area profile.
+		insert(a.AreaCode, residents, 100, d1)
+		insert(a.AreaCode, meanAge, 40, d1)
+		insert(a.AreaCode, residents, 110, d2)
+		insert(b.AreaCode, residents, 5, d2)
+
+		// deleting the key stats records an empty version, deleting them again records nothing.
+		for i := 0; i < 2; i++ {
+			if err := s.DeleteKeyStats(ctx, a.AreaCode); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		insert(a.AreaCode, residents, 120, d4)
+
+		versions, err := s.GetKeyStatsVersionsForProfile(ctx, a)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		numbers := make([]int, 0, len(versions))
+		for _, v := range versions {
+			numbers = append(numbers, v.Version)
+		}
+
+		if expected := []int{4, 3, 2, 1}; !reflect.DeepEqual(numbers, expected) {
+			t.Fatalf("expected versions %v most recent first, got %v", expected, numbers)
+		}
+
+		if versions[1].Label != store.KeyStatsDeletedLabel {
+			t.Errorf("expected version 3 labelled %q, got %q", store.KeyStatsDeletedLabel, versions[1].Label)
+		}
+
+		expected := []map[string]float64{
+			{residents: 100, meanAge: 40},
+			{residents: 110, meanAge: 40},
+			{},
+			{residents: 120},
+		}
+
+		for i, want := range expected {
+			v, err := s.GetKeyStatsVersionByNumber(ctx, a, i+1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			stats, err := s.GetKeyStatsVersion(ctx, a, v.DateCreated)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := values(stats); !reflect.DeepEqual(got, want) {
+				t.Errorf("version %d: expected key stats %v, got %v", i+1, want, got)
+			}
+		}
+
+		if !versions[3].DateCreated.Equal(d1) || !versions[2].DateCreated.Equal(d2) || !versions[0].DateCreated.Equal(d4) {
+			t.Errorf("expected versions dated %s, %s and %s, got %+v", d1, d2, d4, versions)
+		}
+
+		latest, err := s.GetLatestKeyStatsVersion(ctx, a)
+		if err != nil || latest.Version != 4 {
+			t.Errorf("expected latest version 4, got %+v %v", latest, err)
+		}
+
+		if _, err := s.GetKeyStatsVersionByNumber(ctx, a, 5); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("expected %q for version 5, got %v", store.ErrNotFound, err)
+		}
+
+		current, err := s.GetKeyStatsForProfile(ctx, a)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := values(current); !reflect.DeepEqual(got, expected[3]) {
+			t.Errorf("expected current key stats %v, got %v", expected[3], got)
+		}
+
+		other, err := s.GetKeyStatsVersionsForProfile(ctx, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(other) != 1 || other[0].Version != 1 {
+			t.Errorf("expected a single version 1 of the other profile, got %+v", other)
+		}
+	})
+}
+
+func TestKeyStatHistory(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s testStore) {
+		ctx := context.Background()
+		a := addProfile(t, s, "E05011362")
+
+		d1 := time.Now().UTC().Add(-48 * time.Hour).Truncate(time.Second)
+		d4 := time.Now().UTC().Add(48 * time.Hour).Truncate(time.Second)
+
+		for i, value := range []float64{100, 110} {
+			date := d1.Add(time.Duration(i) * time.Minute)
+			if _, err := s.InsertKeyStat(ctx, a.AreaCode, residents, value, "", "TS001", "Census 2021", date); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.InsertKeyStat(ctx, a.AreaCode, meanAge, 40, "", "TS001", "Census 2021", date); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := s.DeleteKeyStats(ctx, a.AreaCode); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := s.InsertKeyStat(ctx, a.AreaCode, residents, 99, "", "TS001", "Census 2021", d4); err != nil {
+			t.Fatal(err)
+		}
+
+		statType, err := s.GetStatTypeByName(ctx, residents)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		history, err := s.GetKeyStatHistory(ctx, a, statType)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if history.Name != residents || history.AreaCode != a.AreaCode {
+			t.Errorf("expected the history of %q for %q, got %+v", residents, a.AreaCode, history)
+		}
+
+		// the deletion is not an entry of the history, the entries keep the number of the version they were added in.
+		type entry struct {
+			version int
+			value   float64
+			change  float64
+		}
+
+		got := make([]entry, 0, len(history.History))
+		for _, h := range history.History {
+			e := entry{version: h.Version, value: h.Value}
+			if h.AbsoluteChange != nil {
+				e.change = *h.AbsoluteChange
+			}
+			got = append(got, e)
+		}
+
+		expected := []entry{{1, 100, 0}, {2, 110, 10}, {4, 99, -11}}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("expected history %+v, got %+v", expected, got)
+		}
+
+		if _, err := s.GetKeyStatHistory(ctx, a, statType+1); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("expected %q for a key stat type without history, got %v", store.ErrNotFound, err)
+		}
+	})
+}
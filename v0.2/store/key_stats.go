@@ -2,90 +2,128 @@ package store
 
 import (
 	"context"
+	"github.com/jackc/pgx/v4"
 	"github.com/pkg/errors"
 	"time"
 )
 
-var (
-	// createKeyStatsTableSQL SQL statement to create the area profiles key statistics table.
-	createKeyStatsTableSQL = `
-		CREATE TABLE IF NOT EXISTS key_stats (
-			stat_id INT PRIMARY KEY NOT NULL, 
-			profile_id INT NOT NULL,
-			stat_type INT NOT NULL, 
-			value VARCHAR(100) NOT NULL, 
-			unit VARCHAR(25) NOT NULL, 
-			date_created TIMESTAMP NOT NULL, 
-			dataset_id VARCHAR(100) NOT NULL, 
-			dataset_name VARCHAR(100) NOT NULL, 
-			UNIQUE (profile_id, stat_type), 
-			CONSTRAINT fk_profile_id 
-				FOREIGN KEY (profile_id) REFERENCES area_profiles (profile_id),
-			CONSTRAINT fk_stat_type 
-				FOREIGN KEY (stat_type) REFERENCES key_stat_types (type_id) 
-		);
-	`
-
-	//createAreaProfileIDSeqSQL is a SQL statement creating a sequence for generating area profile ids.
-	createKeyStatsIDSeqSQL = `
-		CREATE SEQUENCE 
-			key_stat_id 
-		START 
-			1000 
-		INCREMENT 
-			100 
-		MINVALUE 
-			1000 
-		OWNED BY 
-			key_stats.stat_id;
-	`
+// KeyStatsDeletedLabel is the label of the key stats version recording the deletion of an area profile's key stats.
+const KeyStatsDeletedLabel = "key stats deleted"
 
+var (
 	// insertNewKeyStatSQL is an SQL query to insert a new key stat.
 	insertNewKeyStatSQL = `
 		INSERT INTO key_stats 
-			(stat_id, profile_id, stat_type, value, unit, date_created, dataset_id, dataset_name) 
+			(stat_id, profile_id, stat_type, value, unit, date_created, dataset_id) 
 		VALUES 
-			(nextval('key_stat_id'), $1, $2, $3, $4, $5, $6, $7) 
+			(nextval('key_stat_id'), $1, $2, $3, $4, $5, $6) 
 		ON CONFLICT ON CONSTRAINT 
 			key_stats_profile_id_stat_type_key 
-		DO UPDATE SET value = $3 RETURNING stat_id;
+		DO UPDATE SET value = $3, unit = $4, date_created = $5, dataset_id = $6 RETURNING stat_id;
 	`
 
 	// getStatsByProfileIDSQL SQL query returns current version of the key statistics for the specified area profile.
 	getStatsByProfileIDSQL = `
 		SELECT 
-			s.profile_id, s.stat_id, s.stat_type, t.name, s.value, s.unit, s.date_created, s.dataset_id, s.dataset_name 
+			s.profile_id, s.stat_id, s.stat_type, t.name, s.value, t.value_type, t.value_precision, s.unit, 
+			COALESCE(u.symbol, ''), s.date_created, s.dataset_id, d.name 
 		FROM 
 			key_stats s
 		INNER JOIN
 			key_stat_types t
 		ON
 			t.type_id = s.stat_type
+		INNER JOIN
+			datasets d
+		ON
+			d.id = s.dataset_id
+		LEFT JOIN
+			units u
+		ON
+			u.code = s.unit
 		WHERE 
 			s.profile_id = $1;
 	`
+
+	// recordKeyStatsDeletedSQL SQL statement inserting a deleted key stats history entry, dated $2, for each current key
+	// stat of the area profile. Key stats versions at or after $2 do not include the deleted key stats.
+	recordKeyStatsDeletedSQL = `
+		INSERT INTO key_stats_history
+			(stat_id, profile_id, stat_type, value, unit, date_created, last_modified, dataset_id, deleted)
+		SELECT
+			nextval('key_stat_history_id'), profile_id, stat_type, value, unit, $2, $2, dataset_id, true
+		FROM
+			key_stats
+		WHERE
+			profile_id = $1;
+	`
+
+	// deleteKeyStatsSQL SQL statement deleting the current key stats of a profile.
+	deleteKeyStatsSQL = "DELETE FROM key_stats WHERE profile_id = $1;"
 )
 
-// NewKeyStat insert a key statistic for the specified area profile.
-func (s *AreaProfileStore) InsertKeyStat(areaCode, name, value, unit, datasetID, datasetName string, dateCreated time.Time) (int, error) {
-	profile, err := s.GetProfileByAreaCode(areaCode)
+// InsertKeyStat insert a key statistic for the specified area profile. The current key stat and its history entry are
+// written in a single transaction. A blank unit defaults to the default unit of the key stat type. Returns
+// ErrInvalidValue if the value is not valid for the value type of the key stat type and ErrStatTypeNotActive if the key
+// stat type is deprecated or replaced.
+func (s *AreaProfileStore) InsertKeyStat(ctx context.Context, areaCode, name string, value float64, unit, datasetID, datasetName string, dateCreated time.Time) (int, error) {
+	var keyStatID int
+
+	err := s.InTransaction(ctx, func(tx Tx) error {
+		var err error
+		keyStatID, err = tx.InsertKeyStat(ctx, areaCode, name, value, unit, datasetID, datasetName, dateCreated)
+		return err
+	})
+
+	return keyStatID, err
+}
+
+// insertKeyStat upserts the current key stat and inserts a key stat history entry for the specified area profile. The
+// dataset must already exist.
+func insertKeyStat(ctx context.Context, q querier, areaCode, name string, value float64, unit, datasetID string, dateCreated time.Time) (int, error) {
+	profile, err := getProfileByAreaCode(ctx, q, areaCode)
 	if err != nil {
 		return 0, err
 	}
 
-	statType, err := s.GetStatTypeByName(name)
+	var statType int
+	var valueType, defaultUnit, status, replacement string
+
+	err = q.QueryRow(ctx, getStatTypeValueRulesSQL, name).Scan(&statType, &valueType, &defaultUnit, &status, &replacement)
 	if err != nil {
+		if err == pgx.ErrNoRows {
+			return 0, errors.Wrapf(ErrMissingReference, "stat type %q does not exist", name)
+		}
+		return 0, errors.Wrapf(err, "error getting stat type for name %q", name)
+	}
+
+	if err := (KeyStatType{Name: name, Status: status}).CheckActive(replacement); err != nil {
+		return 0, err
+	}
+
+	if err := ValidateValue(valueType, value); err != nil {
+		return 0, errors.Wrapf(err, "invalid value for stat type %q", name)
+	}
+
+	if unit == "" {
+		unit = defaultUnit
+	}
+
+	if _, err := ensureKeyStatsVersion(ctx, q, profile, dateCreated); err != nil {
 		return 0, err
 	}
 
 	var keyStatID int
 
-	err = s.conn.QueryRow(context.Background(), insertNewKeyStatSQL, profile.ID, statType, value, unit, dateCreated, datasetID, datasetName).Scan(&keyStatID)
+	err = q.QueryRow(ctx, insertNewKeyStatSQL, profile.ID, statType, value, unit, dateCreated, datasetID).Scan(&keyStatID)
 	if err != nil {
+		if isPgError(err, pgForeignKeyViolation) {
+			return 0, errors.Wrapf(ErrMissingReference, "unit %q does not exist", unit)
+		}
 		return 0, errors.Wrapf(err, "error inserting new key stat %q for profile_id=%d", name, profile.ID)
 	}
 
-	_, err = s.conn.Exec(context.Background(), insertNewKeyStatHistorySQL, profile.ID, statType, value, unit, dateCreated, dateCreated, datasetID, datasetName)
+	_, err = q.Exec(ctx, insertNewKeyStatHistorySQL, profile.ID, statType, value, unit, dateCreated, dateCreated, datasetID)
 	if err != nil {
 		return 0, errors.Wrapf(err, "error inserting key stat history %q for profile_id=%d", name, profile.ID)
 	}
@@ -94,8 +132,20 @@ func (s *AreaProfileStore) InsertKeyStat(areaCode, name, value, unit, datasetID,
 }
 
 // GetKeyStatsForProfile returns a list of the current Key stats associated with the specified area profile.
-func (s *AreaProfileStore) GetKeyStatsForProfile(profile *AreaProfile) (KeyStatistics, error) {
-	rows, err := s.conn.Query(context.Background(), getStatsByProfileIDSQL, profile.ID)
+func (s *AreaProfileStore) GetKeyStatsForProfile(ctx context.Context, profile *AreaProfile) (KeyStatistics, error) {
+	conn, err := s.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Release()
+
+	return getKeyStatsForProfile(ctx, conn, profile)
+}
+
+// getKeyStatsForProfile returns the current key stats of the area profile.
+func getKeyStatsForProfile(ctx context.Context, q querier, profile *AreaProfile) (KeyStatistics, error) {
+	rows, err := q.Query(ctx, getStatsByProfileIDSQL, profile.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -107,3 +157,41 @@ func (s *AreaProfileStore) GetKeyStatsForProfile(profile *AreaProfile) (KeyStati
 
 	return stats, nil
 }
+
+// DeleteKeyStats deletes the current key stats of the area profile for the specified area code. The deletion is
+// recorded in the key stats history as a new, empty, key stats version so earlier versions are kept. Nothing is
+// recorded if the profile has no key stats.
+func (s *AreaProfileStore) DeleteKeyStats(ctx context.Context, areaCode string) error {
+	return s.InTransaction(ctx, func(tx Tx) error {
+		return tx.DeleteKeyStats(ctx, areaCode)
+	})
+}
+
+// DeleteKeyStats deletes the current key stats of the area profile for the specified area code, recording the
+// deletion as a new, empty, key stats version. Nothing is recorded if the profile has no key stats.
+func (t *areaProfileTx) DeleteKeyStats(ctx context.Context, areaCode string) error {
+	profile, err := getProfileByAreaCode(ctx, t.tx, areaCode)
+	if err != nil {
+		return err
+	}
+
+	created := time.Now()
+	tag, err := t.tx.Exec(ctx, recordKeyStatsDeletedSQL, profile.ID, created)
+	if err != nil {
+		return errors.Wrapf(err, "error recording deleted key stats for profile_id=%d", profile.ID)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return nil
+	}
+
+	if _, err := t.CreateKeyStatsVersion(ctx, areaCode, KeyStatsDeletedLabel, "", created); err != nil {
+		return err
+	}
+
+	if _, err := t.tx.Exec(ctx, deleteKeyStatsSQL, profile.ID); err != nil {
+		return errors.Wrapf(err, "error deleting key stats for profile_id=%d", profile.ID)
+	}
+
+	return nil
+}
@@ -2,113 +2,160 @@ package store
 
 import (
 	"context"
+	"fmt"
 	"github.com/pkg/errors"
 	"time"
 )
 
 // Key stats history queries/statments.
 var (
-	// createKeyStatsHistoryTableSQL SQL statement to create the key stats version table.
-	createKeyStatsHistoryTableSQL = `
-		CREATE TABLE IF NOT EXISTS key_stats_history (
-			stat_id INT PRIMARY KEY NOT NULL, 
-			profile_id INT NOT NULL, 
-			stat_type INT NOT NULL,  
-			value VARCHAR(100) NOT NULL, 
-			unit VARCHAR(25) NOT NULL, 
-			date_created TIMESTAMP NOT NULL, 
-			last_modified TIMESTAMP NOT NULL, 
-			dataset_id VARCHAR(100) NOT NULL, 
-			dataset_name VARCHAR(100) NOT NULL, 
-			UNIQUE (profile_id, last_modified, stat_type), 
-			CONSTRAINT fk_profile_id 
-				FOREIGN KEY (profile_id) REFERENCES area_profiles (profile_id),
-			CONSTRAINT fk_stat_type 
-				FOREIGN KEY (stat_type) REFERENCES key_stat_types (type_id)
-		);
-	`
-	//createKeyStatsHistoryIDSeqSQL is a SQL statement creating a sequence for generating area profile ids.
-	createKeyStatsHistoryIDSeqSQL = `
-		CREATE SEQUENCE 
-			key_stat_history_id 
-		START 
-			1000 
-		INCREMENT 
-			100 
-		MINVALUE 
-			1000 
-		OWNED BY
-			key_stats_history.stat_id;
-	`
-
 	// insertNewKeyStatHistorySQL is an SQL query to insert a new key stat version.
 	insertNewKeyStatHistorySQL = `
 		INSERT INTO key_stats_history 
-			(stat_id, profile_id, stat_type, value, unit, date_created, last_modified, dataset_id, dataset_name) 
+			(stat_id, profile_id, stat_type, value, unit, date_created, last_modified, dataset_id) 
 		VALUES 
-			(nextval('key_stat_history_id'), $1, $2, $3, $4, $5, $6, $7, $8) 
+			(nextval('key_stat_history_id'), $1, $2, $3, $4, $5, $6, $7) 
 		RETURNING stat_id;`
 
-	// listVersionsSQL SQL query returns a list of key stats versions for an area profile.
-	listVersionsSQL = `
-		SELECT DISTINCT 
-			s.date_created 
-		FROM 
-			key_stats_history s 
-		WHERE 
-			s.profile_id = $1 
-		ORDER BY 
-			s.date_created DESC
+	// getKeyStatsVersionSQL SQL query returning key stats for the specified area profile ID and version. Key stats
+	// deleted at or before the version are excluded.
+	getKeyStatsVersionSQL = `
+		SELECT 
+			v.profile_id, v.stat_id, v.stat_type, v.name, v.value, v.value_type, v.value_precision, v.unit, v.symbol, 
+			v.date_created, v.dataset_id, v.dataset_name
+		FROM (
+			SELECT DISTINCT ON 
+				(s.stat_type) s.profile_id, s.stat_id, s.stat_type, t.name, s.value, t.value_type, t.value_precision, s.unit, 
+				COALESCE(u.symbol, '') AS symbol, s.date_created, s.dataset_id, d.name AS dataset_name, s.deleted
+			FROM 
+				key_stats_history s 
+			INNER JOIN
+				key_stat_types t
+			ON
+				t.type_id = s.stat_type
+			INNER JOIN
+				datasets d
+			ON
+				d.id = s.dataset_id
+			LEFT JOIN
+				units u
+			ON
+				u.code = s.unit
+			WHERE 
+				s.profile_id = $1 AND s.date_created <= $2
+			ORDER BY 
+				s.stat_type, s.date_created 
+			DESC
+		) v
+		WHERE
+			NOT v.deleted
+		ORDER BY
+			v.stat_type;
 	`
 
-	// getKeyStatsVersionSQL SQL query returning key stats for the specified area profile ID and version.
-	getKeyStatsVersionSQL = `
-		SELECT DISTINCT ON 
-			(s.stat_type) s.profile_id, s.stat_id, s.stat_type, t.name, s.value, s.unit, s.date_created, s.dataset_id, s.dataset_name
+	// getKeyStatHistorySQL SQL query returning every historical value of a key stat type for the specified area profile ID,
+	// excluding deletions.
+	getKeyStatHistorySQL = `
+		SELECT 
+			t.name, COALESCE(v.version_number, 0), s.value, t.value_precision, s.unit, COALESCE(u.symbol, ''), 
+			s.date_created, s.dataset_id, d.name
 		FROM 
 			key_stats_history s 
 		INNER JOIN
 			key_stat_types t
 		ON
 			t.type_id = s.stat_type
+		INNER JOIN
+			datasets d
+		ON
+			d.id = s.dataset_id
+		LEFT JOIN
+			units u
+		ON
+			u.code = s.unit
+		LEFT JOIN
+			key_stat_versions v
+		ON
+			v.profile_id = s.profile_id AND v.date_created = s.date_created
 		WHERE 
-			s.profile_id = $1 AND s.date_created <= $2
+			s.profile_id = $1 AND s.stat_type = $2 AND NOT s.deleted
 		ORDER BY 
-			s.stat_type, s.date_created 
-		DESC;
+			s.date_created;
 	`
 )
 
-// GetKeyStatsVersionsForProfile list all versions of the key stats for this area profile
-func (s *AreaProfileStore) GetKeyStatsVersionsForProfile(profile *AreaProfile) ([]time.Time, error) {
-	rows, err := s.conn.Query(context.Background(), listVersionsSQL, profile.ID)
+// GetKeyStatsVersion returns a list of key stats belonging to the specified version of the area profile.
+// The result is the latest value of each key stat type created at or before the version timestamp, unless the latest
+// entry records the key stat being deleted.
+func (s *AreaProfileStore) GetKeyStatsVersion(ctx context.Context, profile *AreaProfile, date time.Time) (KeyStatistics, error) {
+	conn, err := s.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, getKeyStatsVersionSQL, profile.ID, date)
 	if err != nil {
 		return nil, err
 	}
 
 	defer rows.Close()
 
-	versions, err := versionsRowsMapper(rows)
+	stats, err := keyStatisticsRowsMapper(profile, rows)
 	if err != nil {
-		return nil, errors.Wrap(err, "error mapping rows to key stats versions list")
+		return nil, errors.Wrap(err, "error mapping stats version result rows")
 	}
 
-	return versions, nil
+	return stats, nil
 }
 
-// GetKeyStatsVersion returns a list of key stats belonging to the specified version of the area profile.
-func (s *AreaProfileStore) GetKeyStatsVersion(profile *AreaProfile, date string) (KeyStatistics, error) {
-	rows, err := s.conn.Query(context.Background(), getKeyStatsVersionSQL, profile.ID, date)
+// GetKeyStatHistory returns each historical value of the key stat type for the area profile, oldest first, with the
+// change from the previous value. Returns ErrNotFound if the profile has no values for the stat type.
+func (s *AreaProfileStore) GetKeyStatHistory(ctx context.Context, profile *AreaProfile, statType int) (*KeyStatHistory, error) {
+	conn, err := s.acquire(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	defer rows.Close()
+	defer conn.Release()
 
-	stats, err := keyStatisticsRowsMapper(profile, rows)
+	rows, err := conn.Query(ctx, getKeyStatHistorySQL, profile.ID, statType)
 	if err != nil {
-		return nil, errors.Wrap(err, "error mapping stats version result rows")
+		return nil, err
 	}
 
-	return stats, nil
+	defer rows.Close()
+
+	history := &KeyStatHistory{
+		AreaCode: profile.AreaCode,
+		StatType: statType,
+		History:  make([]KeyStatHistoryEntry, 0),
+	}
+
+	for rows.Next() {
+		var e KeyStatHistoryEntry
+		var precision int
+		var symbol string
+
+		if err := rows.Scan(&history.Name, &e.Version, &e.Value, &precision, &e.Unit, &symbol, &e.DateCreated, &e.Metadata.DatasetID, &e.Metadata.DatasetName); err != nil {
+			return nil, errors.Wrap(err, "error scanning key stat history row")
+		}
+
+		e.Display = FormatValue(e.Value, precision, symbol)
+
+		e.Metadata.Href = fmt.Sprintf("http://localhost:8080/datasets/%s", e.Metadata.DatasetID)
+		history.History = append(history.History, e)
+	}
+
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	if len(history.History) == 0 {
+		return nil, ErrNotFound
+	}
+
+	history.SetPeriodChanges()
+	return history, nil
 }
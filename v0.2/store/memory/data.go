@@ -0,0 +1,1259 @@
+package memory
+
+import (
+	"fmt"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store"
+	"github.com/pkg/errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Sequence settings matching the postgres ID sequences - start at 1000 and increment by 100.
+const (
+	seqStart     = 1000
+	seqIncrement = 100
+)
+
+// sequence generates IDs in the same way as the postgres sequences.
+type sequence int
+
+func (s *sequence) next() int {
+	if *s == 0 {
+		*s = seqStart
+	} else {
+		*s += seqIncrement
+	}
+	return int(*s)
+}
+
+type area struct {
+	Code string
+	Name string
+	// GeographyType is the geography type code, empty if the area has no geography type.
+	GeographyType string
+	ParentCode    string
+}
+
+// geographyTypes mirrors the geography types the postgres database is seeded with.
+var geographyTypes = []store.GeographyType{
+	{ID: 1000, Code: "OA", Name: "output area"},
+	{ID: 1100, Code: "LSOA", Name: "lower layer super output area"},
+	{ID: 1200, Code: "MSOA", Name: "middle layer super output area"},
+	{ID: 1300, Code: "LAD", Name: "local authority district"},
+}
+
+// defaultStatTypes mirrors the key stat types the postgres database is seeded with.
+var defaultStatTypes = []store.KeyStatType{
+	{Name: "Resident population", Description: "The number of usual residents of the area", Category: "Population", DisplayOrder: 1, ValueType: store.ValueTypeCount},
+	{Name: "Population density (Hectares)", Description: "The number of usual residents per hectare", Category: "Population", DefaultUnit: "per hectare", DisplayOrder: 2, ValueType: store.ValueTypeRate, Precision: 1},
+	{Name: "Average (mean) age", Description: "The mean age of usual residents", Category: "Population", DefaultUnit: "years", DisplayOrder: 3, ValueType: store.ValueTypeMean, Precision: 1},
+	{Name: "People think their general health is good", Description: "The percentage of usual residents reporting good or very good general health", Category: "Health", DefaultUnit: "%", DisplayOrder: 4, ValueType: store.ValueTypePercentage, Precision: 1},
+	{Name: "Households where English is not the main language", Description: "The percentage of households where no adult has English as a main language", Category: "Language", DefaultUnit: "%", DisplayOrder: 5, ValueType: store.ValueTypePercentage, Precision: 1},
+	{Name: "Households owned with a mortgage, loan or shared ownership", Description: "The percentage of households owned with a mortgage, loan or shared ownership", Category: "Housing", DefaultUnit: "%", DisplayOrder: 6, ValueType: store.ValueTypePercentage, Precision: 1},
+}
+
+// units mirrors the units the postgres database is seeded with.
+var units = []store.Unit{
+	{Code: "", Name: "No unit", Symbol: ""},
+	{Code: "%", Name: "Percent", Symbol: "%"},
+	{Code: "households", Name: "Households", Symbol: "households"},
+	{Code: "people", Name: "People", Symbol: "people"},
+	{Code: "per hectare", Name: "People per hectare", Symbol: "per hectare"},
+	{Code: "years", Name: "Years", Symbol: "years"},
+}
+
+// getUnit returns the unit with the specified code.
+func getUnit(code string) (store.Unit, bool) {
+	for _, u := range units {
+		if u.Code == code {
+			return u, true
+		}
+	}
+	return store.Unit{}, false
+}
+
+// historyEntry is an entry in the key stats history - the equivalent of a key_stats_history row.
+type historyEntry struct {
+	StatID      int
+	ProfileID   int
+	StatType    int
+	Value       float64
+	Unit        string
+	DateCreated time.Time
+	DatasetID   string
+	// Deleted is true if the entry records the key stat being deleted.
+	Deleted bool
+}
+
+// recipe is a key stats recipe - the equivalent of a key_stats_recipes row and its recipe_geographies rows.
+type recipe struct {
+	ID              int
+	DatasetID       string
+	DatasetEdition  string
+	CantabularQuery string
+	StatType        int
+	// Geographies holds the IDs of the geography types the recipe applies to.
+	Geographies []int
+}
+
+// data holds the in-memory store state.
+type data struct {
+	areas     map[string]area
+	profiles  map[string]store.AreaProfile
+	statTypes map[string]store.KeyStatType
+	// keyStats holds the current key stats, profile ID -> stat type ID -> key stat.
+	keyStats map[int]map[int]store.KeyStatistic
+	history  []historyEntry
+	// versions holds the key stat versions of each profile in version number order, profile ID -> versions.
+	versions map[int][]store.KeyStatVersion
+	recipes  map[int]recipe
+	datasets map[string]store.Dataset
+	// imports holds the imports ledger in ID order.
+	imports []store.Import
+
+	profileSeq  sequence
+	statTypeSeq sequence
+	keyStatSeq  sequence
+	historySeq  sequence
+	recipeSeq   sequence
+	importSeq   sequence
+}
+
+func newData() *data {
+	d := &data{
+		areas:     make(map[string]area),
+		profiles:  make(map[string]store.AreaProfile),
+		statTypes: make(map[string]store.KeyStatType),
+		keyStats:  make(map[int]map[int]store.KeyStatistic),
+		history:   make([]historyEntry, 0),
+		versions:  make(map[int][]store.KeyStatVersion),
+		recipes:   make(map[int]recipe),
+		datasets:  make(map[string]store.Dataset),
+		imports:   make([]store.Import, 0),
+	}
+
+	for _, t := range defaultStatTypes {
+		d.addStatType(t)
+	}
+
+	return d
+}
+
+// copy returns a deep copy of the data.
+func (d *data) copy() *data {
+	c := &data{
+		areas:       make(map[string]area, len(d.areas)),
+		profiles:    make(map[string]store.AreaProfile, len(d.profiles)),
+		statTypes:   make(map[string]store.KeyStatType, len(d.statTypes)),
+		keyStats:    make(map[int]map[int]store.KeyStatistic, len(d.keyStats)),
+		history:     make([]historyEntry, len(d.history)),
+		versions:    make(map[int][]store.KeyStatVersion, len(d.versions)),
+		recipes:     make(map[int]recipe, len(d.recipes)),
+		datasets:    make(map[string]store.Dataset, len(d.datasets)),
+		imports:     append(make([]store.Import, 0, len(d.imports)), d.imports...),
+		profileSeq:  d.profileSeq,
+		statTypeSeq: d.statTypeSeq,
+		keyStatSeq:  d.keyStatSeq,
+		historySeq:  d.historySeq,
+		recipeSeq:   d.recipeSeq,
+		importSeq:   d.importSeq,
+	}
+
+	for k, v := range d.areas {
+		c.areas[k] = v
+	}
+
+	for k, v := range d.profiles {
+		c.profiles[k] = v
+	}
+
+	for k, v := range d.statTypes {
+		c.statTypes[k] = v
+	}
+
+	for profileID, stats := range d.keyStats {
+		c.keyStats[profileID] = make(map[int]store.KeyStatistic, len(stats))
+		for statType, stat := range stats {
+			c.keyStats[profileID][statType] = stat
+		}
+	}
+
+	copy(c.history, d.history)
+
+	for profileID, versions := range d.versions {
+		c.versions[profileID] = append([]store.KeyStatVersion(nil), versions...)
+	}
+
+	for id, r := range d.recipes {
+		r.Geographies = append([]int(nil), r.Geographies...)
+		c.recipes[id] = r
+	}
+
+	for id, ds := range d.datasets {
+		ds.Editions = append(make([]string, 0, len(ds.Editions)), ds.Editions...)
+		if ds.ReleaseDate != nil {
+			releaseDate := *ds.ReleaseDate
+			ds.ReleaseDate = &releaseDate
+		}
+		c.datasets[id] = ds
+	}
+
+	return c
+}
+
+func (d *data) addArea(code, name string) (string, error) {
+	if _, ok := d.areas[code]; ok {
+		return "", errors.Wrapf(store.ErrConflict, "area with code %q already exists", code)
+	}
+
+	d.areas[code] = area{Code: code, Name: name}
+	return code, nil
+}
+
+func (d *data) addAreaProfile(areaCode, name string) (int, error) {
+	if _, ok := d.areas[areaCode]; !ok {
+		return 0, errors.Wrapf(store.ErrMissingReference, "area %q does not exist", areaCode)
+	}
+
+	if _, ok := d.profiles[areaCode]; ok {
+		return 0, errors.Wrapf(store.ErrConflict, "area profile for area code %q already exists", areaCode)
+	}
+
+	profile := store.AreaProfile{
+		ID:       d.profileSeq.next(),
+		Name:     name,
+		AreaCode: areaCode,
+	}
+
+	d.profiles[areaCode] = profile
+	return profile.ID, nil
+}
+
+// copyAreaProfiles creates the area, if it does not exist, and the area profile of each area without one. A new area
+// without a name is named by its code and a profile without a name by the name of its area.
+func (d *data) copyAreaProfiles(profiles []store.NewAreaProfile) (*store.ProvisionResult, error) {
+	result := &store.ProvisionResult{}
+
+	for _, p := range profiles {
+		if _, ok := d.areas[p.AreaCode]; !ok {
+			name := p.AreaName
+			if name == "" {
+				name = p.AreaCode
+			}
+
+			d.areas[p.AreaCode] = area{Code: p.AreaCode, Name: name}
+			result.AreasCreated++
+		}
+
+		if _, ok := d.profiles[p.AreaCode]; ok {
+			continue
+		}
+
+		name := p.Name
+		if name == "" {
+			name = d.areas[p.AreaCode].Name
+		}
+
+		if _, err := d.addAreaProfile(p.AreaCode, name); err != nil {
+			return nil, err
+		}
+		result.ProfilesCreated++
+	}
+
+	return result, nil
+}
+
+func (d *data) getArea(code string) (*store.Area, error) {
+	a, ok := d.areas[code]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+
+	result := d.toArea(a)
+	return &result, nil
+}
+
+// toArea maps the area to its domain representation.
+func (d *data) toArea(a area) store.Area {
+	result := store.Area{
+		Code:       a.Code,
+		Name:       a.Name,
+		ParentCode: a.ParentCode,
+	}
+
+	if g, err := getGeographyType(a.GeographyType); err == nil {
+		result.GeographyType = g
+	}
+
+	_, hasProfile := d.profiles[a.Code]
+	result.SetLinks(hasProfile)
+	return result
+}
+
+func (d *data) getAreaChildren(code string) ([]store.Area, error) {
+	if _, ok := d.areas[code]; !ok {
+		return nil, store.ErrNotFound
+	}
+
+	children := make([]store.Area, 0)
+	for _, a := range d.areas {
+		if a.ParentCode == code {
+			children = append(children, d.toArea(a))
+		}
+	}
+
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].Code < children[j].Code
+	})
+
+	return children, nil
+}
+
+func (d *data) getAreaAncestors(code string) ([]store.Area, error) {
+	a, ok := d.areas[code]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+
+	ancestors := make([]store.Area, 0)
+	seen := map[string]bool{code: true}
+
+	for a.ParentCode != "" && !seen[a.ParentCode] {
+		seen[a.ParentCode] = true
+		if a, ok = d.areas[a.ParentCode]; !ok {
+			break
+		}
+		ancestors = append(ancestors, d.toArea(a))
+	}
+
+	return ancestors, nil
+}
+
+func (d *data) upsertArea(code, name, geographyType, parentCode string) error {
+	if geographyType != "" {
+		if _, err := getGeographyType(geographyType); err != nil {
+			return err
+		}
+	}
+
+	if parentCode == code {
+		return errors.Wrapf(store.ErrConflict, "area %q cannot be its own parent", code)
+	}
+
+	if _, ok := d.areas[parentCode]; parentCode != "" && !ok {
+		return errors.Wrapf(store.ErrMissingReference, "parent area %q does not exist", parentCode)
+	}
+
+	if name == "" {
+		name = code
+		if existing, ok := d.areas[code]; ok {
+			name = existing.Name
+		}
+	}
+
+	d.areas[code] = area{Code: code, Name: name, GeographyType: geographyType, ParentCode: parentCode}
+	return nil
+}
+
+// getGeographyType returns the geography type with the specified code or name.
+func getGeographyType(codeOrName string) (*store.GeographyType, error) {
+	for _, g := range geographyTypes {
+		if g.Code == codeOrName || g.Name == codeOrName {
+			return &g, nil
+		}
+	}
+	return nil, errors.Wrapf(store.ErrMissingReference, "geography type %q does not exist", codeOrName)
+}
+
+func (d *data) updateArea(code, name string) error {
+	a, ok := d.areas[code]
+	if !ok {
+		return store.ErrNotFound
+	}
+
+	a.Name = name
+	d.areas[code] = a
+	return nil
+}
+
+func (d *data) deleteArea(code string) error {
+	if _, ok := d.areas[code]; !ok {
+		return store.ErrNotFound
+	}
+
+	if _, ok := d.profiles[code]; ok {
+		return errors.Wrapf(store.ErrConflict, "area %q is referenced by other records", code)
+	}
+
+	for _, a := range d.areas {
+		if a.ParentCode == code {
+			return errors.Wrapf(store.ErrConflict, "area %q is referenced by other records", code)
+		}
+	}
+
+	delete(d.areas, code)
+	return nil
+}
+
+func (d *data) updateAreaProfile(areaCode, name string) error {
+	p, ok := d.profiles[areaCode]
+	if !ok {
+		return store.ErrNotFound
+	}
+
+	p.Name = name
+	d.profiles[areaCode] = p
+	return nil
+}
+
+func (d *data) deleteAreaProfile(areaCode string) error {
+	p, ok := d.profiles[areaCode]
+	if !ok {
+		return store.ErrNotFound
+	}
+
+	if len(d.keyStats[p.ID]) > 0 || len(d.versions[p.ID]) > 0 {
+		return errors.Wrapf(store.ErrConflict, "area profile %q has key stats or key stats versions", areaCode)
+	}
+
+	delete(d.profiles, areaCode)
+	return nil
+}
+
+func (d *data) getAreaProfiles() []store.AreaProfile {
+	profiles := make([]store.AreaProfile, 0, len(d.profiles))
+	for _, p := range d.profiles {
+		p.Href = fmt.Sprintf("http://localhost:8080/profiles/%s", p.AreaCode)
+		profiles = append(profiles, p)
+	}
+
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].ID < profiles[j].ID
+	})
+
+	return profiles
+}
+
+func (d *data) getProfileByAreaCode(areaCode string) (*store.AreaProfile, error) {
+	p, ok := d.profiles[areaCode]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+
+	p.Href = fmt.Sprintf("http://localhost:8080/profiles/%s/stats", p.AreaCode)
+	return &p, nil
+}
+
+func (d *data) getProfilesByAreaCodes(areaCodes []string) map[string]*store.AreaProfile {
+	profiles := make(map[string]*store.AreaProfile)
+	for _, code := range areaCodes {
+		if p, err := d.getProfileByAreaCode(code); err == nil {
+			profiles[code] = p
+		}
+	}
+	return profiles
+}
+
+func (d *data) getStatTypes(status string) []store.KeyStatType {
+	types := make([]store.KeyStatType, 0, len(d.statTypes))
+	for _, t := range d.statTypes {
+		if status == "" || t.Status == status {
+			types = append(types, d.toStatType(t))
+		}
+	}
+
+	sort.Slice(types, func(i, j int) bool {
+		if types[i].DisplayOrder != types[j].DisplayOrder {
+			return types[i].DisplayOrder < types[j].DisplayOrder
+		}
+		return types[i].ID < types[j].ID
+	})
+
+	return types
+}
+
+func (d *data) getStatTypeByID(id int) (*store.KeyStatType, error) {
+	for _, t := range d.statTypes {
+		if t.ID == id {
+			result := d.toStatType(t)
+			return &result, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+// toStatType returns a copy of the key stat type with its href set.
+func (d *data) toStatType(t store.KeyStatType) store.KeyStatType {
+	if t.ReplacedBy != nil {
+		replacedBy := *t.ReplacedBy
+		t.ReplacedBy = &replacedBy
+	}
+
+	t.SetHref()
+	return t
+}
+
+func (d *data) addStatType(t store.KeyStatType) (int, error) {
+	if t.Status == "" {
+		t.Status = store.StatTypeActive
+	}
+
+	if t.ValueType == "" {
+		t.ValueType = store.ValueTypeCount
+	}
+
+	if err := d.checkStatType(t); err != nil {
+		return 0, err
+	}
+
+	if t.DisplayOrder == 0 {
+		for _, existing := range d.statTypes {
+			if existing.DisplayOrder > t.DisplayOrder {
+				t.DisplayOrder = existing.DisplayOrder
+			}
+		}
+		t.DisplayOrder++
+	}
+
+	t.ID = d.statTypeSeq.next()
+	t.Href = ""
+	d.statTypes[t.Name] = t
+	return t.ID, nil
+}
+
+func (d *data) updateStatType(t store.KeyStatType) error {
+	existing, err := d.getStatTypeByID(t.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := d.checkStatType(t); err != nil {
+		return err
+	}
+
+	t.Href = ""
+	delete(d.statTypes, existing.Name)
+	d.statTypes[t.Name] = t
+	return nil
+}
+
+// checkStatType mirrors the postgres key_stat_types constraints.
+func (d *data) checkStatType(t store.KeyStatType) error {
+	if existing, ok := d.statTypes[t.Name]; ok && existing.ID != t.ID {
+		return errors.Wrapf(store.ErrConflict, "stat type %q already exists", t.Name)
+	}
+
+	if t.ReplacedBy != nil && d.statTypeName(*t.ReplacedBy) == "" {
+		return errors.Wrapf(store.ErrMissingReference, "replacing stat type %d does not exist", *t.ReplacedBy)
+	}
+
+	if _, ok := getUnit(t.DefaultUnit); !ok {
+		return errors.Wrapf(store.ErrMissingReference, "unit %q does not exist", t.DefaultUnit)
+	}
+
+	return nil
+}
+
+func (d *data) getStatTypeByName(name string) (int, error) {
+	t, ok := d.statTypes[name]
+	if !ok {
+		return 0, errors.Wrapf(store.ErrNotFound, "error getting stat type for name %q", name)
+	}
+	return t.ID, nil
+}
+
+func (d *data) statTypeName(id int) string {
+	return d.statType(id).Name
+}
+
+// statType returns the key stat type with the specified ID, the zero value if there is no such type.
+func (d *data) statType(id int) store.KeyStatType {
+	for _, t := range d.statTypes {
+		if t.ID == id {
+			return t
+		}
+	}
+	return store.KeyStatType{}
+}
+
+// findStatType returns the key stat type with the ID of t or, if there is no key stat type with the ID, the name of t
+// ignoring case. Returns false if there is no such key stat type.
+func (d *data) findStatType(t store.KeyStatType) (store.KeyStatType, bool) {
+	if t.ID != 0 {
+		if statType := d.statType(t.ID); statType.ID != 0 {
+			return statType, true
+		}
+	}
+
+	var found store.KeyStatType
+	for _, statType := range d.statTypes {
+		if strings.EqualFold(statType.Name, t.Name) && (found.ID == 0 || statType.ID < found.ID) {
+			found = statType
+		}
+	}
+
+	return found, found.ID != 0
+}
+
+// checkStatTypeActive returns store.ErrStatTypeNotActive if the key stat type is deprecated or replaced.
+func (d *data) checkStatTypeActive(t store.KeyStatType) error {
+	replacement := ""
+	if t.ReplacedBy != nil {
+		replacement = d.statTypeName(*t.ReplacedBy)
+	}
+	return t.CheckActive(replacement)
+}
+
+// setValue sets the value of the key stat along with the value type and precision of its key stat type and the
+// display string.
+func (d *data) setValue(s *store.KeyStatistic, value float64, unit string) {
+	t := d.statType(s.StatType)
+	u, _ := getUnit(unit)
+
+	s.Value = value
+	s.ValueType = t.ValueType
+	s.Precision = t.Precision
+	s.Unit = unit
+	s.SetDisplay(u.Symbol)
+}
+
+func (d *data) insertKeyStat(areaCode, name string, value float64, unit, datasetID, datasetName string, dateCreated time.Time) (int, error) {
+	profile, err := d.getProfileByAreaCode(areaCode)
+	if err != nil {
+		return 0, err
+	}
+
+	t, ok := d.statTypes[name]
+	if !ok {
+		return 0, errors.Wrapf(store.ErrMissingReference, "stat type %q does not exist", name)
+	}
+
+	if err := d.checkStatTypeActive(t); err != nil {
+		return 0, err
+	}
+
+	if err := store.ValidateValue(t.ValueType, value); err != nil {
+		return 0, errors.Wrapf(err, "invalid value for stat type %q", name)
+	}
+
+	if unit == "" {
+		unit = t.DefaultUnit
+	}
+
+	if _, ok := getUnit(unit); !ok {
+		return 0, errors.Wrapf(store.ErrMissingReference, "unit %q does not exist", unit)
+	}
+
+	statType := t.ID
+
+	created := toTimestamp(dateCreated)
+
+	for _, h := range d.history {
+		if h.ProfileID == profile.ID && h.StatType == statType && h.DateCreated.Equal(created) {
+			return 0, fmt.Errorf("error inserting key stat history %q for profile_id=%d: duplicate entry", name, profile.ID)
+		}
+	}
+
+	d.ensureKeyStatsVersion(profile, created)
+	d.upsertDataset(store.Dataset{ID: datasetID, Name: datasetName})
+
+	stats, ok := d.keyStats[profile.ID]
+	if !ok {
+		stats = make(map[int]store.KeyStatistic)
+		d.keyStats[profile.ID] = stats
+	}
+
+	stat, ok := stats[statType]
+	if !ok {
+		stat.StatID = d.keyStatSeq.next()
+	}
+
+	stat.ProfileID = profile.ID
+	stat.StatType = statType
+	stat.Name = name
+	stat.Value = value
+	stat.Unit = unit
+	stat.DateCreated = created
+	stat.Metadata = store.KeyStatisticMetadata{DatasetID: datasetID}
+	stats[statType] = stat
+
+	d.history = append(d.history, historyEntry{
+		StatID:      d.historySeq.next(),
+		ProfileID:   profile.ID,
+		StatType:    statType,
+		Value:       value,
+		Unit:        unit,
+		DateCreated: created,
+		DatasetID:   datasetID,
+	})
+
+	return stat.StatID, nil
+}
+
+func (d *data) getKeyStatsForProfile(profile *store.AreaProfile) store.KeyStatistics {
+	stats := make(store.KeyStatistics, 0)
+	for _, s := range d.keyStats[profile.ID] {
+		s.AreaCode = profile.AreaCode
+		s.Metadata = d.metadata(s.Metadata.DatasetID)
+		d.setValue(&s, s.Value, s.Unit)
+		stats = append(stats, s)
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].StatType < stats[j].StatType
+	})
+
+	return stats
+}
+
+// deleteKeyStats removes the current key stats of the area profile recording a deleted history entry for each key stat
+// as a new key stats version. Nothing is recorded if the profile has no key stats.
+func (d *data) deleteKeyStats(areaCode string, dateCreated time.Time) error {
+	profile, err := d.getProfileByAreaCode(areaCode)
+	if err != nil {
+		return err
+	}
+
+	stats := d.keyStats[profile.ID]
+	if len(stats) == 0 {
+		return nil
+	}
+
+	created := toTimestamp(dateCreated)
+	if _, err := d.createKeyStatsVersion(areaCode, store.KeyStatsDeletedLabel, "", created); err != nil {
+		return err
+	}
+
+	for _, s := range stats {
+		d.history = append(d.history, historyEntry{
+			StatID:      d.historySeq.next(),
+			ProfileID:   profile.ID,
+			StatType:    s.StatType,
+			Value:       s.Value,
+			Unit:        s.Unit,
+			DateCreated: created,
+			DatasetID:   s.Metadata.DatasetID,
+			Deleted:     true,
+		})
+	}
+
+	delete(d.keyStats, profile.ID)
+	return nil
+}
+
+// ensureKeyStatsVersion returns the index of the profile's key stats version with the specified date created, creating
+// it with the next version number if it does not already exist.
+func (d *data) ensureKeyStatsVersion(profile *store.AreaProfile, created time.Time) int {
+	versions := d.versions[profile.ID]
+	for i, v := range versions {
+		if v.DateCreated.Equal(created) {
+			return i
+		}
+	}
+
+	d.versions[profile.ID] = append(versions, store.KeyStatVersion{
+		Version:     len(versions) + 1,
+		DateCreated: created,
+	})
+
+	return len(versions)
+}
+
+func (d *data) createKeyStatsVersion(areaCode, label, source string, dateCreated time.Time) (*store.KeyStatVersion, error) {
+	profile, err := d.getProfileByAreaCode(areaCode)
+	if err != nil {
+		return nil, err
+	}
+
+	i := d.ensureKeyStatsVersion(profile, toTimestamp(dateCreated))
+	d.versions[profile.ID][i].Label = label
+	d.versions[profile.ID][i].Source = source
+
+	v := withVersionHref(profile, d.versions[profile.ID][i])
+	return &v, nil
+}
+
+// copyKeyStats loads the key stats as a new key stats version of each area profile counting the key stats inserted,
+// updated and unchanged. Only the inserted and updated key stats are written, an area profile without changes does not
+// get a new version. All references are checked before anything is loaded. Unlike insertKeyStat the history is not
+// checked for duplicates, each area profile may only have one row of each key stat type.
+func (d *data) copyKeyStats(rows []store.KeyStatRow, source string, dateCreated time.Time, progress store.BulkProgressFunc) (*store.BulkLoadResult, error) {
+	var missingProfiles, missingStatTypes, inactiveStatTypes int
+	for _, r := range rows {
+		if _, ok := d.profiles[r.AreaCode]; !ok {
+			missingProfiles++
+		}
+		if t, ok := d.statTypes[r.Name]; !ok {
+			missingStatTypes++
+		} else if d.checkStatTypeActive(t) != nil {
+			inactiveStatTypes++
+		}
+	}
+
+	if missingProfiles > 0 || missingStatTypes > 0 {
+		return nil, errors.Wrapf(store.ErrMissingReference, "%d rows for areas without an area profile, %d rows with a stat type that does not exist", missingProfiles, missingStatTypes)
+	}
+
+	if inactiveStatTypes > 0 {
+		return nil, errors.Wrapf(store.ErrStatTypeNotActive, "%d rows with a deprecated or replaced stat type", inactiveStatTypes)
+	}
+
+	result := &store.BulkLoadResult{Versions: make(map[string]int)}
+	created := toTimestamp(dateCreated)
+	datasets := make(map[string]string)
+
+	for i, r := range rows {
+		if progress != nil && i > 0 && i%store.BulkProgressInterval == 0 {
+			progress(i)
+		}
+
+		profile := d.profiles[r.AreaCode]
+		t := d.statTypes[r.Name]
+
+		unit := r.Unit
+		if unit == "" {
+			unit = t.DefaultUnit
+		}
+
+		if err := store.ValidateValue(t.ValueType, r.Value); err != nil {
+			return nil, errors.Wrapf(err, "invalid value for stat type %q", r.Name)
+		}
+
+		if _, ok := getUnit(unit); !ok {
+			return nil, errors.Wrapf(store.ErrMissingReference, "unit %q does not exist", unit)
+		}
+
+		if _, seen := datasets[r.DatasetID]; !seen || r.DatasetName != "" {
+			datasets[r.DatasetID] = r.DatasetName
+		}
+
+		current, exists := d.keyStats[profile.ID][t.ID]
+		switch {
+		case !exists:
+			result.Inserted++
+		case current.Value != r.Value || current.Unit != unit || current.Metadata.DatasetID != r.DatasetID ||
+			(r.DatasetName != "" && d.metadata(r.DatasetID).DatasetName != r.DatasetName):
+			result.Updated++
+		default:
+			result.Unchanged++
+			continue
+		}
+
+		if _, seen := result.Versions[r.AreaCode]; !seen {
+			v, err := d.createKeyStatsVersion(r.AreaCode, "", source, dateCreated)
+			if err != nil {
+				return nil, err
+			}
+			result.Versions[r.AreaCode] = v.Version
+		}
+
+		stats, ok := d.keyStats[profile.ID]
+		if !ok {
+			stats = make(map[int]store.KeyStatistic)
+			d.keyStats[profile.ID] = stats
+		}
+
+		if !exists {
+			current.StatID = d.keyStatSeq.next()
+		}
+
+		current.ProfileID = profile.ID
+		current.StatType = t.ID
+		current.Name = r.Name
+		current.Value = r.Value
+		current.Unit = unit
+		current.DateCreated = created
+		current.Metadata = store.KeyStatisticMetadata{DatasetID: r.DatasetID}
+		stats[t.ID] = current
+
+		d.history = append(d.history, historyEntry{
+			StatID:      d.historySeq.next(),
+			ProfileID:   profile.ID,
+			StatType:    t.ID,
+			Value:       r.Value,
+			Unit:        unit,
+			DateCreated: created,
+			DatasetID:   r.DatasetID,
+		})
+	}
+
+	for id, name := range datasets {
+		d.upsertDataset(store.Dataset{ID: id, Name: name})
+	}
+
+	if progress != nil {
+		progress(len(rows))
+	}
+
+	return result, nil
+}
+
+func (d *data) getKeyStatsVersionsForProfile(profile *store.AreaProfile) []store.KeyStatVersion {
+	versions := d.versions[profile.ID]
+
+	result := make([]store.KeyStatVersion, 0, len(versions))
+	for i := len(versions) - 1; i >= 0; i-- {
+		result = append(result, withVersionHref(profile, versions[i]))
+	}
+
+	return result
+}
+
+func (d *data) getKeyStatsVersionByNumber(profile *store.AreaProfile, number int) (*store.KeyStatVersion, error) {
+	versions := d.versions[profile.ID]
+	if number < 1 || number > len(versions) {
+		return nil, store.ErrNotFound
+	}
+
+	v := withVersionHref(profile, versions[number-1])
+	return &v, nil
+}
+
+func (d *data) getLatestKeyStatsVersion(profile *store.AreaProfile) (*store.KeyStatVersion, error) {
+	return d.getKeyStatsVersionByNumber(profile, len(d.versions[profile.ID]))
+}
+
+func withVersionHref(profile *store.AreaProfile, v store.KeyStatVersion) store.KeyStatVersion {
+	v.Href = fmt.Sprintf("http://localhost:8080/profiles/%s/stats/versions/%d", profile.AreaCode, v.Version)
+	return v
+}
+
+// getKeyStatsVersion returns the latest value of each key stat type created at or before the version timestamp,
+// excluding key stats deleted at or before the version.
+func (d *data) getKeyStatsVersion(profile *store.AreaProfile, version time.Time) store.KeyStatistics {
+	version = toTimestamp(version)
+
+	latest := make(map[int]historyEntry)
+	for _, h := range d.history {
+		if h.ProfileID != profile.ID || h.DateCreated.After(version) {
+			continue
+		}
+
+		if current, ok := latest[h.StatType]; !ok || h.DateCreated.After(current.DateCreated) {
+			latest[h.StatType] = h
+		}
+	}
+
+	stats := make(store.KeyStatistics, 0, len(latest))
+	for _, h := range latest {
+		if h.Deleted {
+			continue
+		}
+
+		s := store.KeyStatistic{
+			StatID:      h.StatID,
+			StatType:    h.StatType,
+			ProfileID:   h.ProfileID,
+			AreaCode:    profile.AreaCode,
+			Name:        d.statTypeName(h.StatType),
+			DateCreated: h.DateCreated,
+			Metadata:    d.metadata(h.DatasetID),
+		}
+
+		d.setValue(&s, h.Value, h.Unit)
+		stats = append(stats, s)
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].StatType < stats[j].StatType
+	})
+
+	return stats
+}
+
+func (d *data) getKeyStatHistory(profile *store.AreaProfile, statType int) (*store.KeyStatHistory, error) {
+	history := &store.KeyStatHistory{
+		AreaCode: profile.AreaCode,
+		StatType: statType,
+		Name:     d.statTypeName(statType),
+		History:  make([]store.KeyStatHistoryEntry, 0),
+	}
+
+	for _, h := range d.history {
+		if h.ProfileID != profile.ID || h.StatType != statType || h.Deleted {
+			continue
+		}
+
+		u, _ := getUnit(h.Unit)
+		history.History = append(history.History, store.KeyStatHistoryEntry{
+			Version:     d.versionNumber(profile, h.DateCreated),
+			Value:       h.Value,
+			Unit:        h.Unit,
+			Display:     store.FormatValue(h.Value, d.statType(statType).Precision, u.Symbol),
+			DateCreated: h.DateCreated,
+			Metadata:    d.metadata(h.DatasetID),
+		})
+	}
+
+	if len(history.History) == 0 {
+		return nil, store.ErrNotFound
+	}
+
+	sort.SliceStable(history.History, func(i, j int) bool {
+		return history.History[i].DateCreated.Before(history.History[j].DateCreated)
+	})
+
+	history.SetPeriodChanges()
+	return history, nil
+}
+
+// versionNumber returns the number of the profile's key stats version with the specified date created, 0 if there is no such version.
+func (d *data) versionNumber(profile *store.AreaProfile, created time.Time) int {
+	for _, v := range d.versions[profile.ID] {
+		if v.DateCreated.Equal(created) {
+			return v.Version
+		}
+	}
+	return 0
+}
+
+func (d *data) getRecipes(datasetID, edition string) []store.KeyStatsRecipe {
+	recipes := make([]store.KeyStatsRecipe, 0)
+	for _, r := range d.recipes {
+		if (datasetID == "" || r.DatasetID == datasetID) && (edition == "" || r.DatasetEdition == edition) {
+			recipes = append(recipes, d.toRecipe(r))
+		}
+	}
+
+	sort.Slice(recipes, func(i, j int) bool {
+		return recipes[i].ID < recipes[j].ID
+	})
+
+	return recipes
+}
+
+func (d *data) getRecipe(id int) (*store.KeyStatsRecipe, error) {
+	r, ok := d.recipes[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+
+	result := d.toRecipe(r)
+	return &result, nil
+}
+
+// toRecipe maps the recipe to its domain representation.
+func (d *data) toRecipe(r recipe) store.KeyStatsRecipe {
+	result := store.KeyStatsRecipe{
+		ID:              r.ID,
+		DatasetID:       r.DatasetID,
+		DatasetEdition:  r.DatasetEdition,
+		CantabularQuery: r.CantabularQuery,
+		StatType:        store.KeyStatType{ID: r.StatType, Name: d.statTypeName(r.StatType)},
+		Geographies:     make([]string, 0, len(r.Geographies)),
+		Href:            fmt.Sprintf("http://localhost:8080/recipes/%d", r.ID),
+	}
+
+	for _, g := range geographyTypes {
+		for _, id := range r.Geographies {
+			if g.ID == id {
+				result.Geographies = append(result.Geographies, g.Name)
+			}
+		}
+	}
+
+	return result
+}
+
+// toRecipeRow resolves the stat type and geography types of the recipe. Returns store.ErrMissingReference if any of
+// them do not exist.
+func (d *data) toRecipeRow(r store.KeyStatsRecipe) (recipe, error) {
+	row := recipe{
+		ID:              r.ID,
+		DatasetID:       r.DatasetID,
+		DatasetEdition:  r.DatasetEdition,
+		CantabularQuery: r.CantabularQuery,
+	}
+
+	statType, ok := d.findStatType(r.StatType)
+	if !ok {
+		return row, r.StatType.MissingReferenceError()
+	}
+	row.StatType = statType.ID
+
+	seen := make(map[int]bool)
+	for _, name := range r.Geographies {
+		g, err := getGeographyType(name)
+		if err != nil {
+			return row, err
+		}
+
+		if !seen[g.ID] {
+			seen[g.ID] = true
+			row.Geographies = append(row.Geographies, g.ID)
+		}
+	}
+
+	return row, nil
+}
+
+func (d *data) addRecipe(r store.KeyStatsRecipe) (int, error) {
+	row, err := d.toRecipeRow(r)
+	if err != nil {
+		return 0, err
+	}
+
+	row.ID = d.recipeSeq.next()
+	d.recipes[row.ID] = row
+	return row.ID, nil
+}
+
+func (d *data) updateRecipe(r store.KeyStatsRecipe) error {
+	row, err := d.toRecipeRow(r)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := d.recipes[r.ID]; !ok {
+		return store.ErrNotFound
+	}
+
+	d.recipes[r.ID] = row
+	return nil
+}
+
+func (d *data) deleteRecipe(id int) error {
+	if _, ok := d.recipes[id]; !ok {
+		return store.ErrNotFound
+	}
+
+	delete(d.recipes, id)
+	return nil
+}
+
+// metadata returns the key stat metadata for the dataset with the specified ID.
+func (d *data) metadata(datasetID string) store.KeyStatisticMetadata {
+	return store.KeyStatisticMetadata{
+		DatasetID:   datasetID,
+		DatasetName: d.datasets[datasetID].Name,
+		Href:        fmt.Sprintf("http://localhost:8080/datasets/%s", datasetID),
+	}
+}
+
+func (d *data) getDatasets() []store.Dataset {
+	datasets := make([]store.Dataset, 0, len(d.datasets))
+	for _, ds := range d.datasets {
+		ds.SetLinks()
+		datasets = append(datasets, ds)
+	}
+
+	sort.Slice(datasets, func(i, j int) bool {
+		return datasets[i].ID < datasets[j].ID
+	})
+
+	return datasets
+}
+
+func (d *data) getDataset(id string) (*store.Dataset, error) {
+	ds, ok := d.datasets[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+
+	ds.SetLinks()
+	return &ds, nil
+}
+
+func (d *data) getDatasetStats(id string) (*store.DatasetStats, error) {
+	if _, ok := d.datasets[id]; !ok {
+		return nil, store.ErrNotFound
+	}
+
+	profiles := d.getAreaProfiles()
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].AreaCode < profiles[j].AreaCode
+	})
+
+	result := &store.DatasetStats{DatasetID: id, StatTypes: make([]store.KeyStatType, 0), Profiles: make([]store.DatasetProfile, 0)}
+	for _, p := range profiles {
+		for _, s := range d.getKeyStatsForProfile(&p) {
+			if s.Metadata.DatasetID == id {
+				result.AddStat(p.AreaCode, p.Name, store.KeyStatType{ID: s.StatType, Name: s.Name})
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// upsertDataset inserts the dataset or updates the existing dataset. A blank name or description keeps the existing
+// value, editions are added to the existing editions and the release date is only updated if it is later.
+func (d *data) upsertDataset(ds store.Dataset) {
+	existing, ok := d.datasets[ds.ID]
+	if !ok {
+		existing = store.Dataset{ID: ds.ID, Name: ds.ID, Editions: make([]string, 0)}
+	}
+
+	if ds.Name != "" {
+		existing.Name = ds.Name
+	}
+
+	if ds.Description != "" {
+		existing.Description = ds.Description
+	}
+
+	for _, e := range ds.Editions {
+		if !contains(existing.Editions, e) {
+			existing.Editions = append(existing.Editions, e)
+		}
+	}
+	sort.Strings(existing.Editions)
+
+	if ds.ReleaseDate != nil && (existing.ReleaseDate == nil || ds.ReleaseDate.After(*existing.ReleaseDate)) {
+		releaseDate := toTimestamp(*ds.ReleaseDate)
+		existing.ReleaseDate = &releaseDate
+	}
+
+	d.datasets[ds.ID] = existing
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// toTimestamp mirrors how a time.Time is stored in a postgres TIMESTAMP column - the wall clock time is kept, the
+// location discarded and the precision truncated to microseconds.
+func toTimestamp(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC).Truncate(time.Microsecond)
+}
+
+func (d *data) getImports(status string) []store.Import {
+	imports := make([]store.Import, 0, len(d.imports))
+	for i := len(d.imports) - 1; i >= 0; i-- {
+		if status == "" || d.imports[i].Status == status {
+			imports = append(imports, d.imports[i])
+		}
+	}
+	return imports
+}
+
+func (d *data) getImport(id int) (*store.Import, error) {
+	for _, i := range d.imports {
+		if i.ID == id {
+			return &i, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (d *data) getCompletedImportByChecksum(checksum string) (*store.Import, error) {
+	for n := len(d.imports) - 1; n >= 0; n-- {
+		if i := d.imports[n]; i.Checksum == checksum && i.Status == store.ImportCompleted {
+			return &i, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (d *data) addImport(i store.Import) int {
+	i.ID = d.importSeq.next()
+	i.SetHref()
+	d.imports = append(d.imports, i)
+	return i.ID
+}
@@ -0,0 +1,583 @@
+// Package memory provides an in-memory implementation of the area profiles store for offline development and tests.
+// Data is held in process memory only and is lost when the process exits.
+package memory
+
+import (
+	"context"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store"
+	log "github.com/daiLlew/funkylog"
+	"sync"
+	"time"
+)
+
+// Store is an in-memory area profiles store. It is safe for concurrent use.
+type Store struct {
+	mu   sync.RWMutex
+	data *data
+}
+
+// tx is an in-memory implementation of store.Tx. It operates directly on the data of the transaction it belongs to.
+type tx struct {
+	data *data
+}
+
+// New construct a new empty in-memory area profiles store.
+func New() *Store {
+	return &Store{data: newData()}
+}
+
+// Init is an initialisation function. If reset is true any existing data is discarded, otherwise no action is taken.
+func (s *Store) Init(ctx context.Context, reset bool) error {
+	if reset {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		log.Info("discarding in-memory data")
+		s.data = newData()
+	}
+
+	log.Info("in-memory store initialisation compeleted successfully :pizza:")
+	return nil
+}
+
+// Seed populates the store with a test area and area profile. The default key stat types are added when the store is
+// created.
+func (s *Store) Seed(ctx context.Context, areaCode, areaName, areaProfileName string) error {
+	return s.InTransaction(ctx, func(t store.Tx) error {
+		d := t.(*tx).data
+
+		log.Info("adding area test data, name=%s, code=%s", areaName, areaCode)
+		if _, err := d.addArea(areaCode, areaName); err != nil {
+			return err
+		}
+
+		log.Info("adding area profile test data, name=%s", areaProfileName)
+		_, err := d.addAreaProfile(areaCode, areaProfileName)
+		return err
+	})
+}
+
+// InTransaction runs fn against a copy of the store data. If fn returns an error the copy is discarded, otherwise it
+// replaces the store data. Transactions are serialised - only one may run at a time.
+func (s *Store) InTransaction(ctx context.Context, fn func(tx store.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	working := s.data.copy()
+	if err := fn(&tx{data: working}); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.data = working
+	return nil
+}
+
+// read runs fn holding the read lock.
+func (s *Store) read(ctx context.Context, fn func(d *data) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return fn(s.data)
+}
+
+// AddArea insert a new area, returns the area code.
+func (s *Store) AddArea(ctx context.Context, code, name string) (string, error) {
+	var areaCode string
+	err := s.InTransaction(ctx, func(t store.Tx) error {
+		var err error
+		areaCode, err = t.AddArea(ctx, code, name)
+		return err
+	})
+	return areaCode, err
+}
+
+// AddAreaProfile insert a new area profile returns the area profile ID.
+func (s *Store) AddAreaProfile(ctx context.Context, areaCode, name string) (int, error) {
+	var profileID int
+	err := s.InTransaction(ctx, func(t store.Tx) error {
+		var err error
+		profileID, err = t.AddAreaProfile(ctx, areaCode, name)
+		return err
+	})
+	return profileID, err
+}
+
+// GetArea returns the area with the specified code.
+func (s *Store) GetArea(ctx context.Context, code string) (*store.Area, error) {
+	var a *store.Area
+	err := s.read(ctx, func(d *data) error {
+		var err error
+		a, err = d.getArea(code)
+		return err
+	})
+	return a, err
+}
+
+// GetAreaChildren returns the areas whose parent is the area with the specified code.
+func (s *Store) GetAreaChildren(ctx context.Context, code string) ([]store.Area, error) {
+	var areas []store.Area
+	err := s.read(ctx, func(d *data) error {
+		var err error
+		areas, err = d.getAreaChildren(code)
+		return err
+	})
+	return areas, err
+}
+
+// GetAreaAncestors returns the parent, grandparent etc. of the area with the specified code, nearest first.
+func (s *Store) GetAreaAncestors(ctx context.Context, code string) ([]store.Area, error) {
+	var areas []store.Area
+	err := s.read(ctx, func(d *data) error {
+		var err error
+		areas, err = d.getAreaAncestors(code)
+		return err
+	})
+	return areas, err
+}
+
+// GetGeographyTypes returns all of the geography types.
+func (s *Store) GetGeographyTypes(ctx context.Context) ([]store.GeographyType, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return append([]store.GeographyType(nil), geographyTypes...), nil
+}
+
+// UpdateArea updates the name of the area with the specified code.
+func (s *Store) UpdateArea(ctx context.Context, code, name string) error {
+	return s.InTransaction(ctx, func(t store.Tx) error {
+		return t.(*tx).data.updateArea(code, name)
+	})
+}
+
+// DeleteArea deletes the area with the specified code. Returns store.ErrConflict if the area has an area profile.
+func (s *Store) DeleteArea(ctx context.Context, code string) error {
+	return s.InTransaction(ctx, func(t store.Tx) error {
+		return t.(*tx).data.deleteArea(code)
+	})
+}
+
+// UpdateAreaProfile updates the name of the area profile for the specified area code.
+func (s *Store) UpdateAreaProfile(ctx context.Context, areaCode, name string) error {
+	return s.InTransaction(ctx, func(t store.Tx) error {
+		return t.(*tx).data.updateAreaProfile(areaCode, name)
+	})
+}
+
+// DeleteAreaProfile deletes the area profile for the specified area code. Returns store.ErrConflict if the profile has key
+// stats or key stats versions.
+func (s *Store) DeleteAreaProfile(ctx context.Context, areaCode string) error {
+	return s.InTransaction(ctx, func(t store.Tx) error {
+		return t.(*tx).data.deleteAreaProfile(areaCode)
+	})
+}
+
+// DeleteKeyStats deletes the current key stats of the area profile, recording the deletion as a new key stats version.
+func (s *Store) DeleteKeyStats(ctx context.Context, areaCode string) error {
+	return s.InTransaction(ctx, func(t store.Tx) error {
+		return t.DeleteKeyStats(ctx, areaCode)
+	})
+}
+
+// GetStatTypes returns the key stat types with the specified status in display order. A blank status returns every key
+// stat type.
+func (s *Store) GetStatTypes(ctx context.Context, status string) ([]store.KeyStatType, error) {
+	var types []store.KeyStatType
+	err := s.read(ctx, func(d *data) error {
+		types = d.getStatTypes(status)
+		return nil
+	})
+	return types, err
+}
+
+// GetStatTypeByID returns the key stat type with the specified ID.
+func (s *Store) GetStatTypeByID(ctx context.Context, id int) (*store.KeyStatType, error) {
+	var statType *store.KeyStatType
+	err := s.read(ctx, func(d *data) error {
+		var err error
+		statType, err = d.getStatTypeByID(id)
+		return err
+	})
+	return statType, err
+}
+
+// AddStatType inserts a new key stat type returning its ID.
+func (s *Store) AddStatType(ctx context.Context, statType store.KeyStatType) (int, error) {
+	var typeID int
+	err := s.InTransaction(ctx, func(t store.Tx) error {
+		var err error
+		typeID, err = t.AddStatType(ctx, statType)
+		return err
+	})
+	return typeID, err
+}
+
+// UpdateStatType replaces the key stat type with the ID of the key stat type provided.
+func (s *Store) UpdateStatType(ctx context.Context, statType store.KeyStatType) error {
+	return s.InTransaction(ctx, func(t store.Tx) error {
+		return t.(*tx).data.updateStatType(statType)
+	})
+}
+
+// GetStatTypeByName return the stat type id for the stat type with the specified name.
+func (s *Store) GetStatTypeByName(ctx context.Context, name string) (int, error) {
+	var typeID int
+	err := s.read(ctx, func(d *data) error {
+		var err error
+		typeID, err = d.getStatTypeByName(name)
+		return err
+	})
+	return typeID, err
+}
+
+// GetUnits returns the units key stat values can be measured in.
+func (s *Store) GetUnits(ctx context.Context) ([]store.Unit, error) {
+	var result []store.Unit
+	err := s.read(ctx, func(d *data) error {
+		result = append(make([]store.Unit, 0, len(units)), units...)
+		return nil
+	})
+	return result, err
+}
+
+// GetAreaProfiles return a list of area profiles
+func (s *Store) GetAreaProfiles(ctx context.Context) ([]store.AreaProfile, error) {
+	var profiles []store.AreaProfile
+	err := s.read(ctx, func(d *data) error {
+		profiles = d.getAreaProfiles()
+		return nil
+	})
+	return profiles, err
+}
+
+// GetProfileByAreaCode return the area profile associated with the specified area code.
+func (s *Store) GetProfileByAreaCode(ctx context.Context, areaCode string) (*store.AreaProfile, error) {
+	var profile *store.AreaProfile
+	err := s.read(ctx, func(d *data) error {
+		var err error
+		profile, err = d.getProfileByAreaCode(areaCode)
+		return err
+	})
+	return profile, err
+}
+
+// InsertKeyStat insert a key statistic for the specified area profile.
+func (s *Store) InsertKeyStat(ctx context.Context, areaCode, name string, value float64, unit, datasetID, datasetName string, dateCreated time.Time) (int, error) {
+	var keyStatID int
+	err := s.InTransaction(ctx, func(t store.Tx) error {
+		var err error
+		keyStatID, err = t.InsertKeyStat(ctx, areaCode, name, value, unit, datasetID, datasetName, dateCreated)
+		return err
+	})
+	return keyStatID, err
+}
+
+// GetKeyStatsForProfile returns a list of the current Key stats associated with the specified area profile.
+func (s *Store) GetKeyStatsForProfile(ctx context.Context, profile *store.AreaProfile) (store.KeyStatistics, error) {
+	var stats store.KeyStatistics
+	err := s.read(ctx, func(d *data) error {
+		stats = d.getKeyStatsForProfile(profile)
+		return nil
+	})
+	return stats, err
+}
+
+// GetKeyStatsVersionsForProfile list all versions of the key stats for this area profile, most recent first.
+func (s *Store) GetKeyStatsVersionsForProfile(ctx context.Context, profile *store.AreaProfile) ([]store.KeyStatVersion, error) {
+	var versions []store.KeyStatVersion
+	err := s.read(ctx, func(d *data) error {
+		versions = d.getKeyStatsVersionsForProfile(profile)
+		return nil
+	})
+	return versions, err
+}
+
+// GetKeyStatsVersionByNumber returns the key stats version of the area profile with the specified version number.
+func (s *Store) GetKeyStatsVersionByNumber(ctx context.Context, profile *store.AreaProfile, number int) (*store.KeyStatVersion, error) {
+	var version *store.KeyStatVersion
+	err := s.read(ctx, func(d *data) error {
+		var err error
+		version, err = d.getKeyStatsVersionByNumber(profile, number)
+		return err
+	})
+	return version, err
+}
+
+// GetLatestKeyStatsVersion returns the most recent key stats version of the area profile.
+func (s *Store) GetLatestKeyStatsVersion(ctx context.Context, profile *store.AreaProfile) (*store.KeyStatVersion, error) {
+	var version *store.KeyStatVersion
+	err := s.read(ctx, func(d *data) error {
+		var err error
+		version, err = d.getLatestKeyStatsVersion(profile)
+		return err
+	})
+	return version, err
+}
+
+// GetKeyStatsVersion returns a list of key stats belonging to the specified version of the area profile.
+// The result is the latest value of each key stat type created at or before the version timestamp.
+func (s *Store) GetKeyStatsVersion(ctx context.Context, profile *store.AreaProfile, date time.Time) (store.KeyStatistics, error) {
+	var stats store.KeyStatistics
+	err := s.read(ctx, func(d *data) error {
+		stats = d.getKeyStatsVersion(profile, date)
+		return nil
+	})
+	return stats, err
+}
+
+// GetKeyStatHistory returns each historical value of the key stat type for the area profile, oldest first.
+func (s *Store) GetKeyStatHistory(ctx context.Context, profile *store.AreaProfile, statType int) (*store.KeyStatHistory, error) {
+	var history *store.KeyStatHistory
+	err := s.read(ctx, func(d *data) error {
+		var err error
+		history, err = d.getKeyStatHistory(profile, statType)
+		return err
+	})
+	return history, err
+}
+
+// GetRecipes returns the key stats recipes for the dataset ID and edition. A blank dataset ID or edition matches every
+// recipe.
+func (s *Store) GetRecipes(ctx context.Context, datasetID, edition string) ([]store.KeyStatsRecipe, error) {
+	var recipes []store.KeyStatsRecipe
+	err := s.read(ctx, func(d *data) error {
+		recipes = d.getRecipes(datasetID, edition)
+		return nil
+	})
+	return recipes, err
+}
+
+// GetRecipe returns the key stats recipe with the specified ID.
+func (s *Store) GetRecipe(ctx context.Context, id int) (*store.KeyStatsRecipe, error) {
+	var recipe *store.KeyStatsRecipe
+	err := s.read(ctx, func(d *data) error {
+		var err error
+		recipe, err = d.getRecipe(id)
+		return err
+	})
+	return recipe, err
+}
+
+// AddRecipe inserts a key stats recipe returning the new recipe ID.
+func (s *Store) AddRecipe(ctx context.Context, recipe store.KeyStatsRecipe) (int, error) {
+	var recipeID int
+	err := s.InTransaction(ctx, func(t store.Tx) error {
+		var err error
+		recipeID, err = t.AddRecipe(ctx, recipe)
+		return err
+	})
+	return recipeID, err
+}
+
+// UpdateRecipe replaces the key stats recipe with the ID of the recipe provided including its geography types.
+func (s *Store) UpdateRecipe(ctx context.Context, recipe store.KeyStatsRecipe) error {
+	return s.InTransaction(ctx, func(t store.Tx) error {
+		return t.UpdateRecipe(ctx, recipe)
+	})
+}
+
+// DeleteRecipe deletes the key stats recipe with the specified ID.
+func (s *Store) DeleteRecipe(ctx context.Context, id int) error {
+	return s.InTransaction(ctx, func(t store.Tx) error {
+		return t.(*tx).data.deleteRecipe(id)
+	})
+}
+
+// GetDatasets returns all datasets.
+func (s *Store) GetDatasets(ctx context.Context) ([]store.Dataset, error) {
+	var datasets []store.Dataset
+	err := s.read(ctx, func(d *data) error {
+		datasets = d.getDatasets()
+		return nil
+	})
+	return datasets, err
+}
+
+// GetDataset returns the dataset with the specified ID.
+func (s *Store) GetDataset(ctx context.Context, id string) (*store.Dataset, error) {
+	var dataset *store.Dataset
+	err := s.read(ctx, func(d *data) error {
+		var err error
+		dataset, err = d.getDataset(id)
+		return err
+	})
+	return dataset, err
+}
+
+// GetDatasetStats returns the area profiles and key stat types the current key stats of which are sourced from the
+// specified dataset.
+func (s *Store) GetDatasetStats(ctx context.Context, id string) (*store.DatasetStats, error) {
+	var stats *store.DatasetStats
+	err := s.read(ctx, func(d *data) error {
+		var err error
+		stats, err = d.getDatasetStats(id)
+		return err
+	})
+	return stats, err
+}
+
+// Ping always succeeds for the in-memory store.
+func (s *Store) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// PoolStats returns empty stats, the in-memory store has no connection pool.
+func (s *Store) PoolStats() store.PoolStats {
+	return store.PoolStats{}
+}
+
+// GetImports returns the imports with the specified status most recent first. A blank status returns every import.
+func (s *Store) GetImports(ctx context.Context, status string) ([]store.Import, error) {
+	var imports []store.Import
+	err := s.read(ctx, func(d *data) error {
+		imports = d.getImports(status)
+		return nil
+	})
+	return imports, err
+}
+
+// GetImport returns the import with the specified ID.
+func (s *Store) GetImport(ctx context.Context, id int) (*store.Import, error) {
+	var i *store.Import
+	err := s.read(ctx, func(d *data) error {
+		var err error
+		i, err = d.getImport(id)
+		return err
+	})
+	return i, err
+}
+
+// AddImport inserts an entry in the imports ledger returning its ID.
+func (s *Store) AddImport(ctx context.Context, i store.Import) (int, error) {
+	var id int
+	err := s.InTransaction(ctx, func(t store.Tx) error {
+		var err error
+		id, err = t.AddImport(ctx, i)
+		return err
+	})
+	return id, err
+}
+
+// Close is a no-op for the in-memory store.
+func (s *Store) Close() error {
+	return nil
+}
+
+// GetProfileByAreaCode return the area profile associated with the specified area code.
+func (t *tx) GetProfileByAreaCode(ctx context.Context, areaCode string) (*store.AreaProfile, error) {
+	return t.data.getProfileByAreaCode(areaCode)
+}
+
+// GetProfilesByAreaCodes returns the area profiles of the specified area codes keyed by area code.
+func (t *tx) GetProfilesByAreaCodes(ctx context.Context, areaCodes []string) (map[string]*store.AreaProfile, error) {
+	return t.data.getProfilesByAreaCodes(areaCodes), nil
+}
+
+// GetArea returns the area with the specified code.
+func (t *tx) GetArea(ctx context.Context, code string) (*store.Area, error) {
+	return t.data.getArea(code)
+}
+
+// AddArea insert a new area, returns the area code.
+func (t *tx) AddArea(ctx context.Context, code, name string) (string, error) {
+	return t.data.addArea(code, name)
+}
+
+// AddAreaProfile insert a new area profile returns the area profile ID.
+func (t *tx) AddAreaProfile(ctx context.Context, areaCode, name string) (int, error) {
+	return t.data.addAreaProfile(areaCode, name)
+}
+
+// GetStatTypeByName return the ID of the key stat type with the specified name.
+func (t *tx) GetStatTypeByName(ctx context.Context, name string) (int, error) {
+	return t.data.getStatTypeByName(name)
+}
+
+// GetStatTypeByID returns the key stat type with the specified ID.
+func (t *tx) GetStatTypeByID(ctx context.Context, id int) (*store.KeyStatType, error) {
+	return t.data.getStatTypeByID(id)
+}
+
+// GetUnits returns the units key stat values can be measured in.
+func (t *tx) GetUnits(ctx context.Context) ([]store.Unit, error) {
+	return append(make([]store.Unit, 0, len(units)), units...), nil
+}
+
+// AddStatType inserts a new key stat type returning its ID.
+func (t *tx) AddStatType(ctx context.Context, statType store.KeyStatType) (int, error) {
+	return t.data.addStatType(statType)
+}
+
+// InsertKeyStat insert a key statistic for the specified area profile.
+func (t *tx) InsertKeyStat(ctx context.Context, areaCode, name string, value float64, unit, datasetID, datasetName string, dateCreated time.Time) (int, error) {
+	return t.data.insertKeyStat(areaCode, name, value, unit, datasetID, datasetName, dateCreated)
+}
+
+// GetKeyStatsForProfile returns a list of the current Key stats associated with the specified area profile.
+func (t *tx) GetKeyStatsForProfile(ctx context.Context, profile *store.AreaProfile) (store.KeyStatistics, error) {
+	return t.data.getKeyStatsForProfile(profile), nil
+}
+
+// DeleteKeyStats deletes the current key stats of the area profile, recording the deletion as a new key stats version.
+func (t *tx) DeleteKeyStats(ctx context.Context, areaCode string) error {
+	return t.data.deleteKeyStats(areaCode, time.Now())
+}
+
+// CreateKeyStatsVersion creates a new key stats version of the area profile with the specified label and source. If a
+// version with the same date created already exists its label and source are updated.
+func (t *tx) CreateKeyStatsVersion(ctx context.Context, areaCode, label, source string, dateCreated time.Time) (*store.KeyStatVersion, error) {
+	return t.data.createKeyStatsVersion(areaCode, label, source, dateCreated)
+}
+
+// UpsertArea inserts the area or updates the name, geography type and parent of the existing area.
+func (t *tx) UpsertArea(ctx context.Context, code, name, geographyType, parentCode string) error {
+	return t.data.upsertArea(code, name, geographyType, parentCode)
+}
+
+// UpsertDataset inserts the dataset or updates the existing dataset.
+func (t *tx) UpsertDataset(ctx context.Context, dataset store.Dataset) error {
+	t.data.upsertDataset(dataset)
+	return nil
+}
+
+// GetCompletedImportByChecksum returns the most recent completed import of a file with the specified checksum.
+func (t *tx) GetCompletedImportByChecksum(ctx context.Context, checksum string) (*store.Import, error) {
+	return t.data.getCompletedImportByChecksum(checksum)
+}
+
+// AddImport inserts an entry in the imports ledger returning its ID.
+func (t *tx) AddImport(ctx context.Context, i store.Import) (int, error) {
+	return t.data.addImport(i), nil
+}
+
+// CopyKeyStats bulk loads the key stats as a new key stats version of each area profile.
+func (t *tx) CopyKeyStats(ctx context.Context, rows []store.KeyStatRow, source string, dateCreated time.Time, progress store.BulkProgressFunc) (*store.BulkLoadResult, error) {
+	return t.data.copyKeyStats(rows, source, dateCreated, progress)
+}
+
+// CopyAreaProfiles creates the area profile of each area without one.
+func (t *tx) CopyAreaProfiles(ctx context.Context, profiles []store.NewAreaProfile) (*store.ProvisionResult, error) {
+	return t.data.copyAreaProfiles(profiles)
+}
+
+// AddRecipe inserts a key stats recipe returning the new recipe ID.
+func (t *tx) AddRecipe(ctx context.Context, recipe store.KeyStatsRecipe) (int, error) {
+	return t.data.addRecipe(recipe)
+}
+
+// UpdateRecipe replaces the key stats recipe with the ID of the recipe provided including its geography types.
+func (t *tx) UpdateRecipe(ctx context.Context, recipe store.KeyStatsRecipe) error {
+	return t.data.updateRecipe(recipe)
+}
@@ -0,0 +1,359 @@
+package store
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	log "github.com/daiLlew/funkylog"
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// migrationsFS contains the versioned schema migration scripts. Each migration consists of a pair of files named
+// <version>_<name>.up.sql and <version>_<name>.down.sql where version is a sequential integer.
+//
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+var (
+	// migrationFileRegex matches migration file names capturing the version, name and direction.
+	migrationFileRegex = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+	// migrationLockID is an arbitrary key for the postgres advisory lock held while migrations are applied.
+	migrationLockID = 7320512
+
+	// createSchemaMigrationsTableSQL SQL statement to create the table recording which migrations have been applied.
+	createSchemaMigrationsTableSQL = `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INT PRIMARY KEY NOT NULL,
+			name VARCHAR(100) NOT NULL,
+			applied_at TIMESTAMP NOT NULL
+		);
+	`
+
+	// getAppliedMigrationsSQL SQL query returning the migrations that have been applied.
+	getAppliedMigrationsSQL = `
+		SELECT
+			version, applied_at
+		FROM
+			schema_migrations
+		ORDER BY
+			version;
+	`
+
+	// insertSchemaMigrationSQL SQL statement recording a migration as applied.
+	insertSchemaMigrationSQL = `
+		INSERT INTO schema_migrations
+			(version, name, applied_at)
+		VALUES
+			($1, $2, $3);
+	`
+
+	// dropLegacySchemaSQL SQL statement dropping the tables and sequences created by init before schema migrations were
+	// introduced. The tables of a legacy database have no record in schema_migrations so rolling back the migrations does
+	// not drop them, and migration 0001 adopts them.
+	dropLegacySchemaSQL = `
+		DROP TABLE IF EXISTS key_stats_history, key_stats, key_stat_types, area_profiles, areas CASCADE;
+		DROP SEQUENCE IF EXISTS area_profile_id, key_stat_type_id, key_stat_id, key_stat_history_id, key_stats_id, key_stats_history_id;
+	`
+
+	// deleteSchemaMigrationSQL SQL statement removing the record of an applied migration.
+	deleteSchemaMigrationSQL = `
+		DELETE FROM
+			schema_migrations
+		WHERE
+			version = $1;
+	`
+)
+
+// Migration is a versioned change to the database schema.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus describes a migration and whether it has been applied to the database.
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Migrations returns the embedded schema migrations ordered by version.
+func Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationsFS, "migrations")
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading embedded migrations")
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, e := range entries {
+		match := migrationFileRegex.FindStringSubmatch(e.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", e.Name())
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration version %d has conflicting names %q and %q", version, m.Name, match[2])
+		}
+
+		b, err := migrationsFS.ReadFile(path.Join("migrations", e.Name()))
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading migration file %q", e.Name())
+		}
+
+		if match[3] == "up" {
+			m.Up = string(b)
+		} else {
+			m.Down = string(b)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s requires both an up and a down script", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migrations must be numbered sequentially from 1, expected version %d but found %d", i+1, m.Version)
+		}
+	}
+
+	return migrations, nil
+}
+
+// MigrateUp applies all outstanding migrations.
+func (s *AreaProfileStore) MigrateUp(ctx context.Context) error {
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+
+	return s.MigrateTo(ctx, len(migrations))
+}
+
+// MigrateDown rolls back the most recently applied migration.
+func (s *AreaProfileStore) MigrateDown(ctx context.Context) error {
+	current, err := s.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	if current == 0 {
+		log.Info("no migrations to roll back")
+		return nil
+	}
+
+	return s.MigrateTo(ctx, current-1)
+}
+
+// MigrateTo applies or rolls back migrations until the schema is at the target version. Version 0 is an empty schema.
+func (s *AreaProfileStore) MigrateTo(ctx context.Context, target int) error {
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+
+	if target < 0 || target > len(migrations) {
+		return fmt.Errorf("invalid target migration version %d, expected a value between 0 and %d", target, len(migrations))
+	}
+
+	conn, err := s.acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Release()
+
+	// Hold an advisory lock so concurrent migration runs cannot interleave.
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+		return errors.Wrap(err, "error acquiring migration lock")
+	}
+
+	defer conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID)
+
+	if _, err := conn.Exec(ctx, createSchemaMigrationsTableSQL); err != nil {
+		return errors.Wrap(err, "error creating schema_migrations table")
+	}
+
+	applied, err := getAppliedMigrations(ctx, conn.Conn())
+	if err != nil {
+		return err
+	}
+
+	current := len(applied)
+
+	for _, m := range migrations {
+		if m.Version <= current || m.Version > target {
+			continue
+		}
+
+		log.Info("applying migration %d_%s", m.Version, m.Name)
+		if err := runMigration(ctx, conn.Conn(), m.Up, insertSchemaMigrationSQL, m.Version, m.Name, time.Now()); err != nil {
+			return errors.Wrapf(err, "error applying migration %d_%s", m.Version, m.Name)
+		}
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.Version > current || m.Version <= target {
+			continue
+		}
+
+		log.Info("rolling back migration %d_%s", m.Version, m.Name)
+		if err := runMigration(ctx, conn.Conn(), m.Down, deleteSchemaMigrationSQL, m.Version); err != nil {
+			return errors.Wrapf(err, "error rolling back migration %d_%s", m.Version, m.Name)
+		}
+	}
+
+	log.Info("database schema is at version %d", target)
+	return nil
+}
+
+// ResetSchema rolls back every migration then drops any tables created before schema migrations were introduced,
+// leaving an empty schema. Returns an error if the legacy tables cannot be dropped.
+func (s *AreaProfileStore) ResetSchema(ctx context.Context) error {
+	if err := s.MigrateTo(ctx, 0); err != nil {
+		return err
+	}
+
+	conn, err := s.acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Release()
+
+	log.Info("dropping any tables created before schema migrations were introduced")
+	if _, err := conn.Exec(ctx, dropLegacySchemaSQL); err != nil {
+		return errors.Wrap(err, "error dropping legacy schema")
+	}
+
+	return nil
+}
+
+// SchemaVersion returns the version of the most recently applied migration, 0 if no migrations have been applied.
+func (s *AreaProfileStore) SchemaVersion(ctx context.Context) (int, error) {
+	statuses, err := s.MigrationStatus(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	version := 0
+	for _, m := range statuses {
+		if m.Applied {
+			version = m.Version
+		}
+	}
+
+	return version, nil
+}
+
+// MigrationStatus returns each of the known migrations and whether it has been applied to the database.
+func (s *AreaProfileStore) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := s.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, createSchemaMigrationsTableSQL); err != nil {
+		return nil, errors.Wrap(err, "error creating schema_migrations table")
+	}
+
+	applied, err := getAppliedMigrations(ctx, conn.Conn())
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		appliedAt, ok := applied[m.Version]
+		statuses = append(statuses, MigrationStatus{
+			Version:   m.Version,
+			Name:      m.Name,
+			Applied:   ok,
+			AppliedAt: appliedAt,
+		})
+	}
+
+	return statuses, nil
+}
+
+// getAppliedMigrations returns a map of applied migration version to the time it was applied.
+func getAppliedMigrations(ctx context.Context, conn *pgx.Conn) (map[int]time.Time, error) {
+	rows, err := conn.Query(ctx, getAppliedMigrationsSQL)
+	if err != nil {
+		return nil, errors.Wrap(err, "error querying applied migrations")
+	}
+
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, errors.Wrap(err, "error scanning applied migration row")
+		}
+
+		applied[version] = appliedAt
+	}
+
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	return applied, nil
+}
+
+// runMigration executes the migration script and updates the schema_migrations table in a single transaction.
+func runMigration(ctx context.Context, conn *pgx.Conn, script, recordSQL string, recordArgs ...interface{}) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, script); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, recordSQL, recordArgs...); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
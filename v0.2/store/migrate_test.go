@@ -0,0 +1,220 @@
+package store_test
+
+import (
+	"context"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store"
+	"github.com/pkg/errors"
+	"reflect"
+	"testing"
+)
+
+// legacySchemaSQL creates the schema created by init before schema migrations were introduced, with an area profile.
+const legacySchemaSQL = `
+	CREATE TABLE areas (
+		code VARCHAR (50) PRIMARY KEY NOT NULL,
+		name VARCHAR (100) NOT NULL
+	);
+
+	CREATE TABLE area_profiles (
+		profile_id INT PRIMARY KEY NOT NULL,
+		area_code VARCHAR(50) NOT NULL,
+		name VARCHAR (100) NOT NULL,
+		UNIQUE (area_code),
+		CONSTRAINT fk_area_code FOREIGN KEY (area_code) REFERENCES areas (code)
+	);
+
+	CREATE SEQUENCE area_profile_id START 1000 INCREMENT 100 MINVALUE 1000 OWNED BY area_profiles.profile_id;
+
+	CREATE TABLE key_stat_types (
+		type_id INT PRIMARY KEY NOT NULL,
+		name VARCHAR(100) NOT NULL,
+		UNIQUE (name)
+	);
+
+	CREATE SEQUENCE key_stat_type_id START 1000 INCREMENT 100 MINVALUE 1000 OWNED BY key_stat_types.type_id;
+
+	INSERT INTO areas (code, name) VALUES ('E05011362', 'Disbury East');
+	INSERT INTO area_profiles (profile_id, area_code, name) VALUES (nextval('area_profile_id'), 'E05011362', 'Legacy profile');
+	INSERT INTO key_stat_types (type_id, name) VALUES (nextval('key_stat_type_id'), 'Legacy key stat');
+`
+
+func TestMigrations(t *testing.T) {
+	migrations, err := store.Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(migrations) == 0 {
+		t.Fatal("expected embedded migrations")
+	}
+
+	for i, m := range migrations {
+		if m.Version != i+1 || m.Name == "" || m.Up == "" || m.Down == "" {
+			t.Errorf("expected migration %d with a name, up and down script, got %d_%s", i+1, m.Version, m.Name)
+		}
+	}
+}
+
+func TestMigrateUpAlreadyMigrated(t *testing.T) {
+	ctx := context.Background()
+	s := newPostgresStore(t)
+
+	migrations, err := store.Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := s.MigrationStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range before {
+		if !m.Applied {
+			t.Fatalf("expected every migration to be applied, %d_%s is not", m.Version, m.Name)
+		}
+	}
+
+	statTypes, err := s.GetStatTypes(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(statTypes) == 0 {
+		t.Fatal("expected the migrations to add the default key stat types")
+	}
+
+	addProfile(t, s, "E05011362")
+
+	// re-running the migrations on an already migrated schema changes nothing and keeps the data.
+	if err := s.MigrateUp(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Init(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := s.MigrationStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(after, before) {
+		t.Errorf("expected the migration status to be unchanged\n%+v\ngot\n%+v", before, after)
+	}
+
+	if version, err := s.SchemaVersion(ctx); err != nil || version != len(migrations) {
+		t.Errorf("expected schema version %d, got %d %v", len(migrations), version, err)
+	}
+
+	again, err := s.GetStatTypes(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(again, statTypes) {
+		t.Errorf("expected the key stat types to be unchanged\n%+v\ngot\n%+v", statTypes, again)
+	}
+
+	if _, err := s.GetProfileByAreaCode(ctx, "E05011362"); err != nil {
+		t.Errorf("expected the area profile to be kept, got %v", err)
+	}
+}
+
+func TestMigrateDownAndUp(t *testing.T) {
+	ctx := context.Background()
+	s := newPostgresStore(t)
+
+	migrations, err := store.Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statTypes, err := s.GetStatTypes(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// roll back each migration in turn.
+	for expected := len(migrations) - 1; expected >= 0; expected-- {
+		if err := s.MigrateDown(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if version, err := s.SchemaVersion(ctx); err != nil || version != expected {
+			t.Fatalf("expected schema version %d, got %d %v", expected, version, err)
+		}
+	}
+
+	// rolling back an empty schema does nothing.
+	if err := s.MigrateDown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// apply each migration in turn.
+	for target := 1; target <= len(migrations); target++ {
+		if err := s.MigrateTo(ctx, target); err != nil {
+			t.Fatal(err)
+		}
+
+		if version, err := s.SchemaVersion(ctx); err != nil || version != target {
+			t.Fatalf("expected schema version %d, got %d %v", target, version, err)
+		}
+	}
+
+	again, err := s.GetStatTypes(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(again) != len(statTypes) {
+		t.Errorf("expected the %d default key stat types to be added again, got %d", len(statTypes), len(again))
+	}
+
+	if err := s.MigrateTo(ctx, len(migrations)+1); err == nil {
+		t.Error("expected an error migrating to a version that does not exist")
+	}
+}
+
+func TestInitResetLegacySchema(t *testing.T) {
+	ctx := context.Background()
+	s := newPostgresStore(t)
+
+	migrations, err := store.Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a database created before schema migrations were introduced has tables but no applied migrations.
+	if err := s.ResetSchema(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	execSQL(t, legacySchemaSQL)
+
+	if version, err := s.SchemaVersion(ctx); err != nil || version != 0 {
+		t.Fatalf("expected schema version 0, got %d %v", version, err)
+	}
+
+	if err := s.Init(ctx, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if version, err := s.SchemaVersion(ctx); err != nil || version != len(migrations) {
+		t.Errorf("expected schema version %d, got %d %v", len(migrations), version, err)
+	}
+
+	profiles, err := s.GetAreaProfiles(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(profiles) != 0 {
+		t.Errorf("expected the legacy area profiles to be dropped, got %+v", profiles)
+	}
+
+	if _, err := s.GetStatTypeByName(ctx, "Legacy key stat"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("expected the legacy key stat types to be dropped, got %v", err)
+	}
+}
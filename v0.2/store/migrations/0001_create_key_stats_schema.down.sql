@@ -0,0 +1,4 @@
+-- 
+-- Drops the v0.2 area profiles schema. Sequences are owned by their tables so are dropped with them.
+-- 
+DROP TABLE IF EXISTS key_stats_history, key_stats, key_stat_types, area_profiles, areas CASCADE;
@@ -0,0 +1,64 @@
+-- 
+-- Creates the v0.2 area profiles schema: areas, area profiles, key stat types, key stats and key stats history.
+-- IF NOT EXISTS is used throughout so databases created before migrations were introduced can be adopted.
+-- 
+CREATE TABLE IF NOT EXISTS areas (
+    code VARCHAR (50) PRIMARY KEY NOT NULL,
+    name VARCHAR (100) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS area_profiles (
+    profile_id INT PRIMARY KEY NOT NULL, 
+    area_code VARCHAR(50) NOT NULL, 
+    name VARCHAR (100) NOT NULL, 
+    UNIQUE (area_code), 
+    CONSTRAINT fk_area_code 
+        FOREIGN KEY (area_code) REFERENCES areas (code)
+);
+
+CREATE SEQUENCE IF NOT EXISTS area_profile_id START 1000 INCREMENT 100 MINVALUE 1000 OWNED BY area_profiles.profile_id;
+
+CREATE TABLE IF NOT EXISTS key_stat_types (
+    type_id INT PRIMARY KEY NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    UNIQUE (name)
+);
+
+CREATE SEQUENCE IF NOT EXISTS key_stat_type_id START 1000 INCREMENT 100 MINVALUE 1000 OWNED BY key_stat_types.type_id;
+
+CREATE TABLE IF NOT EXISTS key_stats (
+    stat_id INT PRIMARY KEY NOT NULL, 
+    profile_id INT NOT NULL,
+    stat_type INT NOT NULL, 
+    value VARCHAR(100) NOT NULL, 
+    unit VARCHAR(25) NOT NULL, 
+    date_created TIMESTAMP NOT NULL, 
+    dataset_id VARCHAR(100) NOT NULL, 
+    dataset_name VARCHAR(100) NOT NULL, 
+    UNIQUE (profile_id, stat_type), 
+    CONSTRAINT fk_profile_id 
+        FOREIGN KEY (profile_id) REFERENCES area_profiles (profile_id),
+    CONSTRAINT fk_stat_type 
+        FOREIGN KEY (stat_type) REFERENCES key_stat_types (type_id) 
+);
+
+CREATE SEQUENCE IF NOT EXISTS key_stat_id START 1000 INCREMENT 100 MINVALUE 1000 OWNED BY key_stats.stat_id;
+
+CREATE TABLE IF NOT EXISTS key_stats_history (
+    stat_id INT PRIMARY KEY NOT NULL, 
+    profile_id INT NOT NULL, 
+    stat_type INT NOT NULL,  
+    value VARCHAR(100) NOT NULL, 
+    unit VARCHAR(25) NOT NULL, 
+    date_created TIMESTAMP NOT NULL, 
+    last_modified TIMESTAMP NOT NULL, 
+    dataset_id VARCHAR(100) NOT NULL, 
+    dataset_name VARCHAR(100) NOT NULL, 
+    UNIQUE (profile_id, last_modified, stat_type), 
+    CONSTRAINT fk_profile_id 
+        FOREIGN KEY (profile_id) REFERENCES area_profiles (profile_id),
+    CONSTRAINT fk_stat_type 
+        FOREIGN KEY (stat_type) REFERENCES key_stat_types (type_id)
+);
+
+CREATE SEQUENCE IF NOT EXISTS key_stat_history_id START 1000 INCREMENT 100 MINVALUE 1000 OWNED BY key_stats_history.stat_id;
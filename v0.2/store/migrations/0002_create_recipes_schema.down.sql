@@ -0,0 +1 @@
+DROP TABLE IF EXISTS recipe_geographies, key_stats_recipes, geography_types CASCADE;
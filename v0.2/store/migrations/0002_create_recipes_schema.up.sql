@@ -0,0 +1,42 @@
+-- 
+-- Adds the v0.5 design: geography types, key stats recipes and the recipe_geographies junction table.
+-- 
+CREATE TABLE geography_types (
+    id INT PRIMARY KEY NOT NULL,
+    code VARCHAR(50) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    UNIQUE (code),
+    UNIQUE (name)
+);
+
+CREATE SEQUENCE geography_type_id START 1000 INCREMENT 100 MINVALUE 1000 OWNED BY geography_types.id;
+
+INSERT INTO geography_types (id, code, name) VALUES (nextval('geography_type_id'), 'OA', 'output area');
+INSERT INTO geography_types (id, code, name) VALUES (nextval('geography_type_id'), 'LSOA', 'lower layer super output area');
+INSERT INTO geography_types (id, code, name) VALUES (nextval('geography_type_id'), 'MSOA', 'middle layer super output area');
+INSERT INTO geography_types (id, code, name) VALUES (nextval('geography_type_id'), 'LAD', 'local authority district');
+
+CREATE TABLE key_stats_recipes (
+    recipe_id INT PRIMARY KEY NOT NULL,
+    dataset_id VARCHAR(100) NOT NULL,
+    dataset_edition VARCHAR(100) NOT NULL,
+    cantabular_query TEXT NOT NULL,
+    stat_type INT NOT NULL,
+    CONSTRAINT fk_stat_type 
+        FOREIGN KEY (stat_type) REFERENCES key_stat_types (type_id)
+);
+
+CREATE SEQUENCE recipe_id START 1000 INCREMENT 100 MINVALUE 1000 OWNED BY key_stats_recipes.recipe_id;
+
+CREATE TABLE recipe_geographies (
+    id INT PRIMARY KEY NOT NULL,
+    recipe_id INT NOT NULL,
+    geography_type_id INT NOT NULL,
+    UNIQUE (recipe_id, geography_type_id),
+    CONSTRAINT fk_recipe_id 
+        FOREIGN KEY (recipe_id) REFERENCES key_stats_recipes (recipe_id) ON DELETE CASCADE,
+    CONSTRAINT fk_geography_type_id
+        FOREIGN KEY (geography_type_id) REFERENCES geography_types (id)
+);
+
+CREATE SEQUENCE recipe_geography_id START 1000 INCREMENT 100 MINVALUE 1000 OWNED BY recipe_geographies.id;
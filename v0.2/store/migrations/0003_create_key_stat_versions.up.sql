@@ -0,0 +1,29 @@
+-- 
+-- Adds key stat versions as a first class entity. Each version has a sequential number per area profile.
+-- Versions are backfilled from the distinct key_stats_history.date_created timestamps of each profile.
+-- 
+CREATE TABLE key_stat_versions (
+    version_id INT PRIMARY KEY NOT NULL,
+    profile_id INT NOT NULL,
+    version_number INT NOT NULL,
+    date_created TIMESTAMP NOT NULL,
+    label VARCHAR(100) NOT NULL DEFAULT '',
+    source VARCHAR(255) NOT NULL DEFAULT '',
+    UNIQUE (profile_id, version_number),
+    UNIQUE (profile_id, date_created),
+    CONSTRAINT fk_profile_id 
+        FOREIGN KEY (profile_id) REFERENCES area_profiles (profile_id)
+);
+
+CREATE SEQUENCE key_stat_version_id START 1000 INCREMENT 100 MINVALUE 1000 OWNED BY key_stat_versions.version_id;
+
+INSERT INTO key_stat_versions (version_id, profile_id, version_number, date_created)
+SELECT 
+    nextval('key_stat_version_id'), 
+    v.profile_id, 
+    ROW_NUMBER() OVER (PARTITION BY v.profile_id ORDER BY v.date_created), 
+    v.date_created
+FROM 
+    (SELECT DISTINCT profile_id, date_created FROM key_stats_history) v
+ORDER BY 
+    v.profile_id, v.date_created;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_areas_parent_code;
+
+ALTER TABLE areas 
+    DROP COLUMN IF EXISTS parent_code,
+    DROP COLUMN IF EXISTS geography_type_id;
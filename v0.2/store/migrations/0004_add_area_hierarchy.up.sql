@@ -0,0 +1,15 @@
+-- 
+-- Adds a geography type and parent area to areas so areas can be navigated hierarchically e.g. OA -> LSOA -> MSOA -> LAD.
+-- Both columns are nullable so existing areas remain valid.
+-- 
+ALTER TABLE areas 
+    ADD COLUMN geography_type_id INT NULL,
+    ADD COLUMN parent_code VARCHAR(50) NULL,
+    ADD CONSTRAINT fk_geography_type_id 
+        FOREIGN KEY (geography_type_id) REFERENCES geography_types (id),
+    ADD CONSTRAINT fk_parent_code 
+        FOREIGN KEY (parent_code) REFERENCES areas (code),
+    ADD CONSTRAINT chk_parent_code 
+        CHECK (parent_code <> code);
+
+CREATE INDEX idx_areas_parent_code ON areas (parent_code);
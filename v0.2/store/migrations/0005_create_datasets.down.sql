@@ -0,0 +1,17 @@
+DROP INDEX IF EXISTS idx_key_stats_dataset_id;
+
+ALTER TABLE key_stats 
+    DROP CONSTRAINT IF EXISTS fk_dataset_id,
+    ADD COLUMN dataset_name VARCHAR(100) NOT NULL DEFAULT '';
+
+ALTER TABLE key_stats_history 
+    DROP CONSTRAINT IF EXISTS fk_dataset_id,
+    ADD COLUMN dataset_name VARCHAR(100) NOT NULL DEFAULT '';
+
+UPDATE key_stats s SET dataset_name = d.name FROM datasets d WHERE d.id = s.dataset_id;
+UPDATE key_stats_history s SET dataset_name = d.name FROM datasets d WHERE d.id = s.dataset_id;
+
+ALTER TABLE key_stats ALTER COLUMN dataset_name DROP DEFAULT;
+ALTER TABLE key_stats_history ALTER COLUMN dataset_name DROP DEFAULT;
+
+DROP TABLE IF EXISTS datasets;
@@ -0,0 +1,38 @@
+-- 
+-- Adds datasets as a first class entity. Datasets are backfilled from the key stats and key stats history using the
+-- most recent dataset_name of each dataset_id and their editions from the key stats recipes. The duplicated
+-- dataset_name columns are replaced by foreign keys to the datasets table.
+-- 
+CREATE TABLE datasets (
+    id VARCHAR(100) PRIMARY KEY NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    editions VARCHAR(100)[] NOT NULL DEFAULT '{}',
+    release_date TIMESTAMP NULL
+);
+
+INSERT INTO datasets (id, name)
+SELECT DISTINCT ON (s.dataset_id) 
+    s.dataset_id, s.dataset_name
+FROM 
+    (SELECT dataset_id, dataset_name, date_created FROM key_stats 
+     UNION ALL 
+     SELECT dataset_id, dataset_name, date_created FROM key_stats_history) s
+ORDER BY 
+    s.dataset_id, s.date_created DESC;
+
+UPDATE datasets d SET editions = ARRAY(
+    SELECT DISTINCT r.dataset_edition FROM key_stats_recipes r WHERE r.dataset_id = d.id ORDER BY r.dataset_edition
+);
+
+ALTER TABLE key_stats 
+    DROP COLUMN dataset_name,
+    ADD CONSTRAINT fk_dataset_id 
+        FOREIGN KEY (dataset_id) REFERENCES datasets (id);
+
+ALTER TABLE key_stats_history 
+    DROP COLUMN dataset_name,
+    ADD CONSTRAINT fk_dataset_id 
+        FOREIGN KEY (dataset_id) REFERENCES datasets (id);
+
+CREATE INDEX idx_key_stats_dataset_id ON key_stats (dataset_id);
@@ -0,0 +1,10 @@
+ALTER TABLE key_stat_types 
+    DROP CONSTRAINT IF EXISTS chk_replaced_by,
+    DROP CONSTRAINT IF EXISTS chk_status,
+    DROP CONSTRAINT IF EXISTS fk_replaced_by,
+    DROP COLUMN IF EXISTS replaced_by,
+    DROP COLUMN IF EXISTS status,
+    DROP COLUMN IF EXISTS display_order,
+    DROP COLUMN IF EXISTS default_unit,
+    DROP COLUMN IF EXISTS category,
+    DROP COLUMN IF EXISTS description;
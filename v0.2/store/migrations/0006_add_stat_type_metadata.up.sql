@@ -0,0 +1,49 @@
+-- 
+-- Manages key stat types as data. Adds a description, category, default unit, display order and status to each key
+-- stat type and seeds the default key stat types, previously inserted by the seed command. A replaced key stat type
+-- references the key stat type that replaces it.
+-- 
+ALTER TABLE key_stat_types 
+    ADD COLUMN description TEXT NOT NULL DEFAULT '',
+    ADD COLUMN category VARCHAR(100) NOT NULL DEFAULT '',
+    ADD COLUMN default_unit VARCHAR(25) NOT NULL DEFAULT '',
+    ADD COLUMN display_order INT NOT NULL DEFAULT 0,
+    ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'active',
+    ADD COLUMN replaced_by INT NULL,
+    ADD CONSTRAINT fk_replaced_by 
+        FOREIGN KEY (replaced_by) REFERENCES key_stat_types (type_id),
+    ADD CONSTRAINT chk_status 
+        CHECK (status IN ('active', 'deprecated', 'replaced')),
+    ADD CONSTRAINT chk_replaced_by 
+        CHECK ((status = 'replaced') = (replaced_by IS NOT NULL) AND replaced_by <> type_id);
+
+INSERT INTO key_stat_types (type_id, name) VALUES (nextval('key_stat_type_id'), 'Resident population') ON CONFLICT (name) DO NOTHING;
+INSERT INTO key_stat_types (type_id, name) VALUES (nextval('key_stat_type_id'), 'Population density (Hectares)') ON CONFLICT (name) DO NOTHING;
+INSERT INTO key_stat_types (type_id, name) VALUES (nextval('key_stat_type_id'), 'Average (mean) age') ON CONFLICT (name) DO NOTHING;
+INSERT INTO key_stat_types (type_id, name) VALUES (nextval('key_stat_type_id'), 'People think their general health is good') ON CONFLICT (name) DO NOTHING;
+INSERT INTO key_stat_types (type_id, name) VALUES (nextval('key_stat_type_id'), 'Households where English is not the main language') ON CONFLICT (name) DO NOTHING;
+INSERT INTO key_stat_types (type_id, name) VALUES (nextval('key_stat_type_id'), 'Households owned with a mortgage, loan or shared ownership') ON CONFLICT (name) DO NOTHING;
+
+UPDATE key_stat_types t SET 
+    description = v.description, 
+    category = v.category, 
+    default_unit = v.default_unit, 
+    display_order = v.display_order
+FROM (VALUES 
+    ('Resident population', 'The number of usual residents of the area', 'Population', '', 1),
+    ('Population density (Hectares)', 'The number of usual residents per hectare', 'Population', 'per hectare', 2),
+    ('Average (mean) age', 'The mean age of usual residents', 'Population', 'years', 3),
+    ('People think their general health is good', 'The percentage of usual residents reporting good or very good general health', 'Health', '%', 4),
+    ('Households where English is not the main language', 'The percentage of households where no adult has English as a main language', 'Language', '%', 5),
+    ('Households owned with a mortgage, loan or shared ownership', 'The percentage of households owned with a mortgage, loan or shared ownership', 'Housing', '%', 6)
+) AS v (name, description, category, default_unit, display_order)
+WHERE 
+    t.name = v.name;
+
+-- Any other existing key stat types are ordered after the defaults.
+UPDATE key_stat_types t SET 
+    display_order = o.display_order
+FROM 
+    (SELECT type_id, 6 + ROW_NUMBER() OVER (ORDER BY type_id) AS display_order FROM key_stat_types WHERE display_order = 0) o
+WHERE 
+    t.type_id = o.type_id;
@@ -0,0 +1,16 @@
+ALTER TABLE key_stat_types 
+    DROP CONSTRAINT IF EXISTS fk_default_unit,
+    DROP CONSTRAINT IF EXISTS chk_value_precision,
+    DROP CONSTRAINT IF EXISTS chk_value_type,
+    DROP COLUMN IF EXISTS value_precision,
+    DROP COLUMN IF EXISTS value_type;
+
+ALTER TABLE key_stats_history 
+    DROP CONSTRAINT IF EXISTS fk_unit,
+    ALTER COLUMN value TYPE VARCHAR(100) USING value::TEXT;
+
+ALTER TABLE key_stats 
+    DROP CONSTRAINT IF EXISTS fk_unit,
+    ALTER COLUMN value TYPE VARCHAR(100) USING value::TEXT;
+
+DROP TABLE IF EXISTS units;
@@ -0,0 +1,82 @@
+-- 
+-- Stores key stat values as numbers. Each key stat type has a value type (count, percentage, rate or mean) and the
+-- number of decimal places values are displayed with. Units become a reference table, the blank unit is used for
+-- values without a unit. Any units already in use are added to the units table.
+-- 
+-- Migrating fails if any existing key stat value is not a number, ignoring white space, thousands separators and a
+-- percent sign. Such values must be corrected or removed first.
+-- 
+CREATE TABLE units (
+    code VARCHAR(25) PRIMARY KEY NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    symbol VARCHAR(25) NOT NULL DEFAULT ''
+);
+
+INSERT INTO units (code, name, symbol) VALUES ('', 'No unit', '');
+INSERT INTO units (code, name, symbol) VALUES ('%', 'Percent', '%');
+INSERT INTO units (code, name, symbol) VALUES ('people', 'People', 'people');
+INSERT INTO units (code, name, symbol) VALUES ('households', 'Households', 'households');
+INSERT INTO units (code, name, symbol) VALUES ('per hectare', 'People per hectare', 'per hectare');
+INSERT INTO units (code, name, symbol) VALUES ('years', 'Years', 'years');
+
+INSERT INTO units (code, name, symbol)
+SELECT DISTINCT 
+    u.unit, u.unit, u.unit
+FROM 
+    (SELECT unit FROM key_stats 
+     UNION SELECT unit FROM key_stats_history 
+     UNION SELECT default_unit FROM key_stat_types) u
+ON CONFLICT (code) DO NOTHING;
+
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM key_stats WHERE regexp_replace(value, '[\s,%]', '', 'g') !~ '^[-+]?[0-9]+(\.[0-9]+)?$'
+        UNION ALL
+        SELECT 1 FROM key_stats_history WHERE regexp_replace(value, '[\s,%]', '', 'g') !~ '^[-+]?[0-9]+(\.[0-9]+)?$'
+    ) THEN
+        RAISE EXCEPTION 'key stats with non-numeric values must be corrected or removed before migrating';
+    END IF;
+END $$;
+
+ALTER TABLE key_stats 
+    ALTER COLUMN value TYPE NUMERIC USING regexp_replace(value, '[\s,%]', '', 'g')::NUMERIC,
+    ADD CONSTRAINT fk_unit 
+        FOREIGN KEY (unit) REFERENCES units (code);
+
+ALTER TABLE key_stats_history 
+    ALTER COLUMN value TYPE NUMERIC USING regexp_replace(value, '[\s,%]', '', 'g')::NUMERIC,
+    ADD CONSTRAINT fk_unit 
+        FOREIGN KEY (unit) REFERENCES units (code);
+
+ALTER TABLE key_stat_types 
+    ADD COLUMN value_type VARCHAR(20) NOT NULL DEFAULT 'count',
+    ADD COLUMN value_precision INT NOT NULL DEFAULT 0,
+    ADD CONSTRAINT chk_value_type 
+        CHECK (value_type IN ('count', 'percentage', 'rate', 'mean')),
+    ADD CONSTRAINT chk_value_precision 
+        CHECK (value_precision BETWEEN 0 AND 6),
+    ADD CONSTRAINT fk_default_unit 
+        FOREIGN KEY (default_unit) REFERENCES units (code);
+
+UPDATE key_stat_types t SET 
+    value_type = v.value_type, 
+    value_precision = v.value_precision
+FROM (VALUES 
+    ('Resident population', 'count', 0),
+    ('Population density (Hectares)', 'rate', 1),
+    ('Average (mean) age', 'mean', 1),
+    ('People think their general health is good', 'percentage', 1),
+    ('Households where English is not the main language', 'percentage', 1),
+    ('Households owned with a mortgage, loan or shared ownership', 'percentage', 1)
+) AS v (name, value_type, value_precision)
+WHERE 
+    t.name = v.name;
+
+-- Other existing key stat types with fractional values are treated as means.
+UPDATE key_stat_types t SET 
+    value_type = 'mean', 
+    value_precision = 2
+WHERE 
+    t.value_type = 'count' 
+    AND EXISTS (SELECT 1 FROM key_stats_history s WHERE s.stat_type = t.type_id AND s.value <> trunc(s.value));
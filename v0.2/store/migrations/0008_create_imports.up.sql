@@ -0,0 +1,30 @@
+-- 
+-- Adds the imports ledger. Each attempt to import a data file is recorded with the checksum of the file, the row counts, 
+-- the outcome and the date created of the key stats versions it created. An import of a file with the same checksum as
+-- a completed import is skipped and references the completed import.
+-- 
+CREATE TABLE imports (
+    id INT PRIMARY KEY NOT NULL,
+    file_name VARCHAR(255) NOT NULL,
+    checksum CHAR(64) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    row_count INT NOT NULL DEFAULT 0,
+    loaded INT NOT NULL DEFAULT 0,
+    rejected INT NOT NULL DEFAULT 0,
+    inserted INT NOT NULL DEFAULT 0,
+    updated INT NOT NULL DEFAULT 0,
+    unchanged INT NOT NULL DEFAULT 0,
+    started_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP NOT NULL,
+    version TIMESTAMP NULL,
+    duplicate_of INT NULL,
+    error TEXT NOT NULL DEFAULT '',
+    CONSTRAINT chk_status 
+        CHECK (status IN ('completed', 'failed', 'skipped')),
+    CONSTRAINT fk_duplicate_of 
+        FOREIGN KEY (duplicate_of) REFERENCES imports (id)
+);
+
+CREATE SEQUENCE import_id START 1000 INCREMENT 100 MINVALUE 1000 OWNED BY imports.id;
+
+CREATE INDEX idx_imports_checksum ON imports (checksum) WHERE status = 'completed';
@@ -0,0 +1,4 @@
+DELETE FROM key_stats_history WHERE deleted;
+
+ALTER TABLE key_stats_history 
+    DROP COLUMN IF EXISTS deleted;
@@ -0,0 +1,7 @@
+-- 
+-- Records deleted key stats in the key stats history instead of deleting the history. Deleting the key stats of an
+-- area profile adds a deleted entry for each key stat dated with a new key stats version, earlier versions still
+-- return the key stats as they were.
+-- 
+ALTER TABLE key_stats_history 
+    ADD COLUMN deleted BOOLEAN NOT NULL DEFAULT false;
@@ -1,13 +1,86 @@
 package store
 
 import (
+	"fmt"
 	"time"
 )
 
-// KetStatType provides a unique identity of each type of key stat value.
+// KetStatType provides a unique identity of each type of key stat value. The descriptive fields are only populated when
+// the key stat type itself is requested, references to a key stat type only include the ID and name.
 type KeyStatType struct {
-	ID   int    `json:"id"`
-	Name string `json:"name"`
+	ID           int    `json:"type_id"`
+	Name         string `json:"name"`
+	Description  string `json:"description,omitempty"`
+	Category     string `json:"category,omitempty"`
+	DefaultUnit  string `json:"default_unit,omitempty"`
+	DisplayOrder int    `json:"display_order,omitempty"`
+	Status       string `json:"status,omitempty"`
+	// ValueType is how values of this type are validated, one of count, percentage, rate or mean.
+	ValueType string `json:"value_type,omitempty"`
+	// Precision is the number of decimal places values of this type are displayed with.
+	Precision int `json:"precision,omitempty"`
+	// ReplacedBy is the ID of the key stat type replacing this type, only set if the status is replaced.
+	ReplacedBy *int   `json:"replaced_by,omitempty"`
+	Href       string `json:"href,omitempty"`
+}
+
+// Key stat type statuses.
+const (
+	StatTypeActive     = "active"
+	StatTypeDeprecated = "deprecated"
+	StatTypeReplaced   = "replaced"
+)
+
+// StatTypeStatuses returns the valid key stat type statuses.
+func StatTypeStatuses() []string {
+	return []string{StatTypeActive, StatTypeDeprecated, StatTypeReplaced}
+}
+
+// SetHref sets the href of the key stat type.
+func (t *KeyStatType) SetHref() {
+	t.Href = fmt.Sprintf("http://localhost:8080/stat-types/%d", t.ID)
+}
+
+// Unit is a unit key stat values are measured in. The symbol is appended to values when they are displayed.
+type Unit struct {
+	Code   string `json:"code"`
+	Name   string `json:"name"`
+	Symbol string `json:"symbol"`
+}
+
+// Area is a domain representation of a geographical area.
+type Area struct {
+	Code          string         `json:"code"`
+	Name          string         `json:"name"`
+	GeographyType *GeographyType `json:"geography_type,omitempty"`
+	ParentCode    string         `json:"parent_code,omitempty"`
+	Href          string         `json:"href"`
+	Links         AreaLinks      `json:"links"`
+}
+
+// SetLinks sets the href of the area and the links to its related areas and area profile.
+func (a *Area) SetLinks(hasProfile bool) {
+	a.Href = fmt.Sprintf("http://localhost:8080/areas/%s", a.Code)
+	a.Links = AreaLinks{
+		Children:  a.Href + "/children",
+		Ancestors: a.Href + "/ancestors",
+	}
+
+	if a.ParentCode != "" {
+		a.Links.Parent = fmt.Sprintf("http://localhost:8080/areas/%s", a.ParentCode)
+	}
+
+	if hasProfile {
+		a.Links.Profile = fmt.Sprintf("http://localhost:8080/profiles/%s", a.Code)
+	}
+}
+
+// AreaLinks are links to the areas related to an area in the geography hierarchy and to its area profile.
+type AreaLinks struct {
+	Parent    string `json:"parent,omitempty"`
+	Children  string `json:"children"`
+	Ancestors string `json:"ancestors"`
+	Profile   string `json:"profile,omitempty"`
 }
 
 // AreaProfile is a domain representation of a geographical area profile.
@@ -28,13 +101,21 @@ type KeyStatistic struct {
 	ProfileID    int                  `json:"-"`
 	AreaCode     string               `json:"area_code"`
 	Name         string               `json:"name"`
-	Value        string               `json:"value"`
+	Value        float64              `json:"value"`
+	ValueType    string               `json:"value_type"`
+	Precision    int                  `json:"precision"`
 	Unit         string               `json:"unit"`
+	Display      string               `json:"display"`
 	DateCreated  time.Time            `json:"date_created"`
 	LastModified time.Time            `json:"last_modified,omitempty"`
 	Metadata     KeyStatisticMetadata `json:"metadata,omitempty"`
 }
 
+// SetDisplay sets the display string of the key stat from its value, precision and the symbol of its unit.
+func (s *KeyStatistic) SetDisplay(symbol string) {
+	s.Display = FormatValue(s.Value, s.Precision, symbol)
+}
+
 // KeyStatisticMetadata is a domain model representing metadata associated with a KeyStatistic
 type KeyStatisticMetadata struct {
 	DatasetID   string `json:"dataset_id"`
@@ -44,31 +125,162 @@ type KeyStatisticMetadata struct {
 
 type KeyStatisticVersions struct {
 	AreaProfile
-	Versions []time.Time `json:"versions"`
+	Versions []KeyStatVersion `json:"versions"`
+}
+
+// KeyStatVersion is a version of the key stats of an area profile. Versions are numbered sequentially per area profile.
+type KeyStatVersion struct {
+	Version     int       `json:"version"`
+	DateCreated time.Time `json:"date_created"`
+	Label       string    `json:"label"`
+	Source      string    `json:"source"`
+	Href        string    `json:"href"`
+}
+
+// KeyStatHistory is the time series of values of a single key statistic for an area profile.
+type KeyStatHistory struct {
+	AreaCode string                `json:"area_code"`
+	StatType int                   `json:"stat_type"`
+	Name     string                `json:"name"`
+	History  []KeyStatHistoryEntry `json:"history"`
+}
+
+// KeyStatHistoryEntry is a historical value of a key statistic.
+type KeyStatHistoryEntry struct {
+	Version     int                  `json:"version"`
+	Value       float64              `json:"value"`
+	Unit        string               `json:"unit"`
+	Display     string               `json:"display"`
+	DateCreated time.Time            `json:"date_created"`
+	Metadata    KeyStatisticMetadata `json:"metadata"`
+	// AbsoluteChange is the change from the previous value. Not set for the first entry.
+	AbsoluteChange *float64 `json:"absolute_change,omitempty"`
+	// PercentageChange is the change as a percentage of the previous value. Not set for the first entry or if the previous value is 0.
+	PercentageChange *float64 `json:"percentage_change,omitempty"`
 }
 
 // KeyStatsRecipe is a type encapslating the import job for a new dataset version notification.
 // It specifies what Cantabular query to run, which geographies it affected too and which key stat type the query results represent.
 type KeyStatsRecipe struct {
 	// Unique ID for the recipe
-	ID int
+	ID int `json:"id"`
 	// The Dataset ID the recipe allies to.
-	DatasetID string
+	DatasetID string `json:"dataset_id"`
 	// The Dataset Edition the recipe applies to.
-	DatasetEdition string
+	DatasetEdition string `json:"dataset_edition"`
 	// A Cantabular query template to execute for this recipe.
-	CantabularQuery string
+	CantabularQuery string `json:"query"`
 	// The Key Stat type the query results represent to i.e. Resident Population
-	StatType int
-	// The Geography types this recipe applies to.
-	Geographies []GeographyType
+	StatType KeyStatType `json:"stat_type"`
+	// The names of the Geography types this recipe applies to.
+	Geographies []string `json:"geographies"`
+	Href        string   `json:"href,omitempty"`
 }
 
 type GeographyType struct {
 	// ID is an internal ID to uniquely identify a geography
-	ID int
+	ID int `json:"id"`
 	// Code is the hierarchy code assigned to this geography type.
-	Code string
+	Code string `json:"code"`
 	// The display name of the geography.
-	Name string
+	Name string `json:"name"`
+}
+
+// Dataset is a domain representation of a dataset key stats are sourced from.
+type Dataset struct {
+	ID          string       `json:"id"`
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Editions    []string     `json:"editions"`
+	ReleaseDate *time.Time   `json:"release_date,omitempty"`
+	Href        string       `json:"href"`
+	Links       DatasetLinks `json:"links"`
+}
+
+// SetLinks sets the href of the dataset and the link to the key stats it feeds.
+func (d *Dataset) SetLinks() {
+	d.Href = fmt.Sprintf("http://localhost:8080/datasets/%s", d.ID)
+	d.Links = DatasetLinks{Stats: d.Href + "/stats"}
+}
+
+// DatasetLinks are links to the resources related to a dataset.
+type DatasetLinks struct {
+	Stats string `json:"stats"`
+}
+
+// DatasetStats lists the area profiles and key stat types a dataset is the source of the current key stats of.
+type DatasetStats struct {
+	DatasetID string           `json:"dataset_id"`
+	StatTypes []KeyStatType    `json:"stat_types"`
+	Profiles  []DatasetProfile `json:"profiles"`
+}
+
+// DatasetProfile is an area profile with current key stats from a dataset.
+type DatasetProfile struct {
+	AreaCode  string        `json:"area_code"`
+	Name      string        `json:"name"`
+	Href      string        `json:"href"`
+	StatTypes []KeyStatType `json:"stat_types"`
+}
+
+// AddStat adds the key stat type of an area profile to the dataset stats. Stats must be added in area code order.
+func (s *DatasetStats) AddStat(areaCode, profileName string, statType KeyStatType) {
+	n := len(s.Profiles)
+	if n == 0 || s.Profiles[n-1].AreaCode != areaCode {
+		s.Profiles = append(s.Profiles, DatasetProfile{
+			AreaCode:  areaCode,
+			Name:      profileName,
+			Href:      fmt.Sprintf("http://localhost:8080/profiles/%s", areaCode),
+			StatTypes: make([]KeyStatType, 0),
+		})
+		n++
+	}
+
+	s.Profiles[n-1].StatTypes = append(s.Profiles[n-1].StatTypes, statType)
+
+	for _, t := range s.StatTypes {
+		if t.ID == statType.ID {
+			return
+		}
+	}
+	s.StatTypes = append(s.StatTypes, statType)
+}
+
+// Import statuses.
+const (
+	ImportCompleted = "completed"
+	ImportFailed    = "failed"
+	ImportSkipped   = "skipped"
+)
+
+// ImportStatuses returns the valid import statuses.
+func ImportStatuses() []string {
+	return []string{ImportCompleted, ImportFailed, ImportSkipped}
+}
+
+// Import is an entry in the imports ledger recording an attempt to import a data file. Version is the date created of
+// the key stats versions created by a completed import. DuplicateOf is the ID of the completed import of the same file
+// a skipped import duplicates.
+type Import struct {
+	ID          int        `json:"id"`
+	File        string     `json:"file"`
+	Checksum    string     `json:"checksum"`
+	Status      string     `json:"status"`
+	Rows        int        `json:"rows"`
+	Loaded      int        `json:"loaded"`
+	Rejected    int        `json:"rejected"`
+	Inserted    int        `json:"inserted"`
+	Updated     int        `json:"updated"`
+	Unchanged   int        `json:"unchanged"`
+	StartedAt   time.Time  `json:"started_at"`
+	FinishedAt  time.Time  `json:"finished_at"`
+	Version     *time.Time `json:"version,omitempty"`
+	DuplicateOf *int       `json:"duplicate_of,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	Href        string     `json:"href"`
+}
+
+// SetHref sets the href of the import.
+func (i *Import) SetHref() {
+	i.Href = fmt.Sprintf("http://localhost:8080/imports/%d", i.ID)
 }
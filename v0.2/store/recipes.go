@@ -0,0 +1,290 @@
+package store
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+)
+
+// Key stats recipe queries/statements.
+var (
+	// getRecipesSQL SQL query returns the key stats recipes with their stat type and geography type names optionally
+	// filtered by dataset ID and edition. A blank filter value matches every recipe.
+	getRecipesSQL = `
+		SELECT
+			r.recipe_id, r.dataset_id, r.dataset_edition, r.cantabular_query, t.type_id, t.name,
+			COALESCE(array_agg(g.name ORDER BY g.id) FILTER (WHERE g.id IS NOT NULL), '{}')
+		FROM
+			key_stats_recipes r
+		INNER JOIN
+			key_stat_types t
+		ON
+			t.type_id = r.stat_type
+		LEFT JOIN
+			recipe_geographies rg
+		ON
+			rg.recipe_id = r.recipe_id
+		LEFT JOIN
+			geography_types g
+		ON
+			g.id = rg.geography_type_id
+		WHERE
+			($1 = '' OR r.dataset_id = $1) AND ($2 = '' OR r.dataset_edition = $2)
+		GROUP BY
+			r.recipe_id, t.type_id
+		ORDER BY
+			r.recipe_id;
+	`
+
+	// getRecipeSQL SQL query returns the key stats recipe with the specified ID.
+	getRecipeSQL = `
+		SELECT
+			r.recipe_id, r.dataset_id, r.dataset_edition, r.cantabular_query, t.type_id, t.name,
+			COALESCE(array_agg(g.name ORDER BY g.id) FILTER (WHERE g.id IS NOT NULL), '{}')
+		FROM
+			key_stats_recipes r
+		INNER JOIN
+			key_stat_types t
+		ON
+			t.type_id = r.stat_type
+		LEFT JOIN
+			recipe_geographies rg
+		ON
+			rg.recipe_id = r.recipe_id
+		LEFT JOIN
+			geography_types g
+		ON
+			g.id = rg.geography_type_id
+		WHERE
+			r.recipe_id = $1
+		GROUP BY
+			r.recipe_id, t.type_id;
+	`
+
+	// getStatTypeSQL SQL query returns the key stat type with the specified ID or, if there is no key stat type with the
+	// ID, the name ignoring case.
+	getStatTypeSQL = `
+		SELECT
+			type_id, name
+		FROM
+			key_stat_types
+		WHERE
+			type_id = $1 OR LOWER(name) = LOWER($2)
+		ORDER BY
+			type_id = $1 DESC, type_id
+		LIMIT 1;
+	`
+
+	// insertRecipeSQL SQL statement to insert a key stats recipe.
+	insertRecipeSQL = `
+		INSERT INTO key_stats_recipes
+			(recipe_id, dataset_id, dataset_edition, cantabular_query, stat_type)
+		VALUES
+			(nextval('recipe_id'), $1, $2, $3, $4)
+		RETURNING recipe_id;
+	`
+
+	// updateRecipeSQL SQL statement to update a key stats recipe.
+	updateRecipeSQL = `
+		UPDATE
+			key_stats_recipes
+		SET
+			dataset_id = $2, dataset_edition = $3, cantabular_query = $4, stat_type = $5
+		WHERE
+			recipe_id = $1;
+	`
+
+	// deleteRecipeSQL SQL statement to delete a key stats recipe. Its recipe_geographies are deleted by cascade.
+	deleteRecipeSQL = `
+		DELETE FROM
+			key_stats_recipes
+		WHERE
+			recipe_id = $1;
+	`
+
+	// insertRecipeGeographySQL SQL statement to add a geography type to a key stats recipe.
+	insertRecipeGeographySQL = `
+		INSERT INTO recipe_geographies
+			(id, recipe_id, geography_type_id)
+		VALUES
+			(nextval('recipe_geography_id'), $1, $2)
+		ON CONFLICT (recipe_id, geography_type_id) DO NOTHING;
+	`
+
+	// deleteRecipeGeographiesSQL SQL statement to remove all geography types from a key stats recipe.
+	deleteRecipeGeographiesSQL = `
+		DELETE FROM
+			recipe_geographies
+		WHERE
+			recipe_id = $1;
+	`
+)
+
+// GetRecipes returns the key stats recipes for the dataset ID and edition. A blank dataset ID or edition matches every
+// recipe.
+func (s *AreaProfileStore) GetRecipes(ctx context.Context, datasetID, edition string) ([]KeyStatsRecipe, error) {
+	conn, err := s.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, getRecipesSQL, datasetID, edition)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	recipes, err := recipesRowsMapper(rows)
+	if err != nil {
+		return nil, errors.Wrap(err, "error mapping recipe result rows")
+	}
+
+	return recipes, nil
+}
+
+// GetRecipe returns the key stats recipe with the specified ID.
+func (s *AreaProfileStore) GetRecipe(ctx context.Context, id int) (*KeyStatsRecipe, error) {
+	conn, err := s.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, getRecipeSQL, id)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	recipes, err := recipesRowsMapper(rows)
+	if err != nil {
+		return nil, errors.Wrap(err, "error mapping recipe result rows")
+	}
+
+	if len(recipes) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return &recipes[0], nil
+}
+
+// AddRecipe inserts a key stats recipe returning the new recipe ID. The stat type is specified by ID or, if there is no
+// key stat type with the ID, name ignoring case and each geography type by name or code. Returns ErrMissingReference if the stat type or any of the geography
+// types do not exist.
+func (s *AreaProfileStore) AddRecipe(ctx context.Context, recipe KeyStatsRecipe) (int, error) {
+	var recipeID int
+	err := s.InTransaction(ctx, func(tx Tx) error {
+		var err error
+		recipeID, err = tx.AddRecipe(ctx, recipe)
+		return err
+	})
+	return recipeID, err
+}
+
+// UpdateRecipe replaces the key stats recipe with the ID of the recipe provided including its geography types.
+func (s *AreaProfileStore) UpdateRecipe(ctx context.Context, recipe KeyStatsRecipe) error {
+	return s.InTransaction(ctx, func(tx Tx) error {
+		return tx.UpdateRecipe(ctx, recipe)
+	})
+}
+
+// AddRecipe inserts a key stats recipe and its geography types returning the new recipe ID.
+func (t *areaProfileTx) AddRecipe(ctx context.Context, recipe KeyStatsRecipe) (int, error) {
+	statType, err := getStatType(ctx, t.tx, recipe.StatType)
+	if err != nil {
+		return 0, err
+	}
+
+	var recipeID int
+	err = t.tx.QueryRow(ctx, insertRecipeSQL, recipe.DatasetID, recipe.DatasetEdition, recipe.CantabularQuery, statType).Scan(&recipeID)
+	if err != nil {
+		return 0, errors.Wrap(err, "error inserting recipe")
+	}
+
+	if err := insertRecipeGeographies(ctx, t.tx, recipeID, recipe.Geographies); err != nil {
+		return 0, err
+	}
+
+	return recipeID, nil
+}
+
+// UpdateRecipe replaces the key stats recipe with the ID of the recipe provided including its geography types.
+func (t *areaProfileTx) UpdateRecipe(ctx context.Context, recipe KeyStatsRecipe) error {
+	statType, err := getStatType(ctx, t.tx, recipe.StatType)
+	if err != nil {
+		return err
+	}
+
+	tag, err := t.tx.Exec(ctx, updateRecipeSQL, recipe.ID, recipe.DatasetID, recipe.DatasetEdition, recipe.CantabularQuery, statType)
+	if err != nil {
+		return errors.Wrapf(err, "error updating recipe %d", recipe.ID)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	if _, err := t.tx.Exec(ctx, deleteRecipeGeographiesSQL, recipe.ID); err != nil {
+		return errors.Wrapf(err, "error deleting geographies of recipe %d", recipe.ID)
+	}
+
+	return insertRecipeGeographies(ctx, t.tx, recipe.ID, recipe.Geographies)
+}
+
+// DeleteRecipe deletes the key stats recipe with the specified ID.
+func (s *AreaProfileStore) DeleteRecipe(ctx context.Context, id int) error {
+	conn, err := s.acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Release()
+
+	tag, err := conn.Exec(ctx, deleteRecipeSQL, id)
+	if err != nil {
+		return errors.Wrapf(err, "error deleting recipe %d", id)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// getStatType returns the ID of the key stat type with the ID or, if there is no key stat type with the ID, the name
+// ignoring case. Returns ErrMissingReference if there is no such key stat type.
+func getStatType(ctx context.Context, q querier, t KeyStatType) (int, error) {
+	var typeID int
+	var name string
+
+	err := q.QueryRow(ctx, getStatTypeSQL, t.ID, t.Name).Scan(&typeID, &name)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return 0, t.MissingReferenceError()
+		}
+		return 0, err
+	}
+
+	return typeID, nil
+}
+
+func insertRecipeGeographies(ctx context.Context, q querier, recipeID int, geographies []string) error {
+	for _, geography := range geographies {
+		g, err := getGeographyType(ctx, q, geography)
+		if err != nil {
+			return err
+		}
+
+		if _, err := q.Exec(ctx, insertRecipeGeographySQL, recipeID, g.ID); err != nil {
+			return errors.Wrapf(err, "error adding geography %q to recipe %d", geography, recipeID)
+		}
+	}
+
+	return nil
+}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"github.com/jackc/pgx/v4"
 	"github.com/pkg/errors"
-	"time"
 )
 
 // areaProfilesRowsMapper maps a postgres results rows to a list of AreaProfile structs
@@ -61,45 +60,190 @@ func keyStatisticsRowsMapper(p *AreaProfile, rows pgx.Rows) (KeyStatistics, erro
 
 func mapRowsToKeyStats(p *AreaProfile, rows pgx.Rows) (KeyStatistic, error) {
 	s := KeyStatistic{AreaCode: p.AreaCode}
+	var symbol string
 
-	if err := rows.Scan(&s.ProfileID, &s.StatID, &s.StatType, &s.Name, &s.Value, &s.Unit, &s.DateCreated, &s.Metadata.DatasetID, &s.Metadata.DatasetName); err != nil {
+	if err := rows.Scan(&s.ProfileID, &s.StatID, &s.StatType, &s.Name, &s.Value, &s.ValueType, &s.Precision, &s.Unit, &symbol, &s.DateCreated, &s.Metadata.DatasetID, &s.Metadata.DatasetName); err != nil {
 		return s, err
 	}
 
+	s.SetDisplay(symbol)
 	s.Metadata.Href = fmt.Sprintf("http://localhost:8080/datasets/%s", s.Metadata.DatasetID)
 
 	return s, nil
 }
 
-func mapRowToKeyStat(row pgx.Row) (KeyStatistic, error) {
-	s := KeyStatistic{}
+// keyStatVersionsRowsMapper maps postgres result rows to a list of KeyStatVersion
+func keyStatVersionsRowsMapper(p *AreaProfile, rows pgx.Rows) ([]KeyStatVersion, error) {
+	versions := make([]KeyStatVersion, 0)
 
-	if err := row.Scan(&s.ProfileID, &s.StatID, &s.StatType, &s.Name, &s.Value, &s.Unit, &s.DateCreated, &s.Metadata.DatasetID, &s.Metadata.DatasetName); err != nil {
-		return s, err
+	for rows.Next() {
+		v, err := mapRowToKeyStatVersion(p, rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "error scanning key stat version row")
+		}
+
+		versions = append(versions, *v)
 	}
 
-	s.Metadata.Href = fmt.Sprintf("http://localhost:8080/datasets/%s", s.Metadata.DatasetID)
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
 
-	return s, nil
+	return versions, nil
 }
 
-// versionsRowsMapper maps pgx.Rows results to an array of time.Time
-func versionsRowsMapper(rows pgx.Rows) ([]time.Time, error) {
-	versions := make([]time.Time, 0)
+func mapRowToKeyStatVersion(p *AreaProfile, row pgx.Row) (*KeyStatVersion, error) {
+	v := &KeyStatVersion{}
+
+	if err := row.Scan(&v.Version, &v.DateCreated, &v.Label, &v.Source); err != nil {
+		return nil, err
+	}
+
+	v.Href = fmt.Sprintf("http://localhost:8080/profiles/%s/stats/versions/%d", p.AreaCode, v.Version)
+	return v, nil
+}
+
+// areasRowsMapper maps postgres result rows to a list of Area structs. Expects the columns code, name, geography type
+// ID, code and name, parent code and whether the area has a profile.
+func areasRowsMapper(rows pgx.Rows) ([]Area, error) {
+	areas := make([]Area, 0)
 
 	for rows.Next() {
-		var dateCreated time.Time
+		var a Area
+		var g GeographyType
+		var hasProfile bool
 
-		if err := rows.Scan(&dateCreated); err != nil {
-			return nil, errors.Wrap(err, "error scanning date created into Time struct")
+		if err := rows.Scan(&a.Code, &a.Name, &g.ID, &g.Code, &g.Name, &a.ParentCode, &hasProfile); err != nil {
+			return nil, err
 		}
 
-		versions = append(versions, dateCreated)
+		if g.ID != 0 {
+			a.GeographyType = &g
+		}
+
+		a.SetLinks(hasProfile)
+		areas = append(areas, a)
 	}
 
 	if rows.Err() != nil {
 		return nil, rows.Err()
 	}
 
-	return versions, nil
+	return areas, nil
+}
+
+// recipesRowsMapper maps postgres result rows to a list of KeyStatsRecipe structs.
+func recipesRowsMapper(rows pgx.Rows) ([]KeyStatsRecipe, error) {
+	recipes := make([]KeyStatsRecipe, 0)
+
+	for rows.Next() {
+		var r KeyStatsRecipe
+		if err := rows.Scan(&r.ID, &r.DatasetID, &r.DatasetEdition, &r.CantabularQuery, &r.StatType.ID, &r.StatType.Name, &r.Geographies); err != nil {
+			return nil, err
+		}
+
+		r.Href = fmt.Sprintf("http://localhost:8080/recipes/%d", r.ID)
+		recipes = append(recipes, r)
+	}
+
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	return recipes, nil
+}
+
+// datasetsRowsMapper maps postgres result rows to a list of Dataset structs.
+func datasetsRowsMapper(rows pgx.Rows) ([]Dataset, error) {
+	datasets := make([]Dataset, 0)
+
+	for rows.Next() {
+		var d Dataset
+		if err := rows.Scan(&d.ID, &d.Name, &d.Description, &d.Editions, &d.ReleaseDate); err != nil {
+			return nil, err
+		}
+
+		d.SetLinks()
+		datasets = append(datasets, d)
+	}
+
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	return datasets, nil
+}
+
+// statTypesRowsMapper maps postgres result rows to a list of KeyStatType structs.
+func statTypesRowsMapper(rows pgx.Rows) ([]KeyStatType, error) {
+	types := make([]KeyStatType, 0)
+
+	for rows.Next() {
+		var t KeyStatType
+		if err := rows.Scan(&t.ID, &t.Name, &t.Description, &t.Category, &t.DefaultUnit, &t.DisplayOrder, &t.Status, &t.ReplacedBy, &t.ValueType, &t.Precision); err != nil {
+			return nil, err
+		}
+
+		t.SetHref()
+		types = append(types, t)
+	}
+
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	return types, nil
+}
+
+// unitsRowsMapper maps postgres result rows to a list of Unit structs.
+func unitsRowsMapper(rows pgx.Rows) ([]Unit, error) {
+	units := make([]Unit, 0)
+
+	for rows.Next() {
+		var u Unit
+		if err := rows.Scan(&u.Code, &u.Name, &u.Symbol); err != nil {
+			return nil, err
+		}
+
+		units = append(units, u)
+	}
+
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	return units, nil
+}
+
+// importsRowsMapper maps postgres result rows to a list of Import structs.
+func importsRowsMapper(rows pgx.Rows) ([]Import, error) {
+	imports := make([]Import, 0)
+
+	for rows.Next() {
+		i, err := mapRowToImport(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		imports = append(imports, *i)
+	}
+
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	return imports, nil
+}
+
+func mapRowToImport(row pgx.Row) (*Import, error) {
+	i := &Import{}
+
+	err := row.Scan(&i.ID, &i.File, &i.Checksum, &i.Status, &i.Rows, &i.Loaded, &i.Rejected, &i.Inserted, &i.Updated,
+		&i.Unchanged, &i.StartedAt, &i.FinishedAt, &i.Version, &i.DuplicateOf, &i.Error)
+	if err != nil {
+		return nil, err
+	}
+
+	i.SetHref()
+	return i, nil
 }
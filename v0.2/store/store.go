@@ -3,116 +3,189 @@ package store
 import (
 	"context"
 	"fmt"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/config"
 	log "github.com/daiLlew/funkylog"
-	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/pkg/errors"
+	"time"
 )
 
 var (
 	// ErrNotFound is an error to represent the state where the requested record does not exist.
 	ErrNotFound = errors.New("no rows exist matching your query parameters")
 
-	// dropSequencesSQL is an SQL statement to drop the sequences created by this demo.
-	dropSequencesSQL = "DROP SEQUENCE IF EXISTS area_profile_id, key_stats_id, key_stats_history_id, key_stat_version_id, key_stat_type_id"
+	// ErrConflict is an error returned when a record cannot be created because it already exists or cannot be deleted
+	// because other records depend on it.
+	ErrConflict = errors.New("record conflicts with the current state of the database")
 
-	// dropTablesSQL is an SQL statement to drop all tables created by this demo.
-	dropTablesSQL = "DROP TABLE IF EXISTS key_stats_history, key_stats, key_stat_types, area_profiles, areas CASCADE;"
+	// ErrMissingReference is an error returned when a record refers to another record that does not exist.
+	ErrMissingReference = errors.New("record references a record that does not exist")
 
-	statTypes = []string{
-		"Resident population",
-		"Population density (Hectares)",
-		"Average (mean) age",
-		"People think their general health is good",
-		"Households where English is not the main language",
-		"Households owned with a mortgage, loan or shared ownership",
-	}
+	// ErrInvalidValue is an error returned when a key stat value is not a number or is not valid for its value type.
+	ErrInvalidValue = errors.New("key stat value is not valid")
+
+	// ErrStatTypeNotActive is an error returned when a key stat value is written for a deprecated or replaced key stat
+	// type.
+	ErrStatTypeNotActive = errors.New("key stat type is not active")
+
+	// ErrConnUnavailable is an error returned when no database connection could be acquired from the pool before the acquire timeout expired.
+	ErrConnUnavailable = errors.New("timed out waiting for an available database connection")
 )
 
 // Store represents the area profiles data store.
 type Store interface {
-	Init(areaCode, areaName, areaProfileName string) error
-	GetAreaProfiles() ([]AreaProfile, error)
-	GetProfileByAreaCode(areaCode string) (*AreaProfile, error)
+	Init(ctx context.Context, reset bool) error
+	Seed(ctx context.Context, areaCode, areaName, areaProfileName string) error
+	GetAreaProfiles(ctx context.Context) ([]AreaProfile, error)
+	GetProfileByAreaCode(ctx context.Context, areaCode string) (*AreaProfile, error)
 	Close() error
 }
 
+// PoolStats is a snapshot of the state of the database connection pool.
+type PoolStats struct {
+	MaxConns             int32         `json:"max_conns"`
+	TotalConns           int32         `json:"total_conns"`
+	AcquiredConns        int32         `json:"acquired_conns"`
+	IdleConns            int32         `json:"idle_conns"`
+	ConstructingConns    int32         `json:"constructing_conns"`
+	AcquireCount         int64         `json:"acquire_count"`
+	EmptyAcquireCount    int64         `json:"empty_acquire_count"`
+	CanceledAcquireCount int64         `json:"canceled_acquire_count"`
+	AcquireDuration      time.Duration `json:"acquire_duration_ns"`
+}
+
+// AreaProfileStore is a postgres backed area profiles store. It is safe for concurrent use - each query checks out its
+// own connection from the pool.
 type AreaProfileStore struct {
-	conn *pgx.Conn
+	pool           *pgxpool.Pool
+	acquireTimeout time.Duration
 }
 
 // New construct a new Area profile store.
-func New(username, password, database string) (*AreaProfileStore, error) {
-	ctx := context.Background()
-	conn, err := pgx.Connect(ctx, fmt.Sprintf("postgres://%s:%s@localhost:5432/%s?sslmode=disable", username, password, database))
+func New(ctx context.Context, cfg *config.Config) (*AreaProfileStore, error) {
+	poolCfg, err := pgxpool.ParseConfig(fmt.Sprintf("postgres://%s:%s@localhost:5432/%s?sslmode=disable", cfg.Username, cfg.Password, cfg.Database))
 	if err != nil {
-		return nil, errors.Wrap(err, "error opening postgres connection")
+		return nil, errors.Wrap(err, "error parsing postgres connection config")
 	}
 
-	log.Info("successfully opened connection to database %q", database)
-	return &AreaProfileStore{conn: conn}, nil
+	poolCfg.MinConns = cfg.Pool.MinConns
+	poolCfg.MaxConns = cfg.Pool.MaxConns
+	poolCfg.HealthCheckPeriod = cfg.Pool.HealthCheckPeriod
+
+	pool, err := pgxpool.ConnectConfig(ctx, poolCfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "error opening postgres connection pool")
+	}
+
+	log.Info("successfully opened connection pool to database %q, min_conns=%d, max_conns=%d", cfg.Database, poolCfg.MinConns, poolCfg.MaxConns)
+	return &AreaProfileStore{pool: pool, acquireTimeout: cfg.Pool.AcquireTimeout}, nil
 }
 
-// Init is an initialisation function. If dropSchema is true any existing tables, data and sequences will be dropped and recreated. If false no action is taken.
-func (s *AreaProfileStore) Init(areaCode, areaName, areaProfileName string) error {
-	stmts := []string{
-		dropSequencesSQL,
-		dropTablesSQL,
+// acquire checks out a connection from the pool waiting at most acquireTimeout for one to become available. Callers
+// must release the connection once finished with it.
+func (s *AreaProfileStore) acquire(ctx context.Context) (*pgxpool.Conn, error) {
+	acquireCtx, cancel := context.WithTimeout(ctx, s.acquireTimeout)
+	defer cancel()
+
+	conn, err := s.pool.Acquire(acquireCtx)
+	if err != nil {
+		if ctx.Err() == nil && acquireCtx.Err() == context.DeadlineExceeded {
+			return nil, ErrConnUnavailable
+		}
+		return nil, errors.Wrap(err, "error acquiring connection from pool")
 	}
 
-	log.Info("dropping database schema")
-	if err := execStmts(context.Background(), s.conn, stmts...); err != nil {
+	return conn, nil
+}
+
+// Ping checks a connection can be acquired from the pool and the database is responding.
+func (s *AreaProfileStore) Ping(ctx context.Context) error {
+	conn, err := s.acquire(ctx)
+	if err != nil {
 		return err
 	}
 
-	stmts = []string{
-		createAreasTableSQL,
-		createProfilesTableSQL,
-		createAreaProfileIDSeqSQL,
-		createKeyStatTypeSQL,
-		createKeyStatTypeSeqSQL,
-		createKeyStatsTableSQL,
-		createKeyStatsIDSeqSQL,
-		createKeyStatsHistoryTableSQL,
-		createKeyStatsHistoryIDSeqSQL,
+	defer conn.Release()
+	return conn.Conn().Ping(ctx)
+}
+
+// PoolStats returns a snapshot of the connection pool statistics.
+func (s *AreaProfileStore) PoolStats() PoolStats {
+	stat := s.pool.Stat()
+	return PoolStats{
+		MaxConns:             stat.MaxConns(),
+		TotalConns:           stat.TotalConns(),
+		AcquiredConns:        stat.AcquiredConns(),
+		IdleConns:            stat.IdleConns(),
+		ConstructingConns:    stat.ConstructingConns(),
+		AcquireCount:         stat.AcquireCount(),
+		EmptyAcquireCount:    stat.EmptyAcquireCount(),
+		CanceledAcquireCount: stat.CanceledAcquireCount(),
+		AcquireDuration:      stat.AcquireDuration(),
 	}
+}
 
-	log.Info("recreating database schema")
-	if err := execStmts(context.Background(), s.conn, stmts...); err != nil {
-		return err
+// Init is an initialisation function bringing the database schema up to date by applying any outstanding migrations.
+// If reset is true all migrations are rolled back first, dropping any existing tables, data and sequences including
+// those of a database created before schema migrations were introduced, see ResetSchema.
+func (s *AreaProfileStore) Init(ctx context.Context, reset bool) error {
+	if reset {
+		log.Info("rolling back all migrations")
+		if err := s.ResetSchema(ctx); err != nil {
+			return err
+		}
 	}
 
-	log.Info("adding area test data, name=%s, code=%s", areaName, areaCode)
-	if _, err := s.AddArea(areaCode, areaName); err != nil {
+	log.Info("applying database migrations")
+	if err := s.MigrateUp(ctx); err != nil {
 		return err
 	}
 
-	log.Info("adding area profile test data, name=%s", areaProfileName)
-	_, err := s.AddAreaProfile(areaCode, areaProfileName)
-	if err != nil {
+	log.Info("database initialisation compeleted successfully :pizza:")
+	return nil
+}
+
+// Seed populates the database with a test area and area profile. The default key stat types are added by the schema
+// migrations.
+func (s *AreaProfileStore) Seed(ctx context.Context, areaCode, areaName, areaProfileName string) error {
+	log.Info("adding area test data, name=%s, code=%s", areaName, areaCode)
+	if _, err := s.AddArea(ctx, areaCode, areaName); err != nil {
 		return err
 	}
 
-	err = s.InsertKeyStatTypes(statTypes...)
-	if err != nil {
+	log.Info("adding area profile test data, name=%s", areaProfileName)
+	if _, err := s.AddAreaProfile(ctx, areaCode, areaProfileName); err != nil {
 		return err
 	}
 
-	log.Info("database initialisation compeleted successfully :pizza:")
+	log.Info("database seeded successfully")
 	return nil
 }
 
-func execStmts(ctx context.Context, conn *pgx.Conn, statements ...string) error {
-	for _, stmt := range statements {
+// Postgres error codes, see https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	pgUniqueViolation     = "23505"
+	pgForeignKeyViolation = "23503"
+)
 
-		_, err := conn.Exec(ctx, stmt)
-		if err != nil {
-			return errors.Wrap(err, fmt.Sprintf("error executing sql statement: %q", stmt))
-		}
+// isPgError returns true if err is a postgres error with the specified error code.
+func isPgError(err error, code string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == code
+}
+
+// pgConstraint returns the name of the constraint a postgres error violated or "" if the error is not a constraint violation.
+func pgConstraint(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.ConstraintName
 	}
-	return nil
+	return ""
 }
 
-// Close closes the underlying postgres connection
+// Close closes all connections in the pool, waiting for any acquired connections to be released.
 func (s *AreaProfileStore) Close() error {
-	return s.conn.Close(context.Background())
+	s.pool.Close()
+	return nil
 }
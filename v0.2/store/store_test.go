@@ -0,0 +1,130 @@
+package store_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/config"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store"
+	"github.com/ONSdigital/dp-area-profiles-design-spike/v2/store/memory"
+	"github.com/jackc/pgx/v4"
+	"os"
+	"testing"
+	"time"
+)
+
+// testDatabaseEnv is the env var naming the postgres database the postgres store tests run against, the tests are
+// skipped if it is not set. The database is reset by each test so it must not be the app database. The connection
+// uses the same env vars as the app e.g. AP_POSTGRES_USER and AP_POSTGRES_PASSWORD.
+const testDatabaseEnv = "AP_TEST_DATABASE_NAME"
+
+// testStore is the part of the store API the tests use, implemented by the postgres and memory stores.
+type testStore interface {
+	store.Store
+	AddArea(ctx context.Context, code, name string) (string, error)
+	AddAreaProfile(ctx context.Context, areaCode, name string) (int, error)
+	GetStatTypeByName(ctx context.Context, name string) (int, error)
+	InsertKeyStat(ctx context.Context, areaCode, name string, value float64, unit, datasetID, datasetName string, dateCreated time.Time) (int, error)
+	GetKeyStatsForProfile(ctx context.Context, profile *store.AreaProfile) (store.KeyStatistics, error)
+	DeleteKeyStats(ctx context.Context, areaCode string) error
+	GetKeyStatsVersionsForProfile(ctx context.Context, profile *store.AreaProfile) ([]store.KeyStatVersion, error)
+	GetKeyStatsVersionByNumber(ctx context.Context, profile *store.AreaProfile, number int) (*store.KeyStatVersion, error)
+	GetLatestKeyStatsVersion(ctx context.Context, profile *store.AreaProfile) (*store.KeyStatVersion, error)
+	GetKeyStatsVersion(ctx context.Context, profile *store.AreaProfile, date time.Time) (store.KeyStatistics, error)
+	GetKeyStatHistory(ctx context.Context, profile *store.AreaProfile, statType int) (*store.KeyStatHistory, error)
+	InTransaction(ctx context.Context, fn func(tx store.Tx) error) error
+}
+
+// newPostgresStore returns a postgres store for the test database with every migration rolled back and reapplied.
+// Skips the test if the test database is not set.
+func newPostgresStore(tb testing.TB) *store.AreaProfileStore {
+	tb.Helper()
+
+	database := os.Getenv(testDatabaseEnv)
+	if database == "" {
+		tb.Skipf("%s is not set", testDatabaseEnv)
+	}
+
+	tb.Setenv("AP_DATABASE_NAME", database)
+	cfg, err := config.Get()
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	ctx := context.Background()
+	s, err := store.New(ctx, cfg)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	tb.Cleanup(func() { s.Close() })
+
+	if err := s.Init(ctx, true); err != nil {
+		tb.Fatal(err)
+	}
+
+	return s
+}
+
+// execSQL executes the SQL statements against the test database outside of the store, e.g. to create tables the store
+// does not know about. Must be called after newPostgresStore.
+func execSQL(tb testing.TB, sql string) {
+	tb.Helper()
+
+	cfg, err := config.Get()
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, fmt.Sprintf("postgres://%s:%s@localhost:5432/%s?sslmode=disable", cfg.Username, cfg.Password, cfg.Database))
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	defer conn.Close(ctx)
+
+	if _, err := conn.Exec(ctx, sql); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// forEachStore runs the test against an empty memory store and, if the test database is set, an empty postgres store.
+func forEachStore(t *testing.T, test func(t *testing.T, s testStore)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, memory.New())
+	})
+
+	t.Run("postgres", func(t *testing.T) {
+		test(t, newPostgresStore(t))
+	})
+}
+
+// addProfile adds an area and its area profile, returning the area profile.
+func addProfile(t *testing.T, s testStore, areaCode string) *store.AreaProfile {
+	t.Helper()
+	ctx := context.Background()
+
+	if _, err := s.AddArea(ctx, areaCode, areaCode+" area"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.AddAreaProfile(ctx, areaCode, areaCode+" profile"); err != nil {
+		t.Fatal(err)
+	}
+
+	profile, err := s.GetProfileByAreaCode(ctx, areaCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return profile
+}
+
+// values returns the value of each key stat by name.
+func values(stats store.KeyStatistics) map[string]float64 {
+	v := make(map[string]float64)
+	for _, s := range stats {
+		v[s.Name] = s.Value
+	}
+	return v
+}
@@ -0,0 +1,161 @@
+package store
+
+import (
+	"context"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// querier is the set of query functions shared by pooled connections and transactions allowing the same query
+// implementation to be used inside or outside of a transaction.
+type querier interface {
+	Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// Tx represents the store operations available inside a transaction. All changes made through a Tx are committed or
+// rolled back as a single atomic unit.
+type Tx interface {
+	GetProfileByAreaCode(ctx context.Context, areaCode string) (*AreaProfile, error)
+	GetProfilesByAreaCodes(ctx context.Context, areaCodes []string) (map[string]*AreaProfile, error)
+	GetArea(ctx context.Context, code string) (*Area, error)
+	AddArea(ctx context.Context, code, name string) (string, error)
+	AddAreaProfile(ctx context.Context, areaCode, name string) (int, error)
+	GetStatTypeByName(ctx context.Context, name string) (int, error)
+	GetStatTypeByID(ctx context.Context, id int) (*KeyStatType, error)
+	GetUnits(ctx context.Context) ([]Unit, error)
+	AddStatType(ctx context.Context, t KeyStatType) (int, error)
+	InsertKeyStat(ctx context.Context, areaCode, name string, value float64, unit, datasetID, datasetName string, dateCreated time.Time) (int, error)
+	GetKeyStatsForProfile(ctx context.Context, profile *AreaProfile) (KeyStatistics, error)
+	DeleteKeyStats(ctx context.Context, areaCode string) error
+	CreateKeyStatsVersion(ctx context.Context, areaCode, label, source string, dateCreated time.Time) (*KeyStatVersion, error)
+	UpsertArea(ctx context.Context, code, name, geographyType, parentCode string) error
+	UpsertDataset(ctx context.Context, dataset Dataset) error
+	GetCompletedImportByChecksum(ctx context.Context, checksum string) (*Import, error)
+	AddImport(ctx context.Context, i Import) (int, error)
+	CopyKeyStats(ctx context.Context, rows []KeyStatRow, source string, dateCreated time.Time, progress BulkProgressFunc) (*BulkLoadResult, error)
+	CopyAreaProfiles(ctx context.Context, profiles []NewAreaProfile) (*ProvisionResult, error)
+	AddRecipe(ctx context.Context, recipe KeyStatsRecipe) (int, error)
+	UpdateRecipe(ctx context.Context, recipe KeyStatsRecipe) error
+}
+
+// areaProfileTx is a postgres transaction implementation of Tx. datasets is the set of datasets, by ID and name,
+// upserted by key stats inserted in the transaction so each distinct dataset is only upserted once.
+type areaProfileTx struct {
+	tx       pgx.Tx
+	datasets map[datasetKey]bool
+}
+
+// datasetKey is the ID and name of a dataset upserted in a transaction.
+type datasetKey struct {
+	id, name string
+}
+
+// InTransaction runs fn inside a database transaction. If fn returns an error the transaction is rolled back and the
+// error returned, otherwise the transaction is committed.
+func (s *AreaProfileStore) InTransaction(ctx context.Context, fn func(tx Tx) error) error {
+	conn, err := s.acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "error beginning transaction")
+	}
+
+	// Rollback is a no-op if the transaction has already been committed.
+	defer tx.Rollback(ctx)
+
+	if err := fn(&areaProfileTx{tx: tx, datasets: make(map[datasetKey]bool)}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return errors.Wrap(err, "error committing transaction")
+	}
+
+	return nil
+}
+
+// GetProfileByAreaCode return the area profile associated with the specified area code.
+func (t *areaProfileTx) GetProfileByAreaCode(ctx context.Context, areaCode string) (*AreaProfile, error) {
+	return getProfileByAreaCode(ctx, t.tx, areaCode)
+}
+
+// GetProfilesByAreaCodes returns the area profiles of the specified area codes keyed by area code.
+func (t *areaProfileTx) GetProfilesByAreaCodes(ctx context.Context, areaCodes []string) (map[string]*AreaProfile, error) {
+	return getProfilesByAreaCodes(ctx, t.tx, areaCodes)
+}
+
+// GetArea returns the area with the specified code.
+func (t *areaProfileTx) GetArea(ctx context.Context, code string) (*Area, error) {
+	return getArea(ctx, t.tx, code)
+}
+
+// AddArea insert a new area, returns the area code. Returns ErrConflict if an area with the code already exists.
+func (t *areaProfileTx) AddArea(ctx context.Context, code, name string) (string, error) {
+	return addArea(ctx, t.tx, code, name)
+}
+
+// AddAreaProfile insert a new area profile returns the area profile ID. Returns ErrConflict if the area already has a
+// profile and ErrMissingReference if the area does not exist.
+func (t *areaProfileTx) AddAreaProfile(ctx context.Context, areaCode, name string) (int, error) {
+	return addAreaProfile(ctx, t.tx, areaCode, name)
+}
+
+// GetStatTypeByName return the ID of the key stat type with the specified name.
+func (t *areaProfileTx) GetStatTypeByName(ctx context.Context, name string) (int, error) {
+	return getStatTypeByName(ctx, t.tx, name)
+}
+
+// GetStatTypeByID returns the key stat type with the specified ID.
+func (t *areaProfileTx) GetStatTypeByID(ctx context.Context, id int) (*KeyStatType, error) {
+	return getStatTypeByID(ctx, t.tx, id)
+}
+
+// GetUnits returns the units key stat values can be measured in.
+func (t *areaProfileTx) GetUnits(ctx context.Context) ([]Unit, error) {
+	return getUnits(ctx, t.tx)
+}
+
+// AddStatType inserts a new key stat type returning its ID.
+func (t *areaProfileTx) AddStatType(ctx context.Context, statType KeyStatType) (int, error) {
+	return addStatType(ctx, t.tx, statType)
+}
+
+// InsertKeyStat insert a key statistic for the specified area profile. The dataset is upserted the first time it is
+// used in the transaction.
+func (t *areaProfileTx) InsertKeyStat(ctx context.Context, areaCode, name string, value float64, unit, datasetID, datasetName string, dateCreated time.Time) (int, error) {
+	key := datasetKey{id: datasetID, name: datasetName}
+	if !t.datasets[key] {
+		if err := upsertDataset(ctx, t.tx, Dataset{ID: datasetID, Name: datasetName}); err != nil {
+			return 0, err
+		}
+		t.datasets[key] = true
+	}
+
+	return insertKeyStat(ctx, t.tx, areaCode, name, value, unit, datasetID, dateCreated)
+}
+
+// GetKeyStatsForProfile returns a list of the current Key stats associated with the specified area profile.
+func (t *areaProfileTx) GetKeyStatsForProfile(ctx context.Context, profile *AreaProfile) (KeyStatistics, error) {
+	return getKeyStatsForProfile(ctx, t.tx, profile)
+}
+
+// UpsertArea inserts the area or updates the name, geography type and parent of the existing area. The geography type
+// is specified by code e.g. LSOA. A blank name keeps the existing name, a new area without a name is named by its code.
+func (t *areaProfileTx) UpsertArea(ctx context.Context, code, name, geographyType, parentCode string) error {
+	return upsertArea(ctx, t.tx, code, name, geographyType, parentCode)
+}
+
+// UpsertDataset inserts the dataset or updates the existing dataset. A blank name or description keeps the existing
+// value, editions are added to the existing editions and the release date is only updated if it is later.
+func (t *areaProfileTx) UpsertDataset(ctx context.Context, dataset Dataset) error {
+	return upsertDataset(ctx, t.tx, dataset)
+}
@@ -0,0 +1,47 @@
+package store
+
+import (
+	"context"
+	"github.com/pkg/errors"
+)
+
+// Unit queries/statements.
+var (
+	// getUnitsSQL SQL query returns all units.
+	getUnitsSQL = `
+		SELECT
+			code, name, symbol
+		FROM
+			units
+		ORDER BY
+			code;
+	`
+)
+
+// GetUnits returns the units key stat values can be measured in.
+func (s *AreaProfileStore) GetUnits(ctx context.Context) ([]Unit, error) {
+	conn, err := s.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Release()
+
+	return getUnits(ctx, conn)
+}
+
+func getUnits(ctx context.Context, q querier) ([]Unit, error) {
+	rows, err := q.Query(ctx, getUnitsSQL)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	units, err := unitsRowsMapper(rows)
+	if err != nil {
+		return nil, errors.Wrap(err, "error mapping unit result rows")
+	}
+
+	return units, nil
+}
@@ -0,0 +1,109 @@
+package store
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Key stat value types.
+const (
+	ValueTypeCount      = "count"
+	ValueTypePercentage = "percentage"
+	ValueTypeRate       = "rate"
+	ValueTypeMean       = "mean"
+)
+
+// MaxPrecision is the largest number of decimal places a key stat type can be displayed with.
+const MaxPrecision = 6
+
+// numericValue matches a number with optional thousands separators and decimal places.
+var numericValue = regexp.MustCompile(`^[-+]?(\d{1,3}(,\d{3})+|\d+)(\.\d+)?$`)
+
+// ValueTypes returns the valid key stat value types.
+func ValueTypes() []string {
+	return []string{ValueTypeCount, ValueTypePercentage, ValueTypeRate, ValueTypeMean}
+}
+
+// ParseValue parses a key stat value ignoring surrounding white space, thousands separators and a trailing percent sign.
+func ParseValue(raw string) (float64, error) {
+	value := strings.TrimSpace(raw)
+	value = strings.TrimSpace(strings.TrimSuffix(value, "%"))
+
+	if !numericValue.MatchString(value) {
+		return 0, errors.Wrapf(ErrInvalidValue, "value %q is not a number", raw)
+	}
+
+	f, err := strconv.ParseFloat(strings.ReplaceAll(value, ",", ""), 64)
+	if err != nil {
+		return 0, errors.Wrapf(ErrInvalidValue, "value %q is not a number", raw)
+	}
+
+	return f, nil
+}
+
+// ValidateValue checks the value is valid for the value type. Counts must be whole numbers of 0 or more, percentages
+// must be between 0 and 100 and rates must be 0 or more. Returns ErrInvalidValue if the value is not valid.
+func ValidateValue(valueType string, value float64) error {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return errors.Wrapf(ErrInvalidValue, "value %v is not a number", value)
+	}
+
+	switch valueType {
+	case ValueTypeCount:
+		if value < 0 || value != math.Trunc(value) {
+			return errors.Wrapf(ErrInvalidValue, "count %v must be a whole number of 0 or more", value)
+		}
+	case ValueTypePercentage:
+		if value < 0 || value > 100 {
+			return errors.Wrapf(ErrInvalidValue, "percentage %v must be between 0 and 100", value)
+		}
+	case ValueTypeRate:
+		if value < 0 {
+			return errors.Wrapf(ErrInvalidValue, "rate %v must be 0 or more", value)
+		}
+	case ValueTypeMean:
+	default:
+		return errors.Wrapf(ErrInvalidValue, "unknown value type %q", valueType)
+	}
+
+	return nil
+}
+
+// FormatValue returns the display string of a value rounded to the precision with thousands separators. A percent
+// symbol is appended directly to the number, any other symbol is separated by a space.
+func FormatValue(value float64, precision int, symbol string) string {
+	s := strconv.FormatFloat(math.Abs(value), 'f', precision, 64)
+
+	whole, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, frac = s[:i], s[i:]
+	}
+
+	var b strings.Builder
+	if value < 0 && strings.Trim(s, "0.") != "" {
+		b.WriteByte('-')
+	}
+
+	for i, c := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(c)
+	}
+
+	b.WriteString(frac)
+
+	switch symbol {
+	case "":
+	case "%":
+		b.WriteString(symbol)
+	default:
+		fmt.Fprintf(&b, " %s", symbol)
+	}
+
+	return b.String()
+}